@@ -0,0 +1,510 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/mdhender/ottoapp/components/app"
+	"github.com/mdhender/ottoapp/components/app/pages/admin"
+	"github.com/mdhender/ottoapp/domains"
+	"github.com/mdhender/phrases/v2"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The administrator pages use the same store functions as the "db" commands.
+// Generated passwords are shown to the administrator once and never stored in the clear.
+
+// getAdmin shows all the users and the form for creating a new one.
+func (s *Server) getAdmin(path string, footer app.Footer) http.HandlerFunc {
+	files := []string{
+		filepath.Join(path, "app", "layout.gohtml"),
+		filepath.Join(path, "app", "pages", "admin", "users.gohtml"),
+		filepath.Join(path, "app", "widgets", "notifications.gohtml"),
+	}
+	s.templates.register(files...)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		started, bytesWritten := time.Now(), 0
+		log.Printf("%s %s: entered\n", r.Method, r.URL.Path)
+		defer func() {
+			log.Printf("%s %s: wrote %d bytes in %s\n", r.Method, r.URL.Path, bytesWritten, time.Since(started))
+		}()
+
+		if r.Method != "GET" {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		user := userFromRequest(r)
+
+		users, err := s.stores.store.GetUserAccounts()
+		if err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		loc := user.LanguageAndDates.Timezone.Location
+		content := admin.Users_t{
+			Form: admin.UserCreateForm_t{Timezone: "UTC"},
+		}
+		for _, u := range users {
+			content.Users = append(content.Users, admin.User_t{
+				Clan:      u.Clan,
+				Email:     u.Email,
+				Roles:     userRoleNames(u),
+				IsActive:  u.Roles.IsActive,
+				LastLogin: userLastLogin(u, loc),
+			})
+		}
+
+		payload := app.Layout{
+			Title:   fmt.Sprintf("Clan %s", user.Clan),
+			Heading: "Administration",
+			Content: content,
+			Footer:  footer,
+		}
+		payload.Footer.Timestamp = time.Now().In(loc).Format("2006-01-02 15:04:05")
+
+		t, err := s.templates.lookup(files...)
+		if err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		// parse into a buffer so that we can handle errors without writing to the response
+		buf := &bytes.Buffer{}
+		if err := t.Execute(buf, payload); err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		bytesWritten, _ = w.Write(buf.Bytes())
+	}
+}
+
+// postAdminUsers creates a user with a generated password and shows the password to the administrator.
+func (s *Server) postAdminUsers(path string) http.HandlerFunc {
+	files := []string{
+		filepath.Join(path, "app", "pages", "admin", "users.gohtml"),
+	}
+	s.templates.register(files...)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("%s %s: entered\n", r.Method, r.URL.Path)
+		if r.Method != "POST" {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		} else if r.Header.Get("HX-Request") != "true" {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		} else if contentType := r.Header.Get("Content-Type"); !(contentType == "application/x-www-form-urlencoded" || strings.HasPrefix(contentType, "application/x-www-form-urlencoded;")) {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		user := userFromRequest(r)
+
+		form := admin.UserCreateForm_t{
+			ClanId:   strings.TrimSpace(r.FormValue("clan")),
+			Email:    strings.ToLower(strings.TrimSpace(r.FormValue("email"))),
+			Timezone: strings.TrimSpace(r.FormValue("timezone")),
+		}
+		if form.Timezone == "" {
+			form.Timezone = "UTC"
+		}
+		// accept "138" as well as "0138"
+		clanNo, err := strconv.Atoi(form.ClanId)
+		if err != nil {
+			clanNo = 0
+		} else if 1 <= clanNo && clanNo <= 999 {
+			form.ClanId = fmt.Sprintf("%04d", clanNo)
+		}
+		loc, tzErr := time.LoadLocation(form.Timezone)
+		password := phrases.Generate(6)
+
+		if clanNo < 1 || clanNo > 999 {
+			form.Error = "Please enter a clan number between 0001 and 0999."
+		} else if !strings.Contains(form.Email, "@") {
+			form.Error = "Please enter an e-mail address."
+		} else if tzErr != nil {
+			form.Error = fmt.Sprintf("%q is not a timezone. Try UTC or a name like America/New_York.", form.Timezone)
+		} else if _, err := s.stores.store.GetUserAccount(form.ClanId); err == nil {
+			form.Error = fmt.Sprintf("Clan %s already has an account.", form.ClanId)
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		} else if _, err := s.stores.store.CreateUser(form.Email, password, form.ClanId, loc); err != nil {
+			// the clan is free, so the most likely cause is the e-mail
+			log.Printf("%s %s: clan %q: %v\n", r.Method, r.URL.Path, form.ClanId, err)
+			form.Error = fmt.Sprintf("Could not create clan %s. Is %s used by another clan?", form.ClanId, form.Email)
+		} else {
+			log.Printf("%s %s: clan %q: created user for clan %q\n", r.Method, r.URL.Path, user.Clan, form.ClanId)
+			s.audit(r, user.Clan, domains.AuditUserCreate, fmt.Sprintf("clan %s", form.ClanId))
+			form.Password = password
+		}
+
+		_, _ = s.writeHtmxFragment(w, r, form, "user-create-form", files...)
+	}
+}
+
+// getAdminUsersClanId shows the roles, password, and status for a single user.
+func (s *Server) getAdminUsersClanId(path string, footer app.Footer) http.HandlerFunc {
+	files := []string{
+		filepath.Join(path, "app", "layout.gohtml"),
+		filepath.Join(path, "app", "pages", "admin", "user.gohtml"),
+		filepath.Join(path, "app", "widgets", "notifications.gohtml"),
+	}
+	s.templates.register(files...)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		started, bytesWritten := time.Now(), 0
+		log.Printf("%s %s: entered\n", r.Method, r.URL.Path)
+		defer func() {
+			log.Printf("%s %s: wrote %d bytes in %s\n", r.Method, r.URL.Path, bytesWritten, time.Since(started))
+		}()
+
+		if r.Method != "GET" {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		user := userFromRequest(r)
+
+		target, status := s.adminTargetUser(r)
+		if target == nil {
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+
+		loc := user.LanguageAndDates.Timezone.Location
+		content := admin.UserDetail_t{
+			Clan:      target.Clan,
+			Email:     target.Email,
+			Timezone:  target.LanguageAndDates.Timezone.Location.String(),
+			Created:   target.Created.In(loc).Format("2006-01-02 15:04"),
+			LastLogin: userLastLogin(target, loc),
+			Roles: admin.UserRolesForm_t{
+				Clan:            target.Clan,
+				IsAdministrator: target.Roles.IsAdministrator,
+				IsOperator:      target.Roles.IsOperator,
+				IsUser:          target.Roles.IsUser,
+			},
+			Password: admin.UserPasswordForm_t{
+				Clan:     target.Clan,
+				IsActive: target.Roles.IsActive,
+			},
+			Account: admin.UserAccountForm_t{
+				Clan:     target.Clan,
+				IsActive: target.Roles.IsActive,
+				IsSelf:   target.ID == user.ID,
+			},
+		}
+
+		payload := app.Layout{
+			Title:   fmt.Sprintf("Clan %s", user.Clan),
+			Heading: "Administration",
+			Content: content,
+			Footer:  footer,
+		}
+		payload.Footer.Timestamp = time.Now().In(loc).Format("2006-01-02 15:04:05")
+
+		t, err := s.templates.lookup(files...)
+		if err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		// parse into a buffer so that we can handle errors without writing to the response
+		buf := &bytes.Buffer{}
+		if err := t.Execute(buf, payload); err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		bytesWritten, _ = w.Write(buf.Bytes())
+	}
+}
+
+// postAdminUsersClanIdRoles replaces the user's roles.
+// Administrators can't remove their own administrator role.
+func (s *Server) postAdminUsersClanIdRoles(path string) http.HandlerFunc {
+	files := []string{
+		filepath.Join(path, "app", "pages", "admin", "user.gohtml"),
+	}
+	s.templates.register(files...)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("%s %s: entered\n", r.Method, r.URL.Path)
+		if r.Method != "POST" {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		} else if r.Header.Get("HX-Request") != "true" {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		} else if contentType := r.Header.Get("Content-Type"); !(contentType == "application/x-www-form-urlencoded" || strings.HasPrefix(contentType, "application/x-www-form-urlencoded;")) {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		user := userFromRequest(r)
+
+		target, status := s.adminTargetUser(r)
+		if target == nil {
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+
+		form := admin.UserRolesForm_t{
+			Clan:            target.Clan,
+			IsAdministrator: cbIsSet(r.FormValue("administrator")),
+			IsOperator:      cbIsSet(r.FormValue("operator")),
+			IsUser:          cbIsSet(r.FormValue("user")),
+		}
+		if target.ID == user.ID && !form.IsAdministrator {
+			form.IsAdministrator = true
+			form.Error = "You can't remove your own administrator role."
+		} else if err := s.stores.store.SetUserRoles(target.ID, target.Roles.IsActive, form.IsAdministrator, form.IsOperator, form.IsUser); err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		} else {
+			target.Roles.IsAdministrator, target.Roles.IsOperator, target.Roles.IsUser = form.IsAdministrator, form.IsOperator, form.IsUser
+			log.Printf("%s %s: clan %q: set roles for clan %q\n", r.Method, r.URL.Path, user.Clan, target.Clan)
+			s.audit(r, user.Clan, domains.AuditUserRoles, fmt.Sprintf("clan %s: %s", target.Clan, userRoleNames(target)))
+			form.Message = "Roles saved."
+		}
+
+		_, _ = s.writeHtmxFragment(w, r, form, "user-roles-form", files...)
+	}
+}
+
+// postAdminUsersClanIdPassword gives an active user a new, generated password.
+func (s *Server) postAdminUsersClanIdPassword(path string) http.HandlerFunc {
+	files := []string{
+		filepath.Join(path, "app", "pages", "admin", "user.gohtml"),
+	}
+	s.templates.register(files...)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("%s %s: entered\n", r.Method, r.URL.Path)
+		if r.Method != "POST" {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		} else if r.Header.Get("HX-Request") != "true" {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		user := userFromRequest(r)
+
+		target, status := s.adminTargetUser(r)
+		if target == nil {
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+
+		password := phrases.Generate(6)
+		form := admin.UserPasswordForm_t{
+			Clan:     target.Clan,
+			IsActive: target.Roles.IsActive,
+		}
+		if !target.Roles.IsActive {
+			form.Error = "Reactivate the user to give them a new password."
+		} else if err := s.stores.store.UpdateUserPassword(target.ID, password, true); err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		} else {
+			// the old password may be compromised, so sign the clan out everywhere
+			detail := fmt.Sprintf("clan %s: sessions signed out", target.Clan)
+			var err error
+			if target.ID == user.ID {
+				err = s.stores.sessions.DeleteOtherUserSessions(target.ID, s.sessionId(r))
+			} else {
+				err = s.stores.sessions.DeleteUserSessions(target.ID)
+			}
+			if err != nil {
+				log.Printf("%s %s: clan %q: %v\n", r.Method, r.URL.Path, target.Clan, err)
+				detail = fmt.Sprintf("clan %s: sign out failed", target.Clan)
+			}
+			log.Printf("%s %s: clan %q: reset password for clan %q\n", r.Method, r.URL.Path, user.Clan, target.Clan)
+			s.audit(r, user.Clan, domains.AuditUserPassword, detail)
+			form.Password = password
+		}
+
+		_, _ = s.writeHtmxFragment(w, r, form, "user-password-form", files...)
+	}
+}
+
+// postAdminUsersClanIdDeactivate deactivates the user and signs them out everywhere.
+// Their data is kept so that they can be reactivated later.
+func (s *Server) postAdminUsersClanIdDeactivate(path string) http.HandlerFunc {
+	files := []string{
+		filepath.Join(path, "app", "pages", "admin", "user.gohtml"),
+	}
+	s.templates.register(files...)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("%s %s: entered\n", r.Method, r.URL.Path)
+		if r.Method != "POST" {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		} else if r.Header.Get("HX-Request") != "true" {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		user := userFromRequest(r)
+
+		target, status := s.adminTargetUser(r)
+		if target == nil {
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+
+		form := admin.UserAccountForm_t{
+			Clan:     target.Clan,
+			IsActive: target.Roles.IsActive,
+			IsSelf:   target.ID == user.ID,
+		}
+		if form.IsSelf {
+			form.Error = "You can't deactivate your own account."
+		} else if !target.Roles.IsActive {
+			form.Error = fmt.Sprintf("Clan %s is already deactivated.", target.Clan)
+		} else if err := s.stores.store.DeleteUserByClan(target.Clan); errors.Is(err, domains.ErrInvalidClan) {
+			form.Error = fmt.Sprintf("Clan %s can't be deactivated.", target.Clan)
+		} else if err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		} else {
+			if err := s.stores.sessions.DeleteUserSessions(target.ID); err != nil {
+				log.Printf("%s %s: clan %q: %v\n", r.Method, r.URL.Path, target.Clan, err)
+			}
+			log.Printf("%s %s: clan %q: deactivated clan %q\n", r.Method, r.URL.Path, user.Clan, target.Clan)
+			s.audit(r, user.Clan, domains.AuditUserDeactivate, fmt.Sprintf("clan %s", target.Clan))
+
+			// the rest of the page depends on the status, so reload it
+			w.Header().Set("HX-Refresh", "true")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		_, _ = s.writeHtmxFragment(w, r, form, "user-account-form", files...)
+	}
+}
+
+// postAdminUsersClanIdReactivate reactivates the user with a new, generated password.
+// Deactivating a user destroys their password, so there is no old one to restore.
+func (s *Server) postAdminUsersClanIdReactivate(path string) http.HandlerFunc {
+	files := []string{
+		filepath.Join(path, "app", "pages", "admin", "user.gohtml"),
+	}
+	s.templates.register(files...)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("%s %s: entered\n", r.Method, r.URL.Path)
+		if r.Method != "POST" {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		} else if r.Header.Get("HX-Request") != "true" {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		user := userFromRequest(r)
+
+		target, status := s.adminTargetUser(r)
+		if target == nil {
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+
+		password := phrases.Generate(6)
+		form := admin.UserAccountForm_t{
+			Clan:     target.Clan,
+			IsActive: target.Roles.IsActive,
+			IsSelf:   target.ID == user.ID,
+		}
+		if target.Roles.IsActive {
+			form.Error = fmt.Sprintf("Clan %s is already active.", target.Clan)
+		} else if err := s.stores.store.SetUserRoles(target.ID, true, target.Roles.IsAdministrator, target.Roles.IsOperator, target.Roles.IsUser); err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		} else if err := s.stores.store.UpdateUserPassword(target.ID, password, true); err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		} else {
+			log.Printf("%s %s: clan %q: reactivated clan %q\n", r.Method, r.URL.Path, user.Clan, target.Clan)
+			s.audit(r, user.Clan, domains.AuditUserReactivate, fmt.Sprintf("clan %s", target.Clan))
+			form.IsActive, form.Password = true, password
+		}
+
+		_, _ = s.writeHtmxFragment(w, r, form, "user-account-form", files...)
+	}
+}
+
+// adminTargetUser returns the user named by the clan_id in the path.
+// If there is no such user, it returns nil and the status to report.
+func (s *Server) adminTargetUser(r *http.Request) (*domains.User_t, int) {
+	clanId := r.PathValue("clan_id")
+	if len(clanId) != 4 {
+		return nil, http.StatusBadRequest
+	} else if n, err := strconv.Atoi(clanId); err != nil || n < 0 || n > 999 {
+		return nil, http.StatusBadRequest
+	}
+	target, err := s.stores.store.GetUserAccount(clanId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, http.StatusNotFound
+	} else if err != nil {
+		log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+		return nil, http.StatusInternalServerError
+	}
+	return target, http.StatusOK
+}
+
+// userRoleNames returns the user's roles for display.
+func userRoleNames(user *domains.User_t) string {
+	var roles []string
+	if user.Roles.IsAdministrator {
+		roles = append(roles, "Administrator")
+	}
+	if user.Roles.IsOperator {
+		roles = append(roles, "Operator")
+	}
+	if user.Roles.IsUser {
+		roles = append(roles, "User")
+	}
+	if len(roles) == 0 {
+		return "None"
+	}
+	return strings.Join(roles, ", ")
+}
+
+// userLastLogin returns the time of the user's last sign in for display.
+func userLastLogin(user *domains.User_t, loc *time.Location) string {
+	if user.LastLogin.Unix() <= 0 {
+		return "Never"
+	}
+	return user.LastLogin.In(loc).Format("2006-01-02 15:04")
+}
@@ -0,0 +1,42 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"github.com/mdhender/ottoapp/domains"
+	"github.com/mdhender/ottoapp/stores/sqlite"
+	"github.com/spf13/cobra"
+	"log"
+	"net/http"
+)
+
+// audit records an event in the audit log.
+// actor is the clan that made the request, or the clan that a failed sign in was for.
+// Errors are logged, not returned, because they should not fail the request.
+func (s *Server) audit(r *http.Request, actor string, action domains.AuditAction, detail string) {
+	err := s.stores.store.CreateAuditEvent(domains.AuditEvent_t{
+		Actor:    actor,
+		Action:   action,
+		Target:   r.URL.Path,
+		ClientIP: clientIP(r),
+		Detail:   detail,
+	})
+	if err != nil {
+		log.Printf("audit: %s: %s: %v\n", actor, action, err)
+	}
+}
+
+// auditCli records an event from the command line in the audit log.
+// There is no request, so the target is the command and the client address is empty.
+// Errors are logged, not returned, because the command has already made its change.
+func auditCli(store *sqlite.DB, cmd *cobra.Command, action domains.AuditAction, detail string) {
+	err := store.CreateAuditEvent(domains.AuditEvent_t{
+		Actor:  domains.AuditActorCli,
+		Action: action,
+		Target: cmd.CommandPath(),
+		Detail: detail,
+	})
+	if err != nil {
+		log.Printf("audit: %s: %s: %v\n", domains.AuditActorCli, action, err)
+	}
+}
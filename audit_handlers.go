@@ -0,0 +1,128 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mdhender/ottoapp/components/app"
+	"github.com/mdhender/ottoapp/components/app/pages/admin"
+	"github.com/mdhender/ottoapp/domains"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// getAdminAudit shows the audit log. The filter is taken from the query string
+// so that a filtered view can be bookmarked or shared with other administrators.
+func (s *Server) getAdminAudit(path string, footer app.Footer) http.HandlerFunc {
+	files := []string{
+		filepath.Join(path, "app", "layout.gohtml"),
+		filepath.Join(path, "app", "pages", "admin", "audit.gohtml"),
+		filepath.Join(path, "app", "widgets", "notifications.gohtml"),
+	}
+	s.templates.register(files...)
+	const maxEvents = 200
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		started, bytesWritten := time.Now(), 0
+		log.Printf("%s %s: entered\n", r.Method, r.URL.Path)
+		defer func() {
+			log.Printf("%s %s: wrote %d bytes in %s\n", r.Method, r.URL.Path, bytesWritten, time.Since(started))
+		}()
+
+		if r.Method != "GET" {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		user := userFromRequest(r)
+
+		loc := user.LanguageAndDates.Timezone.Location
+		content := admin.Audit_t{
+			Filter: admin.AuditFilter_t{
+				Actor:  strings.TrimSpace(r.URL.Query().Get("actor")),
+				Action: r.URL.Query().Get("action"),
+			},
+			Limit: maxEvents,
+		}
+		// accept "138" as well as "0138"
+		if n, err := strconv.Atoi(content.Filter.Actor); err == nil && 0 <= n && n <= 999 {
+			content.Filter.Actor = fmt.Sprintf("%04d", n)
+		}
+		// one more than the limit so that we know if there are more
+		filter := domains.AuditFilter_t{
+			Actor:  content.Filter.Actor,
+			Action: domains.AuditAction(content.Filter.Action),
+			Limit:  maxEvents + 1,
+		}
+		if since, err := time.ParseInLocation(time.DateOnly, r.URL.Query().Get("since"), loc); err == nil {
+			content.Filter.Since, filter.Since = since.Format(time.DateOnly), since
+		}
+		if until, err := time.ParseInLocation(time.DateOnly, r.URL.Query().Get("until"), loc); err == nil {
+			// the form shows the last day to include
+			content.Filter.Until, filter.Until = until.Format(time.DateOnly), until.AddDate(0, 0, 1)
+		}
+
+		actions, err := s.stores.store.GetAuditActions()
+		if err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		for _, action := range actions {
+			content.Actions = append(content.Actions, string(action))
+		}
+		events, err := s.stores.store.GetAuditEvents(filter)
+		if err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		if len(events) > maxEvents {
+			events, content.More = events[:maxEvents], true
+		}
+		for _, event := range events {
+			createdAt := event.CreatedAt.In(loc)
+			content.Events = append(content.Events, admin.AuditEvent_t{
+				Date:     createdAt.Format("2006-01-02"),
+				Time:     createdAt.Format("15:04:05"),
+				Actor:    event.Actor,
+				Action:   string(event.Action),
+				Target:   event.Target,
+				ClientIP: event.ClientIP,
+				Detail:   event.Detail,
+			})
+		}
+
+		payload := app.Layout{
+			Title:   fmt.Sprintf("Clan %s", user.Clan),
+			Heading: "Audit log",
+			Content: content,
+			Footer:  footer,
+		}
+		payload.Footer.Timestamp = time.Now().In(loc).Format("2006-01-02 15:04:05")
+
+		t, err := s.templates.lookup(files...)
+		if err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		// parse into a buffer so that we can handle errors without writing to the response
+		buf := &bytes.Buffer{}
+		if err := t.Execute(buf, payload); err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		bytesWritten, _ = w.Write(buf.Bytes())
+	}
+}
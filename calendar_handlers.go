@@ -0,0 +1,281 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/mdhender/ottoapp/components/app/pages/calendar"
+	"github.com/mdhender/ottoapp/domains"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// findDueDate returns the next turn and the date that its orders are due
+// from the turn header of a report. Comment lines added by the scrubbers
+// may come before the header, so we look for the first turn header.
+func findDueDate(data []byte) (nextTurnId string, due time.Time, ok bool) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if strings.HasPrefix(line, "current turn ") {
+			return matchNextTurn(line)
+		}
+	}
+	return "", time.Time{}, false
+}
+
+// recordDueDate saves the date that orders are due from the report's turn header.
+// It should be called after every successful write to the user's input folder.
+// Errors are logged, not returned, because the upload itself succeeded.
+func (s *Server) recordDueDate(user *domains.User_t, turnId string, data []byte) {
+	nextTurnId, due, ok := findDueDate(data)
+	if !ok {
+		return
+	}
+	if err := s.stores.store.SetTurnDueDate(user.ID, turnId, nextTurnId, due); err != nil {
+		log.Printf("calendar: %s: %s: %v\n", user.Clan, turnId, err)
+	}
+}
+
+// dueDates returns the user's due dates, most recent turn first.
+// Reports that were uploaded before we started saving due dates are
+// scanned so that the calendar isn't empty for existing clans.
+// The dates that are found are saved unless readOnly is set.
+func (s *Server) dueDates(user *domains.User_t, readOnly bool) ([]*domains.DueDate_t, error) {
+	dates, err := s.stores.store.GetTurnDueDates(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	known := map[string]bool{}
+	for _, date := range dates {
+		known[date.TurnId] = true
+	}
+
+	files, err := s.stores.ffs.GetClanFiles(user)
+	if err != nil {
+		// a missing or damaged folder shouldn't hide the dates that we have
+		log.Printf("calendar: %s: %v\n", user.Clan, err)
+	}
+	for _, file := range files.ReportFiles {
+		if known[file.Turn] {
+			continue
+		}
+		data, err := os.ReadFile(file.Path)
+		if err != nil {
+			log.Printf("calendar: %s: %v\n", user.Clan, err)
+			continue
+		}
+		nextTurnId, due, ok := findDueDate(data)
+		if !ok {
+			continue
+		}
+		known[file.Turn] = true
+		if !readOnly {
+			if err := s.stores.store.SetTurnDueDate(user.ID, file.Turn, nextTurnId, due); err != nil {
+				log.Printf("calendar: %s: %s: %v\n", user.Clan, file.Turn, err)
+			}
+		}
+		dates = append(dates, &domains.DueDate_t{TurnId: file.Turn, NextTurnId: nextTurnId, Due: due})
+	}
+
+	sort.Slice(dates, func(i, j int) bool {
+		return dates[i].TurnId > dates[j].TurnId
+	})
+	return dates, nil
+}
+
+// calendarContent builds the month grid for the calendar page.
+// The month is taken from the "month" query parameter, YYYY-MM, and
+// defaults to the current month in the user's timezone.
+//
+// When an operator is viewing the clan, nothing is saved and the feed address
+// is hidden; the address is a credential, and the operator could keep using it
+// after they stop viewing.
+func (s *Server) calendarContent(r *http.Request, user *domains.User_t) (calendar.Content, error) {
+	loc := user.LanguageAndDates.Timezone.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	now := time.Now().In(loc)
+	today := now.Format(time.DateOnly)
+	thisMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	month := thisMonth
+	if value := r.URL.Query().Get("month"); value != "" {
+		if t, err := time.Parse("2006-01", value); err == nil {
+			month = t
+		}
+	}
+
+	content := calendar.Content{
+		ClanId:   user.Clan,
+		Month:    month.Format("January 2006"),
+		MonthId:  month.Format("2006-01"),
+		Previous: month.AddDate(0, -1, 0).Format("2006-01"),
+		Next:     month.AddDate(0, 1, 0).Format("2006-01"),
+		Today:    thisMonth.Format("2006-01"),
+		Timezone: loc.String(),
+	}
+
+	viewAs := viewAsFromRequest(r)
+	dates, err := s.dueDates(user, viewAs != "")
+	if err != nil {
+		return content, err
+	}
+	byDate := map[string][]*calendar.Deadline_t{}
+	for _, date := range dates {
+		deadline := &calendar.Deadline_t{
+			TurnId:     date.TurnId,
+			NextTurnId: date.NextTurnId,
+			Date:       date.Due.Format(time.DateOnly),
+			Display:    date.Due.Format("Monday, January 2, 2006"),
+			MonthId:    date.Due.Format("2006-01"),
+		}
+		deadline.IsPast, deadline.IsToday = deadline.Date < today, deadline.Date == today
+		content.Deadlines = append(content.Deadlines, deadline)
+		byDate[deadline.Date] = append(byDate[deadline.Date], deadline)
+	}
+
+	// the grid starts on the Monday on or before the first of the month
+	day := month.AddDate(0, 0, -((int(month.Weekday()) + 6) % 7))
+	for n := 0; n < 42; n, day = n+1, day.AddDate(0, 0, 1) {
+		date := day.Format(time.DateOnly)
+		content.Days = append(content.Days, &calendar.Day_t{
+			Date:      date,
+			Day:       day.Day(),
+			InMonth:   day.Month() == month.Month(),
+			IsToday:   date == today,
+			Deadlines: byDate[date],
+		})
+	}
+
+	if viewAs != "" {
+		return content, nil
+	}
+	token, err := s.stores.store.GetCalendarFeedToken(user.ID)
+	if err != nil {
+		return content, err
+	}
+	content.FeedURL = s.feedURL(token)
+
+	return content, nil
+}
+
+// feedURL returns the absolute URL for the calendar feed.
+// Calendar apps need the scheme and host, so we can't use a relative link.
+func (s *Server) feedURL(token string) string {
+	return fmt.Sprintf("%s/calendar/feeds/%s.ics", s.baseURL, token)
+}
+
+// getCalendarFeedsFeed returns the clan's due dates as an iCalendar feed.
+// Calendar apps can't log in, so the token in the path is the only credential.
+func (s *Server) getCalendarFeedsFeed() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("%s %s: entered\n", r.Method, r.URL.Path)
+
+		if r.Method != "GET" {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		token, ok := strings.CutSuffix(r.PathValue("feed"), ".ics")
+		if !ok || token == "" {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+		userId, err := s.stores.store.GetCalendarFeedUser(token)
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			}
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+		user, err := s.stores.store.GetUser(userId)
+		if err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		dates, err := s.dueDates(user, false)
+		if err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(icsFeed(user, dates, time.Now().UTC()))
+	}
+}
+
+// icsFeed returns the due dates as an iCalendar document.
+// Orders are due on a date, not at a time, so each deadline is an all-day event.
+func icsFeed(user *domains.User_t, dates []*domains.DueDate_t, now time.Time) []byte {
+	buf := &bytes.Buffer{}
+	line := func(format string, args ...any) {
+		_, _ = fmt.Fprintf(buf, format, args...)
+		buf.WriteString("\r\n")
+	}
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//OttoMap//Orders Due//EN")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	line("X-WR-CALNAME:Clan %s orders due", user.Clan)
+	if loc := user.LanguageAndDates.Timezone.Location; loc != nil {
+		line("X-WR-TIMEZONE:%s", loc.String())
+	}
+	for _, date := range dates {
+		line("BEGIN:VEVENT")
+		line("UID:%s.%s@ottomap", user.Clan, date.NextTurnId)
+		line("DTSTAMP:%s", now.Format("20060102T150405Z"))
+		line("DTSTART;VALUE=DATE:%s", date.Due.Format("20060102"))
+		line("DTEND;VALUE=DATE:%s", date.Due.AddDate(0, 0, 1).Format("20060102"))
+		line("SUMMARY:Turn %s orders due", date.NextTurnId)
+		line("DESCRIPTION:Orders for clan %s are due for turn %s.", user.Clan, date.NextTurnId)
+		line("TRANSP:TRANSPARENT")
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+	return buf.Bytes()
+}
+
+// postCalendarFeedReset replaces the token for the clan's calendar feed.
+// It is used when the feed address has been shared by mistake.
+func (s *Server) postCalendarFeedReset() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("%s %s: entered\n", r.Method, r.URL.Path)
+
+		if r.Method != "POST" {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		} else if r.Header.Get("HX-Request") != "true" {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		user := userFromRequest(r)
+
+		if _, err := s.stores.store.ResetCalendarFeedToken(user.ID); err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		// reload the page so that the new address is shown
+		w.Header().Set("HX-Refresh", "true")
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,239 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+// Package charset repairs the character encoding of uploaded reports.
+//
+// Reports copied out of Windows mail clients often arrive as Windows-1252,
+// or as UTF-8 with a few Windows-1252 bytes mixed in, and word processors
+// replace plain quotes and dashes with typographic ones. The parser only
+// understands ASCII punctuation, so Repair converts everything to UTF-8,
+// swaps the typographic characters for their ASCII equivalents, and removes
+// control characters. It returns a summary of what it changed.
+package charset
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Encoding is the encoding that Repair detected in the input.
+type Encoding string
+
+const (
+	ASCII       Encoding = "ascii"
+	UTF8        Encoding = "utf-8"
+	UTF16LE     Encoding = "utf-16le"
+	UTF16BE     Encoding = "utf-16be"
+	Windows1252 Encoding = "windows-1252"
+	Mixed       Encoding = "utf-8 with windows-1252" // valid UTF-8 with stray Windows-1252 bytes
+)
+
+// Summary_t describes the changes that Repair made.
+type Summary_t struct {
+	Encoding    Encoding // encoding detected in the input
+	ByteOrder   bool     // true if a byte order mark was removed
+	Transcoded  int      // number of characters converted from Windows-1252 or UTF-16
+	Undefined   int      // number of bytes that are not defined in Windows-1252, removed
+	Typographic int      // number of typographic characters replaced with ASCII
+	Controls    int      // number of control characters removed
+}
+
+// Changed returns true if Repair changed the input.
+func (s Summary_t) Changed() bool {
+	return s.ByteOrder || s.Transcoded != 0 || s.Undefined != 0 || s.Typographic != 0 || s.Controls != 0
+}
+
+// Changes returns a short description of each change, suitable for showing to the user.
+func (s Summary_t) Changes() []string {
+	var changes []string
+	if s.ByteOrder {
+		changes = append(changes, "removed the byte order mark")
+	}
+	if s.Transcoded != 0 {
+		changes = append(changes, fmt.Sprintf("converted %s from %s to UTF-8", plural(s.Transcoded, "character"), s.Encoding))
+	}
+	if s.Undefined != 0 {
+		changes = append(changes, fmt.Sprintf("removed %s that could not be decoded", plural(s.Undefined, "byte")))
+	}
+	if s.Typographic != 0 {
+		changes = append(changes, fmt.Sprintf("replaced %s with plain ASCII", plural(s.Typographic, "typographic character")))
+	}
+	if s.Controls != 0 {
+		changes = append(changes, fmt.Sprintf("removed %s", plural(s.Controls, "control character")))
+	}
+	return changes
+}
+
+// String implements the Stringer interface.
+func (s Summary_t) String() string {
+	if !s.Changed() {
+		return "no changes"
+	}
+	return strings.Join(s.Changes(), ", ")
+}
+
+// Add accumulates the changes from another summary.
+// The encoding is kept unless this summary has not detected one.
+func (s *Summary_t) Add(other Summary_t) {
+	if s.Encoding == "" || s.Encoding == ASCII {
+		s.Encoding = other.Encoding
+	}
+	s.ByteOrder = s.ByteOrder || other.ByteOrder
+	s.Transcoded += other.Transcoded
+	s.Undefined += other.Undefined
+	s.Typographic += other.Typographic
+	s.Controls += other.Controls
+}
+
+// Repair converts the input to UTF-8 with ASCII punctuation and no control
+// characters other than tab, carriage return, and new line.
+// Characters that are valid UTF-8 and not typographic, like accented letters, are kept.
+func Repair(data []byte) ([]byte, Summary_t) {
+	var summary Summary_t
+
+	// decode to runes, remembering how we got there
+	var runes []rune
+	switch {
+	case len(data) >= 2 && data[0] == 0xFF && data[1] == 0xFE:
+		summary.Encoding, summary.ByteOrder = UTF16LE, true
+		runes = decodeUTF16(data[2:], false)
+		summary.Transcoded = len(runes)
+	case len(data) >= 2 && data[0] == 0xFE && data[1] == 0xFF:
+		summary.Encoding, summary.ByteOrder = UTF16BE, true
+		runes = decodeUTF16(data[2:], true)
+		summary.Transcoded = len(runes)
+	default:
+		if len(data) >= 3 && data[0] == 0xEF && data[1] == 0xBB && data[2] == 0xBF {
+			summary.ByteOrder = true
+			data = data[3:]
+		}
+		runes, summary.Encoding, summary.Transcoded, summary.Undefined = decode8(data)
+	}
+
+	// normalize the runes
+	out := make([]byte, 0, len(data))
+	for _, r := range runes {
+		if replacement, ok := typographic[r]; ok {
+			summary.Typographic++
+			out = append(out, replacement...)
+		} else if IsControl(r) {
+			summary.Controls++
+		} else {
+			out = utf8.AppendRune(out, r)
+		}
+	}
+
+	return out, summary
+}
+
+// IsControl returns true for the control characters that Repair removes.
+// Tab, carriage return, and new line are not included.
+func IsControl(r rune) bool {
+	switch {
+	case r == '\t' || r == '\r' || r == '\n':
+		return false
+	case r < 0x20 || r == 0x7F:
+		return true
+	case 0x80 <= r && r <= 0x9F: // C1 controls
+		return true
+	}
+	return false
+}
+
+// Typographic returns the ASCII replacement for a typographic character.
+// It returns false if the rune is not one that Repair replaces.
+func Typographic(r rune) (string, bool) {
+	replacement, ok := typographic[r]
+	return replacement, ok
+}
+
+// decode8 decodes an 8-bit input.
+//
+// Valid UTF-8 is kept as is. Otherwise we have to guess. Windows-1252 text can
+// contain byte sequences that happen to be valid UTF-8, like "é”" followed by a
+// non-breaking space, which decodes as a CJK character. If every valid multi-byte
+// sequence decodes to a character that is plausible in a report, we assume the
+// input is UTF-8 with stray Windows-1252 bytes and decode only the invalid bytes.
+// If not, we decode the whole input as Windows-1252.
+func decode8(data []byte) (runes []rune, encoding Encoding, transcoded, undefined int) {
+	if utf8.Valid(data) {
+		encoding = ASCII
+		for _, r := range string(data) {
+			if r >= utf8.RuneSelf {
+				encoding = UTF8
+			}
+			runes = append(runes, r)
+		}
+		return runes, encoding, 0, 0
+	}
+
+	mixed, hasMultiByte := true, false
+	for rest := data; len(rest) != 0; {
+		r, size := utf8.DecodeRune(rest)
+		if size > 1 {
+			hasMultiByte = true
+			if !isPlausible(r) {
+				mixed = false
+				break
+			}
+		}
+		rest = rest[size:]
+	}
+
+	for len(data) != 0 {
+		r, size := utf8.DecodeRune(data)
+		if size == 1 && r >= utf8.RuneSelf || !mixed && size > 1 {
+			// decode the first byte as Windows-1252 and try again with the next byte
+			size = 1
+			if w := windows1252[data[0]]; w != 0 {
+				runes = append(runes, w)
+				transcoded++
+			} else {
+				undefined++
+			}
+		} else {
+			runes = append(runes, r)
+		}
+		data = data[size:]
+	}
+
+	if mixed && hasMultiByte {
+		return runes, Mixed, transcoded, undefined
+	}
+	return runes, Windows1252, transcoded, undefined
+}
+
+// isPlausible returns true if the rune is likely to appear in a report: Latin
+// letters, the punctuation that word processors insert, and a few symbols.
+func isPlausible(r rune) bool {
+	switch {
+	case r <= 0x024F: // Latin-1 Supplement and Latin Extended
+		return true
+	case 0x2000 <= r && r <= 0x206F: // General Punctuation
+		return true
+	case r == 0x20AC || r == 0x2122 || r == 0x2212 || r == 0xFEFF: // euro, trade mark, minus, byte order mark
+		return true
+	}
+	return false
+}
+
+// decodeUTF16 decodes UTF-16 without the byte order mark. An odd trailing byte is dropped.
+func decodeUTF16(data []byte, bigEndian bool) []rune {
+	units := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		if bigEndian {
+			units = append(units, uint16(data[i])<<8|uint16(data[i+1]))
+		} else {
+			units = append(units, uint16(data[i+1])<<8|uint16(data[i]))
+		}
+	}
+	return utf16.Decode(units)
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("1 %s", noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package charset
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRepair(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		input []byte
+		want  string
+		sum   Summary_t
+	}{
+		{"empty", nil, "", Summary_t{Encoding: ASCII}},
+		{"ascii", []byte("Tribe 0138, , Current Hex = QQ 1234\r\n"), "Tribe 0138, , Current Hex = QQ 1234\r\n", Summary_t{Encoding: ASCII}},
+		{"utf-8 letters are kept", []byte("Fjörd café\n"), "Fjörd café\n", Summary_t{Encoding: UTF8}},
+		{"utf-8 byte order mark", []byte("\xEF\xBB\xBFTribe 0138\n"), "Tribe 0138\n", Summary_t{Encoding: ASCII, ByteOrder: true}},
+		{"utf-8 typographic", []byte("“Scout 1” – don’t move"), `"Scout 1" - don't move`, Summary_t{Encoding: UTF8, Typographic: 5}},
+		{"utf-8 controls", []byte("Tribe\x00 0138\x1B\t\x7F\u0085\n"), "Tribe 0138\t\n", Summary_t{Encoding: UTF8, Controls: 4}},
+		{"windows-1252 quotes", []byte("\x93Scout 1\x94 \x96 don\x92t"), `"Scout 1" - don't`, Summary_t{Encoding: Windows1252, Transcoded: 4, Typographic: 4}},
+		{"windows-1252 letters", []byte("Fj\xF6rd caf\xE9"), "Fjörd café", Summary_t{Encoding: Windows1252, Transcoded: 2}},
+		{"windows-1252 undefined", []byte("Tribe\x81 0138\x8D"), "Tribe 0138", Summary_t{Encoding: Windows1252, Undefined: 2}},
+		// valid UTF-8 letters with a stray Windows-1252 dash
+		{"mixed", []byte("café \x96 Fjörd"), "café - Fjörd", Summary_t{Encoding: Mixed, Transcoded: 1, Typographic: 1}},
+		// "é”" in Windows-1252 followed by a no-break space is valid UTF-8 for an implausible character
+		{"windows-1252 that looks like utf-8", []byte("caf\xE9\x94\xA0 x\x96"), `café"  x-`, Summary_t{Encoding: Windows1252, Transcoded: 4, Typographic: 3}},
+		{"utf-16le", []byte("\xFF\xFET\x00r\x00\x1C\x20i\x00\x1D\x20"), `Tr"i"`, Summary_t{Encoding: UTF16LE, ByteOrder: true, Transcoded: 5, Typographic: 2}},
+		{"utf-16be", []byte("\xFE\xFF\x00T\x00r\x00\xE9"), "Tré", Summary_t{Encoding: UTF16BE, ByteOrder: true, Transcoded: 3}},
+		{"utf-16 odd byte", []byte("\xFF\xFET\x00r"), "T", Summary_t{Encoding: UTF16LE, ByteOrder: true, Transcoded: 1}},
+	} {
+		got, sum := Repair(tc.input)
+		if string(got) != tc.want {
+			t.Errorf("%s: want %q, got %q", tc.name, tc.want, got)
+		}
+		if sum != tc.sum {
+			t.Errorf("%s: want %+v, got %+v", tc.name, tc.sum, sum)
+		}
+		// repairing the output again must not change anything
+		if again, sum := Repair(got); string(again) != string(got) || sum.Changed() {
+			t.Errorf("%s: repair is not idempotent: %q: %s", tc.name, again, sum)
+		}
+	}
+}
+
+func TestSummaryChanges(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		sum  Summary_t
+		want []string
+	}{
+		{"none", Summary_t{Encoding: UTF8}, nil},
+		{"singular", Summary_t{Encoding: Windows1252, Transcoded: 1, Undefined: 1, Typographic: 1, Controls: 1}, []string{
+			"converted 1 character from windows-1252 to UTF-8",
+			"removed 1 byte that could not be decoded",
+			"replaced 1 typographic character with plain ASCII",
+			"removed 1 control character",
+		}},
+		{"plural", Summary_t{Encoding: UTF16LE, ByteOrder: true, Transcoded: 12, Typographic: 3}, []string{
+			"removed the byte order mark",
+			"converted 12 characters from utf-16le to UTF-8",
+			"replaced 3 typographic characters with plain ASCII",
+		}},
+	} {
+		if got := tc.sum.Changes(); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: want %q, got %q", tc.name, tc.want, got)
+		}
+		if got, want := tc.sum.Changed(), tc.want != nil; got != want {
+			t.Errorf("%s: changed: want %v, got %v", tc.name, want, got)
+		}
+	}
+}
+
+func TestSummaryAdd(t *testing.T) {
+	sum := Summary_t{Encoding: ASCII}
+	sum.Add(Summary_t{Encoding: Windows1252, Transcoded: 2, Controls: 1})
+	sum.Add(Summary_t{Encoding: UTF8, ByteOrder: true, Typographic: 3})
+	want := Summary_t{Encoding: Windows1252, ByteOrder: true, Transcoded: 2, Typographic: 3, Controls: 1}
+	if sum != want {
+		t.Errorf("want %+v, got %+v", want, sum)
+	}
+}
+
+func TestIsControl(t *testing.T) {
+	for _, tc := range []struct {
+		r    rune
+		want bool
+	}{
+		{'\t', false}, {'\r', false}, {'\n', false}, {' ', false}, {'a', false}, {'é', false},
+		{0x00, true}, {0x1B, true}, {0x1F, true}, {0x7F, true}, {0x80, true}, {0x9F, true}, {0xA0, false},
+	} {
+		if got := IsControl(tc.r); got != tc.want {
+			t.Errorf("%U: want %v, got %v", tc.r, tc.want, got)
+		}
+	}
+}
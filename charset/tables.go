@@ -0,0 +1,54 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package charset
+
+// windows1252 maps the bytes from 0x80 to 0xFF to runes. Bytes below 0x80 are
+// always valid UTF-8, so they never need a lookup. The five bytes that are not
+// defined in Windows-1252 map to zero.
+var windows1252 = func() (table [256]rune) {
+	high := [32]rune{
+		'€', 0, '‚', 'ƒ', '„', '…', '†', '‡', // 0x80
+		'ˆ', '‰', 'Š', '‹', 'Œ', 0, 'Ž', 0, // 0x88
+		0, '‘', '’', '“', '”', '•', '–', '—', // 0x90
+		'˜', '™', 'š', '›', 'œ', 0, 'ž', 'Ÿ', // 0x98
+	}
+	for i, r := range high {
+		table[0x80+i] = r
+	}
+	// 0xA0 through 0xFF are the same as Latin-1
+	for b := 0xA0; b <= 0xFF; b++ {
+		table[b] = rune(b)
+	}
+	return table
+}()
+
+// typographic characters that word processors and mail clients like to
+// substitute for plain ASCII, and the ASCII that the parser expects.
+var typographic = map[rune]string{
+	'\u00A0': " ",   // no-break space
+	'\u00AD': "",    // soft hyphen
+	'\u2002': " ",   // en space
+	'\u2003': " ",   // em space
+	'\u2009': " ",   // thin space
+	'\u200B': "",    // zero width space
+	'\u2010': "-",   // hyphen
+	'\u2011': "-",   // non-breaking hyphen
+	'\u2012': "-",   // figure dash
+	'\u2013': "-",   // en dash
+	'\u2014': "-",   // em dash
+	'\u2018': "'",   // left single quote
+	'\u2019': "'",   // right single quote
+	'\u201A': "'",   // single low-9 quote
+	'\u201B': "'",   // single high-reversed-9 quote
+	'\u201C': `"`,   // left double quote
+	'\u201D': `"`,   // right double quote
+	'\u201E': `"`,   // double low-9 quote
+	'\u2022': "*",   // bullet
+	'\u2026': "...", // horizontal ellipsis
+	'\u2032': "'",   // prime
+	'\u2033': `"`,   // double prime
+	'\u2039': "<",   // single left-pointing angle quote
+	'\u203A': ">",   // single right-pointing angle quote
+	'\u2212': "-",   // minus sign
+	'\uFEFF': "",    // byte order mark
+}
@@ -4,11 +4,16 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/mdhender/ottoapp/domains"
 	"github.com/mdhender/ottoapp/stores/sqlite"
 	"github.com/mdhender/phrases/v2"
 	"github.com/spf13/cobra"
 	"log"
+	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -39,6 +44,21 @@ var (
 				usePhrase bool   // if true, use a phrase instead of a secret
 				isActive  bool   // if true, force user to be active when resetting password
 			}
+			audit struct {
+				output string // path to the export file, stdout if empty
+				actor  string // export only this actor
+				action string // export only this action
+				since  string // first day to export, YYYY-MM-DD in UTC
+				until  string // last day to export, YYYY-MM-DD in UTC
+			}
+			lockout struct {
+				ip  string // client address to clear
+				all bool   // if true, clear all clans and addresses
+			}
+			magicLink struct {
+				baseURL string // scheme and host of the server, e.g. https://ottomap.example.com
+				hours   int    // number of hours until the link expires
+			}
 		}
 	}
 
@@ -51,8 +71,9 @@ var (
 		Use:   "init",
 		Short: "Initialize the database",
 		PreRunE: func(cmd *cobra.Command, args []string) error {
+			// the assets and components are embedded, so their override directories are optional
 			if argsDb.paths.assets == "" {
-				return fmt.Errorf("assets: path is required")
+				// use the embedded assets
 			} else if path, err := abspath(argsDb.paths.assets); err != nil {
 				return fmt.Errorf("assets: %v\n", err)
 			} else if ok, err := isdir(path); err != nil {
@@ -84,7 +105,7 @@ var (
 			}
 
 			if argsDb.paths.components == "" {
-				return fmt.Errorf("components: path is required")
+				// use the embedded components
 			} else if path, err := abspath(argsDb.paths.components); err != nil {
 				return fmt.Errorf("components: %v\n", err)
 			} else if ok, err := isdir(path); err != nil {
@@ -117,6 +138,103 @@ var (
 		},
 	}
 
+	cmdDbAudit = &cobra.Command{
+		Use:   "audit",
+		Short: "Audit log commands",
+	}
+
+	cmdDbAuditExport = &cobra.Command{
+		Use:   "export",
+		Short: "Export the audit log as JSON lines, oldest first",
+		PreRun: func(cmd *cobra.Command, args []string) {
+			if argsDb.paths.database == "" {
+				log.Fatal("database: path is required\n")
+			} else if path, err := filepath.Abs(argsDb.paths.database); err != nil {
+				log.Fatalf("database: %v\n", err)
+			} else if ok, err := isfile(path); err != nil {
+				log.Fatalf("database: %v\n", err)
+			} else if !ok {
+				log.Fatalf("database: %s: not a file\n", path)
+			} else {
+				argsDb.paths.database = path
+			}
+
+			if argsDb.data.audit.since != "" {
+				if _, err := time.Parse(time.DateOnly, argsDb.data.audit.since); err != nil {
+					log.Fatalf("since: must be YYYY-MM-DD\n")
+				}
+			}
+			if argsDb.data.audit.until != "" {
+				if _, err := time.Parse(time.DateOnly, argsDb.data.audit.until); err != nil {
+					log.Fatalf("until: must be YYYY-MM-DD\n")
+				}
+			}
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			// open the database
+			store, err := sqlite.Open(argsDb.paths.database, context.Background())
+			if err != nil {
+				log.Fatalf("db: audit export: %v\n", err)
+			}
+			defer func() {
+				_ = store.Close()
+			}()
+
+			filter := domains.AuditFilter_t{
+				Actor:  argsDb.data.audit.actor,
+				Action: domains.AuditAction(argsDb.data.audit.action),
+			}
+			if since, err := time.Parse(time.DateOnly, argsDb.data.audit.since); err == nil {
+				filter.Since = since
+			}
+			if until, err := time.Parse(time.DateOnly, argsDb.data.audit.until); err == nil {
+				filter.Until = until.AddDate(0, 0, 1)
+			}
+			events, err := store.GetAuditEvents(filter)
+			if err != nil {
+				log.Fatalf("db: audit export: %v\n", err)
+			}
+
+			w := os.Stdout
+			if argsDb.data.audit.output != "" {
+				if w, err = os.Create(argsDb.data.audit.output); err != nil {
+					log.Fatalf("db: audit export: %v\n", err)
+				}
+			}
+			enc := json.NewEncoder(w)
+			// events are newest first; the export reads better oldest first
+			for i := len(events) - 1; i >= 0; i-- {
+				event := events[i]
+				err = enc.Encode(struct {
+					ID        int    `json:"id"`
+					CreatedAt string `json:"created_at"`
+					Actor     string `json:"actor"`
+					Action    string `json:"action"`
+					Target    string `json:"target"`
+					ClientIP  string `json:"client_ip"`
+					Detail    string `json:"detail,omitempty"`
+				}{
+					ID:        int(event.ID),
+					CreatedAt: event.CreatedAt.Format(time.RFC3339),
+					Actor:     event.Actor,
+					Action:    string(event.Action),
+					Target:    event.Target,
+					ClientIP:  event.ClientIP,
+					Detail:    event.Detail,
+				})
+				if err != nil {
+					log.Fatalf("db: audit export: %v\n", err)
+				}
+			}
+			if w != os.Stdout {
+				if err := w.Close(); err != nil {
+					log.Fatalf("db: audit export: %v\n", err)
+				}
+				log.Printf("db: audit export: wrote %d events to %s\n", len(events), argsDb.data.audit.output)
+			}
+		},
+	}
+
 	cmdDbCreate = &cobra.Command{
 		Use:   "create",
 		Short: "Create data-base objects",
@@ -195,12 +313,67 @@ var (
 			if err != nil {
 				log.Fatalf("db: create user: %v\n", err)
 			}
-			log.Printf("db: create user: magic  %q\n", user.MagicLink)
 
+			auditCli(store, cmd, domains.AuditUserCreate, fmt.Sprintf("clan %s", argsDb.data.user.clan))
 			log.Printf("db: create user: user %d created\n", int(user.ID))
 		},
 	}
 
+	cmdDbCreateMagicLink = &cobra.Command{
+		Use:   "magic-link",
+		Short: "Create a single-use login link for a user",
+		PreRun: func(cmd *cobra.Command, args []string) {
+			if argsDb.paths.database == "" {
+				log.Fatal("database: path is required\n")
+			} else if path, err := filepath.Abs(argsDb.paths.database); err != nil {
+				log.Fatalf("database: %v\n", err)
+			} else if ok, err := isfile(path); err != nil {
+				log.Fatalf("database: %v\n", err)
+			} else if !ok {
+				log.Fatalf("database: %s: not a file\n", path)
+			} else {
+				argsDb.paths.database = path
+			}
+
+			if len(argsDb.data.user.clan) != 4 {
+				log.Fatalf("clan: must be 4 digits between 1 and 999\n")
+			} else if n, err := strconv.Atoi(argsDb.data.user.clan); err != nil {
+				log.Fatalf("clan: must be 4 digits between 1 and 999\n")
+			} else if n < 1 || n > 999 {
+				log.Fatalf("clan: must be 4 digits between 1 and 999\n")
+			}
+
+			if argsDb.data.magicLink.hours < 1 || argsDb.data.magicLink.hours > maxMagicLinkHours {
+				log.Fatalf("hours: must be between 1 and %d\n", maxMagicLinkHours)
+			}
+			argsDb.data.magicLink.baseURL = strings.TrimRight(argsDb.data.magicLink.baseURL, "/")
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			// open the database
+			log.Printf("db: create magic-link: opening database %s\n", argsDb.paths.database)
+			store, err := sqlite.Open(argsDb.paths.database, context.Background())
+			if err != nil {
+				log.Fatalf("db: create magic-link: %v\n", err)
+			}
+			defer func() {
+				_ = store.Close()
+			}()
+
+			id, err := store.GetUserByClan(argsDb.data.user.clan)
+			if err != nil {
+				log.Fatalf("db: create magic-link: invalid clan: %v\n", err)
+			}
+			token, expiresAt, err := store.CreateMagicLink(id, 0, time.Duration(argsDb.data.magicLink.hours)*time.Hour)
+			if err != nil {
+				log.Fatalf("db: create magic-link: %v\n", err)
+			}
+
+			auditCli(store, cmd, domains.AuditMagicLink, fmt.Sprintf("clan %s: expires %s", argsDb.data.user.clan, expiresAt.Format(time.RFC3339)))
+			log.Printf("db: create magic-link: clan %q: expires %s\n", argsDb.data.user.clan, expiresAt.Format(time.RFC3339))
+			fmt.Println(magicLinkURL(argsDb.data.magicLink.baseURL, argsDb.data.user.clan, token))
+		},
+	}
+
 	cmdDbDelete = &cobra.Command{
 		Use:   "delete",
 		Short: "Delete data-base objects",
@@ -247,10 +420,133 @@ var (
 				log.Fatalf("db: delete user: %v\n", err)
 			}
 
+			auditCli(store, cmd, domains.AuditUserDelete, fmt.Sprintf("clan %s", argsDb.data.user.clan))
 			log.Printf("db: delete user: user deleted\n")
 		},
 	}
 
+	cmdDbDeleteLockouts = &cobra.Command{
+		Use:   "lockouts",
+		Short: "Clear failed sign in attempts and lockouts",
+		PreRun: func(cmd *cobra.Command, args []string) {
+			if argsDb.paths.database == "" {
+				log.Fatal("database: path is required\n")
+			} else if path, err := filepath.Abs(argsDb.paths.database); err != nil {
+				log.Fatalf("database: %v\n", err)
+			} else if ok, err := isfile(path); err != nil {
+				log.Fatalf("database: %v\n", err)
+			} else if !ok {
+				log.Fatalf("database: %s: not a file\n", path)
+			} else {
+				argsDb.paths.database = path
+			}
+
+			if argsDb.data.user.clan == "" && argsDb.data.lockout.ip == "" && !argsDb.data.lockout.all {
+				log.Fatalf("lockouts: one of --clan-id, --ip, or --all is required\n")
+			} else if argsDb.data.lockout.all && (argsDb.data.user.clan != "" || argsDb.data.lockout.ip != "") {
+				log.Fatalf("lockouts: --all can't be used with --clan-id or --ip\n")
+			}
+			if argsDb.data.user.clan != "" {
+				if len(argsDb.data.user.clan) != 4 {
+					log.Fatalf("clan: must be 4 digits between 0 and 999\n")
+				} else if n, err := strconv.Atoi(argsDb.data.user.clan); err != nil {
+					log.Fatalf("clan: must be 4 digits between 0 and 999\n")
+				} else if n < 0 || n > 999 {
+					log.Fatalf("clan: must be 4 digits between 0 and 999\n")
+				}
+			}
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			// open the database
+			log.Printf("db: delete lockouts: opening database %s\n", argsDb.paths.database)
+			store, err := sqlite.Open(argsDb.paths.database, context.Background())
+			if err != nil {
+				log.Fatalf("db: delete lockouts: %v\n", err)
+			}
+			defer func() {
+				_ = store.Close()
+			}()
+
+			if argsDb.data.lockout.all {
+				n, err := store.DeleteAllLoginFailures()
+				if err != nil {
+					log.Fatalf("db: delete lockouts: %v\n", err)
+				}
+				auditCli(store, cmd, domains.AuditLockoutClear, fmt.Sprintf("all: %d cleared", n))
+				log.Printf("db: delete lockouts: cleared %d clans and addresses\n", n)
+				return
+			}
+			for scope, subject := range map[string]string{domains.LoginScopeClan: argsDb.data.user.clan, domains.LoginScopeIP: argsDb.data.lockout.ip} {
+				if subject == "" {
+					continue
+				} else if err := store.DeleteLoginFailure(scope, subject); errors.Is(err, sql.ErrNoRows) {
+					log.Printf("db: delete lockouts: %s %q: no failed attempts\n", scope, subject)
+				} else if err != nil {
+					log.Fatalf("db: delete lockouts: %v\n", err)
+				} else {
+					auditCli(store, cmd, domains.AuditLockoutClear, fmt.Sprintf("%s %s", scope, subject))
+					log.Printf("db: delete lockouts: %s %q: cleared\n", scope, subject)
+				}
+			}
+		},
+	}
+
+	cmdDbList = &cobra.Command{
+		Use:   "list",
+		Short: "List data-base objects",
+	}
+
+	cmdDbListLockouts = &cobra.Command{
+		Use:   "lockouts",
+		Short: "List failed sign in attempts and recent lockouts",
+		PreRun: func(cmd *cobra.Command, args []string) {
+			if argsDb.paths.database == "" {
+				log.Fatal("database: path is required\n")
+			} else if path, err := filepath.Abs(argsDb.paths.database); err != nil {
+				log.Fatalf("database: %v\n", err)
+			} else if ok, err := isfile(path); err != nil {
+				log.Fatalf("database: %v\n", err)
+			} else if !ok {
+				log.Fatalf("database: %s: not a file\n", path)
+			} else {
+				argsDb.paths.database = path
+			}
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			// open the database
+			store, err := sqlite.Open(argsDb.paths.database, context.Background())
+			if err != nil {
+				log.Fatalf("db: list lockouts: %v\n", err)
+			}
+			defer func() {
+				_ = store.Close()
+			}()
+
+			now := time.Now().UTC()
+			failures, err := store.GetLoginFailures(now.Add(-loginFailureWindow))
+			if err != nil {
+				log.Fatalf("db: list lockouts: %v\n", err)
+			}
+			events, err := store.GetRecentLockoutEvents(25)
+			if err != nil {
+				log.Fatalf("db: list lockouts: %v\n", err)
+			}
+
+			fmt.Printf("failed sign ins in the last %v:\n", loginFailureWindow)
+			for _, lf := range failures {
+				status := "-"
+				if now.Before(lf.LockedUntil) {
+					status = "locked until " + lf.LockedUntil.Format(time.RFC3339)
+				}
+				fmt.Printf("  %-4s  %-39s  failures %2d  lockouts %2d  last %s  %s\n", lf.Scope, lf.Subject, lf.Failures, lf.Lockouts, lf.LastFailureAt.Format(time.RFC3339), status)
+			}
+			fmt.Printf("recent lockouts:\n")
+			for _, event := range events {
+				fmt.Printf("  %s  %-4s  %-39s  failures %2d  until %s  (clan %s from %s)\n", event.CreatedAt.Format(time.RFC3339), event.Scope, event.Subject, event.Failures, event.LockedUntil.Format(time.RFC3339), event.Clan, event.ClientIP)
+			}
+		},
+	}
+
 	cmdDbUpdate = &cobra.Command{
 		Use:   "update",
 		Short: "Update database configuration",
@@ -306,6 +602,7 @@ var (
 				log.Fatalf("db: update user: %v\n", err)
 			}
 
+			auditCli(store, cmd, domains.AuditUserPassword, fmt.Sprintf("clan %s", argsDb.data.user.clan))
 			log.Printf("db: update user: clan %q: secret %q\n", argsDb.data.user.clan, argsDb.data.user.secret)
 		},
 	}
@@ -6,11 +6,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/mdhender/ottoapp/jobs"
+	"github.com/mdhender/ottoapp/notifications"
 	"github.com/mdhender/ottoapp/stores/sqlite"
 	"github.com/spf13/cobra"
 	"log"
 	"net/http"
 	"os"
+	"os/exec"
 	"os/signal"
 	"path/filepath"
 	"syscall"
@@ -21,11 +24,28 @@ var (
 	argsServe struct {
 		paths struct {
 			database string // path to the database file
+			ottomap  string // path to the ottomap executable
+		}
+		render struct {
+			workers int // number of map render workers
 		}
 		server struct {
-			host   string
-			port   string
-			static bool // if true, serve static files from the assets directory
+			baseURL string // scheme and host that users reach the server at, used for links
+			host    string
+			port    string
+			static  bool // if true, serve static files from the assets directory
+			dev     bool // if true, rebuild the templates when the components change
+		}
+		mailer struct {
+			kind string // smtp, stdout, or file
+			file string // path for the file mailer
+		}
+		smtp struct {
+			host     string // e-mail is disabled if the host is not set
+			port     string
+			username string // credentials are only sent if the username is set
+			password string
+			from     string
 		}
 	}
 
@@ -45,6 +65,18 @@ var (
 			} else {
 				argsServe.paths.database = path
 			}
+			if argsServe.render.workers < 0 {
+				return fmt.Errorf("render-workers: must not be negative\n")
+			}
+			switch argsServe.mailer.kind {
+			case "smtp", "stdout":
+			case "file":
+				if argsServe.mailer.file == "" {
+					return fmt.Errorf("mailer-file: path is required for the file mailer\n")
+				}
+			default:
+				return fmt.Errorf("mailer: %q: must be smtp, stdout, or file\n", argsServe.mailer.kind)
+			}
 			return nil
 		},
 		Run: func(cmd *cobra.Command, args []string) {
@@ -52,8 +84,14 @@ var (
 
 			log.Printf("host      : %s\n", argsServe.server.host)
 			log.Printf("port      : %s\n", argsServe.server.port)
+			log.Printf("base url  : %s\n", argsServe.server.baseURL)
 			log.Printf("database  : %s\n", argsServe.paths.database)
 			log.Printf("staticfs  : %v\n", argsServe.server.static)
+			log.Printf("dev       : %v\n", argsServe.server.dev)
+			log.Printf("ottomap   : %s\n", argsServe.paths.ottomap)
+			log.Printf("workers   : %d\n", argsServe.render.workers)
+			log.Printf("mailer    : %s\n", argsServe.mailer.kind)
+			log.Printf("smtp      : %s\n", argsServe.smtp.host)
 
 			// open the database
 			log.Printf("database : %s\n", argsServe.paths.database)
@@ -69,11 +107,53 @@ var (
 				store = nil
 			}()
 
+			// start the notifier. e-mail is only sent if an smtp server is configured
+			// or if one of the development mailers is selected.
+			var mailer notifications.Mailer
+			switch argsServe.mailer.kind {
+			case "stdout":
+				mailer = notifications.NewWriter(os.Stdout, argsServe.smtp.from)
+			case "file":
+				if m, err := notifications.NewFile(argsServe.mailer.file, argsServe.smtp.from); err != nil {
+					log.Fatalf("error: %v\n", err)
+				} else {
+					mailer = m
+				}
+			default:
+				if argsServe.smtp.host == "" {
+					log.Printf("notifications: no smtp host, e-mail is disabled\n")
+				} else if m, err := notifications.NewSMTP(argsServe.smtp.host, argsServe.smtp.port, argsServe.smtp.username, argsServe.smtp.password, argsServe.smtp.from); err != nil {
+					log.Fatalf("error: %v\n", err)
+				} else {
+					mailer = m
+				}
+			}
+			notifier := notifications.New(store, mailer)
+			notifier.Start(ctx)
+
+			// start the map render queue. rendering is disabled if there are no workers
+			// or if we can't find the ottomap executable.
+			var queue *jobs.Queue
+			if argsServe.render.workers == 0 {
+				log.Printf("jobs: no workers, map rendering is disabled\n")
+			} else if ottomap, err := exec.LookPath(argsServe.paths.ottomap); err != nil {
+				log.Printf("jobs: %v: map rendering is disabled\n", err)
+			} else if queue, err = jobs.New(store, notifier, ottomap, argsServe.render.workers); err != nil {
+				log.Fatalf("error: jobs: %v\n", err)
+			} else if err = queue.Start(ctx); err != nil {
+				log.Fatalf("error: jobs: %v\n", err)
+			}
+
 			s, err := newServer(
 				withHost(argsServe.server.host),
 				withPort(argsServe.server.port),
+				withBaseURL(argsServe.server.baseURL),
 				withStaticFileServer(argsServe.server.static),
+				withDevMode(argsServe.server.dev),
 				withStore(store),
+				withJobs(queue),
+				withNotifier(notifier),
+				withMailer(mailer),
 			)
 			if err != nil {
 				log.Fatalf("error: %v\n", err)
@@ -86,7 +166,7 @@ var (
 			// start the server in a goroutine so that it doesn't block.
 			go func() {
 				log.Printf("listening on %s\n", s.BaseURL())
-				if err := http.ListenAndServe(s.Addr, s.mux); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				if err := http.ListenAndServe(s.Addr, s); err != nil && !errors.Is(err, http.ErrServerClosed) {
 					log.Printf("server: %v\n", err)
 				}
 				log.Printf("server: shutdown\n")
@@ -97,6 +177,14 @@ var (
 
 			log.Printf("signal: received %v (%v)\n", sig, time.Since(started))
 
+			// stop the render workers before closing the database they use.
+			if queue != nil {
+				log.Printf("stopping render workers (%v)\n", time.Since(started))
+				queue.Stop()
+			}
+			log.Printf("stopping notifier (%v)\n", time.Since(started))
+			notifier.Stop()
+
 			// close the database connection
 			// todo: db close may wait on pending transactions. will this cause a race condition?
 			log.Printf("closing store (%v)\n", time.Since(started))
@@ -15,6 +15,8 @@ type FileInfo_t struct {
 	Time  string         // time of the file, formatted as HH:MM:SS in the user's timezone.
 	Route string         // route to the file. assumes the handler respects permissions.
 	Path  string         // path to the file.
+
+	Revisions int // number of saved revisions of a report. zero for other kinds of files.
 }
 
 type FileInfoKind_e int
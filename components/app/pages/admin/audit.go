@@ -0,0 +1,30 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package admin
+
+type Audit_t struct {
+	Filter  AuditFilter_t
+	Actions []string // actions for the filter drop-down
+	Events  []AuditEvent_t
+	Limit   int  // maximum number of events shown
+	More    bool // true if there are more events than are shown
+}
+
+// AuditFilter_t holds the values of the filter form.
+// Dates are YYYY-MM-DD in the administrator's time zone.
+type AuditFilter_t struct {
+	Actor  string
+	Action string
+	Since  string
+	Until  string
+}
+
+type AuditEvent_t struct {
+	Date     string
+	Time     string
+	Actor    string
+	Action   string
+	Target   string
+	ClientIP string
+	Detail   string
+}
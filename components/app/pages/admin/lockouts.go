@@ -0,0 +1,29 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package admin
+
+type Lockouts_t struct {
+	Failures []LoginFailure_t
+	Events   []LockoutEvent_t
+}
+
+// LoginFailure_t is a clan or address with recent failed sign in attempts.
+type LoginFailure_t struct {
+	Scope       string // "clan" or "ip"
+	Subject     string
+	Failures    int
+	Lockouts    int
+	LastFailure string
+	Locked      bool
+	LockedUntil string
+}
+
+type LockoutEvent_t struct {
+	Scope       string
+	Subject     string
+	Clan        string
+	ClientIP    string
+	Failures    int
+	Created     string
+	LockedUntil string
+}
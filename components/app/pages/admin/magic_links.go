@@ -0,0 +1,27 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package admin
+
+type MagicLinks_t struct {
+	Form  MagicLinkForm_t
+	Links []MagicLink_t
+}
+
+// MagicLinkForm_t is the form for creating a magic link.
+// The URL is only shown once, right after the link is created.
+type MagicLinkForm_t struct {
+	ClanId  string
+	Hours   int
+	Error   string
+	URL     string
+	Expires string
+}
+
+type MagicLink_t struct {
+	Clan      string
+	Created   string
+	Expires   string
+	Status    string // "Unused", "Expired", or "Used"
+	Used      string
+	UserAgent string
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package admin
+
+type Users_t struct {
+	Form  UserCreateForm_t
+	Users []User_t
+}
+
+// UserCreateForm_t is the form for creating a user.
+// The password is generated and only shown once, right after the user is created.
+type UserCreateForm_t struct {
+	ClanId   string
+	Email    string
+	Timezone string
+	Error    string
+	Password string
+}
+
+type User_t struct {
+	Clan      string
+	Email     string
+	Roles     string // "Administrator, Operator" etc.
+	IsActive  bool
+	LastLogin string // "Never" if the user has not signed in
+}
+
+// UserDetail_t is the page for managing a single user.
+type UserDetail_t struct {
+	Clan      string
+	Email     string
+	Timezone  string
+	Created   string
+	LastLogin string
+	Roles     UserRolesForm_t
+	Password  UserPasswordForm_t
+	Account   UserAccountForm_t
+}
+
+type UserRolesForm_t struct {
+	Clan            string
+	IsAdministrator bool
+	IsOperator      bool
+	IsUser          bool
+	Error           string
+	Message         string
+}
+
+// UserPasswordForm_t resets the user's password.
+// The new password is only shown once.
+type UserPasswordForm_t struct {
+	Clan     string
+	IsActive bool
+	Error    string
+	Password string
+}
+
+// UserAccountForm_t deactivates or reactivates the user.
+// Reactivating sets a new password, which is only shown once.
+type UserAccountForm_t struct {
+	Clan     string
+	IsActive bool
+	IsSelf   bool
+	Error    string
+	Password string
+}
@@ -3,5 +3,35 @@
 package calendar
 
 type Content struct {
-	ClanId string
+	ClanId    string
+	Month     string // e.g. "October 2023"
+	MonthId   string // e.g. "2023-10"
+	Previous  string // month id of the previous month
+	Next      string // month id of the next month
+	Today     string // month id of the current month
+	Timezone  string // name of the user's timezone
+	Days      []*Day_t
+	Deadlines []*Deadline_t // every known due date, most recent first
+	FeedURL   string        // private iCalendar feed for the clan, empty while an operator is viewing
+}
+
+// Day_t is one cell of the month grid.
+// The grid always has six weeks, starting on a Monday.
+type Day_t struct {
+	Date      string // YYYY-MM-DD
+	Day       int
+	InMonth   bool
+	IsToday   bool
+	Deadlines []*Deadline_t
+}
+
+// Deadline_t is the date that orders are due for a turn.
+type Deadline_t struct {
+	TurnId     string // turn of the report the date came from
+	NextTurnId string // turn that the orders are for
+	Date       string // YYYY-MM-DD
+	Display    string // e.g. "Sunday, October 29, 2023"
+	MonthId    string // e.g. "2023-10", used to link to the month
+	IsPast     bool
+	IsToday    bool
 }
@@ -4,4 +4,39 @@ package maps
 
 type Content struct {
 	ClanId string
+	Turns  []*Turn_t   // maps created for the clan, newest turn first
+	Shared []*Shared_t // maps that other clans have shared with this clan
+}
+
+// Turn_t is the list of maps created for a single turn.
+type Turn_t struct {
+	Turn string // year-month
+	Maps []*Map_t
+}
+
+// Map_t is a map created for the clan.
+type Map_t struct {
+	Name   string // file name of the map
+	Date   string // date of the file, formatted as YYYY-MM-DD in the user's timezone.
+	Time   string // time of the file, formatted as HH:MM:SS in the user's timezone.
+	Size   string // size of the file, formatted for display
+	Route  string // route to download the map
+	Shares []*Share_t
+}
+
+// Share_t is a clan that the map has been shared with.
+type Share_t struct {
+	ID   int64
+	Clan string // clan id of the grantee
+	Date string // date the map was shared
+}
+
+// Shared_t is a map that another clan has shared with this clan.
+type Shared_t struct {
+	ID    int64
+	Name  string // file name of the map
+	Turn  string // year-month
+	Owner string // clan id of the owner
+	Date  string // date the map was shared
+	Route string // route to download the map
 }
@@ -0,0 +1,15 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package preview
+
+import "html/template"
+
+type Content_t struct {
+	MapId   string
+	Route   string        // route to download the .wxx file
+	Width   int           // width of the map, in tiles
+	Height  int           // height of the map, in tiles
+	Labels  int           // number of labels on the map
+	SVG     template.HTML // rendered map
+	Message string        // set when the map could not be rendered
+}
@@ -0,0 +1,14 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package operator
+
+type ViewAs_t struct {
+	Viewing string // clan being viewed, empty if none
+	Form    ViewAsForm_t
+}
+
+// ViewAsForm_t is the form for viewing a clan in read-only mode.
+type ViewAsForm_t struct {
+	ClanId string
+	Error  string
+}
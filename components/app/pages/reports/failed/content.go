@@ -3,5 +3,23 @@
 package failed
 
 type Content_t struct {
-	Reason string
+	Reason      string
+	Diagnostics []Diagnostic_t
+	Excerpt     []Line_t // lines with diagnostics, plus a little context
+}
+
+type Diagnostic_t struct {
+	Line     int
+	Column   int
+	Severity string // error, warning, or info
+	Code     string
+	Message  string
+	Fix      string
+}
+
+type Line_t struct {
+	Number   int
+	Text     string
+	Severity string // severity of the worst diagnostic on the line, empty if none
+	Gap      bool   // true if lines were skipped before this one
 }
@@ -0,0 +1,22 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package history
+
+type Content_t struct {
+	ClanId  string
+	Uploads []Upload_t
+}
+
+type Upload_t struct {
+	Date         string // date of the upload in the user's timezone
+	Time         string // time of the upload in the user's timezone
+	TurnId       string // empty if the turn could not be determined
+	FileName     string // empty for pasted text
+	Kind         string
+	Size         int
+	Checksum     string // hex encoded SHA-256
+	ScrubOptions string
+	Succeeded    bool
+	Reason       string // empty if the upload succeeded
+	Changes      []string
+}
@@ -0,0 +1,7 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package success
+
+type Content_t struct {
+	Changes []string // changes made while repairing the text, empty if none
+}
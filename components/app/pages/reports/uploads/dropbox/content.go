@@ -5,3 +5,21 @@ package dropbox
 type Content_t struct {
 	Title string
 }
+
+// ZipResults_t is the result of unpacking a zip archive of reports.
+type ZipResults_t struct {
+	Archive    string // name of the archive sent by the browser
+	Accepted   int
+	Rejected   int
+	Duplicates int
+	Entries    []ZipEntry_t
+}
+
+// ZipEntry_t is the result for a single entry in the archive.
+type ZipEntry_t struct {
+	Name     string   `json:"name"`                // name of the entry in the archive
+	Status   string   `json:"status"`              // accepted, rejected, or duplicate
+	Reason   string   `json:"reason,omitempty"`    // why the entry was rejected or skipped
+	ReportId string   `json:"report_id,omitempty"` // YYYY-MM.CLAN, if the name was valid
+	Changes  []string `json:"changes,omitempty"`   // changes made while repairing the text
+}
@@ -2,7 +2,10 @@
 
 package settings
 
-import "github.com/mdhender/ottoapp/components/app"
+import (
+	"github.com/mdhender/ottoapp/components/app"
+	"github.com/mdhender/ottoapp/components/app/widgets"
+)
 
 type Layout_t struct {
 	Title       string
@@ -14,6 +17,7 @@ type Layout_t struct {
 		Plans         bool
 		Notifications bool
 	}
-	Content any
-	Footer  app.Footer
+	Content       any
+	Footer        app.Footer
+	Notifications widgets.NotificationPanel_t
 }
@@ -0,0 +1,14 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package notifications
+
+type Content_t struct {
+	Email          string // the address that e-mail is sent to
+	EmailEnabled   bool   // true if the server can send e-mail
+	Saved          bool   // true after the settings have been updated
+	UploadAccepted bool
+	MapRendered    bool
+	RenderFailed   bool
+	OrdersDue      bool
+	ByEmail        bool
+}
@@ -20,7 +20,7 @@ var Content = Content_t{
 			Title: "Hosting",
 			Text:  "Monitor load on the new server to see if it needs to be upgraded.",
 		},
-		{Icon: Backlog.String(),
+		{Icon: Done.String(),
 			Title: "Update job scheduler",
 			Text:  "Replace the current job scheduler with a process that runs in the server after each upload.",
 		},
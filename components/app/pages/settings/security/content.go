@@ -0,0 +1,23 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package security
+
+type Content_t struct {
+	Password Password_t
+	Sessions []Session_t
+}
+
+// Password_t is the change password form.
+type Password_t struct {
+	Error string // reason the password was not changed
+	Saved bool   // true after the password has been changed
+}
+
+type Session_t struct {
+	Key       string // public handle for the session
+	Current   bool   // true if this is the session viewing the page
+	UserAgent string
+	Created   string // formatted in the user's timezone
+	LastSeen  string // formatted in the user's timezone
+	Expires   string // formatted in the user's timezone
+}
@@ -10,6 +10,7 @@ type NotificationPanel_t struct {
 type Notification_t struct {
 	Title   string
 	Message string
+	Details []string // shown as a list below the message, one item for each problem
 	Button  Button_e
 }
 
@@ -25,3 +26,9 @@ const (
 type ReportText_t struct {
 	Text string
 }
+
+// ViewAsBanner_t is shown on every page while an operator is viewing another clan.
+type ViewAsBanner_t struct {
+	Operator string
+	Clan     string
+}
@@ -6,4 +6,5 @@ type LoginClan struct {
 	HideLinks bool
 	ClanId    string
 	Email     string
+	Error     string // shown above the form after a failed attempt
 }
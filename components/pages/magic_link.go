@@ -0,0 +1,12 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package pages
+
+// MagicLink is the page used to sign in with a magic link.
+type MagicLink struct {
+	SignedIn bool   // true if the link was redeemed and the session cookie was set
+	ClanId   string // clan from the link, used for the login page link
+	Token    string // set when the sign in form is shown
+	Heading  string
+	Message  string
+}
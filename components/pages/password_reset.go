@@ -0,0 +1,14 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package pages
+
+// PasswordReset is the page used to request a password reset and to set the new password.
+type PasswordReset struct {
+	ClanId    string
+	Token     string // set when the new password form is shown
+	Form      string // "request", "password", or empty to show only the message
+	Heading   string
+	Message   string
+	Error     string
+	MinLength int
+}
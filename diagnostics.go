@@ -0,0 +1,205 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/mdhender/ottoapp/charset"
+	"github.com/mdhender/ottoapp/components/app"
+	"github.com/mdhender/ottoapp/components/app/pages/reports/failed"
+	"github.com/mdhender/ottoapp/validator"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// excerptContext is the number of lines to show before and after a line with a diagnostic.
+const excerptContext = 1
+
+// postApiReportValidate runs the validator against a report without saving it.
+// The client sends the report in the "text" field, just like the text upload.
+func (s *Server) postApiReportValidate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		started, bytesWritten := time.Now(), 0
+		log.Printf("%s %s: entered\n", r.Method, r.URL.Path)
+		defer func() {
+			log.Printf("%s %s: wrote %d bytes in %s\n", r.Method, r.URL.Path, bytesWritten, time.Since(started))
+		}()
+
+		if r.Method != "POST" {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		// repair the text first if the client asked us to, just like the text upload
+		data, changes := []byte(r.FormValue("text")), []string(nil)
+		if cbIsSet(r.FormValue("remove-bad-bytes")) {
+			var summary charset.Summary_t
+			data, summary = replaceInvalidUTF8(data)
+			changes = summary.Changes()
+		}
+
+		lines := trimReportLines(data)
+		diagnostics := validator.Check(lines)
+		log.Printf("%s %s: lines %d: diagnostics %d\n", r.Method, r.URL.Path, len(lines), len(diagnostics))
+
+		bytesWritten = writeDiagnostics(w, http.StatusOK, !validator.HasErrors(diagnostics), "", changes, diagnostics)
+	}
+}
+
+// trimReportLines splits the report into lines and trims it the same way the text upload does.
+func trimReportLines(data []byte) [][]byte {
+	lines := validator.SplitLines(data)
+	for n, line := range lines {
+		lines[n] = bytes.TrimLeft(line, " \t\r\n")
+	}
+	return trimLeadingBlankLines(trimTrailingBlankLines(lines))
+}
+
+// diagnosticsReason returns a short summary of the diagnostics for the upload history.
+func diagnosticsReason(diagnostics []validator.Diagnostic_t) string {
+	for _, d := range diagnostics {
+		if d.Severity == validator.Error {
+			if n := validator.CountErrors(diagnostics); n > 1 {
+				return fmt.Sprintf("line %d: %s (and %d more errors)", d.Line, d.Message, n-1)
+			}
+			return fmt.Sprintf("line %d: %s", d.Line, d.Message)
+		}
+	}
+	return ""
+}
+
+// diagnosticsDetails returns one line of text for each diagnostic, for the
+// notification panel on pages that can't show the upload failed page.
+func diagnosticsDetails(diagnostics []validator.Diagnostic_t) []string {
+	var details []string
+	for _, d := range diagnostics {
+		detail := fmt.Sprintf("Line %d, column %d: %s: %s", d.Line, d.Column, d.Severity, d.Message)
+		if d.Fix != "" {
+			detail += " " + d.Fix
+		}
+		details = append(details, detail)
+	}
+	return details
+}
+
+// wantsJSON returns true if the client asked for a JSON response.
+func wantsJSON(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+// writeDiagnostics sends the diagnostics as a JSON response and returns the number of bytes written.
+// Changes lists the repairs that were made to the text before it was checked.
+func writeDiagnostics(w http.ResponseWriter, status int, success bool, reason string, changes []string, diagnostics []validator.Diagnostic_t) int {
+	if diagnostics == nil {
+		diagnostics = []validator.Diagnostic_t{}
+	}
+	buf, _ := json.MarshalIndent(struct {
+		Success     bool                     `json:"success"`
+		Reason      string                   `json:"reason,omitempty"`
+		Changes     []string                 `json:"changes,omitempty"`
+		Diagnostics []validator.Diagnostic_t `json:"diagnostics"`
+	}{
+		Success:     success,
+		Reason:      reason,
+		Changes:     changes,
+		Diagnostics: diagnostics,
+	}, "", "  ")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	n, _ := w.Write(buf)
+	return n
+}
+
+// renderUploadFailed renders the upload failed page with the diagnostics and the offending lines.
+// It returns the number of bytes written.
+func (s *Server) renderUploadFailed(w http.ResponseWriter, r *http.Request, path string, reason string, lines [][]byte, diagnostics []validator.Diagnostic_t) int {
+	files := uploadFailedFiles(path)
+
+	payload := app.Layout{
+		Title:   "Upload Failed",
+		Heading: "Reports",
+		Content: failedContent(reason, lines, diagnostics),
+	}
+
+	t, err := s.templates.lookup(files...)
+	if err != nil {
+		log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return 0
+	}
+
+	// parse into a buffer so that we can handle errors without writing to the response
+	buf := &bytes.Buffer{}
+	if err := t.Execute(buf, payload); err != nil {
+		log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return 0
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	n, _ := w.Write(buf.Bytes())
+	return n
+}
+
+// uploadFailedFiles returns the templates for the upload failed page.
+func uploadFailedFiles(path string) []string {
+	return []string{
+		filepath.Join(path, "app", "pages", "reports", "failed", "content.gohtml"),
+	}
+}
+
+// failedContent converts the diagnostics into the content for the upload failed page.
+// The excerpt includes every line with a diagnostic and a line of context on either side.
+func failedContent(reason string, lines [][]byte, diagnostics []validator.Diagnostic_t) failed.Content_t {
+	content := failed.Content_t{Reason: reason}
+
+	severities := map[int]string{}
+	for _, d := range diagnostics {
+		content.Diagnostics = append(content.Diagnostics, failed.Diagnostic_t{
+			Line:     d.Line,
+			Column:   d.Column,
+			Severity: string(d.Severity),
+			Code:     d.Code,
+			Message:  d.Message,
+			Fix:      d.Fix,
+		})
+		if severities[d.Line] != string(validator.Error) {
+			severities[d.Line] = string(d.Severity)
+		}
+	}
+
+	shown := map[int]bool{}
+	for lineNo := range severities {
+		for n := lineNo - excerptContext; n <= lineNo+excerptContext; n++ {
+			if 1 <= n && n <= len(lines) {
+				shown[n] = true
+			}
+		}
+	}
+	last := 0
+	for n := 1; n <= len(lines); n++ {
+		if !shown[n] {
+			continue
+		}
+		text := lines[n-1]
+		if !utf8.Valid(text) {
+			text = bytes.ToValidUTF8(text, []byte("\uFFFD"))
+		}
+		content.Excerpt = append(content.Excerpt, failed.Line_t{
+			Number:   n,
+			Text:     string(text),
+			Severity: severities[n],
+			Gap:      last != 0 && n != last+1,
+		})
+		last = n
+	}
+
+	return content
+}
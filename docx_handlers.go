@@ -4,20 +4,21 @@ package main
 
 import (
 	"bytes"
-	"database/sql"
-	"errors"
 	"fmt"
+	"github.com/mdhender/ottoapp/charset"
 	"github.com/mdhender/ottoapp/components/app"
 	"github.com/mdhender/ottoapp/components/app/pages/reports/uploads/docx"
 	"github.com/mdhender/ottoapp/components/app/widgets"
+	"github.com/mdhender/ottoapp/domains"
+	"github.com/mdhender/ottoapp/stores/office"
+	"github.com/mdhender/ottoapp/validator"
 	"github.com/playbymail/tndocx"
-	dokx "github.com/playbymail/tndocx/docx"
-	"html/template"
 	"io"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 )
@@ -29,6 +30,7 @@ func (s *Server) getReportsDocxUpload(path string, footer app.Footer) http.Handl
 		filepath.Join(path, "app", "widgets", "notifications.gohtml"),
 		filepath.Join(path, "app", "widgets", "report_text.gohtml"),
 	}
+	s.templates.register(files...)
 	scripts := []string{
 		"/js/jszip-3.10.1.min.js",
 		"/js/docx-preview.min.js",
@@ -48,17 +50,7 @@ func (s *Server) getReportsDocxUpload(path string, footer app.Footer) http.Handl
 		//}()
 		_, _ = started, bytesWritten
 
-		// fetch the session and get the current user. if either fails, return an error
-		user, err := s.extractSession(r)
-		if err != nil && !errors.Is(err, sql.ErrNoRows) {
-			//log.Printf("%s %s: extractSession: %v\n", r.Method, r.URL.Path, err)
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
-		} else if user == nil {
-			// there is no active session, so this is an error
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-			return
-		}
+		user := userFromRequest(r)
 		//log.Printf("%s %s: session: clan_id %q\n", r.Method, r.URL.Path, user.Clan)
 
 		payload := app.Layout{
@@ -71,7 +63,7 @@ func (s *Server) getReportsDocxUpload(path string, footer app.Footer) http.Handl
 		payload.CurrentPage.Reports = true
 		payload.Footer.Timestamp = time.Now().In(user.LanguageAndDates.Timezone.Location).Format("2006-01-02 15:04:05")
 
-		t, err := template.ParseFiles(files...)
+		t, err := s.templates.lookup(files...)
 		if err != nil {
 			//log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -98,13 +90,15 @@ func (s *Server) postDocxUpload(path string) http.HandlerFunc {
 	files := []string{
 		filepath.Join(path, "app", "widgets", "notifications.gohtml"),
 	}
+	s.templates.register(files...)
 
-	render := func(w http.ResponseWriter, r *http.Request, title, message string, button widgets.Button_e) (int, error) {
+	render := func(w http.ResponseWriter, r *http.Request, title, message string, button widgets.Button_e, details ...string) (int, error) {
 		alertFragment, err := s.renderFragment(widgets.NotificationPanel_t{
 			OOB: true,
 			Notifications: []widgets.Notification_t{{
 				Title:   title,
 				Message: message,
+				Details: details,
 				Button:  button,
 			}},
 		}, "notifications-panel", files...)
@@ -113,7 +107,6 @@ func (s *Server) postDocxUpload(path string) http.HandlerFunc {
 		}
 		return s.writeFragments(w, r, alertFragment)
 	}
-	_ = render
 
 	return func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("%s %s: entered\n", r.Method, r.URL.Path)
@@ -132,25 +125,20 @@ func (s *Server) postDocxUpload(path string) http.HandlerFunc {
 		}
 		log.Printf("%s %s: ct %q: accepted\n", r.Method, r.URL.Path, r.Header.Get("Content-Type"))
 
-		// fetch the session and get the current user. if either fails, return an error
-		user, err := s.extractSession(r)
-		if err != nil && !errors.Is(err, sql.ErrNoRows) {
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
-		} else if user == nil {
-			// there is no active session, so this is an error
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-			return
-		}
+		user := userFromRequest(r)
+		upload := newUpload(user, domains.UploadDocx)
+		defer s.recordUpload(r, upload)
 
 		// verify that we have an input directory for the clan
 		inputPath := filepath.Join(user.Data, "input")
 		if sb, err := os.Stat(inputPath); err != nil {
+			upload.Reason = "input folder is missing"
 			if _, err := render(w, r, "Account error", "Your account has not been set up correctly. Please let the administrator know that your input directory is missing.", ""); err != nil {
 				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			}
 			return
 		} else if !sb.IsDir() {
+			upload.Reason = "input folder is not a directory"
 			if _, err := render(w, r, "Account error", "Your account has not been set up correctly. Please let the administrator know that your input directory is not a folder.", ""); err != nil {
 				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			}
@@ -159,6 +147,7 @@ func (s *Server) postDocxUpload(path string) http.HandlerFunc {
 
 		// parse the form data, limiting the size to 1MB
 		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			upload.Reason = "form data could not be parsed"
 			if _, err := render(w, r, "Upload failed", "The file upload failed. Please try again with a smaller file.", ""); err != nil {
 				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			}
@@ -167,11 +156,13 @@ func (s *Server) postDocxUpload(path string) http.HandlerFunc {
 		// verify that we have exactly one file in the form data. retrieve if we do, otherwise return an error.
 		const fieldName = "docx-upload"
 		if n := len(r.MultipartForm.File[fieldName]); n == 0 {
+			upload.Reason = "file missing from form data"
 			if _, err := render(w, r, "Upload failed", "The file upload failed. We could not find the file in the request. Please try again with a file.", ""); err != nil {
 				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			}
 			return
 		} else if n > 1 { // it is an error to upload multiple files
+			upload.Reason = fmt.Sprintf("expected 1 file, got %d", n)
 			if _, err := render(w, r, "Upload failed", "The file upload failed because the request contained multiple files. Please try again with a single file.", ""); err != nil {
 				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			}
@@ -180,6 +171,7 @@ func (s *Server) postDocxUpload(path string) http.HandlerFunc {
 		file, handler, err := r.FormFile(fieldName)
 		if err != nil {
 			log.Printf("%s %s: parsing form: %v\n", r.Method, r.URL.Path, err)
+			upload.Reason = "file missing from form data"
 			if _, err := render(w, r, "Upload failed", "The file upload failed. We were unable to extract the file from the upload request. Please report this error.", ""); err != nil {
 				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			}
@@ -188,8 +180,10 @@ func (s *Server) postDocxUpload(path string) http.HandlerFunc {
 		defer func() {
 			_ = file.Close()
 		}()
+		upload.FileName = handler.Filename
 		// ensure the uploaded file has the correct suffix
 		if !strings.HasSuffix(handler.Filename, ".docx") {
+			upload.Reason = "file name must end with .docx"
 			if _, err := render(w, r, "Invalid file name", "The report file name must end with .docx.", ""); err != nil {
 				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			}
@@ -200,11 +194,15 @@ func (s *Server) postDocxUpload(path string) http.HandlerFunc {
 		data, err := io.ReadAll(file)
 		if err != nil {
 			log.Printf("%s %s: reading form data: %v\n", r.Method, r.URL.Path, err)
+			upload.Reason = "file could not be read"
 			if _, err := render(w, r, "Server error", "The server encountered an error while reading the form data from your request.", ""); err != nil {
 				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			}
 			return
-		} else if len(data) == 0 {
+		}
+		setUploadData(upload, data)
+		if len(data) == 0 {
+			upload.Reason = "file is empty"
 			if _, err := render(w, r, "Report is empty", "The file uploaded is empty. Please select a different file.", ""); err != nil {
 				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			}
@@ -212,58 +210,104 @@ func (s *Server) postDocxUpload(path string) http.HandlerFunc {
 		}
 		log.Printf("%s %s: read     %d bytes\n", r.Method, r.URL.Path, len(data))
 
-		// load the Word document
-		log.Printf("%s %s: loaded %d bytes in %v\n", r.Method, r.URL.Path, len(data), time.Since(started))
-
-		// extract the text from the Word document
-		text, err := dokx.ReadBuffer(data)
+		// extract the mapping lines from the Word document
+		lines, summary, err := convertDocxReport(data)
 		if err != nil {
-			log.Printf("%s %s: docx reading buffer: %v\n", r.Method, r.URL.Path, err)
-			if _, err := render(w, r, "Server error", "The server encountered an error while reading the Word document uploaded with your request. Please report this error.", ""); err != nil {
+			log.Printf("%s %s: docx: %v\n", r.Method, r.URL.Path, err)
+			upload.Reason = err.Error()
+			if _, err := render(w, r, "Input checks failed", "Error: "+err.Error(), ""); err != nil {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}
+			return
+		}
+		upload.Changes = summary.Changes()
+		log.Printf("%s %s: converted to %d lines in %v\n", r.Method, r.URL.Path, len(lines), time.Since(started))
+
+		// walk the whole report so that the player can fix every problem at once
+		diagnostics := validator.Check(lines)
+		if validator.HasErrors(diagnostics) {
+			log.Printf("%s %s: diagnostics: %d errors\n", r.Method, r.URL.Path, validator.CountErrors(diagnostics))
+			upload.Reason = diagnosticsReason(diagnostics)
+			if _, err := render(w, r, "Input checks failed", "Please fix the problems listed below and try again.", "", diagnosticsDetails(diagnostics)...); err != nil {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}
+			return
+		}
+		unitId, turnId, _ := validator.Header(lines)
+		if reason := checkReportClan(user, unitId); reason != "" {
+			upload.Reason = reason
+			if _, err := render(w, r, "Wrong clan", reason, ""); err != nil {
 				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			}
 			return
 		}
-		log.Printf("%s %s: read    %d in %v\n", r.Method, r.URL.Path, len(text), time.Since(started))
 
-		// compress spaces within the text
-		text = tndocx.CompressSpaces(text)
-		log.Printf("%s %s: despaced to %d bytes in %v\n", r.Method, r.URL.Path, len(text), time.Since(started))
+		fileName := fmt.Sprintf("%s.%s.report.txt", turnId, unitId)
+		upload.FileName, upload.TurnId = fileName, turnId
+		report := bytes.Join(lines, []byte{'\n'})
+		if len(report) == 0 || report[len(report)-1] != '\n' {
+			report = append(report, '\n')
+		}
+		if _, err := s.stores.ffs.SaveReport(user, fileName, report); err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			upload.Reason = "file could not be saved"
+			if _, err := render(w, r, "Server error", "The server encountered an error while saving your report to disc. Please report this error.", ""); err != nil {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}
+			return
+		}
+		log.Printf("%s %s: saved %q in %v\n", r.Method, r.URL.Path, fileName, time.Since(started))
+
+		upload.Succeeded = true
+		s.recordDueDate(user, turnId, report)
+		s.queueRender(user, turnId)
 
-		// remove unnecessary lines from the text
-		lines := bytes.Split(text, []byte{'\n'})
-		log.Printf("%s %s: split into %d lines in %v\n", r.Method, r.URL.Path, len(lines), time.Since(started))
-		lines = tndocx.RemoveNonMappingLines(lines)
-		log.Printf("%s %s: trimmed to %d lines in %v\n", r.Method, r.URL.Path, len(lines), time.Since(started))
-		for i := range lines {
-			lines[i] = tndocx.PreProcessMovementLine(lines[i])
+		message := fmt.Sprintf("The Word document has been converted and saved as %q. You can view it from the dashboard.", fileName)
+		if summary.Changed() {
+			message += fmt.Sprintf(" We repaired the text before saving it: %s.", summary)
+		}
+		if len(diagnostics) != 0 {
+			message += " The report may not map correctly because of the warnings listed below."
+		}
+		if _, err := render(w, r, "File uploaded", message, widgets.BOpenDashboard, diagnosticsDetails(diagnostics)...); err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		}
-		log.Printf("%s %s: prepped %d lines in %v\n", r.Method, r.URL.Path, len(lines), time.Since(started))
+	}
+}
 
-		//// convert the text to a report
-		//report := tndocx.ToReport("yyyy-mm", lines)
-		//log.Printf("%s %s: created report with %d units in %v\n", r.Method, r.URL.Path, len(report.Units), time.Since(started))
-		//
-		//// create the json
-		//jsonPath := filepath.Join(inputPath, "docx-to-text.json")
-		//if buf, err := json.MarshalIndent(report, "", "  "); err != nil {
-		//	log.Printf("%s %s: docx marshalling json: %v\n", r.Method, r.URL.Path, err)
-		//	if _, err := render(w, r, "Server error", "The server encountered an error while translating your report data to an internal format. Please report this error.", ""); err != nil {
-		//		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		//	}
-		//	return
-		//} else if err := os.WriteFile(jsonPath, buf, 0644); err != nil {
-		//	log.Printf("%s %s: docx writing json: %v\n", r.Method, r.URL.Path, err)
-		//	if _, err := render(w, r, "Server error", "The server encountered an error while saving your report to disc. Please report this error.", ""); err != nil {
-		//		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		//	}
-		//}
-		//log.Printf("%s: %s: created %s in %v\n", r.Method, r.URL.Path, jsonPath, time.Since(started))
-		//
-		//if _, err := render(w, r, "Document uploaded and converted to json", "The entire process is not yet fully implemented, but you can view the work in progress.", widgets.BBetaPeekAtJson); err != nil {
-		//	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		//}
+var (
+	// rxDocxDirectionUnit matches a direction followed by a unit id, "NE 0138c1".
+	// tndocx has the same fix, but only for lower case directions.
+	rxDocxDirectionUnit = regexp.MustCompile(`\b(NE|SE|SW|NW|N|S) (\d{4}(?:[cefg]\d)?)`)
+)
 
-		_, _ = render(w, r, "Under Construction", "This page is under construction. Some parts of it are not yet implemented.", "")
+// convertDocxReport extracts the text from a Word document and returns the lines
+// that the map renderer needs. Callers should run the validator over the lines.
+func convertDocxReport(data []byte) (lines [][]byte, summary charset.Summary_t, err error) {
+	// the office reader keeps each row of a Word table on a single line
+	text, err := office.ReadText(bytes.NewReader(data))
+	if err != nil {
+		return nil, summary, fmt.Errorf("unable to read the Word document")
 	}
+	text, summary = replaceInvalidUTF8(text)
+	text = []byte(scrubEOL(string(text)))
+	text = tndocx.CompressSpaces(text)
+
+	// the tndocx filters only match lower case input, so they are run on a
+	// lower-cased copy of each line. the report keeps the case of the original.
+	for _, line := range bytes.Split(text, []byte{'\n'}) {
+		lower := bytes.ToLower(line)
+		if tndocx.IsMovementLine(lower) {
+			// fix the backslashes and the unit ids that follow a direction
+			line = rxDocxDirectionUnit.ReplaceAll(tndocx.PreProcessMovementLine(line), []byte{'$', '1', ',', '$', '2'})
+		} else if !tndocx.IsUnitHeader(lower) && !tndocx.IsTurnHeader(lower) && !tndocx.IsUnitStatus(lower) {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return nil, summary, fmt.Errorf("the Word document does not contain any mapping lines")
+	}
+
+	return lines, summary, nil
 }
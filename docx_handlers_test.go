@@ -0,0 +1,105 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"github.com/mdhender/ottoapp/validator"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConvertDocxReportTables(t *testing.T) {
+	// players often paste the report into Word tables, with the unit header split across cells
+	body := docxTable(
+		[]string{"Tribe 0138", "", "Current Hex = QQ 1234", "(Previous Hex = QQ 1234)"},
+	) + docxParagraph("Current Turn 901-04 (#40), Spring, FINE", "\t", "Next Turn 901-05 (#41), 12/10/2024") +
+		docxTable(
+			[]string{"Tribe Movement:", "Move NE-GH"},
+			[]string{"Scout 1:", "Scout N-PR"},
+			[]string{"Scout 2:", "Scout N-PR, N 0138e1"},
+		) + docxParagraph("Nothing to map here") +
+		docxParagraph("0138 Status: PRAIRIE, River S")
+
+	lines, _, err := convertDocxReport(testDocx(t, body))
+	if err != nil {
+		t.Fatal(err)
+	} else if diagnostics := validator.Check(lines); validator.HasErrors(diagnostics) {
+		t.Errorf("want no errors, got %+v", diagnostics)
+	} else if unitId, turnId, _ := validator.Header(lines); unitId != "0138" || turnId != "0901-04" {
+		t.Errorf("want 0138 0901-04, got %q %q", unitId, turnId)
+	}
+	var got []string
+	for _, line := range lines {
+		got = append(got, string(line))
+	}
+	// the case of the report is kept. only the spaces around delimiters are removed.
+	want := []string{
+		"Tribe 0138,,Current Hex = QQ 1234,(Previous Hex = QQ 1234)",
+		"Current Turn 901-04(#40),Spring,FINE Next Turn 901-05(#41),12/10/2024",
+		"Tribe Movement:Move NE-GH",
+		"Scout 1:Scout N-PR",
+		"Scout 2:Scout N-PR,N,0138e1",
+		"0138 Status:PRAIRIE,River S",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %q\ngot  %q", want, got)
+	}
+}
+
+// docxParagraph returns a paragraph with a run for each text. A "\t" is written as a tab.
+func docxParagraph(texts ...string) string {
+	sb := &strings.Builder{}
+	sb.WriteString(`<w:p><w:r>`)
+	for _, text := range texts {
+		if text == "\t" {
+			sb.WriteString(`<w:tab/>`)
+		} else {
+			sb.WriteString(`<w:t xml:space="preserve">` + text + `</w:t>`)
+		}
+	}
+	sb.WriteString(`</w:r></w:p>`)
+	return sb.String()
+}
+
+// docxTable returns a table with one row for each slice of cells.
+func docxTable(rows ...[]string) string {
+	sb := &strings.Builder{}
+	sb.WriteString(`<w:tbl><w:tblPr/>`)
+	for _, row := range rows {
+		sb.WriteString(`<w:tr>`)
+		for _, cell := range row {
+			if cell == "" {
+				sb.WriteString(`<w:tc><w:p/></w:tc>`)
+			} else {
+				sb.WriteString(`<w:tc>` + docxParagraph(cell) + `</w:tc>`)
+			}
+		}
+		sb.WriteString(`</w:tr>`)
+	}
+	sb.WriteString(`</w:tbl>`)
+	return sb.String()
+}
+
+// testDocx returns a minimal Word document with the given body.
+func testDocx(t *testing.T, body string) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	w, err := zw.Create("word/document.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = w.Write([]byte(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+		`<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>` +
+		body +
+		`<w:sectPr/></w:body></w:document>`))
+	if err != nil {
+		t.Fatal(err)
+	} else if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
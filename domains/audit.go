@@ -0,0 +1,60 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package domains
+
+import "time"
+
+// AuditAction is the kind of event recorded in the audit log.
+type AuditAction string
+
+const (
+	AuditLogin          AuditAction = "login"         // signed in with a password
+	AuditLoginFailed    AuditAction = "login-failed"  // wrong e-mail or password, or the clan didn't match
+	AuditLoginBlocked   AuditAction = "login-blocked" // refused because of failed attempts
+	AuditLoginMagicLink AuditAction = "login-magic-link"
+	AuditLogout         AuditAction = "logout"
+	AuditLockoutClear   AuditAction = "lockout-clear"     // the detail is the scope and subject, or "all"
+	AuditMagicLink      AuditAction = "magic-link-create" // the detail is the clan the link signs in to
+	AuditPasswordChange AuditAction = "password-change"
+	AuditPasswordReset  AuditAction = "password-reset"
+	AuditUpload         AuditAction = "upload"        // report saved
+	AuditUploadFailed   AuditAction = "upload-failed" // report rejected
+	AuditDeleteReport   AuditAction = "delete-report"
+	AuditDeleteMap      AuditAction = "delete-map"
+	AuditDeleteLog      AuditAction = "delete-log"
+	AuditDeleteErrorLog AuditAction = "delete-error-log"
+	AuditUserCreate     AuditAction = "user-create" // the actor is the administrator, the detail is the clan
+	AuditUserDeactivate AuditAction = "user-deactivate"
+	AuditUserDelete     AuditAction = "user-delete"
+	AuditUserReactivate AuditAction = "user-reactivate"
+	AuditUserPassword   AuditAction = "user-password"
+	AuditUserRoles      AuditAction = "user-roles"
+	AuditViewAs         AuditAction = "view-as" // an operator viewed a page for the clan in the detail
+	AuditViewAsStart    AuditAction = "view-as-start"
+	AuditViewAsStop     AuditAction = "view-as-stop"
+	AuditSessionRevoke  AuditAction = "session-revoke" // the detail says which sessions were revoked
+)
+
+// AuditActorCli is the actor for events from the command line.
+const AuditActorCli = "cli"
+
+// AuditEvent_t is an entry in the audit log.
+type AuditEvent_t struct {
+	ID        ID
+	CreatedAt time.Time // always UTC
+	Actor     string    // clan id, or AuditActorCli for the command line
+	Action    AuditAction
+	Target    string // request path, or the command for the command line
+	ClientIP  string
+	Detail    string
+}
+
+// AuditFilter_t selects events from the audit log.
+// Empty fields match every event.
+type AuditFilter_t struct {
+	Actor  string
+	Action AuditAction
+	Since  time.Time // inclusive, zero for the beginning
+	Until  time.Time // exclusive, zero for now
+	Limit  int       // zero or negative for no limit
+}
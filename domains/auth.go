@@ -27,11 +27,52 @@ type Claim_t struct {
 	}
 }
 
+// MagicLink_t is the type for a single-use login link.
+// The token is never stored, so it is not part of the type.
+type MagicLink_t struct {
+	Clan          string    // clan that the link logs in as
+	CreatedAt     time.Time // always UTC
+	ExpiresAt     time.Time // always UTC
+	UsedAt        time.Time // always UTC, time.Zero if the link has not been used
+	UsedUserAgent string    // user agent of the browser that used the link
+}
+
+// LoginFailure_t tracks failed sign in attempts for a clan or a client address.
+type LoginFailure_t struct {
+	Scope         string    // LoginScopeClan or LoginScopeIP
+	Subject       string    // clan id or client address
+	Failures      int       // failures since the last lockout
+	Lockouts      int       // lockouts since the subject was last cleared
+	LastFailureAt time.Time // always UTC
+	LockedUntil   time.Time // always UTC, time.Zero if the subject has never been locked
+	RetryAt       time.Time // always UTC, the end of the backoff from the last failure
+}
+
+const (
+	LoginScopeClan = "clan"
+	LoginScopeIP   = "ip"
+)
+
+// LockoutEvent_t records a lockout so that administrators can see attacks.
+type LockoutEvent_t struct {
+	Scope       string
+	Subject     string
+	Clan        string // clan of the attempt that caused the lockout
+	ClientIP    string // address of the attempt that caused the lockout
+	Failures    int
+	CreatedAt   time.Time // always UTC
+	LockedUntil time.Time // always UTC
+}
+
 // Session_t is the type for a session.
 type Session_t struct {
 	Id        string    // unique identifier for the session
+	Key       string    // public handle for the session, safe to show to the user
+	Current   bool      // true if this is the session making the request
+	UserAgent string    // user agent of the browser that created the session
 	CreatedAt time.Time // always UTC
 	ExpiresAt time.Time // always UTC
+	LastSeen  time.Time // always UTC, updated at most every few minutes
 
 	Claim_t // the claim for the session, embedded
 }
@@ -66,6 +107,9 @@ type User_t struct {
 	Created   time.Time // always UTC
 	Updated   time.Time // always UTC
 	LastLogin time.Time // always UTC, time.Zero if never logged in
+
+	// the operator viewing this clan in read-only mode, nil if the user is signed in as themselves
+	ViewedBy *User_t
 }
 
 // authentication domain errors
@@ -78,6 +122,16 @@ var (
 	ErrInvalidTimezone      = errors.New("invalid timezone")
 	ErrInvalidTurnMonth     = errors.New("invalid turn month")
 	ErrInvalidTurnYear      = errors.New("invalid turn year")
+	ErrMagicLinkExpired     = errors.New("magic link expired")
+	ErrMagicLinkInvalid     = errors.New("magic link invalid")
+	ErrMagicLinkUsed        = errors.New("magic link used")
+	ErrPasswordResetExpired = errors.New("password reset expired")
+	ErrPasswordResetInvalid = errors.New("password reset invalid")
+	ErrPasswordResetUsed    = errors.New("password reset used")
+	ErrRefreshTokenExpired  = errors.New("refresh token expired")
+	ErrRefreshTokenInvalid  = errors.New("refresh token invalid")
+	ErrRefreshTokenReused   = errors.New("refresh token reused")
+	ErrRefreshTokenRevoked  = errors.New("refresh token revoked")
 	ErrSessionCookieInvalid = errors.New("session cookie invalid")
 	ErrSessionExpired       = errors.New("session expired")
 	ErrSessionInvalid       = errors.New("session invalid")
@@ -0,0 +1,13 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package domains
+
+import "time"
+
+// DueDate_t is the date that orders are due for the next turn.
+// It is taken from the "Next Turn" field of a report's turn header.
+type DueDate_t struct {
+	TurnId     string    // turn the report is for, e.g. "0901-02"
+	NextTurnId string    // turn the orders are for, e.g. "0901-03"
+	Due        time.Time // midnight UTC of the due date; only the date is significant
+}
@@ -14,7 +14,10 @@ const (
 	ErrDatabaseExists      = Error("database exists")
 	ErrForeignKeysDisabled = Error("foreign keys disabled")
 	ErrInvalidPath         = Error("invalid path")
+	ErrInvalidWorkerCount  = Error("invalid worker count")
 	ErrMissingUserdataPath = Error("missing userdata path")
+	ErrNoSuchRevision      = Error("no such revision")
 	ErrNotDirectory        = Error("not a directory")
 	ErrPragmaReturnedNil   = Error("pragma returned nil")
+	ErrRevisionsDiffer     = Error("revisions differ too much to show")
 )
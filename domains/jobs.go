@@ -0,0 +1,26 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package domains
+
+import "time"
+
+// JobStatus is the status of a render job.
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+)
+
+// Job_t is the type for a map render job.
+type Job_t struct {
+	ID           ID        // unique identifier for the job
+	UserID       ID        // the user that queued the job
+	Clan         string    // clan number, always 4 digits
+	TurnId       string    // turn id, e.g. "0901-02"
+	Status       JobStatus // current status of the job
+	ErrorMessage string    // set when the job has failed
+	StartedAt    time.Time // always UTC
+}
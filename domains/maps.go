@@ -0,0 +1,15 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package domains
+
+import "time"
+
+// MapShare_t grants one clan read access to a map owned by another clan.
+type MapShare_t struct {
+	ID          ID        // unique identifier for the share
+	OwnerID     ID        // the user that owns the map
+	OwnerClan   string    // clan number of the owner, set when listing shares for the grantee
+	GranteeClan string    // clan number of the grantee, set when listing shares for the owner
+	MapId       string    // file name of the map, e.g. "0901-02.0138.wxx"
+	CreatedAt   time.Time // always UTC
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package domains
+
+import "time"
+
+// NotificationEvent is the kind of event that a player can be notified about.
+type NotificationEvent string
+
+const (
+	EventUploadAccepted NotificationEvent = "upload-accepted"
+	EventMapRendered    NotificationEvent = "map-rendered"
+	EventRenderFailed   NotificationEvent = "render-failed"
+	EventOrdersDue      NotificationEvent = "orders-due"
+)
+
+// EmailStatus is the delivery status of the e-mail copy of a notification.
+type EmailStatus string
+
+const (
+	EmailNone    EmailStatus = "none" // the message is only in the inbox
+	EmailPending EmailStatus = "pending"
+	EmailSent    EmailStatus = "sent"
+	EmailFailed  EmailStatus = "failed" // gave up after the last retry
+)
+
+// Notification_t is a message in the user's inbox.
+type Notification_t struct {
+	ID        ID
+	Event     NotificationEvent
+	Title     string
+	Message   string
+	CreatedAt time.Time // always UTC
+}
+
+// PendingEmail_t is a notification that is waiting to be e-mailed.
+type PendingEmail_t struct {
+	ID       ID // id of the notification
+	To       string
+	Subject  string
+	Body     string
+	Attempts int // number of failed attempts so far
+}
+
+// NotificationSettings_t is the events that the user has opted in to.
+type NotificationSettings_t struct {
+	UploadAccepted bool
+	MapRendered    bool
+	RenderFailed   bool
+	OrdersDue      bool
+	ByEmail        bool // send a copy of each notification by e-mail
+}
+
+// Wants returns true if the user has opted in to the event.
+func (ns NotificationSettings_t) Wants(event NotificationEvent) bool {
+	switch event {
+	case EventUploadAccepted:
+		return ns.UploadAccepted
+	case EventMapRendered:
+		return ns.MapRendered
+	case EventRenderFailed:
+		return ns.RenderFailed
+	case EventOrdersDue:
+		return ns.OrdersDue
+	}
+	return false
+}
+
+// OrdersDue_t is a due date that the user should be reminded of.
+type OrdersDue_t struct {
+	UserID     ID
+	NextTurnId string
+	Due        time.Time // midnight UTC of the due date
+}
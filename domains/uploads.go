@@ -0,0 +1,33 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package domains
+
+import "time"
+
+// UploadKind is the way a report was sent to the server.
+type UploadKind string
+
+const (
+	UploadText    UploadKind = "text"    // text pasted into a form
+	UploadFile    UploadKind = "file"    // plain text file
+	UploadDocx    UploadKind = "docx"    // Word document
+	UploadDropbox UploadKind = "dropbox" // file dropped on the dropbox page
+	UploadZip     UploadKind = "zip"     // entry from a zip archive dropped on the dropbox page
+)
+
+// Upload_t is the type for an entry in the upload history.
+type Upload_t struct {
+	ID           ID         // unique identifier for the upload
+	UserID       ID         // the user that sent the upload
+	Clan         string     // clan number, always 4 digits
+	TurnId       string     // turn id, e.g. "0901-02", empty if it could not be determined
+	FileName     string     // file name sent by the browser, empty for pasted text
+	Kind         UploadKind // how the report was sent
+	Size         int        // number of bytes received
+	Checksum     string     // hex encoded SHA-256 of the bytes received
+	ScrubOptions []string   // scrub options selected by the user
+	Succeeded    bool       // true if the report was saved
+	Reason       string     // why the upload failed, empty on success
+	Changes      []string   // changes made while repairing the text, empty if none
+	UploadedAt   time.Time  // always UTC
+}
@@ -4,15 +4,16 @@ package main
 
 import (
 	"bytes"
-	"database/sql"
 	"errors"
 	"fmt"
 	"github.com/google/uuid"
+	"github.com/mdhender/ottoapp/charset"
 	"github.com/mdhender/ottoapp/components/app"
 	"github.com/mdhender/ottoapp/components/app/pages/reports/uploads/dropbox"
 	"github.com/mdhender/ottoapp/components/app/widgets"
+	"github.com/mdhender/ottoapp/domains"
+	"github.com/mdhender/ottoapp/validator"
 	"github.com/playbymail/tndocx"
-	"html/template"
 	"io"
 	"log"
 	"net/http"
@@ -31,6 +32,7 @@ func (s *Server) getReportsDropboxUpload(path string, footer app.Footer) http.Ha
 		filepath.Join(path, "app", "widgets", "notifications.gohtml"),
 		filepath.Join(path, "app", "widgets", "report_text.gohtml"),
 	}
+	s.templates.register(files...)
 	scripts := []string{
 		"/js/jszip-3.10.1.min.js",
 		"/js/docx-preview.min.js",
@@ -50,17 +52,7 @@ func (s *Server) getReportsDropboxUpload(path string, footer app.Footer) http.Ha
 		//}()
 		_, _ = started, bytesWritten
 
-		// fetch the session and get the current user. if either fails, return an error
-		user, err := s.extractSession(r)
-		if err != nil && !errors.Is(err, sql.ErrNoRows) {
-			//log.Printf("%s %s: extractSession: %v\n", r.Method, r.URL.Path, err)
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
-		} else if user == nil {
-			// there is no active session, so this is an error
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-			return
-		}
+		user := userFromRequest(r)
 		//log.Printf("%s %s: session: clan_id %q\n", r.Method, r.URL.Path, user.Clan)
 
 		payload := app.Layout{
@@ -73,7 +65,7 @@ func (s *Server) getReportsDropboxUpload(path string, footer app.Footer) http.Ha
 		payload.CurrentPage.Reports = true
 		payload.Footer.Timestamp = time.Now().In(user.LanguageAndDates.Timezone.Location).Format("2006-01-02 15:04:05")
 
-		t, err := template.ParseFiles(files...)
+		t, err := s.templates.lookup(files...)
 		if err != nil {
 			//log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -101,6 +93,7 @@ func (s *Server) postDropboxScrub(path string, serverVersion string) http.Handle
 		filepath.Join(path, "app", "pages", "reports", "uploads", "dropbox", "content.gohtml"),
 		filepath.Join(path, "app", "widgets", "notifications.gohtml"),
 	}
+	s.templates.register(files...)
 	alert := func(w http.ResponseWriter, r *http.Request, title, message string, button widgets.Button_e) {
 		alertFragment, err := s.renderFragment(widgets.NotificationPanel_t{
 			OOB: true,
@@ -118,7 +111,6 @@ func (s *Server) postDropboxScrub(path string, serverVersion string) http.Handle
 	}
 
 	const fieldName = "report-file-input"
-	rxTurnReports := regexp.MustCompile(`^([0-9]+)-([0-9]+)\.([0-9]+)\.report\.(docx|txt)$`)
 
 	return func(w http.ResponseWriter, r *http.Request) {
 		//log.Printf("%s %s: entered\n", r.Method, r.URL.Path)
@@ -135,15 +127,13 @@ func (s *Server) postDropboxScrub(path string, serverVersion string) http.Handle
 			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 			return
 		}
-		// fetch the session and get the current user. if either fails, return an error
-		user, err := s.extractSession(r)
-		if err != nil && !errors.Is(err, sql.ErrNoRows) {
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
-		} else if user == nil {
-			// there is no active session, so this is an error
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-			return
+		user := userFromRequest(r)
+
+		upload := newUpload(user, domains.UploadDropbox)
+		defer s.recordUpload(r, upload)
+		fail := func(title, message string) {
+			upload.Reason = message
+			alert(w, r, title, message, "")
 		}
 
 		// after those header checks, we're expected to return an alert fragment if there are issues with the request
@@ -151,22 +141,22 @@ func (s *Server) postDropboxScrub(path string, serverVersion string) http.Handle
 		// verify that we have an input directory for the clan
 		inputPath := filepath.Join(user.Data, "input")
 		if sb, err := os.Stat(inputPath); err != nil {
-			alert(w, r, "Account error", "Your account has not been set up correctly. Please let the administrator know that your input directory is missing.", "")
+			fail("Account error", "Your account has not been set up correctly. Please let the administrator know that your input directory is missing.")
 			return
 		} else if !sb.IsDir() {
-			alert(w, r, "Account error", "Your account has not been set up correctly. Please let the administrator know that your input directory is not a folder.", "")
+			fail("Account error", "Your account has not been set up correctly. Please let the administrator know that your input directory is not a folder.")
 			return
 		}
 
 		// parse the form data, limiting the size to 1MB, and verify that we have exactly one file in the form data.
 		if err := r.ParseMultipartForm(1 << 20); err != nil {
-			alert(w, r, "Upload failed", "The file upload failed. The attached file exceeds the size limit of 1mb.", "")
+			fail("Upload failed", "The file upload failed. The attached file exceeds the size limit of 1mb.")
 			return
 		} else if n := len(r.MultipartForm.File[fieldName]); n == 0 {
-			alert(w, r, "Upload failed", "The file upload failed. The request did not include a named file.", "")
+			fail("Upload failed", "The file upload failed. The request did not include a named file.")
 			return
 		} else if n > 1 { // it is an error to upload multiple files
-			alert(w, r, "Upload failed", "The file upload failed. The request included multiple files.", "")
+			fail("Upload failed", "The file upload failed. The request included multiple files.")
 			return
 		}
 		// read the file from the form data
@@ -175,47 +165,26 @@ func (s *Server) postDropboxScrub(path string, serverVersion string) http.Handle
 			id := uuid.NewString()
 			log.Printf("%s %s: parsing form: %v (%s)\n", r.Method, r.URL.Path, err, id)
 			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
-			alert(w, r, "Upload failed", fmt.Sprintf("The file upload failed. The attached file could not be extracted from the request. Please report error %q", id[len(id)-8:]), "")
+			fail("Upload failed", fmt.Sprintf("The file upload failed. The attached file could not be extracted from the request. Please report error %q", id[len(id)-8:]))
 			return
 		}
 		defer func() {
 			_ = file.Close()
 		}()
+		upload.FileName = handler.Filename
 
-		// the file name must match the YYYY-MM.CLAN.report.ext pattern, but I got talked into
-		// allowing for three digit years, so we must normalize both the year and month.
-		var fileName, reportId, turnId, clanId string
-		isTextFile, isWordFile := false, false
-		if matches := rxTurnReports.FindStringSubmatch(handler.Filename); len(matches) != 5 {
-			alert(w, r, "Upload failed", "The file upload failed. The file name must match YEAR-MONTH.CLAN.report and have an extension of .txt or .docx.", "")
+		// the file name must match the YYYY-MM.CLAN.report.ext pattern
+		report, err := parseDropboxFileName(handler.Filename)
+		if err != nil {
+			fail("Upload failed", "The file upload failed. "+err.Error())
+			return
+		}
+		reportId, turnId, clanId := report.ReportId, report.TurnId, report.ClanId
+		isTextFile, isWordFile := report.IsTextFile, report.IsWordFile
+		upload.TurnId = turnId
+		if reason := checkReportClan(user, clanId); reason != "" {
+			fail("Upload failed", "The file upload failed. "+reason)
 			return
-		} else {
-			var year, month, clanNo int
-			if year, err = strconv.Atoi(matches[1]); err != nil {
-				alert(w, r, "Upload failed", "The file upload failed. The file name must include a numeric YEAR.", "")
-				return
-			} else if year < 899 || year > 1234 {
-				alert(w, r, "Upload failed", "The file upload failed. The YEAR in the file must be between 899 and 1234.", "")
-				return
-			} else if month, err = strconv.Atoi(matches[2]); err != nil {
-				alert(w, r, "Upload failed", "The file upload failed. The file name must include a numeric MONTH.", "")
-				return
-			} else if month < 1 || month > 12 {
-				alert(w, r, "Upload failed", "The file upload failed. The MONTH in the file name must be between 1 and 12.", "")
-				return
-			} else if clanNo, err = strconv.Atoi(matches[3]); err != nil {
-				alert(w, r, "Upload failed", "The file upload failed. The file name must include a numeric CLAN.", "")
-				return
-			} else if clanNo < 1 || clanNo > 999 {
-				alert(w, r, "Upload failed", "The file upload failed. The CLAN in the file name must be between 1 and 999.", "")
-				return
-			}
-			ext := matches[4]
-			isTextFile, isWordFile = ext == "txt", ext == "docx"
-			turnId = fmt.Sprintf("%04d-%02d", year, month)
-			clanId = fmt.Sprintf("%04d", clanNo)
-			reportId = fmt.Sprintf("%s.%s", turnId, clanId)
-			fileName = fmt.Sprintf("%s.report.%s", reportId, ext)
 		}
 		//log.Printf("%s %s: filename %q\n", r.Method, r.URL.Path, fileName)
 
@@ -223,15 +192,15 @@ func (s *Server) postDropboxScrub(path string, serverVersion string) http.Handle
 		//log.Printf("%s %s: field %q: %q\n", r.Method, r.URL.Path, fieldName, handler.Filename)
 		//log.Printf("%s %s: field %q: %v\n", r.Method, r.URL.Path, fieldName, handler.Header["Content-Type"])
 		if !(isTextFile || isWordFile) {
-			alert(w, r, "Upload failed", "The file upload failed. The extension must be .txt or .docx.", "")
+			fail("Upload failed", "The file upload failed. The extension must be .txt or .docx.")
 			return
 		} else if isTextFile && handler.Header["Content-Type"][0] != "text/plain" {
 			//log.Printf("%s %s: field %q: %q: unexpected content type %q\n", r.Method, r.URL.Path, fieldName, handler.Filename, handler.Header["Content-Type"][0])
-			alert(w, r, "Upload failed", "The file upload failed. The browser did not encode the text file correctly.", "")
+			fail("Upload failed", "The file upload failed. The browser did not encode the text file correctly.")
 			return
 		} else if isWordFile && handler.Header["Content-Type"][0] != "application/vnd.openxmlformats-officedocument.wordprocessingml.document" {
 			//log.Printf("%s %s: field %q: %q: unexpected content type %q\n", r.Method, r.URL.Path, fieldName, handler.Filename, handler.Header["Content-Type"][0])
-			alert(w, r, "Upload failed", "The file upload failed. The browser did not encode the word document correctly.", "")
+			fail("Upload failed", "The file upload failed. The browser did not encode the word document correctly.")
 			return
 		}
 
@@ -239,91 +208,40 @@ func (s *Server) postDropboxScrub(path string, serverVersion string) http.Handle
 		data, err := io.ReadAll(file)
 		if err != nil {
 			//log.Printf("%s %s: reading form data: %v\n", r.Method, r.URL.Path, err)
-			alert(w, r, "Upload failed", "The file upload failed. We tried to read the file, but failed. This could be a bug...", "")
+			fail("Upload failed", "The file upload failed. We tried to read the file, but failed. This could be a bug...")
 			return
 		} else if len(data) == 0 {
-			alert(w, r, "Upload failed", "The file upload failed. The attached file is empty.", "")
+			fail("Upload failed", "The file upload failed. The attached file is empty.")
 			return
 		}
+		setUploadData(upload, data)
 
-		// parse the report text into sections
-		sections, err := tndocx.ParseSections(data)
+		// parse the report text into sections and create a scrubbed file from them
+		scrubbedData, summary, err := scrubDropboxReport(user, report, serverVersion, data)
+		upload.Changes = summary.Changes()
 		if err != nil {
-			if errors.Is(err, tndocx.ErrEmptyInput) {
-				alert(w, r, "Upload failed", "The file upload failed. We could not find any lines in the file.", "")
-			} else if errors.Is(err, tndocx.ErrUnknownFormat) {
-				alert(w, r, "Upload failed", "The file upload failed. We could not find any report sections in the report text.", "")
+			if reason, ok := dropboxParseReason(err); ok {
+				fail("Upload failed", "The file upload failed. "+reason)
 			} else {
 				log.Printf("%s %s: parse sections: %v\n", r.Method, r.URL.Path, err)
-				alert(w, r, "Upload failed", "The file upload failed. We could not parse the report text.", "")
+				fail("Upload failed", "The file upload failed. We could not parse the report text.")
 			}
 			return
 		}
-		//log.Printf("%s %s: parsed report with %d units in %v\n", r.Method, r.URL.Path, len(sections), time.Since(started))
-
-		// create a scrubbed file from the sections
-		scrubbedData := &bytes.Buffer{}
-		if isTextFile {
-			scrubbedData.WriteString(fmt.Sprintf("// text file %q\n", fileName))
-		} else if isWordFile {
-			scrubbedData.WriteString(fmt.Sprintf("// word file %q\n", fileName))
-		}
-		metaTimestamp := time.Now().In(user.LanguageAndDates.Timezone.Location)
-		scrubbedData.WriteString(fmt.Sprintf("// submitted by user %s at %s\n", user.Clan, metaTimestamp.Format("2006-01-02 15:04:05")))
-		scrubbedData.WriteString(fmt.Sprintf("// ottoapp v%s\n", serverVersion))
-		scrubbedData.WriteString(fmt.Sprintf("// tndocx  v%s\n", tndocx.Version()))
-		// stuff the section back in
-		for _, section := range sections {
-			scrubbedData.WriteString(fmt.Sprintf("\n// section %d\n", section.Id))
-			if len(section.Header) == 0 {
-				scrubbedData.WriteString("// missing element header")
-			} else {
-				scrubbedData.Write(section.Header)
-			}
-			scrubbedData.WriteByte('\n')
-			if len(section.Turn) == 0 {
-				scrubbedData.WriteString("// missing turn header")
-			} else {
-				scrubbedData.Write(section.Turn)
-			}
-			scrubbedData.WriteByte('\n')
-			if len(section.Moves.Movement) != 0 {
-				scrubbedData.Write(section.Moves.Movement)
-				scrubbedData.WriteByte('\n')
-			}
-			if len(section.Moves.Follows) != 0 {
-				scrubbedData.Write(section.Moves.Fleet)
-				scrubbedData.WriteByte('\n')
-			}
-			if len(section.Moves.GoesTo) != 0 {
-				scrubbedData.Write(section.Moves.GoesTo)
-				scrubbedData.WriteByte('\n')
-			}
-			if len(section.Moves.Fleet) != 0 {
-				scrubbedData.Write(section.Moves.Fleet)
-				scrubbedData.WriteByte('\n')
-			}
-			for _, scout := range section.Moves.Scouts {
-				scrubbedData.Write(scout)
-				scrubbedData.WriteByte('\n')
-			}
-			if len(section.Status) == 0 {
-				scrubbedData.WriteString("// missing element status")
-			} else {
-				scrubbedData.Write(section.Status)
-			}
-			scrubbedData.WriteByte('\n')
-		}
 
 		scrubbedPath := filepath.Join(inputPath, fmt.Sprintf("%s.scrubbed.txt", reportId))
-		if err := os.WriteFile(scrubbedPath, scrubbedData.Bytes(), 0644); err != nil {
+		if err := os.WriteFile(scrubbedPath, scrubbedData, 0644); err != nil {
 			id := uuid.NewString()
 			log.Printf("%s %s: dropbox: writing scrubbed file: %v (%s)\n", r.Method, r.URL.Path, err, id)
-			alert(w, r, "Server error", fmt.Sprintf("The server encountered an error while saving your report. Please report error %q.", id[len(id)-8:]), "")
+			fail("Server error", fmt.Sprintf("The server encountered an error while saving your report. Please report error %q.", id[len(id)-8:]))
 			return
 		}
 		//log.Printf("%s: %s: created %s in %v\n", r.Method, r.URL.Path, scrubbedPath, time.Since(started))
 
+		upload.Succeeded = true
+		s.recordDueDate(user, turnId, scrubbedData)
+		s.queueRender(user, turnId)
+
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
 		w.Header().Set("HX-Redirect", fmt.Sprintf("/reports/turn/%s/clan/%s", turnId, clanId))
 		w.WriteHeader(http.StatusNoContent)
@@ -334,6 +252,7 @@ func (s *Server) postDropboxUpload(path string) http.HandlerFunc {
 	files := []string{
 		filepath.Join(path, "app", "widgets", "notifications.gohtml"),
 	}
+	s.templates.register(files...)
 
 	const fieldName = "report-text"
 
@@ -371,16 +290,7 @@ func (s *Server) postDropboxUpload(path string) http.HandlerFunc {
 		}
 		log.Printf("%s %s: ct %q: accepted\n", r.Method, r.URL.Path, r.Header.Get("Content-Type"))
 
-		// fetch the session and get the current user. if either fails, return an error
-		user, err := s.extractSession(r)
-		if err != nil && !errors.Is(err, sql.ErrNoRows) {
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
-		} else if user == nil {
-			// there is no active session, so this is an error
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-			return
-		}
+		user := userFromRequest(r)
 
 		// verify that we have an input directory for the clan
 		inputPath := filepath.Join(user.Data, "input")
@@ -446,6 +356,164 @@ func (s *Server) postDropboxUpload(path string) http.HandlerFunc {
 	}
 }
 
+// dropboxReport_t is a report file name that passed validation.
+type dropboxReport_t struct {
+	TurnId     string // YYYY-MM
+	ClanId     string // always 4 digits
+	ReportId   string // YYYY-MM.CLAN
+	FileName   string // normalized file name
+	IsTextFile bool
+	IsWordFile bool
+}
+
+var rxDropboxReports = regexp.MustCompile(`^([0-9]+)-([0-9]+)\.([0-9]+)\.report\.(docx|txt)$`)
+
+// parseDropboxFileName validates the name of a file sent to the dropbox.
+// The name must match the YYYY-MM.CLAN.report.ext pattern, but I got talked into
+// allowing for three digit years, so we must normalize both the year and month.
+// The error messages are meant to be shown to the user.
+func parseDropboxFileName(name string) (dropboxReport_t, error) {
+	matches := rxDropboxReports.FindStringSubmatch(name)
+	if len(matches) != 5 {
+		return dropboxReport_t{}, errors.New("The file name must match YEAR-MONTH.CLAN.report and have an extension of .txt or .docx.")
+	}
+	year, err := strconv.Atoi(matches[1])
+	if err != nil {
+		return dropboxReport_t{}, errors.New("The file name must include a numeric YEAR.")
+	} else if year < 899 || year > 1234 {
+		return dropboxReport_t{}, errors.New("The YEAR in the file must be between 899 and 1234.")
+	}
+	month, err := strconv.Atoi(matches[2])
+	if err != nil {
+		return dropboxReport_t{}, errors.New("The file name must include a numeric MONTH.")
+	} else if month < 1 || month > 12 {
+		return dropboxReport_t{}, errors.New("The MONTH in the file name must be between 1 and 12.")
+	}
+	clanNo, err := strconv.Atoi(matches[3])
+	if err != nil {
+		return dropboxReport_t{}, errors.New("The file name must include a numeric CLAN.")
+	} else if clanNo < 1 || clanNo > 999 {
+		return dropboxReport_t{}, errors.New("The CLAN in the file name must be between 1 and 999.")
+	}
+	ext := matches[4]
+	report := dropboxReport_t{
+		TurnId:     fmt.Sprintf("%04d-%02d", year, month),
+		ClanId:     fmt.Sprintf("%04d", clanNo),
+		IsTextFile: ext == "txt",
+		IsWordFile: ext == "docx",
+	}
+	report.ReportId = fmt.Sprintf("%s.%s", report.TurnId, report.ClanId)
+	report.FileName = fmt.Sprintf("%s.report.%s", report.ReportId, ext)
+	return report, nil
+}
+
+// scrubDropboxReport parses the report into sections and returns the scrubbed report text.
+// The character encoding of text files is repaired before parsing. Word documents are
+// always UTF-8, but they are full of typographic punctuation, so their scrubbed text
+// is repaired after parsing.
+func scrubDropboxReport(user *domains.User_t, report dropboxReport_t, serverVersion string, data []byte) ([]byte, charset.Summary_t, error) {
+	var summary charset.Summary_t
+	if report.IsTextFile {
+		data, summary = replaceInvalidUTF8(data)
+	}
+
+	// parse the report text into sections
+	sections, err := tndocx.ParseSections(data)
+	if err != nil {
+		return nil, summary, err
+	}
+	// the file name was checked by the caller, but the units in the report must match, too
+	for _, section := range sections {
+		if unitId, ok := validator.UnitId(section.Header); ok {
+			if reason := checkReportClan(user, unitId); reason != "" {
+				return nil, summary, dropboxReportError(reason)
+			}
+		}
+	}
+
+	// create a scrubbed file from the sections
+	scrubbedData := &bytes.Buffer{}
+	if report.IsTextFile {
+		scrubbedData.WriteString(fmt.Sprintf("// text file %q\n", report.FileName))
+	} else if report.IsWordFile {
+		scrubbedData.WriteString(fmt.Sprintf("// word file %q\n", report.FileName))
+	}
+	metaTimestamp := time.Now().In(user.LanguageAndDates.Timezone.Location)
+	scrubbedData.WriteString(fmt.Sprintf("// submitted by user %s at %s\n", user.Clan, metaTimestamp.Format("2006-01-02 15:04:05")))
+	scrubbedData.WriteString(fmt.Sprintf("// ottoapp v%s\n", serverVersion))
+	scrubbedData.WriteString(fmt.Sprintf("// tndocx  v%s\n", tndocx.Version()))
+	// stuff the section back in
+	for _, section := range sections {
+		scrubbedData.WriteString(fmt.Sprintf("\n// section %d\n", section.Id))
+		if len(section.Header) == 0 {
+			scrubbedData.WriteString("// missing element header")
+		} else {
+			scrubbedData.Write(section.Header)
+		}
+		scrubbedData.WriteByte('\n')
+		if len(section.Turn) == 0 {
+			scrubbedData.WriteString("// missing turn header")
+		} else {
+			scrubbedData.Write(section.Turn)
+		}
+		scrubbedData.WriteByte('\n')
+		if len(section.Moves.Movement) != 0 {
+			scrubbedData.Write(section.Moves.Movement)
+			scrubbedData.WriteByte('\n')
+		}
+		if len(section.Moves.Follows) != 0 {
+			scrubbedData.Write(section.Moves.Fleet)
+			scrubbedData.WriteByte('\n')
+		}
+		if len(section.Moves.GoesTo) != 0 {
+			scrubbedData.Write(section.Moves.GoesTo)
+			scrubbedData.WriteByte('\n')
+		}
+		if len(section.Moves.Fleet) != 0 {
+			scrubbedData.Write(section.Moves.Fleet)
+			scrubbedData.WriteByte('\n')
+		}
+		for _, scout := range section.Moves.Scouts {
+			scrubbedData.Write(scout)
+			scrubbedData.WriteByte('\n')
+		}
+		if len(section.Status) == 0 {
+			scrubbedData.WriteString("// missing element status")
+		} else {
+			scrubbedData.Write(section.Status)
+		}
+		scrubbedData.WriteByte('\n')
+	}
+
+	if report.IsWordFile {
+		repaired, wordSummary := replaceInvalidUTF8(scrubbedData.Bytes())
+		summary.Add(wordSummary)
+		return repaired, summary, nil
+	}
+	return scrubbedData.Bytes(), summary, nil
+}
+
+// dropboxReportError is an error in the report that is shown to the user as is.
+type dropboxReportError string
+
+func (e dropboxReportError) Error() string {
+	return string(e)
+}
+
+// dropboxParseReason returns the message to show the user for errors from tndocx
+// and scrubDropboxReport. It returns false if the error is not one that the user can fix.
+func dropboxParseReason(err error) (string, bool) {
+	var reportError dropboxReportError
+	if errors.As(err, &reportError) {
+		return string(reportError), true
+	} else if errors.Is(err, tndocx.ErrEmptyInput) {
+		return "We could not find any lines in the file.", true
+	} else if errors.Is(err, tndocx.ErrUnknownFormat) {
+		return "We could not find any report sections in the report text.", true
+	}
+	return "", false
+}
+
 func containsNonASCII(b []byte) bool {
 	var line []byte
 	for _, ch := range b {
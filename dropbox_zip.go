@@ -0,0 +1,340 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/mdhender/ottoapp/components/app/pages/reports/uploads/dropbox"
+	"github.com/mdhender/ottoapp/components/app/widgets"
+	"github.com/mdhender/ottoapp/domains"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// limits for zip archives. the entry limit matches the limit for a single upload.
+// the ratio limit catches zip bombs before we inflate them; the size limits catch
+// archives that lie about their sizes.
+const (
+	maxZipArchiveSize = 10 << 20 // largest archive we accept
+	maxZipEntries     = 250      // most entries we will look at
+	maxZipEntrySize   = 1 << 20  // largest report we will inflate
+	maxZipTotalSize   = 50 << 20 // most bytes we will inflate from one archive
+	maxZipRatio       = 100      // largest uncompressed to compressed ratio
+)
+
+const (
+	zipAccepted  = "accepted"
+	zipRejected  = "rejected"
+	zipDuplicate = "duplicate"
+)
+
+// postDropboxZip accepts a zip archive of turn reports. Each entry goes through the
+// same file name validation and scrubbing as a single file dropped on the dropbox.
+// The response lists the result for every entry in the archive.
+//
+// HTMX requests get the results table as a fragment; other clients get JSON.
+func (s *Server) postDropboxZip(path string, serverVersion string) http.HandlerFunc {
+	files := []string{
+		filepath.Join(path, "app", "pages", "reports", "uploads", "dropbox", "content.gohtml"),
+		filepath.Join(path, "app", "widgets", "notifications.gohtml"),
+	}
+	s.templates.register(files...)
+
+	const fieldName = "report-zip-input"
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		log.Printf("%s %s: entered\n", r.Method, r.URL.Path)
+
+		if r.Method != "POST" {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		} else if contentType := r.Header.Get("Content-Type"); !(contentType == "multipart/form-data" || strings.HasPrefix(contentType, "multipart/form-data;")) {
+			log.Printf("%s %s: ct %q\n", r.Method, r.URL.Path, contentType)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		isHtmx := r.Header.Get("HX-Request") == "true"
+
+		user := userFromRequest(r)
+
+		// fail reports a problem with the archive as a whole
+		fail := func(title, message string) {
+			log.Printf("%s %s: %s: %s\n", r.Method, r.URL.Path, user.Clan, message)
+			if !isHtmx {
+				buf, _ := json.MarshalIndent(struct {
+					Success bool   `json:"success"`
+					Reason  string `json:"reason"`
+				}{Reason: message}, "", "  ")
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write(buf)
+				return
+			}
+			alertFragment, err := s.renderFragment(widgets.NotificationPanel_t{
+				OOB: true,
+				Notifications: []widgets.Notification_t{{
+					Title:   title,
+					Message: message,
+				}},
+			}, "notifications-panel", files...)
+			if err != nil {
+				return
+			}
+			_, _ = s.writeFragments(w, r, alertFragment)
+		}
+
+		// verify that we have an input directory for the clan
+		inputPath := filepath.Join(user.Data, "input")
+		if sb, err := os.Stat(inputPath); err != nil {
+			fail("Account error", "Your account has not been set up correctly. Please let the administrator know that your input directory is missing.")
+			return
+		} else if !sb.IsDir() {
+			fail("Account error", "Your account has not been set up correctly. Please let the administrator know that your input directory is not a folder.")
+			return
+		}
+
+		// limit the size of the request, allowing a little extra for the multipart encoding.
+		// anything over 1mb is spooled to a temporary file by the multipart reader.
+		r.Body = http.MaxBytesReader(w, r.Body, maxZipArchiveSize+(64<<10))
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			fail("Upload failed", fmt.Sprintf("The archive upload failed. The archive exceeds the size limit of %dmb.", maxZipArchiveSize>>20))
+			return
+		} else if n := len(r.MultipartForm.File[fieldName]); n == 0 {
+			fail("Upload failed", "The archive upload failed. The request did not include a named file.")
+			return
+		} else if n > 1 {
+			fail("Upload failed", "The archive upload failed. The request included multiple files.")
+			return
+		}
+		file, handler, err := r.FormFile(fieldName)
+		if err != nil {
+			id := uuid.NewString()
+			log.Printf("%s %s: parsing form: %v (%s)\n", r.Method, r.URL.Path, err, id)
+			fail("Upload failed", fmt.Sprintf("The archive upload failed. The archive could not be extracted from the request. Please report error %q", id[len(id)-8:]))
+			return
+		}
+		defer func() {
+			_ = file.Close()
+		}()
+
+		zr, err := zip.NewReader(file, handler.Size)
+		if err != nil {
+			fail("Upload failed", "The archive upload failed. The file is not a zip archive.")
+			return
+		} else if len(zr.File) > maxZipEntries {
+			fail("Upload failed", fmt.Sprintf("The archive upload failed. The archive has %d entries, but the limit is %d.", len(zr.File), maxZipEntries))
+			return
+		}
+
+		results := dropbox.ZipResults_t{Archive: handler.Filename}
+		seenChecksums, seenReports := map[string]bool{}, map[string]bool{}
+		var totalSize int64
+		var latestTurnId string
+		for _, f := range zr.File {
+			// folders and the resource forks that macOS adds to archives are not entries
+			if f.FileInfo().IsDir() || strings.HasPrefix(f.Name, "__MACOSX/") {
+				continue
+			}
+			entry := s.unpackZipEntry(r, user, handler.Filename, f, inputPath, serverVersion, &totalSize, seenChecksums, seenReports)
+			switch entry.Status {
+			case zipAccepted:
+				results.Accepted++
+				if turnId := entry.ReportId[:7]; turnId > latestTurnId {
+					latestTurnId = turnId
+				}
+			case zipDuplicate:
+				results.Duplicates++
+			default:
+				results.Rejected++
+			}
+			results.Entries = append(results.Entries, entry)
+		}
+		log.Printf("%s %s: %s: %q: accepted %d: rejected %d: duplicates %d in %v\n", r.Method, r.URL.Path, user.Clan, handler.Filename, results.Accepted, results.Rejected, results.Duplicates, time.Since(started))
+
+		// the render uses every report up to the turn, so we only need to queue the latest one
+		if latestTurnId != "" {
+			s.queueRender(user, latestTurnId)
+		}
+
+		if !isHtmx {
+			if results.Entries == nil {
+				results.Entries = []dropbox.ZipEntry_t{}
+			}
+			buf, _ := json.MarshalIndent(struct {
+				Success    bool                 `json:"success"`
+				Archive    string               `json:"archive"`
+				Accepted   int                  `json:"accepted"`
+				Rejected   int                  `json:"rejected"`
+				Duplicates int                  `json:"duplicates"`
+				Entries    []dropbox.ZipEntry_t `json:"entries"`
+			}{
+				Success:    true,
+				Archive:    results.Archive,
+				Accepted:   results.Accepted,
+				Rejected:   results.Rejected,
+				Duplicates: results.Duplicates,
+				Entries:    results.Entries,
+			}, "", "  ")
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write(buf)
+			return
+		}
+
+		resultsFragment, err := s.renderFragment(results, "zip-results", files...)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		_, _ = s.writeFragments(w, r, resultsFragment)
+	}
+}
+
+// unpackZipEntry validates, scrubs, and saves a single entry from the archive.
+// Every entry is recorded in the upload history, including rejected ones.
+func (s *Server) unpackZipEntry(r *http.Request, user *domains.User_t, archive string, f *zip.File, inputPath, serverVersion string, totalSize *int64, seenChecksums, seenReports map[string]bool) dropbox.ZipEntry_t {
+	entry := dropbox.ZipEntry_t{Name: f.Name}
+
+	upload := newUpload(user, domains.UploadZip)
+	upload.FileName = archive + "/" + f.Name
+	defer s.recordUpload(r, upload)
+	reject := func(status, reason string) dropbox.ZipEntry_t {
+		entry.Status, entry.Reason = status, reason
+		upload.Reason = reason
+		return entry
+	}
+
+	// we never use the entry name to create files, but we reject unsafe names
+	// so that a malicious archive can't sneak one past a later change.
+	if !isSafeZipName(f.Name) {
+		return reject(zipRejected, "The entry has an unsafe path.")
+	}
+
+	report, err := parseDropboxFileName(path.Base(f.Name))
+	if err != nil {
+		return reject(zipRejected, err.Error())
+	}
+	entry.ReportId, upload.TurnId = report.ReportId, report.TurnId
+	if reason := checkReportClan(user, report.ClanId); reason != "" {
+		return reject(zipRejected, reason)
+	}
+
+	if reason := checkZipEntry(f, *totalSize); reason != "" {
+		return reject(zipRejected, reason)
+	}
+	data, reason := readZipEntry(f)
+	if reason != "" {
+		return reject(zipRejected, reason)
+	}
+	*totalSize += int64(len(data))
+	setUploadData(upload, data)
+
+	if seenChecksums[upload.Checksum] {
+		return reject(zipDuplicate, "Another entry in the archive has the same contents.")
+	} else if seenReports[report.ReportId] {
+		return reject(zipDuplicate, "Another entry in the archive is for the same turn and clan.")
+	}
+	seenChecksums[upload.Checksum], seenReports[report.ReportId] = true, true
+
+	scrubbedData, summary, err := scrubDropboxReport(user, report, serverVersion, data)
+	upload.Changes = summary.Changes()
+	if err != nil {
+		if reason, ok := dropboxParseReason(err); ok {
+			return reject(zipRejected, reason)
+		}
+		log.Printf("dropbox: zip: %s: %q: parse sections: %v\n", user.Clan, f.Name, err)
+		return reject(zipRejected, "We could not parse the report text.")
+	}
+
+	// only the current report matters, so an older copy may be uploaded again to replace it
+	scrubbedPath := filepath.Join(inputPath, fmt.Sprintf("%s.scrubbed.txt", report.ReportId))
+	if isCurrentScrubbedReport(scrubbedPath, scrubbedData) {
+		return reject(zipDuplicate, "This report is the same as the one already saved for this turn.")
+	}
+	if err := os.WriteFile(scrubbedPath, scrubbedData, 0644); err != nil {
+		id := uuid.NewString()
+		log.Printf("dropbox: zip: %s: writing scrubbed file: %v (%s)\n", user.Clan, err, id)
+		return reject(zipRejected, fmt.Sprintf("The server encountered an error while saving the report. Please report error %q.", id[len(id)-8:]))
+	}
+
+	upload.Succeeded = true
+	s.recordDueDate(user, report.TurnId, scrubbedData)
+	entry.Status, entry.Changes = zipAccepted, upload.Changes
+	return entry
+}
+
+// isCurrentScrubbedReport returns true if the scrubbed report has the same sections as the
+// report already saved at path. The comments before the first section are ignored because
+// they include the time of the upload.
+func isCurrentScrubbedReport(path string, scrubbedData []byte) bool {
+	current, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	sections := func(data []byte) []byte {
+		if n := bytes.Index(data, []byte("\n// section ")); n != -1 {
+			return data[n:]
+		}
+		return data
+	}
+	return bytes.Equal(sections(current), sections(scrubbedData))
+}
+
+// checkZipEntry checks the sizes in the entry header before anything is inflated.
+// totalSize is the number of bytes already inflated from the archive.
+// Returns the reason to reject the entry, or an empty string if it may be read.
+func checkZipEntry(f *zip.File, totalSize int64) string {
+	if f.UncompressedSize64 > maxZipEntrySize {
+		return fmt.Sprintf("The entry exceeds the size limit of %dmb.", maxZipEntrySize>>20)
+	} else if f.CompressedSize64 != 0 && f.UncompressedSize64/f.CompressedSize64 > maxZipRatio {
+		return "The entry is compressed too well to be a turn report."
+	} else if totalSize+int64(f.UncompressedSize64) > maxZipTotalSize {
+		return fmt.Sprintf("The archive exceeds the limit of %dmb of uncompressed reports.", maxZipTotalSize>>20)
+	}
+	return ""
+}
+
+// readZipEntry inflates the entry. The header may lie, so it never reads more than the limit.
+// Returns the reason to reject the entry if it can't be read.
+func readZipEntry(f *zip.File) ([]byte, string) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, "The entry could not be read from the archive."
+	}
+	data, err := io.ReadAll(io.LimitReader(rc, maxZipEntrySize+1))
+	_ = rc.Close()
+	if err != nil {
+		return nil, "The entry could not be read from the archive."
+	} else if len(data) > maxZipEntrySize {
+		return nil, fmt.Sprintf("The entry exceeds the size limit of %dmb.", maxZipEntrySize>>20)
+	} else if len(data) == 0 {
+		return nil, "The entry is empty."
+	}
+	return data, ""
+}
+
+// isSafeZipName returns false for entry names that could escape a folder if they were
+// ever used to create files: absolute paths, parent references, drive letters, and
+// Windows separators.
+func isSafeZipName(name string) bool {
+	if name == "" || strings.ContainsAny(name, "\\:\x00") || path.IsAbs(name) {
+		return false
+	}
+	for _, element := range strings.Split(name, "/") {
+		if element == ".." {
+			return false
+		}
+	}
+	return true
+}
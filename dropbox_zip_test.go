@@ -0,0 +1,318 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/mdhender/ottoapp/domains"
+	"github.com/mdhender/ottoapp/stores/sqlite"
+	"hash/crc32"
+	"math/rand"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIsSafeZipName(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		want bool
+	}{
+		{"0901-04.0138.report.txt", true},
+		{"reports/0901-04.0138.report.txt", true},
+		{"reports/2024/0901-04.0138.report.txt", true},
+		{"reports..old/0901-04.0138.report.txt", true},
+		{"", false},
+		{"../0901-04.0138.report.txt", false},
+		{"reports/../../0901-04.0138.report.txt", false},
+		{"reports/..", false},
+		{"/etc/0901-04.0138.report.txt", false},
+		{"C:/0901-04.0138.report.txt", false},
+		{"reports\\0901-04.0138.report.txt", false},
+		{"..\\0901-04.0138.report.txt", false},
+		{"0901-04.0138.report.txt\x00.docx", false},
+	} {
+		if got := isSafeZipName(tc.name); got != tc.want {
+			t.Errorf("%q: want %v, got %v", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestCheckZipEntry(t *testing.T) {
+	for _, tc := range []struct {
+		name             string
+		compressed       uint64
+		uncompressed     uint64
+		totalSize        int64
+		wantRejectReason string // empty if the entry may be read
+	}{
+		{"small", 400, 1000, 0, ""},
+		{"stored", 1000, 1000, 0, ""},
+		{"at entry limit", maxZipEntrySize / 2, maxZipEntrySize, 0, ""},
+		{"over entry limit", maxZipEntrySize / 2, maxZipEntrySize + 1, 0, "size limit of 1mb"},
+		{"at ratio limit", 10, 10 * maxZipRatio, 0, ""},
+		{"over ratio limit", 10, 10*maxZipRatio + 10, 0, "compressed too well"},
+		{"unknown compressed size", 0, 1000, 0, ""},
+		{"at total limit", 400, 1000, maxZipTotalSize - 1000, ""},
+		{"over total limit", 400, 1000, maxZipTotalSize - 999, "limit of 50mb of uncompressed"},
+	} {
+		f := &zip.File{FileHeader: zip.FileHeader{
+			Name:               "0901-04.0138.report.txt",
+			CompressedSize64:   tc.compressed,
+			UncompressedSize64: tc.uncompressed,
+		}}
+		got := checkZipEntry(f, tc.totalSize)
+		if tc.wantRejectReason == "" && got != "" {
+			t.Errorf("%s: want accepted, got %q", tc.name, got)
+		} else if !strings.Contains(got, tc.wantRejectReason) {
+			t.Errorf("%s: want %q, got %q", tc.name, tc.wantRejectReason, got)
+		}
+	}
+}
+
+func TestReadZipEntry(t *testing.T) {
+	report := []byte("Tribe 0138, , Current Hex = QQ 1234, (Previous Hex = QQ 1234)\n")
+
+	for _, tc := range []struct {
+		name             string
+		entry            testZipEntry_t
+		wantRejectReason string // empty if the entry is read
+	}{
+		{"deflated", testZipEntry_t{data: report}, ""},
+		{"stored", testZipEntry_t{data: report, stored: true}, ""},
+		{"at entry limit", testZipEntry_t{data: randomText(maxZipEntrySize)}, ""},
+		{"empty", testZipEntry_t{}, "is empty"},
+		// the header claims 100 bytes but the entry inflates to more than the limit
+		{"lying header", testZipEntry_t{data: randomText(maxZipEntrySize + 1), size: 100}, "could not be read"},
+		// the header claims the limit but the entry inflates to more than the limit
+		{"lying header at limit", testZipEntry_t{data: randomText(maxZipEntrySize + 1), size: maxZipEntrySize}, "could not be read"},
+		{"corrupt", testZipEntry_t{data: report, corrupt: true}, "could not be read"},
+	} {
+		zr := readTestZip(t, buildTestZip(t, tc.entry))
+		data, got := readZipEntry(zr.File[0])
+		if tc.wantRejectReason == "" {
+			if got != "" {
+				t.Errorf("%s: want accepted, got %q", tc.name, got)
+			} else if !bytes.Equal(data, tc.entry.data) {
+				t.Errorf("%s: data does not match", tc.name)
+			}
+		} else if got == "" || !strings.Contains(got, tc.wantRejectReason) {
+			t.Errorf("%s: want %q, got %q", tc.name, tc.wantRejectReason, got)
+		}
+	}
+}
+
+func TestZipBomb(t *testing.T) {
+	// a megabyte of one letter inflates from about a kilobyte
+	zr := readTestZip(t, buildTestZip(t, testZipEntry_t{data: bytes.Repeat([]byte{'a'}, maxZipEntrySize)}))
+	if got := checkZipEntry(zr.File[0], 0); !strings.Contains(got, "compressed too well") {
+		t.Errorf("want rejected for ratio, got %q", got)
+	}
+}
+
+func TestPostDropboxZipArchiveLimits(t *testing.T) {
+	manyEntries := make([]testZipEntry_t, maxZipEntries+1)
+	for i := range manyEntries {
+		manyEntries[i] = testZipEntry_t{data: []byte("x"), stored: true}
+	}
+
+	for _, tc := range []struct {
+		name             string
+		field            string
+		body             []byte
+		wantRejectReason string
+	}{
+		{"missing file", "some-other-input", buildTestZip(t, testZipEntry_t{data: []byte("x")}), "did not include a named file"},
+		{"not a zip", "report-zip-input", []byte("Tribe 0138, , Current Hex = QQ 1234\n"), "not a zip archive"},
+		{"too many entries", "report-zip-input", buildTestZip(t, manyEntries...), "has 251 entries, but the limit is 250"},
+		{"too large", "report-zip-input", randomText(maxZipArchiveSize + (64 << 10)), "size limit of 10mb"},
+	} {
+		s := &Server{templates: newTemplateRegistry(nil, "")}
+		user := &domains.User_t{Clan: "0138", Data: t.TempDir()}
+		if err := os.MkdirAll(filepath.Join(user.Data, "input"), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		body := &bytes.Buffer{}
+		mw := multipart.NewWriter(body)
+		if fw, err := mw.CreateFormFile(tc.field, "reports.zip"); err != nil {
+			t.Fatal(err)
+		} else if _, err := fw.Write(tc.body); err != nil {
+			t.Fatal(err)
+		} else if err := mw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		r := httptest.NewRequest("POST", "/dropbox/zip", body)
+		r.Header.Set("Content-Type", mw.FormDataContentType())
+		r = r.WithContext(context.WithValue(r.Context(), contextKeyUser, user))
+		w := httptest.NewRecorder()
+
+		s.postDropboxZip("components", "test")(w, r)
+		if r.MultipartForm != nil {
+			_ = r.MultipartForm.RemoveAll()
+		}
+
+		var response struct {
+			Success bool   `json:"success"`
+			Reason  string `json:"reason"`
+		}
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: want status %d, got %d", tc.name, http.StatusBadRequest, w.Code)
+		} else if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Errorf("%s: response: %v", tc.name, err)
+		} else if response.Success || !strings.Contains(response.Reason, tc.wantRejectReason) {
+			t.Errorf("%s: want %q, got %q", tc.name, tc.wantRejectReason, response.Reason)
+		}
+	}
+}
+
+func TestUnpackZipEntry(t *testing.T) {
+	path, ctx := t.TempDir(), context.Background()
+	dbPath := filepath.Join(path, "test.db")
+	if err := sqlite.Create(dbPath, false, "", "", path, "admin-secret", "", ctx); err != nil {
+		t.Fatal(err)
+	}
+	store, err := sqlite.Open(dbPath, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	created, err := store.CreateUser("clan0138@ottomap", "a-long-password", "0138", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := store.GetUser(created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputPath := filepath.Join(user.Data, "input")
+	if err := os.MkdirAll(inputPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{}
+	s.stores.store = store
+
+	report := func(unitId, move string) []byte {
+		return []byte("Tribe " + unitId + ", , Current Hex = QQ 1234, (Previous Hex = QQ 1234)\n" +
+			"Current Turn 901-04 (#40), Spring, FINE\tNext Turn 901-05 (#41), 12/10/2024\n" +
+			"Tribe Movement: Move " + move + "\n" +
+			unitId + " Status: PRAIRIE, River S\n")
+	}
+
+	// the entries share the input folder, so each case depends on the ones before it
+	for _, tc := range []struct {
+		name   string
+		file   string
+		data   []byte
+		status string
+		reason string
+	}{
+		{"accepted", "0901-04.0138.report.txt", report("0138", "NE-GH"), zipAccepted, ""},
+		{"same as current", "0901-04.0138.report.txt", report("0138", "NE-GH"), zipDuplicate, "same as the one already saved"},
+		{"changed", "0901-04.0138.report.txt", report("0138", "N-PR"), zipAccepted, ""},
+		{"older copy", "0901-04.0138.report.txt", report("0138", "NE-GH"), zipAccepted, ""},
+		{"tribe of the clan", "0901-04.0138.report.txt", report("1138", "NE-GH"), zipAccepted, ""},
+		{"other clan file name", "0901-04.0200.report.txt", report("0200", "NE-GH"), zipRejected, "for clan 0200"},
+		{"other clan units", "0901-04.0138.report.txt", report("0200", "N-PR"), zipRejected, "for clan 0200"},
+	} {
+		zr := readTestZip(t, buildTestZip(t, testZipEntry_t{name: tc.file, data: tc.data}))
+		r := httptest.NewRequest("POST", "/dropbox/zip", nil)
+		var totalSize int64
+		entry := s.unpackZipEntry(r, user, "reports.zip", zr.File[0], inputPath, "test", &totalSize, map[string]bool{}, map[string]bool{})
+		if entry.Status != tc.status || !strings.Contains(entry.Reason, tc.reason) {
+			t.Errorf("%s: want %s %q, got %s %q", tc.name, tc.status, tc.reason, entry.Status, entry.Reason)
+		}
+	}
+}
+
+// testZipEntry_t is an entry for buildTestZip.
+type testZipEntry_t struct {
+	name    string // defaults to a valid report name
+	data    []byte
+	stored  bool   // if true, the data is not compressed
+	size    uint64 // uncompressed size to put in the header if not zero
+	corrupt bool   // if true, the compressed data is damaged
+}
+
+// buildTestZip returns an archive with the entries. The entries are written raw
+// so that the header can lie about the size of the data.
+func buildTestZip(t *testing.T, entries ...testZipEntry_t) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	for i, entry := range entries {
+		if entry.name == "" {
+			entry.name = "0901-04.0138.report.txt"
+			if i != 0 {
+				entry.name = fmt.Sprintf("%03d/%s", i, entry.name)
+			}
+		}
+		method, compressed := zip.Store, entry.data
+		if !entry.stored {
+			method = zip.Deflate
+			cbuf := &bytes.Buffer{}
+			fw, err := flate.NewWriter(cbuf, flate.BestCompression)
+			if err != nil {
+				t.Fatal(err)
+			} else if _, err := fw.Write(entry.data); err != nil {
+				t.Fatal(err)
+			} else if err := fw.Close(); err != nil {
+				t.Fatal(err)
+			}
+			compressed = cbuf.Bytes()
+		}
+		if entry.corrupt {
+			compressed = append([]byte{0xFF, 0xFF, 0xFF}, compressed...)
+		}
+		size := uint64(len(entry.data))
+		if entry.size != 0 {
+			size = entry.size
+		}
+		w, err := zw.CreateRaw(&zip.FileHeader{
+			Name:               entry.name,
+			Method:             method,
+			CRC32:              crc32.ChecksumIEEE(entry.data),
+			CompressedSize64:   uint64(len(compressed)),
+			UncompressedSize64: size,
+		})
+		if err != nil {
+			t.Fatal(err)
+		} else if _, err := w.Write(compressed); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func readTestZip(t *testing.T, data []byte) *zip.Reader {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return zr
+}
+
+// randomText returns n bytes of letters and spaces that don't compress well.
+func randomText(n int) []byte {
+	rng := rand.New(rand.NewSource(int64(n)))
+	const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789 ,.-"
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = letters[rng.Intn(len(letters))]
+	}
+	return data
+}
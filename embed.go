@@ -0,0 +1,47 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"embed"
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// The assets and components are embedded so that the server can run from a single binary.
+// The server table can name an override directory for either tree. Files in the
+// override directory win over the embedded copies, so a site can customize a page
+// or a stylesheet without rebuilding.
+
+//go:embed assets
+var embeddedAssets embed.FS
+
+//go:embed components
+var embeddedComponents embed.FS
+
+// overlayFS returns files from the first file system that has them.
+type overlayFS []fs.FS
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	for _, fsys := range o[:len(o)-1] {
+		if fp, err := fsys.Open(name); err == nil {
+			return fp, nil
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return o[len(o)-1].Open(name)
+}
+
+// newOverlayFS returns the embedded tree with the override directory on top of it.
+// If override is empty, it returns just the embedded tree.
+func newOverlayFS(override string, embedded embed.FS, dir string) (fs.FS, error) {
+	sub, err := fs.Sub(embedded, dir)
+	if err != nil {
+		return nil, err
+	} else if override == "" {
+		return sub, nil
+	}
+	return overlayFS{os.DirFS(override), sub}, nil
+}
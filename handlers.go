@@ -4,15 +4,14 @@ package main
 
 import (
 	"bytes"
-	"database/sql"
 	"encoding/json"
-	"errors"
 	"fmt"
+	"github.com/mdhender/ottoapp/charset"
 	"github.com/mdhender/ottoapp/components/app"
-	"github.com/mdhender/ottoapp/components/app/pages/calendar"
 	"github.com/mdhender/ottoapp/components/app/pages/dashboard"
 	"github.com/mdhender/ottoapp/components/app/pages/reports"
-	"github.com/mdhender/ottoapp/components/app/pages/reports/failed"
+	"github.com/mdhender/ottoapp/components/app/pages/reports/history"
+	"github.com/mdhender/ottoapp/components/app/pages/reports/success"
 	"github.com/mdhender/ottoapp/components/app/pages/reports/uploads"
 	"github.com/mdhender/ottoapp/components/app/pages/settings"
 	"github.com/mdhender/ottoapp/components/app/pages/settings/general"
@@ -20,10 +19,12 @@ import (
 	"github.com/mdhender/ottoapp/components/hero"
 	"github.com/mdhender/ottoapp/components/pages"
 	"github.com/mdhender/ottoapp/domains"
-	"html/template"
+	"github.com/mdhender/ottoapp/validator"
 	"io"
+	"io/fs"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -54,18 +55,10 @@ func (s *Server) getApiClanFilesV1(path string) http.HandlerFunc {
 			log.Printf("%s %s: wrote %d bytes in %s\n", r.Method, r.URL.Path, bytesWritten, time.Since(started))
 		}()
 
-		user, err := s.extractSession(r)
-		if err != nil {
-			log.Printf("%s %s: extractSession: %v\n", r.Method, r.URL.Path, err)
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
-		} else if user == nil {
-			// there is no active session, so this is an error
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-			return
-		} else if clanId := r.PathValue("clan_id"); clanId != user.Clan {
+		user := userFromRequest(r)
+		if clanId := r.PathValue("clan_id"); clanId != user.Clan {
 			// do not let users request other clan's data
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			authError(w, r, http.StatusForbidden)
 			return
 		}
 
@@ -96,17 +89,6 @@ func (s *Server) getApiPathsV1() http.HandlerFunc {
 			log.Printf("%s %s: wrote %d bytes in %s\n", r.Method, r.URL.Path, bytesWritten, time.Since(started))
 		}()
 
-		user, err := s.extractSession(r)
-		if err != nil {
-			log.Printf("%s %s: extractSession: %v\n", r.Method, r.URL.Path, err)
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
-		} else if user == nil {
-			// there is no active session, so this is an error
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-			return
-		}
-
 		response := struct {
 			Assets     string `json:"assets"`
 			Components string `json:"components"`
@@ -150,17 +132,7 @@ func (s *Server) postApiReportUploadFile(userdata string) http.HandlerFunc {
 		}
 		log.Printf("%s %s: ct accepted\n", r.Method, r.URL.Path)
 
-		// fetch the session and get the current user. if either fails, return an error
-		user, err := s.extractSession(r)
-		if err != nil && !errors.Is(err, sql.ErrNoRows) {
-			log.Printf("%s %s: extractSession: %v\n", r.Method, r.URL.Path, err)
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
-		} else if user == nil {
-			// there is no active session, so this is an error
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-			return
-		}
+		user := userFromRequest(r)
 		log.Printf("%s %s: session: clan_id %q\n", r.Method, r.URL.Path, user.Clan)
 
 		// check for the remove-bad-bytes and remove-sensitive-lines parameter in the form data
@@ -169,9 +141,13 @@ func (s *Server) postApiReportUploadFile(userdata string) http.HandlerFunc {
 		removeSensitiveLines := cbIsSet(r.FormValue("remove-sensitive-lines"))
 		log.Printf("%s %s: removeSensitiveLines %v\n", r.Method, r.URL.Path, removeSensitiveLines)
 
+		upload := newUpload(user, domains.UploadFile, scrubOptions(removeBadBytes, removeSensitiveLines)...)
+		defer s.recordUpload(r, upload)
+
 		// parse the form data, limiting the size to 1MB
 		if err := r.ParseMultipartForm(1 << 20); err != nil {
 			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			upload.Reason = "form data could not be parsed"
 			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 			return
 		}
@@ -179,6 +155,7 @@ func (s *Server) postApiReportUploadFile(userdata string) http.HandlerFunc {
 		// it is an error to upload multiple files
 		if n := len(r.MultipartForm.File[fieldName]); n != 1 {
 			log.Printf("%s %s: files %d\n", r.Method, r.URL.Path, n)
+			upload.Reason = fmt.Sprintf("expected 1 file, got %d", n)
 			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 			return
 		}
@@ -187,61 +164,80 @@ func (s *Server) postApiReportUploadFile(userdata string) http.HandlerFunc {
 		file, handler, err := r.FormFile(fieldName)
 		if err != nil {
 			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			upload.Reason = "file missing from form data"
 			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 			return
 		}
 		defer file.Close()
+		upload.FileName = handler.Filename
 
 		// ensure the uploaded file has the correct suffix
 		log.Printf("%s %s: filename %q\n", r.Method, r.URL.Path, handler.Filename)
 		if !strings.HasSuffix(handler.Filename, ".report.txt") {
 			log.Printf("%s %s: suffix %q\n", r.Method, r.URL.Path, handler.Filename)
+			upload.Reason = "file name must end with .report.txt"
 			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 			return
 		}
 		var fileName string
 		if matches := rxTurnReports.FindStringSubmatch(handler.Filename); len(matches) != 4 {
 			log.Printf("%s %s: matches %d\n", r.Method, r.URL.Path, len(matches))
+			upload.Reason = "file name must match YEAR-MONTH.CLAN.report.txt"
 			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 			return
 		} else {
 			var year, month, clanId int
 			if year, err = strconv.Atoi(matches[1]); err != nil {
 				log.Printf("%s %s: year %v\n", r.Method, r.URL.Path, err)
+				upload.Reason = "turn year is invalid"
 				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 				return
 			} else if year < 899 || year > 1234 {
 				log.Printf("%s %s: year %d\n", r.Method, r.URL.Path, year)
+				upload.Reason = "turn year is invalid"
 				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 				return
 			} else if month, err = strconv.Atoi(matches[2]); err != nil {
 				log.Printf("%s %s: month %v\n", r.Method, r.URL.Path, err)
+				upload.Reason = "turn month is invalid"
 				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 				return
 			} else if month < 1 || month > 12 {
 				log.Printf("%s %s: month %d\n", r.Method, r.URL.Path, month)
+				upload.Reason = "turn month is invalid"
 				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 				return
 			} else if clanId, err = strconv.Atoi(matches[3]); err != nil {
 				log.Printf("%s %s: clan %v\n", r.Method, r.URL.Path, err)
+				upload.Reason = "clan id is invalid"
 				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 				return
 			} else if clanId < 1 || clanId > 999 {
 				log.Printf("%s %s: clan %d\n", r.Method, r.URL.Path, month)
+				upload.Reason = "clan id is invalid"
 				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 				return
 			}
-			fileName = fmt.Sprintf("%04d-%02d.%04d.report.txt", year, month, clanId)
+			upload.TurnId = fmt.Sprintf("%04d-%02d", year, month)
+			fileName = fmt.Sprintf("%s.%04d.report.txt", upload.TurnId, clanId)
+			if reason := checkReportClan(user, fmt.Sprintf("%04d", clanId)); reason != "" {
+				log.Printf("%s %s: clan %d: %s\n", r.Method, r.URL.Path, clanId, user.Clan)
+				upload.Reason = reason
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
 		}
 
 		// verify that we have an input directory for the clan
 		inputPath := filepath.Join(user.Data, "input")
 		if sb, err := os.Stat(inputPath); err != nil {
 			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			upload.Reason = "input folder is missing"
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			return
 		} else if !sb.IsDir() {
 			log.Printf("%s %s: %s is not a directory\n", r.Method, r.URL.Path, inputPath)
+			upload.Reason = "input folder is not a directory"
 			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
 			return
 		}
@@ -251,39 +247,60 @@ func (s *Server) postApiReportUploadFile(userdata string) http.HandlerFunc {
 		data, err := io.ReadAll(file)
 		if err != nil {
 			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			upload.Reason = "file could not be read"
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			return
 		} else {
+			setUploadData(upload, data)
+			if removeBadBytes {
+				var summary charset.Summary_t
+				data, summary = replaceInvalidUTF8(data)
+				upload.Changes = summary.Changes()
+				log.Printf("%s %s: removeBadBytes: %s: %s\n", r.Method, r.URL.Path, summary.Encoding, summary)
+			}
 			data = bytes.ReplaceAll(data, []byte{'\r', '\n'}, []byte{'\n'})
 			data = bytes.ReplaceAll(data, []byte{'\r'}, []byte{'\n'})
 		}
 
+		// walk the whole report so that the player can fix every problem at once
+		lines := trimReportLines(data)
+		diagnostics := validator.Check(lines)
+		if validator.HasErrors(diagnostics) {
+			log.Printf("%s %s: diagnostics: %d errors\n", r.Method, r.URL.Path, validator.CountErrors(diagnostics))
+			upload.Reason = diagnosticsReason(diagnostics)
+			bytesWritten = writeDiagnostics(w, http.StatusUnprocessableEntity, false, "report has errors", upload.Changes, diagnostics)
+			return
+		}
+		unitId, _, _ := validator.Header(lines)
+		if reason := checkReportClan(user, unitId); reason != "" {
+			upload.Reason = reason
+			bytesWritten = writeDiagnostics(w, http.StatusForbidden, false, upload.Reason, upload.Changes, nil)
+			return
+		}
+
 		reportFile := filepath.Join(inputPath, fileName)
 		log.Printf("%s %s: creating %q\n", r.Method, r.URL.Path, reportFile)
 
-		if err := os.WriteFile(reportFile, data, 0644); err != nil {
+		if _, err := s.stores.ffs.SaveReport(user, fileName, data); err != nil {
 			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			upload.Reason = "file could not be saved"
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			return
 		}
 		log.Printf("%s %s: created  %q\n", r.Method, r.URL.Path, reportFile)
 
-		bytesWritten = len(data)
+		upload.Succeeded = true
+		s.recordDueDate(user, upload.TurnId, data)
+		s.queueRender(user, upload.TurnId)
 
-		// send a json response
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		_ = json.NewEncoder(w).Encode(struct {
-			Success bool `json:"success"`
-		}{
-			Success: true,
-		})
+		// send a json response, including any warnings
+		bytesWritten = writeDiagnostics(w, http.StatusOK, true, "", upload.Changes, diagnostics)
 	}
 }
 
-func (s *Server) postApiReportUploadText(userdata string) http.HandlerFunc {
+func (s *Server) postApiReportUploadText(path, userdata string) http.HandlerFunc {
 	const fieldName = "report-file"
-	rxTurnReports := regexp.MustCompile(`^([0-9]+)-([0-9]+)\.([0-9]+)\.report\.txt`)
+	s.templates.register(uploadFailedFiles(path)...)
 
 	return func(w http.ResponseWriter, r *http.Request) {
 		started, bytesWritten := time.Now(), 0
@@ -306,17 +323,7 @@ func (s *Server) postApiReportUploadText(userdata string) http.HandlerFunc {
 		}
 		log.Printf("%s %s: ct accepted\n", r.Method, r.URL.Path)
 
-		// fetch the session and get the current user. if either fails, return an error
-		user, err := s.extractSession(r)
-		if err != nil && !errors.Is(err, sql.ErrNoRows) {
-			log.Printf("%s %s: extractSession: %v\n", r.Method, r.URL.Path, err)
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
-		} else if user == nil {
-			// there is no active session, so this is an error
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-			return
-		}
+		user := userFromRequest(r)
 		log.Printf("%s %s: session: clan_id %q\n", r.Method, r.URL.Path, user.Clan)
 
 		// pull the parameters from the form
@@ -327,9 +334,22 @@ func (s *Server) postApiReportUploadText(userdata string) http.HandlerFunc {
 		removeSensitiveLines := cbIsSet(r.FormValue("remove-sensitive-lines"))
 		log.Printf("%s %s: removeSensitiveLines %v\n", r.Method, r.URL.Path, removeSensitiveLines)
 
+		upload := newUpload(user, domains.UploadText, scrubOptions(removeBadBytes, removeSensitiveLines)...)
+		defer s.recordUpload(r, upload)
+		setUploadData(upload, []byte(text))
+
+		// repair the character encoding before we look at the text
+		data := []byte(text)
+		if removeBadBytes {
+			var summary charset.Summary_t
+			data, summary = replaceInvalidUTF8(data)
+			upload.Changes = summary.Changes()
+			log.Printf("%s %s: removeBadBytes: %s: %s\n", r.Method, r.URL.Path, summary.Encoding, summary)
+		}
+
 		// convert eol on the input file
 		var lines [][]byte
-		if data := []byte(text); len(data) > 0 {
+		if len(data) > 0 {
 			data = bytes.ReplaceAll(data, []byte{'\r', '\n'}, []byte{'\n'})
 			data = bytes.ReplaceAll(data, []byte{'\r'}, []byte{'\n'})
 			lines = bytes.Split(data, []byte{'\n'})
@@ -340,137 +360,43 @@ func (s *Server) postApiReportUploadText(userdata string) http.HandlerFunc {
 		}
 		log.Printf("%s %s: daFile: lines %d\n", r.Method, r.URL.Path, len(lines))
 
-		// extract the clan and turn from the first two lines of the input
-		var clanId, turnId string
-		if len(lines) == 0 {
-			http.Redirect(w, r, "/reports/uploads/failed?reason=input is empty", http.StatusSeeOther)
-			return
-		} else if len(lines) == 1 {
-			http.Redirect(w, r, "/reports/uploads/failed?reason=input has only one line", http.StatusSeeOther)
-			return
-		} else if len(lines) == 2 {
-			http.Redirect(w, r, "/reports/uploads/failed?reason=input has only two lines", http.StatusSeeOther)
-			return
-		} else if len(lines[0]) < 45 {
-			http.Redirect(w, r, fmt.Sprintf("/reports/uploads/failed?reason=tribe header has only %d characters", len(lines[0])), http.StatusSeeOther)
-			return
-		} else if len(lines[0]) > 85 {
-			http.Redirect(w, r, fmt.Sprintf("/reports/uploads/failed?reason=tribe header has %d characters", len(lines[0])), http.StatusSeeOther)
-			return
-		}
-		clanFields := bytes.Split(lines[0], []byte{','})
-		switch n := len(clanFields); n {
-		case 0:
-			http.Redirect(w, r, "/reports/uploads/failed?reason=tribe header contains 0 fields", http.StatusSeeOther)
-			return
-		case 1:
-			http.Redirect(w, r, "/reports/uploads/failed?reason=tribe header contains only 1 field", http.StatusSeeOther)
-			return
-		case 2, 3:
-			http.Redirect(w, r, fmt.Sprintf("/reports/uploads/failed?reason=tribe header contains only %d fields", len(clanFields)), http.StatusSeeOther)
-			return
-		case 4:
-			// accept
-		default:
-			http.Redirect(w, r, fmt.Sprintf("/reports/uploads/failed?reason=tribe header contains %d fields", len(clanFields)), http.StatusSeeOther)
-			return
-		}
-		tribeField, currHexField, prevHexField := clanFields[0], bytes.TrimSpace(clanFields[2]), bytes.TrimSpace(clanFields[3])
-		if !bytes.HasPrefix(tribeField, []byte("Tribe 0")) {
-			http.Redirect(w, r, "/reports/uploads/failed?reason=expected first line to start with \"Tribe 0\"", http.StatusSeeOther)
-			return
-		} else if !bytes.HasPrefix(currHexField, []byte("Current Hex = ")) {
-			http.Redirect(w, r, "/reports/uploads/failed?reason=third field of tribe header is not current hex", http.StatusSeeOther)
-			return
-		} else if !bytes.HasPrefix(prevHexField, []byte("(Previous Hex = ")) {
-			http.Redirect(w, r, "/reports/uploads/failed?reason=fourth field of tribe header is not previous hex", http.StatusSeeOther)
-			return
-		}
-		if fields := strings.Fields(string(tribeField)); len(fields) != 2 {
-			http.Redirect(w, r, "/reports/uploads/failed?reason=tribe header missing clan id", http.StatusSeeOther)
-			return
-		} else {
-			clanId = fields[1]
-			log.Printf("%s %s: clan fields: clanId %q\n", r.Method, r.URL.Path, clanId)
-		}
-		// split the second line into four fields
-		turnFields := bytes.Split(lines[1], []byte{','})
-		log.Printf("%s %s: turn %d\n", r.Method, r.URL.Path, len(turnFields))
-		switch n := len(turnFields); n {
-		case 0:
-			http.Redirect(w, r, "/reports/uploads/failed?reason=current turn line is missing", http.StatusSeeOther)
-			return
-		case 1:
-			http.Redirect(w, r, "/reports/uploads/failed?reason=current turn line has only 1 field", http.StatusSeeOther)
-			return
-		case 2, 3:
-			http.Redirect(w, r, fmt.Sprintf("/reports/uploads/failed?reason=current turn line has only %d fields", len(turnFields)), http.StatusSeeOther)
-			return
-		case 4:
-			// accept
-		default:
-			http.Redirect(w, r, fmt.Sprintf("/reports/uploads/failed?reason=current turn line has %d fields", len(turnFields)), http.StatusSeeOther)
-			return
-		}
-		if !bytes.HasPrefix(turnFields[0], []byte("Current Turn ")) {
-			log.Printf("%s %s: turn fields: invalid current turn\n", r.Method, r.URL.Path)
-			http.Redirect(w, r, "/reports/uploads/failed?reason=second line does not start with \"Current Turn\"", http.StatusSeeOther)
-			return
-		}
-		// the first field should be "Current Turn" space and a turn number
-		currentTurnFields := strings.Fields(string(turnFields[0]))
-		if len(currentTurnFields) != 4 {
-			http.Redirect(w, r, "/reports/uploads/failed?reason=could not decipher current turn", http.StatusSeeOther)
+		// walk the whole report so that the player can fix every problem at once
+		if diagnostics := validator.Check(lines); validator.HasErrors(diagnostics) {
+			log.Printf("%s %s: diagnostics: %d errors\n", r.Method, r.URL.Path, validator.CountErrors(diagnostics))
+			upload.Reason = diagnosticsReason(diagnostics)
+			if wantsJSON(r) {
+				bytesWritten = writeDiagnostics(w, http.StatusUnprocessableEntity, false, "report has errors", upload.Changes, diagnostics)
+			} else {
+				bytesWritten = s.renderUploadFailed(w, r, path, "The report has errors.", lines, diagnostics)
+			}
 			return
-		} else {
-			turnId = currentTurnFields[2]
-			log.Printf("%s %s: turn fields: turnId %q\n", r.Method, r.URL.Path, turnId)
 		}
 
-		var fileName string
-		if matches := rxTurnReports.FindStringSubmatch(turnId + "." + clanId + ".report.txt"); len(matches) != 4 {
-			log.Printf("%s %s: matches %d\n", r.Method, r.URL.Path, len(matches))
-			http.Redirect(w, r, "/reports/uploads/failed?reason=file name does not match clan and turn from header", http.StatusSeeOther)
-			return
-		} else {
-			var year, month, clanId int
-			if year, err = strconv.Atoi(matches[1]); err != nil {
-				log.Printf("%s %s: year %v\n", r.Method, r.URL.Path, err)
-				http.Redirect(w, r, "/reports/uploads/failed?reason=turn year is invalid", http.StatusSeeOther)
-				return
-			} else if year < 899 || year > 1234 {
-				log.Printf("%s %s: year %d\n", r.Method, r.URL.Path, year)
-				http.Redirect(w, r, "/reports/uploads/failed?reason=turn year is invalid", http.StatusSeeOther)
-				return
-			} else if month, err = strconv.Atoi(matches[2]); err != nil {
-				log.Printf("%s %s: month %v\n", r.Method, r.URL.Path, err)
-				http.Redirect(w, r, "/reports/uploads/failed?reason=turn month is invalid", http.StatusSeeOther)
-				return
-			} else if month < 1 || month > 12 {
-				log.Printf("%s %s: month %d\n", r.Method, r.URL.Path, month)
-				http.Redirect(w, r, "/reports/uploads/failed?reason=turn month is invalid", http.StatusSeeOther)
-				return
-			} else if clanId, err = strconv.Atoi(matches[3]); err != nil {
-				log.Printf("%s %s: clan %v\n", r.Method, r.URL.Path, err)
-				http.Redirect(w, r, "/reports/uploads/failed?reason=clan id is invalid", http.StatusSeeOther)
-				return
-			} else if clanId < 1 || clanId > 999 {
-				log.Printf("%s %s: clan %d\n", r.Method, r.URL.Path, month)
-				http.Redirect(w, r, "/reports/uploads/failed?reason=clan id is invalid", http.StatusSeeOther)
-				return
+		// the validator has checked the headers, so the clan and turn can be trusted
+		unitId, turnId, _ := validator.Header(lines)
+		if reason := checkReportClan(user, unitId); reason != "" {
+			upload.Reason = reason
+			if wantsJSON(r) {
+				bytesWritten = writeDiagnostics(w, http.StatusForbidden, false, reason, upload.Changes, nil)
+			} else {
+				bytesWritten = s.renderUploadFailed(w, r, path, reason, lines, nil)
 			}
-			fileName = fmt.Sprintf("%04d-%02d.%04d.report.txt", year, month, clanId)
+			return
 		}
+		fileName := fmt.Sprintf("%s.%s.report.txt", turnId, unitId)
+		upload.TurnId = turnId
 		log.Printf("%s %s: reportFileName %q\n", r.Method, r.URL.Path, fileName)
 
 		// verify that we have an input directory for the clan
 		inputPath := filepath.Join(user.Data, "input")
 		if sb, err := os.Stat(inputPath); err != nil {
 			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			upload.Reason = "input folder is missing"
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			return
 		} else if !sb.IsDir() {
 			log.Printf("%s %s: %s is not a directory\n", r.Method, r.URL.Path, inputPath)
+			upload.Reason = "input folder is not a directory"
 			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
 			return
 		}
@@ -482,15 +408,13 @@ func (s *Server) postApiReportUploadText(userdata string) http.HandlerFunc {
 		if removeSensitiveLines {
 			lines = trimNonMappingLines(lines)
 		}
-		data := bytes.Join(lines, []byte{'\n'})
-		if removeBadBytes {
-			data = replaceInvalidUTF8(data)
-		}
+		data = bytes.Join(lines, []byte{'\n'})
 		if len(data) == 0 || data[len(data)-1] != '\n' {
 			data = append(data, '\n')
 		}
-		if err := os.WriteFile(reportFile, data, 0644); err != nil {
+		if _, err := s.stores.ffs.SaveReport(user, fileName, data); err != nil {
 			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			upload.Reason = "file could not be saved"
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			return
 		}
@@ -498,7 +422,12 @@ func (s *Server) postApiReportUploadText(userdata string) http.HandlerFunc {
 
 		log.Printf("%s %s: wrote    %d bytes\n", r.Method, r.URL.Path, len(data))
 
-		http.Redirect(w, r, "/reports/uploads/success?filename="+fileName, http.StatusSeeOther)
+		upload.Succeeded = true
+		s.recordDueDate(user, turnId, data)
+		s.queueRender(user, turnId)
+
+		query := url.Values{"filename": {fileName}, "changes": upload.Changes}
+		http.Redirect(w, r, "/reports/uploads/success?"+query.Encode(), http.StatusSeeOther)
 	}
 }
 
@@ -526,6 +455,7 @@ func (s *Server) getCalendar(path string, footer app.Footer) http.HandlerFunc {
 		filepath.Join(path, "app", "pages", "calendar", "content.gohtml"),
 		filepath.Join(path, "app", "widgets", "notifications.gohtml"),
 	}
+	s.templates.register(files...)
 
 	return func(w http.ResponseWriter, r *http.Request) {
 		started, bytesWritten := time.Now(), 0
@@ -543,30 +473,26 @@ func (s *Server) getCalendar(path string, footer app.Footer) http.HandlerFunc {
 			return
 		}
 
-		user, err := s.extractSession(r)
+		user := userFromRequest(r)
+		log.Printf("%s %s: session: clan_id %q\n", r.Method, r.URL.Path, user.Clan)
+
+		content, err := s.calendarContent(r, user)
 		if err != nil {
-			log.Printf("%s %s: extractSession: %v\n", r.Method, r.URL.Path, err)
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			return
-		} else if user == nil {
-			// there is no active session, so this is an error
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-			return
 		}
-		log.Printf("%s %s: session: clan_id %q\n", r.Method, r.URL.Path, user.Clan)
 
 		payload := app.Layout{
 			Title:   fmt.Sprintf("Clan %s", user.Clan),
 			Heading: "Calendar",
-			Content: calendar.Content{
-				ClanId: user.Clan,
-			},
-			Footer: footer,
+			Content: content,
+			Footer:  footer,
 		}
 		payload.CurrentPage.Calendar = true
 		payload.Footer.Timestamp = time.Now().In(user.LanguageAndDates.Timezone.Location).Format("2006-01-02 15:04:05")
 
-		t, err := template.ParseFiles(files...)
+		t, err := s.templates.lookup(files...)
 		if err != nil {
 			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -596,6 +522,7 @@ func (s *Server) getDashboard(path string, footer app.Footer, cacheBuster bool)
 		filepath.Join(path, "app", "pages", "dashboard", "turn-files-htmx.gohtml"),
 		filepath.Join(path, "app", "widgets", "notifications.gohtml"),
 	}
+	s.templates.register(files...)
 
 	return func(w http.ResponseWriter, r *http.Request) {
 		started, bytesWritten := time.Now(), 0
@@ -613,16 +540,7 @@ func (s *Server) getDashboard(path string, footer app.Footer, cacheBuster bool)
 			return
 		}
 
-		user, err := s.extractSession(r)
-		if err != nil {
-			log.Printf("%s %s: extractSession: %v\n", r.Method, r.URL.Path, err)
-			http.Redirect(w, r, "/login?internal_server_error=true", http.StatusSeeOther)
-			return
-		} else if user == nil {
-			// there is no active session, so this is an error
-			http.Redirect(w, r, "/login?session_expired=true", http.StatusSeeOther)
-			return
-		}
+		user := userFromRequest(r)
 		log.Printf("%s %s: session: clan_id %q\n", r.Method, r.URL.Path, user.Clan)
 
 		content := dashboard.Content{
@@ -730,6 +648,8 @@ func (s *Server) getDashboard(path string, footer app.Footer, cacheBuster bool)
 				Time:  f.Timestamp.In(user.LanguageAndDates.Timezone.Location).Format("15:04:05"),
 				Route: fmt.Sprintf("/report/%s", f.Name),
 				Path:  f.Path,
+
+				Revisions: f.Revisions,
 			}
 			if cacheBuster {
 				fi.Route += fmt.Sprintf("?ctl=%s", f.Timestamp.In(user.LanguageAndDates.Timezone.Location).Format("2006.01.02.15.04.05"))
@@ -752,7 +672,7 @@ func (s *Server) getDashboard(path string, footer app.Footer, cacheBuster bool)
 		payload.CurrentPage.Dashboard = true
 		payload.Footer.Timestamp = time.Now().In(user.LanguageAndDates.Timezone.Location).Format("2006-01-02 15:04:05")
 
-		t, err := template.ParseFiles(files...)
+		t, err := s.templates.lookup(files...)
 		if err != nil {
 			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -786,6 +706,7 @@ func (s *Server) deleteErrorLogLogId(components string) http.HandlerFunc {
 	files := []string{
 		filepath.Join(components, "app", "pages", "dashboard", "turn-files-htmx.gohtml"),
 	}
+	s.templates.register(files...)
 
 	return func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("%s %s: entered\n", r.Method, r.URL.Path)
@@ -804,16 +725,7 @@ func (s *Server) deleteErrorLogLogId(components string) http.HandlerFunc {
 			log.Printf("%s %s: wrote %d bytes in %s\n", r.Method, r.URL.Path, bytesWritten, time.Since(started))
 		}()
 
-		user, err := s.extractSession(r)
-		if err != nil {
-			log.Printf("%s %s: extractSession: %v\n", r.Method, r.URL.Path, err)
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
-		} else if user == nil {
-			// there is no active session, so this is an error
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-			return
-		}
+		user := userFromRequest(r)
 		log.Printf("%s %s: session: clan_id %q\n", r.Method, r.URL.Path, user.Clan)
 
 		logId := r.PathValue("log_id")
@@ -855,6 +767,8 @@ func (s *Server) deleteErrorLogLogId(components string) http.HandlerFunc {
 		if err := os.Remove(path); err != nil {
 			// normally we would fail on an error, but we want to return the details to the user
 			log.Printf("%s %s: r %v\n", r.Method, r.URL.Path, err)
+		} else {
+			s.audit(r, user.Clan, domains.AuditDeleteErrorLog, path)
 		}
 
 		// rebuild the turn details
@@ -864,7 +778,7 @@ func (s *Server) deleteErrorLogLogId(components string) http.HandlerFunc {
 			log.Printf("%s %s: ctfl %v\n", r.Method, r.URL.Path, err)
 		}
 
-		t, err := template.ParseFiles(files...)
+		t, err := s.templates.lookup(files...)
 		if err != nil {
 			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -906,16 +820,7 @@ func (s *Server) getErrorLogLogId() http.HandlerFunc {
 			log.Printf("%s %s: wrote %d bytes in %s\n", r.Method, r.URL.Path, bytesWritten, time.Since(started))
 		}()
 
-		user, err := s.extractSession(r)
-		if err != nil {
-			log.Printf("%s %s: extractSession: %v\n", r.Method, r.URL.Path, err)
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
-		} else if user == nil {
-			// there is no active session, so this is an error
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-			return
-		}
+		user := userFromRequest(r)
 		log.Printf("%s %s: session: clan_id %q\n", r.Method, r.URL.Path, user.Clan)
 
 		logId := r.PathValue("log_id")
@@ -1001,6 +906,7 @@ func (s *Server) getHeroPage(path string, page string) http.HandlerFunc {
 	default:
 		panic("!")
 	}
+	s.templates.register(files...)
 
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != "GET" {
@@ -1008,7 +914,7 @@ func (s *Server) getHeroPage(path string, page string) http.HandlerFunc {
 			return
 		}
 
-		t, err := template.ParseFiles(files...)
+		t, err := s.templates.lookup(files...)
 		if err != nil {
 			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -1030,10 +936,10 @@ func (s *Server) getHeroPage(path string, page string) http.HandlerFunc {
 	}
 }
 
-func (s *Server) getIndex(serveStaticFiles bool, assets string, landing http.HandlerFunc) http.HandlerFunc {
+func (s *Server) getIndex(serveStaticFiles bool, assets fs.FS, landing http.HandlerFunc) http.HandlerFunc {
 	var assetsFS http.Handler
 	if serveStaticFiles {
-		assetsFS = http.FileServer(http.Dir(assets))
+		assetsFS = http.FileServer(http.FS(assets))
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -1087,6 +993,7 @@ func (s *Server) deleteLogLogId(components string) http.HandlerFunc {
 	files := []string{
 		filepath.Join(components, "app", "pages", "dashboard", "turn-files-htmx.gohtml"),
 	}
+	s.templates.register(files...)
 
 	return func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("%s %s: entered\n", r.Method, r.URL.Path)
@@ -1105,16 +1012,7 @@ func (s *Server) deleteLogLogId(components string) http.HandlerFunc {
 			log.Printf("%s %s: wrote %d bytes in %s\n", r.Method, r.URL.Path, bytesWritten, time.Since(started))
 		}()
 
-		user, err := s.extractSession(r)
-		if err != nil {
-			log.Printf("%s %s: extractSession: %v\n", r.Method, r.URL.Path, err)
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
-		} else if user == nil {
-			// there is no active session, so this is an error
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-			return
-		}
+		user := userFromRequest(r)
 		log.Printf("%s %s: session: clan_id %q\n", r.Method, r.URL.Path, user.Clan)
 
 		logId := r.PathValue("log_id")
@@ -1156,6 +1054,8 @@ func (s *Server) deleteLogLogId(components string) http.HandlerFunc {
 		if err := os.Remove(path); err != nil {
 			// normally we would fail on an error, but we want to return the details to the user
 			log.Printf("%s %s: r %v\n", r.Method, r.URL.Path, err)
+		} else {
+			s.audit(r, user.Clan, domains.AuditDeleteLog, path)
 		}
 
 		// rebuild the turn details
@@ -1165,7 +1065,7 @@ func (s *Server) deleteLogLogId(components string) http.HandlerFunc {
 			log.Printf("%s %s: ctfl %v\n", r.Method, r.URL.Path, err)
 		}
 
-		t, err := template.ParseFiles(files...)
+		t, err := s.templates.lookup(files...)
 		if err != nil {
 			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -1207,16 +1107,7 @@ func (s *Server) getLogLogId() http.HandlerFunc {
 			log.Printf("%s %s: wrote %d bytes in %s\n", r.Method, r.URL.Path, bytesWritten, time.Since(started))
 		}()
 
-		user, err := s.extractSession(r)
-		if err != nil {
-			log.Printf("%s %s: extractSession: %v\n", r.Method, r.URL.Path, err)
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
-		} else if user == nil {
-			// there is no active session, so this is an error
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-			return
-		}
+		user := userFromRequest(r)
 		log.Printf("%s %s: session: clan_id %q\n", r.Method, r.URL.Path, user.Clan)
 
 		logId := r.PathValue("log_id")
@@ -1264,6 +1155,7 @@ func (s *Server) getLogin(path string) http.HandlerFunc {
 	files := []string{
 		filepath.Join(path, "pages", "login.gohtml"),
 	}
+	s.templates.register(files...)
 
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != "GET" {
@@ -1281,7 +1173,7 @@ func (s *Server) getLogin(path string) http.HandlerFunc {
 			}
 		}
 
-		t, err := template.ParseFiles(files...)
+		t, err := s.templates.lookup(files...)
 		if err != nil {
 			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -1307,6 +1199,7 @@ func (s *Server) getLoginClanId(path string) http.HandlerFunc {
 	files := []string{
 		filepath.Join(path, "pages", "login_clan.gohtml"),
 	}
+	s.templates.register(files...)
 
 	return func(w http.ResponseWriter, r *http.Request) {
 		// delete any existing session on the client
@@ -1333,8 +1226,13 @@ func (s *Server) getLoginClanId(path string) http.HandlerFunc {
 			}
 			payload.ClanId, payload.Email = clanId, clanId+"@ottomap"
 		}
+		if seconds, err := strconv.Atoi(r.URL.Query().Get("retry_after")); err == nil && seconds > 0 {
+			payload.Error = fmt.Sprintf("Too many failed attempts. Please wait %s before trying again.", retryAfterText(time.Duration(seconds)*time.Second))
+		} else if r.URL.Query().Get("invalid_credentials") == "true" {
+			payload.Error = "The e-mail address or password is not correct."
+		}
 
-		t, err := template.ParseFiles(files...)
+		t, err := s.templates.lookup(files...)
 		if err != nil {
 			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -1411,9 +1309,16 @@ func (s *Server) postLoginClanId() http.HandlerFunc {
 			rememberMe: r.Form.Get("remember-me") == "on" || r.Form.Get("remember-me") == "true",
 		}
 
-		// clan id must match the email
-		if input.email != clanId+"@ottomap" {
-			http.Redirect(w, r, fmt.Sprintf("/login/clan/%s?invalid_credentials=true", clanId), http.StatusSeeOther)
+		// count the attempt, and refuse to check the password if the clan or address has failed too often
+		ip := clientIP(r)
+		if wait, err := s.countLoginAttempt(clanId, ip); err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		} else if wait > 0 {
+			log.Printf("%s %s: clan %q: ip %q: retry after %v\n", r.Method, r.URL.Path, clanId, ip, wait)
+			s.audit(r, clanId, domains.AuditLoginBlocked, fmt.Sprintf("retry after %v", wait.Round(time.Second)))
+			http.Redirect(w, r, fmt.Sprintf("/login/clan/%s?retry_after=%d", clanId, int(wait.Seconds()+1)), http.StatusSeeOther)
 			return
 		}
 
@@ -1421,34 +1326,27 @@ func (s *Server) postLoginClanId() http.HandlerFunc {
 		user, err := s.stores.sessions.AuthenticateUser(input.email, input.password)
 		if err != nil {
 			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
-			http.Redirect(w, r, fmt.Sprintf("/login/clan/%s?invalid_credentials=true", clanId), http.StatusSeeOther)
-			return
 		}
-		loggedIn := user.Roles.IsActive
+		// clan id must match the account. we don't check the email because the
+		// administrator's account is admin@ottomap rather than 0000@ottomap.
+		loggedIn := err == nil && user.Roles.IsActive && user.Clan == clanId
 
-		// if the check fails, send them back to the login page
+		// if the check fails, the attempt stays counted as a failure and we send them back to the login page
 		if !loggedIn {
+			s.audit(r, clanId, domains.AuditLoginFailed, fmt.Sprintf("email %q", input.email))
 			http.Redirect(w, r, fmt.Sprintf("/login/clan/%s?invalid_credentials=true", clanId), http.StatusSeeOther)
 			return
 		}
+		if err := s.clearLoginFailures(clanId, ip); err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+		}
+		s.audit(r, user.Clan, domains.AuditLogin, "")
 
-		sessionId, err := s.stores.sessions.CreateSession(user.ID, s.sessions.ttl)
-		if err != nil {
+		if err := s.startSession(w, r, user); err != nil {
 			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			return
 		}
-
-		// set the session cookie
-		http.SetCookie(w, &http.Cookie{
-			Name:     s.sessions.cookieName,
-			Value:    sessionId,
-			Path:     "/",
-			MaxAge:   s.sessions.maxAge,
-			HttpOnly: true,
-			Secure:   true,
-			SameSite: http.SameSiteStrictMode,
-		})
 		if input.rememberMe {
 			// set the clan tracking cookie
 			http.SetCookie(w, &http.Cookie{
@@ -1471,8 +1369,14 @@ func (s *Server) getLogout() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// we don't delete cookies if they are missing because we're afraid of leaking cookie names to bad clients
 
-		// delete the session cookie if we have one
-		if _, err := r.Cookie(s.sessions.cookieName); err == nil {
+		// delete the session and the session cookie if we have one
+		if cookie, err := r.Cookie(s.sessions.cookieName); err == nil {
+			if user, _, err := s.stores.sessions.GetSession(cookie.Value); err == nil && user != nil {
+				if err := s.stores.sessions.DeleteSession(user.ID, cookie.Value); err != nil {
+					log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+				}
+				s.audit(r, user.Clan, domains.AuditLogout, "")
+			}
 			http.SetCookie(w, &http.Cookie{
 				Name:   s.sessions.cookieName,
 				Value:  "",
@@ -1508,6 +1412,7 @@ func (s *Server) deleteMapMapId(components string) http.HandlerFunc {
 	files := []string{
 		filepath.Join(components, "app", "pages", "dashboard", "turn-files-htmx.gohtml"),
 	}
+	s.templates.register(files...)
 
 	return func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("%s %s: entered\n", r.Method, r.URL.Path)
@@ -1526,16 +1431,7 @@ func (s *Server) deleteMapMapId(components string) http.HandlerFunc {
 			log.Printf("%s %s: wrote %d bytes in %s\n", r.Method, r.URL.Path, bytesWritten, time.Since(started))
 		}()
 
-		user, err := s.extractSession(r)
-		if err != nil {
-			log.Printf("%s %s: extractSession: %v\n", r.Method, r.URL.Path, err)
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
-		} else if user == nil {
-			// there is no active session, so this is an error
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-			return
-		}
+		user := userFromRequest(r)
 		log.Printf("%s %s: session: clan_id %q\n", r.Method, r.URL.Path, user.Clan)
 
 		mapId := r.PathValue("map_id")
@@ -1577,6 +1473,12 @@ func (s *Server) deleteMapMapId(components string) http.HandlerFunc {
 		if err := os.Remove(path); err != nil {
 			// normally we would fail on an error, but we want to return the details to the user
 			log.Printf("%s %s: r %v\n", r.Method, r.URL.Path, err)
+		} else {
+			s.audit(r, user.Clan, domains.AuditDeleteMap, path)
+		}
+		// and stop sharing it
+		if err := s.stores.store.DeleteMapSharesByMap(user.ID, mapId); err != nil {
+			log.Printf("%s %s: shares %v\n", r.Method, r.URL.Path, err)
 		}
 
 		// rebuild the turn details
@@ -1586,7 +1488,7 @@ func (s *Server) deleteMapMapId(components string) http.HandlerFunc {
 			log.Printf("%s %s: ctfl %v\n", r.Method, r.URL.Path, err)
 		}
 
-		t, err := template.ParseFiles(files...)
+		t, err := s.templates.lookup(files...)
 		if err != nil {
 			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -1628,16 +1530,7 @@ func (s *Server) getMapMapId() http.HandlerFunc {
 			log.Printf("%s %s: wrote %d bytes in %s\n", r.Method, r.URL.Path, bytesWritten, time.Since(started))
 		}()
 
-		user, err := s.extractSession(r)
-		if err != nil {
-			log.Printf("%s %s: extractSession: %v\n", r.Method, r.URL.Path, err)
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
-		} else if user == nil {
-			// there is no active session, so this is an error
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-			return
-		}
+		user := userFromRequest(r)
 		//log.Printf("%s %s: session: clan_id %q\n", r.Method, r.URL.Path, user.Clan)
 
 		mapId := r.PathValue("map_id")
@@ -1661,13 +1554,13 @@ func (s *Server) getMapMapId() http.HandlerFunc {
 			return
 		}
 
-		// does the file exist in the userdata directory?
-		path := filepath.Join(user.Data, "output", mapId)
+		// does the file exist in the userdata directory or has it been shared with the user?
+		path, ok := s.mapFilePath(user, mapId)
 		//log.Printf("%s %s: path %q\n", r.Method, r.URL.Path, path)
-		if sb, err := os.Stat(path); err != nil || sb.IsDir() || !sb.Mode().IsRegular() {
+		if !ok {
 			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
 			return
-		} else {
+		} else if sb, err := os.Stat(path); err == nil {
 			bytesWritten = int(sb.Size())
 		}
 
@@ -1686,6 +1579,7 @@ func (s *Server) getMaps(path string, footer app.Footer) http.HandlerFunc {
 		filepath.Join(path, "app", "pages", "maps", "content.gohtml"),
 		filepath.Join(path, "app", "widgets", "notifications.gohtml"),
 	}
+	s.templates.register(files...)
 
 	return func(w http.ResponseWriter, r *http.Request) {
 		started, bytesWritten := time.Now(), 0
@@ -1703,30 +1597,26 @@ func (s *Server) getMaps(path string, footer app.Footer) http.HandlerFunc {
 			return
 		}
 
-		user, err := s.extractSession(r)
+		user := userFromRequest(r)
+		log.Printf("%s %s: session: clan_id %q\n", r.Method, r.URL.Path, user.Clan)
+
+		content, err := s.mapsContent(user)
 		if err != nil {
-			log.Printf("%s %s: extractSession: %v\n", r.Method, r.URL.Path, err)
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			return
-		} else if user == nil {
-			// there is no active session, so this is an error
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-			return
 		}
-		log.Printf("%s %s: session: clan_id %q\n", r.Method, r.URL.Path, user.Clan)
 
 		payload := app.Layout{
 			Title:   fmt.Sprintf("Clan %s", user.Clan),
 			Heading: "Maps",
-			Content: dashboard.Content{
-				ClanId: user.Clan,
-			},
-			Footer: footer,
+			Content: content,
+			Footer:  footer,
 		}
 		payload.CurrentPage.Maps = true
 		payload.Footer.Timestamp = time.Now().In(user.LanguageAndDates.Timezone.Location).Format("2006-01-02 15:04:05")
 
-		t, err := template.ParseFiles(files...)
+		t, err := s.templates.lookup(files...)
 		if err != nil {
 			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -1761,6 +1651,7 @@ func (s *Server) deleteReportReportId(components string) http.HandlerFunc {
 	files := []string{
 		filepath.Join(components, "app", "pages", "dashboard", "turn-files-htmx.gohtml"),
 	}
+	s.templates.register(files...)
 
 	return func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("%s %s: entered\n", r.Method, r.URL.Path)
@@ -1779,16 +1670,7 @@ func (s *Server) deleteReportReportId(components string) http.HandlerFunc {
 			log.Printf("%s %s: wrote %d bytes in %s\n", r.Method, r.URL.Path, bytesWritten, time.Since(started))
 		}()
 
-		user, err := s.extractSession(r)
-		if err != nil {
-			log.Printf("%s %s: extractSession: %v\n", r.Method, r.URL.Path, err)
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
-		} else if user == nil {
-			// there is no active session, so this is an error
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-			return
-		}
+		user := userFromRequest(r)
 		log.Printf("%s %s: session: clan_id %q\n", r.Method, r.URL.Path, user.Clan)
 
 		reportId := r.PathValue("report_id")
@@ -1830,6 +1712,8 @@ func (s *Server) deleteReportReportId(components string) http.HandlerFunc {
 		if err := os.Remove(path); err != nil {
 			// normally we would fail on an error, but we want to return the details to the user
 			log.Printf("%s %s: r %v\n", r.Method, r.URL.Path, err)
+		} else {
+			s.audit(r, user.Clan, domains.AuditDeleteReport, path)
 		}
 
 		// rebuild the turn details
@@ -1839,7 +1723,7 @@ func (s *Server) deleteReportReportId(components string) http.HandlerFunc {
 			log.Printf("%s %s: ctfl %v\n", r.Method, r.URL.Path, err)
 		}
 
-		t, err := template.ParseFiles(files...)
+		t, err := s.templates.lookup(files...)
 		if err != nil {
 			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -1868,15 +1752,7 @@ func (s *Server) getReportBetaDocxToJson() http.HandlerFunc {
 			return
 		}
 
-		user, err := s.extractSession(r)
-		if err != nil {
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
-		} else if user == nil {
-			// there is no active session, so this is an error
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-			return
-		}
+		user := userFromRequest(r)
 
 		reportId := "docx-to-text.json"
 
@@ -1899,15 +1775,7 @@ func (s *Server) getReportBetaDocxToText() http.HandlerFunc {
 			return
 		}
 
-		user, err := s.extractSession(r)
-		if err != nil {
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
-		} else if user == nil {
-			// there is no active session, so this is an error
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-			return
-		}
+		user := userFromRequest(r)
 		//log.Printf("%s %s: session: clan_id %q\n", r.Method, r.URL.Path, user.Clan)
 
 		reportId := "docx-to-text.txt"
@@ -1945,16 +1813,7 @@ func (s *Server) getReportReportId() http.HandlerFunc {
 			log.Printf("%s %s: wrote %d bytes in %s\n", r.Method, r.URL.Path, bytesWritten, time.Since(started))
 		}()
 
-		user, err := s.extractSession(r)
-		if err != nil {
-			log.Printf("%s %s: extractSession: %v\n", r.Method, r.URL.Path, err)
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
-		} else if user == nil {
-			// there is no active session, so this is an error
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-			return
-		}
+		user := userFromRequest(r)
 		//log.Printf("%s %s: session: clan_id %q\n", r.Method, r.URL.Path, user.Clan)
 
 		reportId := r.PathValue("report_id")
@@ -1999,6 +1858,7 @@ func (s *Server) getReports(path string, footer app.Footer) http.HandlerFunc {
 		filepath.Join(path, "app", "pages", "reports", "content.gohtml"),
 		filepath.Join(path, "app", "widgets", "notifications.gohtml"),
 	}
+	s.templates.register(files...)
 
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != "GET" {
@@ -2013,17 +1873,7 @@ func (s *Server) getReports(path string, footer app.Footer) http.HandlerFunc {
 			log.Printf("%s %s: wrote %d bytes in %s\n", r.Method, r.URL.Path, bytesWritten, time.Since(started))
 		}()
 
-		// fetch the session and get the current user. if either fails, return an error
-		user, err := s.extractSession(r)
-		if err != nil && !errors.Is(err, sql.ErrNoRows) {
-			log.Printf("%s %s: extractSession: %v\n", r.Method, r.URL.Path, err)
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
-		} else if user == nil {
-			// there is no active session, so this is an error
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-			return
-		}
+		user := userFromRequest(r)
 		log.Printf("%s %s: session: clan_id %q\n", r.Method, r.URL.Path, user.Clan)
 
 		// fetch the reports for the current user
@@ -2086,7 +1936,7 @@ func (s *Server) getReports(path string, footer app.Footer) http.HandlerFunc {
 		payload.CurrentPage.Reports = true
 		payload.Footer.Timestamp = time.Now().In(user.LanguageAndDates.Timezone.Location).Format("2006-01-02 15:04:05")
 
-		t, err := template.ParseFiles(files...)
+		t, err := s.templates.lookup(files...)
 		if err != nil {
 			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -2109,9 +1959,16 @@ func (s *Server) getReports(path string, footer app.Footer) http.HandlerFunc {
 	}
 }
 
-func (s *Server) getReportsTurnIdClanId(path string) http.HandlerFunc {
-	rxClanId := regexp.MustCompile(`^0[0-9]{3}$`)
-	rxTurnId := regexp.MustCompile(`^[0-9]{4}-[0-9]{2}$`)
+func (s *Server) getReportsHistory(path string, footer app.Footer) http.HandlerFunc {
+	files := []string{
+		filepath.Join(path, "app", "layout.gohtml"),
+		filepath.Join(path, "app", "pages", "reports", "history", "content.gohtml"),
+		filepath.Join(path, "app", "widgets", "notifications.gohtml"),
+	}
+	s.templates.register(files...)
+
+	// maximum number of uploads to show on the page
+	const maxUploads = 100
 
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != "GET" {
@@ -2119,16 +1976,82 @@ func (s *Server) getReportsTurnIdClanId(path string) http.HandlerFunc {
 			return
 		}
 
-		user, err := s.extractSession(r)
+		log.Printf("%s %s: entered\n", r.Method, r.URL.Path)
+		started, bytesWritten := time.Now(), 0
+		defer func() {
+			log.Printf("%s %s: wrote %d bytes in %s\n", r.Method, r.URL.Path, bytesWritten, time.Since(started))
+		}()
+
+		user := userFromRequest(r)
+		log.Printf("%s %s: session: clan_id %q\n", r.Method, r.URL.Path, user.Clan)
+
+		uploads, err := s.stores.store.GetUserUploads(user.ID, maxUploads)
 		if err != nil {
-			log.Printf("%s %s: extractSession: %v\n", r.Method, r.URL.Path, err)
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			return
-		} else if user == nil {
-			// there is no active session, so this is an error
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		}
+		content := history.Content_t{
+			ClanId: user.Clan,
+		}
+		for _, upload := range uploads {
+			uploadedAt := upload.UploadedAt.In(user.LanguageAndDates.Timezone.Location)
+			content.Uploads = append(content.Uploads, history.Upload_t{
+				Date:         uploadedAt.Format(user.LanguageAndDates.DateFormat),
+				Time:         uploadedAt.Format("15:04:05"),
+				TurnId:       upload.TurnId,
+				FileName:     upload.FileName,
+				Kind:         string(upload.Kind),
+				Size:         upload.Size,
+				Checksum:     upload.Checksum,
+				ScrubOptions: strings.Join(upload.ScrubOptions, ", "),
+				Succeeded:    upload.Succeeded,
+				Reason:       upload.Reason,
+				Changes:      upload.Changes,
+			})
+		}
+
+		payload := app.Layout{
+			Title:   fmt.Sprintf("Clan %s", user.Clan),
+			Heading: "Reports",
+			Content: content,
+			Footer:  footer,
+		}
+		payload.CurrentPage.Reports = true
+		payload.Footer.Timestamp = time.Now().In(user.LanguageAndDates.Timezone.Location).Format("2006-01-02 15:04:05")
+
+		t, err := s.templates.lookup(files...)
+		if err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		// parse into a buffer so that we can handle errors without writing to the response
+		buf := &bytes.Buffer{}
+		if err := t.Execute(buf, payload); err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			return
 		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		bytesWritten, _ = w.Write(buf.Bytes())
+	}
+}
+
+func (s *Server) getReportsTurnIdClanId(path string) http.HandlerFunc {
+	rxClanId := regexp.MustCompile(`^0[0-9]{3}$`)
+	rxTurnId := regexp.MustCompile(`^[0-9]{4}-[0-9]{2}$`)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		user := userFromRequest(r)
 		// verify that we have an input directory for the clan
 		inputPath := filepath.Join(user.Data, "input")
 		if sb, err := os.Stat(inputPath); err != nil || !sb.IsDir() {
@@ -2165,6 +2088,7 @@ func (s *Server) getReportsUploads(path string, footer app.Footer) http.HandlerF
 		filepath.Join(path, "app", "pages", "reports", "uploads", "content.gohtml"),
 		filepath.Join(path, "app", "widgets", "notifications.gohtml"),
 	}
+	s.templates.register(files...)
 
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != "GET" {
@@ -2179,17 +2103,7 @@ func (s *Server) getReportsUploads(path string, footer app.Footer) http.HandlerF
 			log.Printf("%s %s: wrote %d bytes in %s\n", r.Method, r.URL.Path, bytesWritten, time.Since(started))
 		}()
 
-		// fetch the session and get the current user. if either fails, return an error
-		user, err := s.extractSession(r)
-		if err != nil && !errors.Is(err, sql.ErrNoRows) {
-			log.Printf("%s %s: extractSession: %v\n", r.Method, r.URL.Path, err)
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
-		} else if user == nil {
-			// there is no active session, so this is an error
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-			return
-		}
+		user := userFromRequest(r)
 		log.Printf("%s %s: session: clan_id %q\n", r.Method, r.URL.Path, user.Clan)
 
 		payload := app.Layout{
@@ -2201,7 +2115,7 @@ func (s *Server) getReportsUploads(path string, footer app.Footer) http.HandlerF
 		payload.CurrentPage.Reports = true
 		payload.Footer.Timestamp = time.Now().In(user.LanguageAndDates.Timezone.Location).Format("2006-01-02 15:04:05")
 
-		t, err := template.ParseFiles(files...)
+		t, err := s.templates.lookup(files...)
 		if err != nil {
 			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -2224,50 +2138,11 @@ func (s *Server) getReportsUploads(path string, footer app.Footer) http.HandlerF
 	}
 }
 
-func (s *Server) getReportsUploadsFailed(path string) http.HandlerFunc {
-	files := []string{
-		filepath.Join(path, "app", "pages", "reports", "failed", "content.gohtml"),
-	}
-
-	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != "GET" {
-			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
-			return
-		}
-
-		payload := app.Layout{
-			Title:   "Upload Failed",
-			Heading: "Reports",
-			Content: failed.Content_t{
-				Reason: r.URL.Query().Get("reason"),
-			},
-		}
-
-		t, err := template.ParseFiles(files...)
-		if err != nil {
-			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
-		}
-
-		// parse into a buffer so that we can handle errors without writing to the response
-		buf := &bytes.Buffer{}
-		if err := t.Execute(buf, payload); err != nil {
-			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
-		}
-
-		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write(buf.Bytes())
-	}
-}
-
 func (s *Server) getReportsUploadsSuccess(path string) http.HandlerFunc {
 	files := []string{
 		filepath.Join(path, "app", "pages", "reports", "success", "content.gohtml"),
 	}
+	s.templates.register(files...)
 
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != "GET" {
@@ -2275,16 +2150,24 @@ func (s *Server) getReportsUploadsSuccess(path string) http.HandlerFunc {
 			return
 		}
 
-		t, err := template.ParseFiles(files...)
+		t, err := s.templates.lookup(files...)
 		if err != nil {
 			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			return
 		}
 
+		payload := app.Layout{
+			Title:   "Upload Succeeded",
+			Heading: "Reports",
+			Content: success.Content_t{
+				Changes: r.URL.Query()["changes"],
+			},
+		}
+
 		// parse into a buffer so that we can handle errors without writing to the response
 		buf := &bytes.Buffer{}
-		if err := t.Execute(buf, nil); err != nil {
+		if err := t.Execute(buf, payload); err != nil {
 			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			return
@@ -2307,7 +2190,9 @@ func (s *Server) getSettingsGeneral(path string, footer app.Footer) http.Handler
 		filepath.Join(path, "app", "pages", "settings", "layout.gohtml"),
 		filepath.Join(path, "app", "pages", "settings", "general", "content.gohtml"),
 		filepath.Join(path, "app", "pages", "settings", "general", "timezone-htmx.gohtml"),
+		filepath.Join(path, "app", "widgets", "notifications.gohtml"),
 	}
+	s.templates.register(files...)
 
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != "GET" {
@@ -2322,17 +2207,7 @@ func (s *Server) getSettingsGeneral(path string, footer app.Footer) http.Handler
 			log.Printf("%s %s: wrote %d bytes in %s\n", r.Method, r.URL.Path, bytesWritten, time.Since(started))
 		}()
 
-		// fetch the session and get the current user. if either fails, return an error
-		user, err := s.extractSession(r)
-		if err != nil && !errors.Is(err, sql.ErrNoRows) {
-			log.Printf("%s %s: extractSession: %v\n", r.Method, r.URL.Path, err)
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
-		} else if user == nil {
-			// there is no active session, so this is an error
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-			return
-		}
+		user := userFromRequest(r)
 		log.Printf("%s %s: session: clan_id %q\n", r.Method, r.URL.Path, user.Clan)
 
 		// trim the user data path for the template
@@ -2374,7 +2249,7 @@ func (s *Server) getSettingsGeneral(path string, footer app.Footer) http.Handler
 		content.LanguageAndDates.TimezoneSelect = general.TimezoneSelectList(user.LanguageAndDates.Timezone.Location)
 		payload.Content = content
 
-		t, err := template.ParseFiles(files...)
+		t, err := s.templates.lookup(files...)
 		if err != nil {
 			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -2401,6 +2276,7 @@ func (s *Server) getSettingsGeneralTimezone(path string) http.HandlerFunc {
 	files := []string{
 		filepath.Join(path, "app", "pages", "settings", "general", "timezone-htmx.gohtml"),
 	}
+	s.templates.register(files...)
 
 	return func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("%s %s: entered\n", r.Method, r.URL.Path)
@@ -2412,19 +2288,9 @@ func (s *Server) getSettingsGeneralTimezone(path string) http.HandlerFunc {
 			return
 		}
 
-		// fetch the session and get the current user. if either fails, return an error
-		user, err := s.extractSession(r)
-		if err != nil && !errors.Is(err, sql.ErrNoRows) {
-			log.Printf("%s %s: extractSession: %v\n", r.Method, r.URL.Path, err)
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
-		} else if user == nil {
-			// there is no active session, so this is an error
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-			return
-		}
+		user := userFromRequest(r)
 
-		t, err := template.ParseFiles(files...)
+		t, err := s.templates.lookup(files...)
 		if err != nil {
 			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -2452,6 +2318,7 @@ func (s *Server) postSettingsGeneralTimezone(path string) http.HandlerFunc {
 	files := []string{
 		filepath.Join(path, "app", "pages", "settings", "general", "timezone-htmx.gohtml"),
 	}
+	s.templates.register(files...)
 
 	return func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("%s %s: entered\n", r.Method, r.URL.Path)
@@ -2466,17 +2333,7 @@ func (s *Server) postSettingsGeneralTimezone(path string) http.HandlerFunc {
 			return
 		}
 
-		// fetch the session and get the current user. if either fails, return an error
-		user, err := s.extractSession(r)
-		if err != nil && !errors.Is(err, sql.ErrNoRows) {
-			log.Printf("%s %s: extractSession: %v\n", r.Method, r.URL.Path, err)
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
-		} else if user == nil {
-			// there is no active session, so this is an error
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-			return
-		}
+		user := userFromRequest(r)
 
 		// pull the parameters from the form
 		newLocation := r.FormValue("timezone-location")
@@ -2495,7 +2352,7 @@ func (s *Server) postSettingsGeneralTimezone(path string) http.HandlerFunc {
 			return
 		}
 
-		t, err := template.ParseFiles(files...)
+		t, err := s.templates.lookup(files...)
 		if err != nil {
 			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -2523,7 +2380,9 @@ func (s *Server) getSettingsPlans(path string, footer app.Footer) http.HandlerFu
 	files := []string{
 		filepath.Join(path, "app", "pages", "settings", "layout.gohtml"),
 		filepath.Join(path, "app", "pages", "settings", "plans", "content.gohtml"),
+		filepath.Join(path, "app", "widgets", "notifications.gohtml"),
 	}
+	s.templates.register(files...)
 
 	content := plans.Content
 	for n := range content.Cards {
@@ -2552,17 +2411,7 @@ func (s *Server) getSettingsPlans(path string, footer app.Footer) http.HandlerFu
 			log.Printf("%s %s: wrote %d bytes in %s\n", r.Method, r.URL.Path, bytesWritten, time.Since(started))
 		}()
 
-		// fetch the session and get the current user. if either fails, return an error
-		user, err := s.extractSession(r)
-		if err != nil && !errors.Is(err, sql.ErrNoRows) {
-			log.Printf("%s %s: extractSession: %v\n", r.Method, r.URL.Path, err)
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
-		} else if user == nil {
-			// there is no active session, so this is an error
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-			return
-		}
+		user := userFromRequest(r)
 		log.Printf("%s %s: session: clan_id %q\n", r.Method, r.URL.Path, user.Clan)
 
 		payload := settings.Layout_t{
@@ -2574,7 +2423,7 @@ func (s *Server) getSettingsPlans(path string, footer app.Footer) http.HandlerFu
 		payload.CurrentPage.Plans = true
 		payload.Footer.Timestamp = time.Now().In(user.LanguageAndDates.Timezone.Location).Format("2006-01-02 15:04:05")
 
-		t, err := template.ParseFiles(files...)
+		t, err := s.templates.lookup(files...)
 		if err != nil {
 			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -2685,6 +2534,8 @@ func (s *Server) clanTurnFileList(user *domains.User_t, turnId string, cacheBust
 			Time:  f.Timestamp.In(user.LanguageAndDates.Timezone.Location).Format("15:04:05"),
 			Route: fmt.Sprintf("/report/%s", f.Name),
 			Path:  f.Path,
+
+			Revisions: f.Revisions,
 		}
 		if cacheBuster {
 			fi.Route += fmt.Sprintf("?ctl=%s", f.Timestamp.In(user.LanguageAndDates.Timezone.Location).Format("2006.01.02.15.04.05"))
@@ -4,13 +4,12 @@ package main
 
 import (
 	"bytes"
-	"html/template"
 	"log"
 	"net/http"
 )
 
 func (s *Server) renderFragment(payload any, templateName string, templateFiles ...string) ([]byte, error) {
-	t, err := template.ParseFiles(templateFiles...)
+	t, err := s.templates.lookup(templateFiles...)
 	if err != nil {
 		log.Printf("%s: %v\n", templateName, err)
 		return nil, err
@@ -47,7 +46,7 @@ func (s *Server) writeFragments(w http.ResponseWriter, r *http.Request, fragment
 }
 
 func (s *Server) writeHtmxFragment(w http.ResponseWriter, r *http.Request, payload any, templateName string, templateFiles ...string) (int, error) {
-	t, err := template.ParseFiles(templateFiles...)
+	t, err := s.templates.lookup(templateFiles...)
 	if err != nil {
 		log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -0,0 +1,220 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+// Package jobs implements the queue that renders maps after a report is uploaded.
+//
+// Jobs are persisted in the database so that a restart does not lose them.
+// A fixed number of workers pull jobs from the queue and run ottomap for the
+// clan and turn, leaving the map in the output folder and the log (or error log)
+// in the logs folder. Those are the folders that ffs.GetClanFiles scans.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mdhender/ottoapp/domains"
+	"github.com/mdhender/ottoapp/notifications"
+	"github.com/mdhender/ottoapp/stores/sqlite"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Queue is a bounded pool of workers that run render jobs.
+type Queue struct {
+	store    *sqlite.DB
+	notifier *notifications.Notifier // nil if notifications are disabled
+	ottomap  string                  // path to the ottomap executable
+	workers  int                     // number of workers in the pool
+	timeout  time.Duration           // maximum time for a single render
+	interval time.Duration           // how often idle workers check the queue
+	wake     chan struct{}
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// New returns a queue that will run jobs with the given executable.
+// The notifier is told when a render finishes. It may be nil.
+// The workers are not started until Start is called.
+func New(store *sqlite.DB, notifier *notifications.Notifier, ottomap string, workers int) (*Queue, error) {
+	if workers < 1 {
+		return nil, domains.ErrInvalidWorkerCount
+	}
+	return &Queue{
+		store:    store,
+		notifier: notifier,
+		ottomap:  ottomap,
+		workers:  workers,
+		timeout:  5 * time.Minute,
+		interval: 30 * time.Second,
+		wake:     make(chan struct{}, workers),
+	}, nil
+}
+
+// Start re-queues any jobs that were running when the server last stopped
+// and then starts the workers.
+func (q *Queue) Start(ctx context.Context) error {
+	if err := q.store.ResetRunningJobs(); err != nil {
+		return err
+	}
+	q.ctx, q.cancel = context.WithCancel(ctx)
+	for n := 1; n <= q.workers; n++ {
+		q.wg.Add(1)
+		go q.worker(n)
+	}
+	log.Printf("jobs: started %d workers\n", q.workers)
+	return nil
+}
+
+// Stop signals the workers to quit and waits for them to finish.
+// A render that is interrupted is left running in the database
+// and will be re-queued the next time the queue is started.
+func (q *Queue) Stop() {
+	if q.cancel == nil {
+		return
+	}
+	q.cancel()
+	q.wg.Wait()
+	log.Printf("jobs: stopped\n")
+}
+
+// Enqueue adds a render job for the user's clan and the turn.
+// It is safe to call after every upload; duplicate requests for a
+// clan and turn that are still waiting in the queue are ignored.
+func (q *Queue) Enqueue(user *domains.User_t, turnId string) error {
+	id, err := q.store.CreateJob(user.ID, user.Clan, turnId)
+	if err != nil {
+		return err
+	} else if id == 0 {
+		log.Printf("jobs: %s: %s: already queued\n", user.Clan, turnId)
+		return nil
+	}
+	log.Printf("jobs: %s: %s: queued job %d\n", user.Clan, turnId, id)
+
+	// nudge an idle worker, but don't block if they are all busy
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (q *Queue) worker(n int) {
+	defer q.wg.Done()
+	for {
+		if q.ctx.Err() != nil {
+			return
+		}
+		job, err := q.store.ClaimNextJob()
+		if err != nil {
+			log.Printf("jobs: worker %d: claim: %v\n", n, err)
+		} else if job != nil {
+			q.run(n, job)
+			continue
+		}
+		select {
+		case <-q.ctx.Done():
+			return
+		case <-q.wake:
+		case <-time.After(q.interval):
+		}
+	}
+}
+
+// run renders the map for a single job and records the outcome.
+func (q *Queue) run(n int, job *domains.Job_t) {
+	started := time.Now()
+	log.Printf("jobs: worker %d: job %d: %s: %s: running\n", n, job.ID, job.Clan, job.TurnId)
+
+	err := q.render(job)
+	if q.ctx.Err() != nil {
+		// the server is shutting down. leave the job as running so that it is re-queued.
+		log.Printf("jobs: worker %d: job %d: interrupted\n", n, job.ID)
+		return
+	}
+
+	status, message := domains.JobSucceeded, ""
+	if err != nil {
+		status, message = domains.JobFailed, err.Error()
+	}
+	if err := q.store.FinishJob(job.ID, status, message); err != nil {
+		log.Printf("jobs: worker %d: job %d: finish: %v\n", n, job.ID, err)
+	}
+	log.Printf("jobs: worker %d: job %d: %s in %v\n", n, job.ID, status, time.Since(started))
+
+	event := domains.EventMapRendered
+	title := fmt.Sprintf("Map ready for turn %s", job.TurnId)
+	body := fmt.Sprintf("The map for clan %s, turn %s, is ready to download.", job.Clan, job.TurnId)
+	if err != nil {
+		event = domains.EventRenderFailed
+		title = fmt.Sprintf("Map failed for turn %s", job.TurnId)
+		body = fmt.Sprintf("We could not render the map for clan %s, turn %s. The error log is on your dashboard.", job.Clan, job.TurnId)
+	}
+	if err := q.notifier.Notify(job.UserID, event, "", title, body); err != nil {
+		log.Printf("jobs: worker %d: job %d: notify: %v\n", n, job.ID, err)
+	}
+}
+
+// render runs ottomap from the clan's root folder, the same way the old
+// scheduler script did. The ottomap log is saved as the turn's .log file
+// if the render succeeds, or as the turn's .err file if it fails.
+func (q *Queue) render(job *domains.Job_t) error {
+	user, err := q.store.GetUser(job.UserID)
+	if err != nil {
+		return err
+	}
+
+	logsPath := filepath.Join(user.Data, "logs")
+	if err := os.MkdirAll(logsPath, 0755); err != nil {
+		return err
+	} else if err := os.MkdirAll(filepath.Join(user.Data, "output"), 0755); err != nil {
+		return err
+	}
+	logFile := filepath.Join(logsPath, fmt.Sprintf("%s.%s.log", job.TurnId, job.Clan))
+	errorFile := filepath.Join(logsPath, fmt.Sprintf("%s.%s.err", job.TurnId, job.Clan))
+	tmpFile := filepath.Join(logsPath, fmt.Sprintf("%s.%s.tmp", job.TurnId, job.Clan))
+	for _, path := range []string{logFile, errorFile, tmpFile} {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	defer func() {
+		_ = os.Remove(tmpFile)
+	}()
+
+	ctx, cancel := context.WithTimeout(q.ctx, q.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, q.ottomap, "render",
+		"--log-file", tmpFile,
+		"--clan-id", job.Clan,
+		"--max-turn", job.TurnId,
+		"--show-grid-coords",
+		"--shift-map",
+		"--save-with-turn-id",
+		"--auto-eol",
+	)
+	cmd.Dir = filepath.Dir(user.Data)
+	output, renderErr := cmd.CombinedOutput()
+
+	// prefer the log that ottomap wrote. if it failed before creating one,
+	// fall back to whatever it printed.
+	data, err := os.ReadFile(tmpFile)
+	if err != nil || len(data) == 0 {
+		data = output
+	}
+	if renderErr != nil {
+		if ctx.Err() != nil {
+			renderErr = ctx.Err()
+		}
+		data = append(data, []byte(fmt.Sprintf("\nrender failed: %v\n", renderErr))...)
+		if err := os.WriteFile(errorFile, data, 0644); err != nil {
+			log.Printf("jobs: job %d: %v\n", job.ID, err)
+		}
+		return renderErr
+	}
+	return os.WriteFile(logFile, data, 0644)
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package jobs
+
+import (
+	"context"
+	"github.com/mdhender/ottoapp/domains"
+	"github.com/mdhender/ottoapp/stores/sqlite"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		script  string
+		status  domains.JobStatus
+		message string
+		file    string // the log file that should be left for the dashboard
+		want    string // text expected in the log file
+	}{
+		{"succeeded", "echo rendered 0138\nexit 0\n", domains.JobSucceeded, "", "0901-04.0138.log", "rendered 0138"},
+		{"failed", "echo bad hex\nexit 3\n", domains.JobFailed, "exit status 3", "0901-04.0138.err", "bad hex"},
+	} {
+		q, store, user := testQueue(t, tc.script, 1)
+		q.ctx, q.cancel = context.WithCancel(context.Background())
+		if err := q.Enqueue(user, "0901-04"); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		job, err := store.ClaimNextJob()
+		if err != nil || job == nil {
+			t.Fatalf("%s: claim: %+v %v", tc.name, job, err)
+		}
+		q.run(1, job)
+		q.cancel()
+
+		if got, err := store.GetJob(job.ID); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		} else if got.Status != tc.status || got.ErrorMessage != tc.message {
+			t.Errorf("%s: want %s %q, got %s %q", tc.name, tc.status, tc.message, got.Status, got.ErrorMessage)
+		}
+		if data, err := os.ReadFile(filepath.Join(user.Data, "logs", tc.file)); err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+		} else if !strings.Contains(string(data), tc.want) {
+			t.Errorf("%s: want %q in log, got %q", tc.name, tc.want, data)
+		}
+	}
+}
+
+func TestWorkersDoNotOverlapClan(t *testing.T) {
+	// the script fails if another render is running in the clan's folder
+	script := "mkdir render.lock || { echo overlapping render; exit 1; }\nsleep 0.3\nrmdir render.lock\n"
+	q, store, user := testQueue(t, script, 2)
+	if err := q.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer q.Stop()
+
+	for _, turnId := range []string{"0901-04", "0901-05"} {
+		if err := q.Enqueue(user, turnId); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// job ids start at 1 in a new database
+	for _, id := range []domains.ID{1, 2} {
+		for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(20 * time.Millisecond) {
+			job, err := store.GetJob(id)
+			if err != nil {
+				t.Fatal(err)
+			} else if job.Status == domains.JobSucceeded {
+				break
+			} else if job.Status == domains.JobFailed {
+				t.Fatalf("job %d: %s", id, job.ErrorMessage)
+			} else if time.Now().After(deadline) {
+				t.Fatalf("job %d: still %s", id, job.Status)
+			}
+		}
+	}
+}
+
+// testQueue returns a queue that runs a shell script in place of ottomap,
+// along with its store and a user for clan 0138.
+func testQueue(t *testing.T, script string, workers int) (*Queue, *sqlite.DB, *domains.User_t) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake ottomap is a shell script")
+	}
+	path, ctx := t.TempDir(), context.Background()
+	dbPath := filepath.Join(path, "test.db")
+	if err := sqlite.Create(dbPath, false, "", "", path, "admin-secret", "", ctx); err != nil {
+		t.Fatal(err)
+	}
+	store, err := sqlite.Open(dbPath, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = store.Close()
+	})
+	created, err := store.CreateUser("clan0138@ottomap", "a-long-password", "0138", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := store.GetUser(created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ottomap := filepath.Join(path, "ottomap.sh")
+	if err := os.WriteFile(ottomap, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	q, err := New(store, nil, ottomap, workers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q, store, user
+}
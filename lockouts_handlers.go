@@ -0,0 +1,145 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/mdhender/ottoapp/components/app"
+	"github.com/mdhender/ottoapp/components/app/pages/admin"
+	"github.com/mdhender/ottoapp/domains"
+	"log"
+	"net/http"
+	"path/filepath"
+	"time"
+)
+
+// getAdminLockouts shows the clans and addresses with failed sign ins and the recent lockouts.
+func (s *Server) getAdminLockouts(path string, footer app.Footer) http.HandlerFunc {
+	files := []string{
+		filepath.Join(path, "app", "layout.gohtml"),
+		filepath.Join(path, "app", "pages", "admin", "lockouts.gohtml"),
+		filepath.Join(path, "app", "widgets", "notifications.gohtml"),
+	}
+	s.templates.register(files...)
+	const maxEvents = 50
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		started, bytesWritten := time.Now(), 0
+		log.Printf("%s %s: entered\n", r.Method, r.URL.Path)
+		defer func() {
+			log.Printf("%s %s: wrote %d bytes in %s\n", r.Method, r.URL.Path, bytesWritten, time.Since(started))
+		}()
+
+		if r.Method != "GET" {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		user := userFromRequest(r)
+
+		now := time.Now().UTC()
+		failures, err := s.stores.store.GetLoginFailures(now.Add(-loginFailureWindow))
+		if err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		events, err := s.stores.store.GetRecentLockoutEvents(maxEvents)
+		if err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		loc := user.LanguageAndDates.Timezone.Location
+		var content admin.Lockouts_t
+		for _, lf := range failures {
+			content.Failures = append(content.Failures, admin.LoginFailure_t{
+				Scope:       lf.Scope,
+				Subject:     lf.Subject,
+				Failures:    lf.Failures,
+				Lockouts:    lf.Lockouts,
+				LastFailure: lf.LastFailureAt.In(loc).Format("2006-01-02 15:04"),
+				Locked:      now.Before(lf.LockedUntil),
+				LockedUntil: lf.LockedUntil.In(loc).Format("2006-01-02 15:04"),
+			})
+		}
+		for _, event := range events {
+			content.Events = append(content.Events, admin.LockoutEvent_t{
+				Scope:       event.Scope,
+				Subject:     event.Subject,
+				Clan:        event.Clan,
+				ClientIP:    event.ClientIP,
+				Failures:    event.Failures,
+				Created:     event.CreatedAt.In(loc).Format("2006-01-02 15:04"),
+				LockedUntil: event.LockedUntil.In(loc).Format("2006-01-02 15:04"),
+			})
+		}
+
+		payload := app.Layout{
+			Title:   fmt.Sprintf("Clan %s", user.Clan),
+			Heading: "Lockouts",
+			Content: content,
+			Footer:  footer,
+		}
+		payload.Footer.Timestamp = time.Now().In(loc).Format("2006-01-02 15:04:05")
+
+		t, err := s.templates.lookup(files...)
+		if err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		// parse into a buffer so that we can handle errors without writing to the response
+		buf := &bytes.Buffer{}
+		if err := t.Execute(buf, payload); err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		bytesWritten, _ = w.Write(buf.Bytes())
+	}
+}
+
+// deleteAdminLockoutsScopeSubject clears the failed attempts and any lock for a clan or address.
+func (s *Server) deleteAdminLockoutsScopeSubject() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("%s %s: entered\n", r.Method, r.URL.Path)
+		if r.Method != "DELETE" {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		} else if r.Header.Get("HX-Request") != "true" {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		user := userFromRequest(r)
+
+		scope, subject := r.PathValue("scope"), r.PathValue("subject")
+		if !(scope == domains.LoginScopeClan || scope == domains.LoginScopeIP) {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		if err := s.stores.store.DeleteLoginFailure(scope, subject); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+				return
+			}
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		log.Printf("%s %s: clan %q: cleared %s %q\n", r.Method, r.URL.Path, user.Clan, scope, subject)
+		s.audit(r, user.Clan, domains.AuditLockoutClear, fmt.Sprintf("%s %s", scope, subject))
+
+		w.Header().Set("HX-Refresh", "true")
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/mdhender/ottoapp/domains"
+	"log"
+	"time"
+)
+
+// Failed sign in attempts are tracked for both the clan and the client address.
+// After a few free attempts, each failure doubles the time the client must wait
+// before trying again. Enough failures lock the clan or address for a while,
+// and each lockout is twice as long as the one before.
+//
+// Addresses get more attempts than clans because players may share an address.
+
+type loginLimit struct {
+	freeAttempts int // failures allowed before the backoff starts
+	lockAfter    int // failures that trigger a lockout
+}
+
+var loginLimits = map[string]loginLimit{
+	domains.LoginScopeClan: {freeAttempts: 3, lockAfter: 10},
+	domains.LoginScopeIP:   {freeAttempts: 5, lockAfter: 25},
+}
+
+const (
+	loginBackoffMax    = 5 * time.Minute
+	loginLockout       = 15 * time.Minute
+	loginLockoutMax    = 24 * time.Hour
+	loginFailureWindow = 24 * time.Hour // failures and lockouts are forgotten after a day without failures
+)
+
+// countLoginAttempt counts a sign in attempt against the clan and the address before the
+// password is checked. It returns how long the client must wait if the attempt is refused.
+//
+// The attempt is counted first so that requests made at the same time can't all pass the
+// check before any of them is recorded as a failure. A successful sign in takes it back
+// with clearLoginFailures.
+//
+// A subject that has failed too many times is locked when it tries again, and that attempt
+// is refused.
+func (s *Server) countLoginAttempt(clanId, ip string) (time.Duration, error) {
+	now := time.Now().UTC()
+	subjects := []*domains.LoginFailure_t{
+		{Scope: domains.LoginScopeClan, Subject: clanId},
+		{Scope: domains.LoginScopeIP, Subject: ip},
+	}
+	list, counted, err := s.stores.store.CountLoginAttempt(subjects, now, now.Add(-loginFailureWindow), func(lf *domains.LoginFailure_t) *domains.LockoutEvent_t {
+		// the count includes this attempt, so it must wait for the backoff if it fails
+		failures := lf.Failures - 1
+		if failures < loginLimits[lf.Scope].lockAfter {
+			lf.RetryAt = now.Add(loginBackoff(lf.Scope, lf.Failures))
+			return nil
+		}
+
+		lf.Lockouts++
+		duration := loginLockout << (lf.Lockouts - 1)
+		if duration <= 0 || duration > loginLockoutMax {
+			duration = loginLockoutMax
+		}
+		lf.LockedUntil = now.Add(duration)
+		log.Printf("login: %s %q: locked for %v after %d failures (lockout %d)\n", lf.Scope, lf.Subject, duration, failures, lf.Lockouts)
+		// the lockout replaces the backoff, so start counting again when it ends
+		lf.Failures, lf.RetryAt = 0, time.Time{}
+		return &domains.LockoutEvent_t{
+			Scope:       lf.Scope,
+			Subject:     lf.Subject,
+			Clan:        clanId,
+			ClientIP:    ip,
+			Failures:    failures,
+			CreatedAt:   now,
+			LockedUntil: lf.LockedUntil,
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// a counted attempt may still be refused if it locked the clan or the address
+	var wait time.Duration
+	for _, lf := range list {
+		wait = max(wait, lf.LockedUntil.Sub(now))
+		if !counted {
+			wait = max(wait, lf.RetryAt.Sub(now))
+		}
+	}
+	return wait, nil
+}
+
+// clearLoginFailures forgets the failed attempts for the clan after a successful sign in.
+// The address is not cleared; otherwise an attacker with one account could use it
+// to reset their counter while guessing the passwords for other clans. Only the
+// attempt that succeeded is taken back.
+func (s *Server) clearLoginFailures(clanId, ip string) error {
+	if err := s.stores.store.DeleteLoginFailure(domains.LoginScopeClan, clanId); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	return s.stores.store.UncountLoginAttempt(domains.LoginScopeIP, ip)
+}
+
+// loginBackoff returns the delay required after the given number of failures.
+func loginBackoff(scope string, failures int) time.Duration {
+	n := failures - loginLimits[scope].freeAttempts
+	if n <= 0 {
+		return 0
+	}
+	backoff := time.Second << (n - 1)
+	if backoff <= 0 || backoff > loginBackoffMax {
+		return loginBackoffMax
+	}
+	return backoff
+}
+
+// retryAfterText returns a short description of the wait for the sign in page.
+func retryAfterText(wait time.Duration) string {
+	if seconds := int((wait + time.Second - 1) / time.Second); seconds <= 1 {
+		return "a second"
+	} else if seconds < 90 {
+		return fmt.Sprintf("%d seconds", seconds)
+	}
+	return fmt.Sprintf("%d minutes", int((wait+time.Minute-1)/time.Minute))
+}
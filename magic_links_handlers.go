@@ -0,0 +1,326 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/mdhender/ottoapp/components/app"
+	"github.com/mdhender/ottoapp/components/app/pages/admin"
+	"github.com/mdhender/ottoapp/components/pages"
+	"github.com/mdhender/ottoapp/domains"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultMagicLinkHours = 24
+	maxMagicLinkHours     = 7 * 24
+)
+
+// getLoginClanIdMagicLink shows the page used to sign in if the magic link is valid.
+//
+// Mail scanners and link previews fetch the links in a message, so the link is
+// only used when the user submits the form on this page.
+func (s *Server) getLoginClanIdMagicLink(path string) http.HandlerFunc {
+	files := []string{
+		filepath.Join(path, "pages", "magic_link.gohtml"),
+	}
+	s.templates.register(files...)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("%s %s: entered\n", r.Method, r.URL.Path)
+		if r.Method != "GET" {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		clanId, ok := magicLinkClanId(r)
+		if !ok {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		token := r.PathValue("magic_link")
+
+		if _, err := s.stores.store.CheckMagicLink(clanId, token); err != nil {
+			payload, status := magicLinkFailed(clanId, err)
+			if status == http.StatusInternalServerError {
+				log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			log.Printf("%s %s: clan %q: %v\n", r.Method, r.URL.Path, clanId, err)
+			s.writeMagicLinkPage(w, r, status, payload, files...)
+			return
+		}
+
+		payload := pages.MagicLink{
+			ClanId:  clanId,
+			Token:   token,
+			Heading: fmt.Sprintf("Sign in as clan %s", clanId),
+			Message: "This link signs you in once. It stops working after you use it.",
+		}
+		s.writeMagicLinkPage(w, r, http.StatusOK, payload, files...)
+	}
+}
+
+// postLoginClanIdMagicLink redeems a magic link and starts a normal session.
+//
+// The session cookie is SameSite=Strict. The form is on our own page, so the
+// browser sends the new cookie on the refresh to the dashboard.
+func (s *Server) postLoginClanIdMagicLink(path string) http.HandlerFunc {
+	files := []string{
+		filepath.Join(path, "pages", "magic_link.gohtml"),
+	}
+	s.templates.register(files...)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("%s %s: entered\n", r.Method, r.URL.Path)
+		if r.Method != "POST" {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		clanId, ok := magicLinkClanId(r)
+		if !ok {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		// the user agent is saved with the link, so limit the length
+		userAgent := r.UserAgent()
+		if len(userAgent) > 256 {
+			userAgent = userAgent[:256]
+		}
+
+		user, err := s.stores.store.RedeemMagicLink(clanId, r.PathValue("magic_link"), userAgent)
+		if err != nil {
+			payload, status := magicLinkFailed(clanId, err)
+			if status == http.StatusInternalServerError {
+				log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			log.Printf("%s %s: clan %q: %v\n", r.Method, r.URL.Path, clanId, err)
+			s.writeMagicLinkPage(w, r, status, payload, files...)
+			return
+		}
+		if err := s.startSession(w, r, user); err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		log.Printf("%s %s: clan %q: signed in with magic link\n", r.Method, r.URL.Path, user.Clan)
+		s.audit(r, user.Clan, domains.AuditLoginMagicLink, "")
+
+		payload := pages.MagicLink{
+			SignedIn: true,
+			ClanId:   clanId,
+			Heading:  "You're signed in",
+			Message:  "Taking you to your dashboard.",
+		}
+		s.writeMagicLinkPage(w, r, http.StatusOK, payload, files...)
+	}
+}
+
+// magicLinkClanId returns the clan from the link path.
+func magicLinkClanId(r *http.Request) (string, bool) {
+	clanId := r.PathValue("clan_id")
+	if len(clanId) != 4 {
+		return "", false
+	} else if n, err := strconv.Atoi(clanId); err != nil || n < 0 || n > 999 {
+		return "", false
+	}
+	return clanId, true
+}
+
+// magicLinkFailed returns the page and status for a link that can't be used.
+// The status is StatusInternalServerError if the error isn't about the link.
+func magicLinkFailed(clanId string, err error) (pages.MagicLink, int) {
+	payload := pages.MagicLink{ClanId: clanId}
+	switch {
+	case errors.Is(err, domains.ErrMagicLinkUsed):
+		payload.Heading = "This link has already been used"
+		payload.Message = "Magic links only work once. Sign in with your password, or ask an administrator for a new link."
+		return payload, http.StatusGone
+	case errors.Is(err, domains.ErrMagicLinkExpired):
+		payload.Heading = "This link has expired"
+		payload.Message = "Sign in with your password, or ask an administrator for a new link."
+		return payload, http.StatusGone
+	case errors.Is(err, domains.ErrMagicLinkInvalid):
+		payload.Heading = "This link is not valid"
+		payload.Message = "Check that you copied the whole link, or ask an administrator for a new one."
+		return payload, http.StatusNotFound
+	}
+	return payload, http.StatusInternalServerError
+}
+
+func (s *Server) writeMagicLinkPage(w http.ResponseWriter, r *http.Request, status int, payload pages.MagicLink, files ...string) {
+	t, err := s.templates.lookup(files...)
+	if err != nil {
+		log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	// parse into a buffer so that we can handle errors without writing to the response
+	buf := &bytes.Buffer{}
+	if err := t.Execute(buf, payload); err != nil {
+		log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_, _ = w.Write(buf.Bytes())
+}
+
+func (s *Server) getAdminMagicLinks(path string, footer app.Footer) http.HandlerFunc {
+	files := []string{
+		filepath.Join(path, "app", "layout.gohtml"),
+		filepath.Join(path, "app", "pages", "admin", "magic_links.gohtml"),
+		filepath.Join(path, "app", "widgets", "notifications.gohtml"),
+	}
+	s.templates.register(files...)
+	const maxLinks = 25
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		started, bytesWritten := time.Now(), 0
+		log.Printf("%s %s: entered\n", r.Method, r.URL.Path)
+		defer func() {
+			log.Printf("%s %s: wrote %d bytes in %s\n", r.Method, r.URL.Path, bytesWritten, time.Since(started))
+		}()
+
+		if r.Method != "GET" {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		user := userFromRequest(r)
+
+		links, err := s.stores.store.GetRecentMagicLinks(maxLinks)
+		if err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		loc, now := user.LanguageAndDates.Timezone.Location, time.Now().UTC()
+		content := admin.MagicLinks_t{
+			Form: admin.MagicLinkForm_t{Hours: defaultMagicLinkHours},
+		}
+		for _, link := range links {
+			ml := admin.MagicLink_t{
+				Clan:      link.Clan,
+				Created:   link.CreatedAt.In(loc).Format("2006-01-02 15:04"),
+				Expires:   link.ExpiresAt.In(loc).Format("2006-01-02 15:04"),
+				Status:    "Unused",
+				UserAgent: link.UsedUserAgent,
+			}
+			if !link.UsedAt.IsZero() {
+				ml.Status, ml.Used = "Used", link.UsedAt.In(loc).Format("2006-01-02 15:04")
+			} else if !now.Before(link.ExpiresAt) {
+				ml.Status = "Expired"
+			}
+			content.Links = append(content.Links, ml)
+		}
+
+		payload := app.Layout{
+			Title:   fmt.Sprintf("Clan %s", user.Clan),
+			Heading: "Magic links",
+			Content: content,
+			Footer:  footer,
+		}
+		payload.Footer.Timestamp = time.Now().In(loc).Format("2006-01-02 15:04:05")
+
+		t, err := s.templates.lookup(files...)
+		if err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		// parse into a buffer so that we can handle errors without writing to the response
+		buf := &bytes.Buffer{}
+		if err := t.Execute(buf, payload); err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		bytesWritten, _ = w.Write(buf.Bytes())
+	}
+}
+
+// postAdminMagicLinks creates a magic link for a clan and shows it to the administrator.
+func (s *Server) postAdminMagicLinks(path string) http.HandlerFunc {
+	files := []string{
+		filepath.Join(path, "app", "pages", "admin", "magic_links.gohtml"),
+	}
+	s.templates.register(files...)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("%s %s: entered\n", r.Method, r.URL.Path)
+		if r.Method != "POST" {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		} else if r.Header.Get("HX-Request") != "true" {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		} else if contentType := r.Header.Get("Content-Type"); !(contentType == "application/x-www-form-urlencoded" || strings.HasPrefix(contentType, "application/x-www-form-urlencoded;")) {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		user := userFromRequest(r)
+
+		form := admin.MagicLinkForm_t{
+			ClanId: strings.TrimSpace(r.FormValue("clan")),
+			Hours:  defaultMagicLinkHours,
+		}
+		if hours, err := strconv.Atoi(r.FormValue("hours")); err == nil {
+			form.Hours = hours
+		}
+		// accept "138" as well as "0138"
+		clanNo, err := strconv.Atoi(form.ClanId)
+		if err != nil {
+			clanNo = 0
+		} else if 1 <= clanNo && clanNo <= 999 {
+			form.ClanId = fmt.Sprintf("%04d", clanNo)
+		}
+
+		if form.Hours < 1 || form.Hours > maxMagicLinkHours {
+			form.Error = fmt.Sprintf("Links must expire in 1 to %d hours.", maxMagicLinkHours)
+		} else if clanNo < 1 || clanNo > 999 {
+			form.Error = "Please enter a clan number between 0001 and 0999."
+		} else if target, err := s.stores.store.GetUserByClan(form.ClanId); err != nil {
+			log.Printf("%s %s: clan %q: %v\n", r.Method, r.URL.Path, form.ClanId, err)
+			form.Error = fmt.Sprintf("There is no user for clan %s.", form.ClanId)
+		} else if token, expiresAt, err := s.stores.store.CreateMagicLink(target, user.ID, time.Duration(form.Hours)*time.Hour); err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		} else {
+			log.Printf("%s %s: clan %q: created magic link for clan %q\n", r.Method, r.URL.Path, user.Clan, form.ClanId)
+			s.audit(r, user.Clan, domains.AuditMagicLink, fmt.Sprintf("clan %s: expires %s", form.ClanId, expiresAt.Format(time.RFC3339)))
+			form.URL = magicLinkURL(s.baseURL, form.ClanId, token)
+			form.Expires = expiresAt.In(user.LanguageAndDates.Timezone.Location).Format("2006-01-02 15:04")
+		}
+
+		_, _ = s.writeHtmxFragment(w, r, form, "magic-link-form", files...)
+	}
+}
+
+// magicLinkURL returns the address that redeems the token.
+func magicLinkURL(baseURL, clanId, token string) string {
+	return fmt.Sprintf("%s/login/%s/%s", baseURL, clanId, token)
+}
@@ -5,6 +5,7 @@ package main
 
 import (
 	"bytes"
+	"github.com/mdhender/ottoapp/charset"
 	"github.com/mdhender/semver"
 	"github.com/spf13/cobra"
 	"log"
@@ -52,20 +53,22 @@ func main() {
 	cmdDb.AddCommand(cmdDbInit)
 	cmdDbInit.Flags().BoolVarP(&argsDb.force, "force", "f", false, "force the creation even if the database exists")
 	cmdDbInit.Flags().StringVar(&argsDb.secrets.admin, "admin-password", "", "optional password for the admin user")
-	cmdDbInit.Flags().StringVarP(&argsDb.paths.assets, "assets", "a", "", "path to the assets directory")
-	if err := cmdDbInit.MarkFlagRequired("assets"); err != nil {
-		log.Fatalf("error: assets: %v\n", err)
-	}
-	cmdDbInit.Flags().StringVarP(&argsDb.paths.components, "components", "t", "", "path to the components directory")
-	if err := cmdDbInit.MarkFlagRequired("components"); err != nil {
-		log.Fatalf("error: components: %v\n", err)
-	}
+	cmdDbInit.Flags().StringVarP(&argsDb.paths.assets, "assets", "a", "", "optional directory of assets that override the embedded assets")
+	cmdDbInit.Flags().StringVarP(&argsDb.paths.components, "components", "t", "", "optional directory of components that override the embedded components")
 	cmdDbInit.Flags().StringVarP(&argsDb.paths.data, "data", "d", "", "path to the data files directory")
 	if err := cmdDbInit.MarkFlagRequired("data"); err != nil {
 		log.Fatalf("error: data: %v\n", err)
 	}
 	cmdDbInit.Flags().StringVarP(&argsDb.secrets.signing, "secret", "s", "", "new secret for signing tokens")
 
+	cmdDb.AddCommand(cmdDbAudit)
+	cmdDbAudit.AddCommand(cmdDbAuditExport)
+	cmdDbAuditExport.Flags().StringVarP(&argsDb.data.audit.output, "output", "o", "", "file to write the events to (default is stdout)")
+	cmdDbAuditExport.Flags().StringVar(&argsDb.data.audit.actor, "actor", "", "export only events for this clan")
+	cmdDbAuditExport.Flags().StringVar(&argsDb.data.audit.action, "action", "", "export only events with this action")
+	cmdDbAuditExport.Flags().StringVar(&argsDb.data.audit.since, "since", "", "first day to export (YYYY-MM-DD, UTC)")
+	cmdDbAuditExport.Flags().StringVar(&argsDb.data.audit.until, "until", "", "last day to export (YYYY-MM-DD, UTC)")
+
 	cmdDb.AddCommand(cmdDbCreate)
 	cmdDbCreate.AddCommand(cmdDbCreateUser)
 	cmdDbCreateUser.Flags().StringVarP(&argsDb.data.user.clan, "clan-id", "c", "", "clan number for user")
@@ -80,6 +83,14 @@ func main() {
 	cmdDbCreateUser.Flags().StringVarP(&argsDb.data.user.timezone, "timezone", "t", "UTC", "timezone for user")
 	cmdDbCreateUser.Flags().BoolVar(&argsDb.data.user.usePhrase, "use-phrases", false, "generate secret phrase for user")
 
+	cmdDbCreate.AddCommand(cmdDbCreateMagicLink)
+	cmdDbCreateMagicLink.Flags().StringVarP(&argsDb.data.user.clan, "clan-id", "c", "", "clan number for user")
+	if err := cmdDbCreateMagicLink.MarkFlagRequired("clan-id"); err != nil {
+		log.Fatalf("error: clan-id: %v\n", err)
+	}
+	cmdDbCreateMagicLink.Flags().IntVar(&argsDb.data.magicLink.hours, "hours", defaultMagicLinkHours, "number of hours until the link expires")
+	cmdDbCreateMagicLink.Flags().StringVar(&argsDb.data.magicLink.baseURL, "base-url", "http://localhost:29631", "scheme and host of the server")
+
 	cmdDb.AddCommand(cmdDbDelete)
 	cmdDbDelete.AddCommand(cmdDbDeleteUser)
 	cmdDbDeleteUser.Flags().StringVarP(&argsDb.data.user.clan, "clan-id", "c", "", "clan number for user")
@@ -87,6 +98,14 @@ func main() {
 		log.Fatalf("error: clan-id: %v\n", err)
 	}
 
+	cmdDbDelete.AddCommand(cmdDbDeleteLockouts)
+	cmdDbDeleteLockouts.Flags().StringVarP(&argsDb.data.user.clan, "clan-id", "c", "", "clan to clear")
+	cmdDbDeleteLockouts.Flags().StringVar(&argsDb.data.lockout.ip, "ip", "", "client address to clear")
+	cmdDbDeleteLockouts.Flags().BoolVar(&argsDb.data.lockout.all, "all", false, "clear all clans and addresses")
+
+	cmdDb.AddCommand(cmdDbList)
+	cmdDbList.AddCommand(cmdDbListLockouts)
+
 	cmdDb.AddCommand(cmdDbUpdate)
 	cmdDbUpdate.Flags().BoolVar(&argsDb.secrets.useRandomSecret, "use-random-secret", false, "generate a new random secret for signing tokens")
 	cmdDbUpdate.Flags().StringVar(&argsDb.secrets.admin, "admin-password", "", "update password for the admin user")
@@ -116,9 +135,20 @@ func main() {
 	if err := cmdServe.MarkFlagRequired("database"); err != nil {
 		log.Fatalf("error: database: %v\n", err)
 	}
+	cmdServe.Flags().StringVar(&argsServe.server.baseURL, "base-url", "", "scheme and host that users reach the server at, used for e-mailed and shared links (default http://host:port)")
 	cmdServe.Flags().StringVar(&argsServe.server.host, "host", "localhost", "host to serve on")
 	cmdServe.Flags().StringVar(&argsServe.server.port, "port", "29631", "port to bind to")
+	cmdServe.Flags().StringVar(&argsServe.paths.ottomap, "ottomap", "ottomap", "path to the ottomap executable used to render maps")
+	cmdServe.Flags().IntVar(&argsServe.render.workers, "render-workers", 2, "number of map render workers (0 disables rendering)")
 	cmdServe.Flags().BoolVar(&argsServe.server.static, "serve-static-files", true, "serve static files from the assets directory")
+	cmdServe.Flags().BoolVar(&argsServe.server.dev, "dev", false, "development mode: rebuild templates when the components change")
+	cmdServe.Flags().StringVar(&argsServe.mailer.kind, "mailer", "smtp", "how to deliver e-mail: smtp, stdout, or file (stdout and file are for development)")
+	cmdServe.Flags().StringVar(&argsServe.mailer.file, "mailer-file", "", "file that the file mailer appends messages to")
+	cmdServe.Flags().StringVar(&argsServe.smtp.host, "smtp-host", "", "smtp server for notification e-mails (e-mail is disabled if not set)")
+	cmdServe.Flags().StringVar(&argsServe.smtp.port, "smtp-port", "587", "smtp server port")
+	cmdServe.Flags().StringVar(&argsServe.smtp.username, "smtp-username", "", "smtp username (no authentication if not set)")
+	cmdServe.Flags().StringVar(&argsServe.smtp.password, "smtp-password", "", "smtp password")
+	cmdServe.Flags().StringVar(&argsServe.smtp.from, "smtp-from", "ottomap@localhost", "from address for notification e-mails")
 
 	cmdRoot.AddCommand(cmdVersion)
 
@@ -136,23 +166,12 @@ func isBlankLine(line []byte) bool {
 	return len(line) == 0
 }
 
-// replaceInvalidUTF8 replaces all invalid UTF-8 sequences in a byte slice with spaces.
-func replaceInvalidUTF8(data []byte) []byte {
-	// no op until we figure out how to handle invalid UTF-8 sequences
-	return data
-	//var result []byte
-	//for len(data) > 0 {
-	//	if r, size := utf8.DecodeRune(data); r == utf8.RuneError && size == 1 {
-	//		// Invalid UTF-8 byte found, replace with space.
-	//		result = append(result, ' ')
-	//		data = data[1:] // Move to the next byte.
-	//	} else {
-	//		// Valid rune, copy it to the result.
-	//		result = append(result, data[:size]...)
-	//		data = data[size:] // Move past the valid rune.
-	//	}
-	//}
-	//return result
+// replaceInvalidUTF8 repairs the character encoding of a report.
+// Bytes that are not valid UTF-8 are decoded as Windows-1252, typographic
+// punctuation is replaced with ASCII, and control characters are removed.
+// The summary lists the changes so that we can show them to the user.
+func replaceInvalidUTF8(data []byte) ([]byte, charset.Summary_t) {
+	return charset.Repair(data)
 }
 
 // trim leading blank lines from the slice of byte slices
@@ -0,0 +1,347 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/mdhender/ottoapp/components/app"
+	"github.com/mdhender/ottoapp/components/app/pages/maps"
+	"github.com/mdhender/ottoapp/components/app/pages/maps/preview"
+	"github.com/mdhender/ottoapp/components/app/widgets"
+	"github.com/mdhender/ottoapp/domains"
+	"github.com/mdhender/ottoapp/wxx"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// getMapMapIdPreview renders the Worldographer map as SVG so that players
+// can look at the map without installing Worldographer.
+func (s *Server) getMapMapIdPreview(path string, footer app.Footer) http.HandlerFunc {
+	files := []string{
+		filepath.Join(path, "app", "layout.gohtml"),
+		filepath.Join(path, "app", "pages", "maps", "preview", "content.gohtml"),
+		filepath.Join(path, "app", "widgets", "notifications.gohtml"),
+	}
+	s.templates.register(files...)
+	rxMap := regexp.MustCompile(`^(\d{4})-(\d{2}).(\d{4})\.wxx$`)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		started, bytesWritten := time.Now(), 0
+		log.Printf("%s %s: entered\n", r.Method, r.URL.Path)
+		defer func() {
+			log.Printf("%s %s: wrote %d bytes in %s\n", r.Method, r.URL.Path, bytesWritten, time.Since(started))
+		}()
+
+		user := userFromRequest(r)
+
+		mapId := r.PathValue("map_id")
+		matches := rxMap.FindStringSubmatch(mapId)
+		if len(matches) != 4 {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+
+		// validate every field of the map id
+		if year, err := strconv.Atoi(matches[1]); err != nil || year < 899 || year > 1380 {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		} else if month, err := strconv.Atoi(matches[2]); err != nil || month < 1 || month > 12 {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		} else if clan, err := strconv.Atoi(matches[3]); err != nil || clan < 1 || clan > 1000 {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+
+		// does the file exist in the userdata directory or has it been shared with the user?
+		path, ok := s.mapFilePath(user, mapId)
+		if !ok {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+
+		content := preview.Content_t{
+			MapId: mapId,
+			Route: fmt.Sprintf("/map/%s", mapId),
+		}
+		if m, err := wxx.Decode(data); err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			content.Message = "We were unable to read this map. You can still download it and open it in Worldographer."
+		} else {
+			content.Width, content.Height, content.Labels = m.TilesWide, m.TilesHigh, len(m.Labels)
+			content.SVG = template.HTML(m.SVG())
+		}
+
+		payload := app.Layout{
+			Title:   fmt.Sprintf("Clan %s", user.Clan),
+			Heading: "Maps",
+			Content: content,
+			Footer:  footer,
+		}
+		payload.CurrentPage.Maps = true
+		payload.Footer.Timestamp = time.Now().In(user.LanguageAndDates.Timezone.Location).Format("2006-01-02 15:04:05")
+
+		t, err := s.templates.lookup(files...)
+		if err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		// parse into a buffer so that we can handle errors without writing to the response
+		buf := &bytes.Buffer{}
+		if err := t.Execute(buf, payload); err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		bytesWritten, _ = w.Write(buf.Bytes())
+	}
+}
+
+// mapFilePath returns the path to the map file. The map may belong to the
+// user or may have been shared with the user by another clan.
+func (s *Server) mapFilePath(user *domains.User_t, mapId string) (string, bool) {
+	path := filepath.Join(user.Data, "output", mapId)
+	if sb, err := os.Stat(path); err == nil && sb.Mode().IsRegular() {
+		return path, true
+	}
+
+	ownerId, err := s.stores.store.GetMapShareOwner(user.ID, mapId)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("maps: %s: %s: %v\n", user.Clan, mapId, err)
+		}
+		return "", false
+	}
+	owner, err := s.stores.store.GetUser(ownerId)
+	if err != nil {
+		// the owner is no longer active
+		return "", false
+	}
+	path = filepath.Join(owner.Data, "output", mapId)
+	if sb, err := os.Stat(path); err != nil || !sb.Mode().IsRegular() {
+		return "", false
+	}
+	return path, true
+}
+
+// mapsContent returns the maps created for the user's clan, grouped by turn,
+// and the maps that other clans have shared with the user.
+func (s *Server) mapsContent(user *domains.User_t) (maps.Content, error) {
+	loc := user.LanguageAndDates.Timezone.Location
+	content := maps.Content{
+		ClanId: user.Clan,
+	}
+
+	cf, err := s.stores.ffs.GetClanFiles(user)
+	if err != nil {
+		return content, err
+	}
+	shares, err := s.stores.store.GetMapSharesByOwner(user.ID)
+	if err != nil {
+		return content, err
+	}
+
+	turns := map[string]*maps.Turn_t{}
+	for _, f := range cf.MapFiles {
+		turn, ok := turns[f.Turn]
+		if !ok {
+			turn = &maps.Turn_t{Turn: f.Turn}
+			turns[f.Turn] = turn
+			content.Turns = append(content.Turns, turn)
+		}
+		m := &maps.Map_t{
+			Name:  f.Name,
+			Date:  f.Timestamp.In(loc).Format("2006-01-02"),
+			Time:  f.Timestamp.In(loc).Format("15:04:05"),
+			Size:  formatFileSize(f.Size),
+			Route: fmt.Sprintf("/map/%s", f.Name),
+		}
+		for _, share := range shares {
+			if share.MapId == f.Name {
+				m.Shares = append(m.Shares, &maps.Share_t{
+					ID:   int64(share.ID),
+					Clan: share.GranteeClan,
+					Date: share.CreatedAt.In(loc).Format("2006-01-02"),
+				})
+			}
+		}
+		turn.Maps = append(turn.Maps, m)
+	}
+	// newest turn first, then by map name
+	sort.Slice(content.Turns, func(i, j int) bool {
+		return content.Turns[i].Turn > content.Turns[j].Turn
+	})
+	for _, turn := range content.Turns {
+		sort.Slice(turn.Maps, func(i, j int) bool {
+			return turn.Maps[i].Name < turn.Maps[j].Name
+		})
+	}
+
+	shared, err := s.stores.store.GetMapSharesByGrantee(user.ID)
+	if err != nil {
+		return content, err
+	}
+	for _, share := range shared {
+		content.Shared = append(content.Shared, &maps.Shared_t{
+			ID:    int64(share.ID),
+			Name:  share.MapId,
+			Turn:  share.MapId[:7],
+			Owner: share.OwnerClan,
+			Date:  share.CreatedAt.In(loc).Format("2006-01-02"),
+			Route: fmt.Sprintf("/map/%s", share.MapId),
+		})
+	}
+
+	return content, nil
+}
+
+// formatFileSize returns the size in bytes, KB, or MB.
+func formatFileSize(n int64) string {
+	switch {
+	case n < 1024:
+		return fmt.Sprintf("%d bytes", n)
+	case n < 1024*1024:
+		return fmt.Sprintf("%.1f KB", float64(n)/1024)
+	}
+	return fmt.Sprintf("%.1f MB", float64(n)/(1024*1024))
+}
+
+// postMapMapIdShare grants another clan read access to one of the user's maps.
+func (s *Server) postMapMapIdShare(path string) http.HandlerFunc {
+	files := []string{
+		filepath.Join(path, "app", "widgets", "notifications.gohtml"),
+	}
+	s.templates.register(files...)
+	rxMap := regexp.MustCompile(`^(\d{4})-(\d{2}).(\d{4})\.wxx$`)
+	rxClan := regexp.MustCompile(`^\d{1,4}$`)
+
+	render := func(w http.ResponseWriter, r *http.Request, title, message string) {
+		alertFragment, err := s.renderFragment(widgets.NotificationPanel_t{
+			OOB: true,
+			Notifications: []widgets.Notification_t{{
+				Title:   title,
+				Message: message,
+			}},
+		}, "notifications-panel", files...)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		_, _ = s.writeFragments(w, r, alertFragment)
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("%s %s: entered\n", r.Method, r.URL.Path)
+
+		if r.Method != "POST" {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		} else if r.Header.Get("HX-Request") != "true" {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		user := userFromRequest(r)
+
+		// only maps in the user's own output folder can be shared
+		mapId := r.PathValue("map_id")
+		if !rxMap.MatchString(mapId) {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		} else if sb, err := os.Stat(filepath.Join(user.Data, "output", mapId)); err != nil || !sb.Mode().IsRegular() {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+
+		clan := strings.TrimSpace(r.FormValue("clan"))
+		if !rxClan.MatchString(clan) {
+			render(w, r, "Invalid clan", "Please enter the clan number that you want to share the map with.")
+			return
+		}
+		n, _ := strconv.Atoi(clan)
+		clan = fmt.Sprintf("%04d", n)
+		if clan == user.Clan {
+			render(w, r, "Invalid clan", "You can't share a map with your own clan.")
+			return
+		}
+		granteeId, err := s.stores.store.GetUserByClan(clan)
+		if errors.Is(err, sql.ErrNoRows) {
+			render(w, r, "Unknown clan", fmt.Sprintf("We couldn't find an active account for clan %s.", clan))
+			return
+		} else if err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		if err := s.stores.store.CreateMapShare(user.ID, granteeId, mapId); err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		log.Printf("%s %s: shared %q with clan %q\n", r.Method, r.URL.Path, mapId, clan)
+
+		// reload the page so that the new share is listed
+		w.Header().Set("HX-Refresh", "true")
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// deleteMapsSharesShareId removes a share. The owner uses this to stop sharing
+// a map and the grantee uses it to remove a map from their list.
+func (s *Server) deleteMapsSharesShareId() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("%s %s: entered\n", r.Method, r.URL.Path)
+
+		if r.Method != "DELETE" {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		} else if r.Header.Get("HX-Request") != "true" {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		user := userFromRequest(r)
+
+		shareId, err := strconv.Atoi(r.PathValue("share_id"))
+		if err != nil || shareId < 1 {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+		if err := s.stores.store.DeleteMapShare(user.ID, domains.ID(shareId)); err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		// reload the page so that the share is removed from the list
+		w.Header().Set("HX-Refresh", "true")
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
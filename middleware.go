@@ -0,0 +1,125 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/mdhender/ottoapp/domains"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// authLevel is the requirement that a route declares in routes().
+type authLevel int
+
+const (
+	authPublic        authLevel = iota // anyone; the handler checks the session itself if it cares
+	authUser                           // any signed in user
+	authOperator                       // users with the operator role
+	authAdministrator                  // users with the administrator role
+)
+
+func (level authLevel) String() string {
+	switch level {
+	case authPublic:
+		return "public"
+	case authUser:
+		return "user"
+	case authOperator:
+		return "operator"
+	case authAdministrator:
+		return "administrator"
+	}
+	return "unknown"
+}
+
+type contextKey int
+
+const (
+	contextKeyUser contextKey = iota
+	contextKeyViewAs
+)
+
+// requires returns a handler that checks the session before calling next.
+// The user is stored in the request context; handlers get it with userFromRequest.
+//
+// For user routes, the user is the clan being viewed if an operator is viewing
+// another clan. Operator and administrator routes always get the signed in user,
+// because they act on that user's behalf.
+func (s *Server) requires(level authLevel, next http.HandlerFunc) http.HandlerFunc {
+	if level == authPublic {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var user *domains.User_t
+		operator, viewAs, err := s.extractSessionViewAs(r)
+		if err == nil && operator != nil {
+			if level == authUser && viewAs != "" {
+				user, err = s.viewAsUser(r, operator, viewAs)
+			} else {
+				user = operator
+			}
+		}
+
+		if err != nil {
+			log.Printf("%s %s: extractSession: %v\n", r.Method, r.URL.Path, err)
+			authError(w, r, http.StatusInternalServerError)
+			return
+		} else if user == nil {
+			// there is no active session, so this is an error
+			authError(w, r, http.StatusUnauthorized)
+			return
+		} else if (level == authOperator && !user.Roles.IsOperator) || (level == authAdministrator && !user.Roles.IsAdministrator) {
+			log.Printf("%s %s: clan %q: not an %s\n", r.Method, r.URL.Path, user.Clan, level)
+			authError(w, r, http.StatusForbidden)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), contextKeyUser, user)
+		ctx = context.WithValue(ctx, contextKeyViewAs, viewAs)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// userFromRequest returns the user that requires stored in the request context.
+// Returns nil for public routes.
+func userFromRequest(r *http.Request) *domains.User_t {
+	user, _ := r.Context().Value(contextKeyUser).(*domains.User_t)
+	return user
+}
+
+// viewAsFromRequest returns the clan that the operator is viewing, or an empty string.
+func viewAsFromRequest(r *http.Request) string {
+	viewAs, _ := r.Context().Value(contextKeyViewAs).(string)
+	return viewAs
+}
+
+// authError reports a failed check in the form that the client expects.
+//
+//   - JSON clients (the /api/ routes) get a JSON error.
+//   - HTMX requests get the status, and are sent to the sign in page when the session is missing.
+//   - Browsers are redirected to the sign in page when the session is missing.
+func authError(w http.ResponseWriter, r *http.Request, status int) {
+	if strings.HasPrefix(r.URL.Path, "/api/") || strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(struct {
+			Error string `json:"error"`
+		}{Error: http.StatusText(status)})
+		return
+	}
+
+	const signIn = "/login?session_expired=true"
+	if status == http.StatusUnauthorized {
+		if r.Header.Get("HX-Request") == "true" {
+			w.Header().Set("HX-Redirect", signIn)
+		} else if r.Method == "GET" {
+			http.Redirect(w, r, signIn, http.StatusSeeOther)
+			return
+		}
+	}
+	http.Error(w, http.StatusText(status), status)
+}
@@ -0,0 +1,182 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package notifications
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mailer sends a plain text e-mail.
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// SMTP is a Mailer that delivers through an SMTP server.
+//
+// STARTTLS is used when the server offers it. Credentials are only sent if a
+// username is set, so a local stand-in such as MailHog or smtp4dev can be
+// used for testing with just a host and port.
+type SMTP struct {
+	host     string
+	addr     string
+	username string
+	password string
+	from     string
+	timeout  time.Duration
+}
+
+// NewSMTP returns a Mailer for the SMTP server at host and port.
+func NewSMTP(host, port, username, password, from string) (*SMTP, error) {
+	if host == "" {
+		return nil, fmt.Errorf("smtp: host is required")
+	} else if port == "" {
+		return nil, fmt.Errorf("smtp: port is required")
+	} else if !strings.Contains(from, "@") {
+		return nil, fmt.Errorf("smtp: from: invalid address %q", from)
+	}
+	return &SMTP{
+		host:     host,
+		addr:     net.JoinHostPort(host, port),
+		username: username,
+		password: password,
+		from:     from,
+		timeout:  30 * time.Second,
+	}, nil
+}
+
+// Send delivers a single message.
+// It is smtp.SendMail with a deadline so that a stalled server can't block the caller.
+func (m *SMTP) Send(to, subject, body string) error {
+	conn, err := net.DialTimeout("tcp", m.addr, m.timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(2 * m.timeout)); err != nil {
+		return err
+	}
+
+	c, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: m.host}); err != nil {
+			return err
+		}
+	}
+	if m.username != "" {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return fmt.Errorf("smtp: server doesn't support AUTH")
+		}
+		if err := c.Auth(smtp.PlainAuth("", m.username, m.password, m.host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(m.from); err != nil {
+		return err
+	} else if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	} else if _, err := w.Write(message(m.from, to, subject, body)); err != nil {
+		return err
+	} else if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// separator is written after each message by the Writer and File mailers.
+var separator = []byte("-- end of message --\r\n\r\n")
+
+// Writer is a Mailer that writes messages to an io.Writer instead of sending them.
+// It is meant for development, where it's useful to see the messages on stdout.
+type Writer struct {
+	sync.Mutex
+	w    io.Writer
+	from string
+}
+
+// NewWriter returns a Mailer that writes messages to w.
+func NewWriter(w io.Writer, from string) *Writer {
+	return &Writer{w: w, from: from}
+}
+
+// Send writes the message followed by a separator line.
+func (m *Writer) Send(to, subject, body string) error {
+	m.Lock()
+	defer m.Unlock()
+	_, err := m.w.Write(append(message(m.from, to, subject, body), separator...))
+	return err
+}
+
+// File is a Mailer that appends messages to a file instead of sending them.
+// It is meant for development and testing.
+type File struct {
+	sync.Mutex
+	path string
+	from string
+}
+
+// NewFile returns a Mailer that appends messages to the file at path.
+// The file is created if it doesn't exist.
+func NewFile(path, from string) (*File, error) {
+	if path == "" {
+		return nil, fmt.Errorf("file: path is required")
+	}
+	fd, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	_ = fd.Close()
+	return &File{path: path, from: from}, nil
+}
+
+// Send appends the message to the file.
+func (m *File) Send(to, subject, body string) error {
+	m.Lock()
+	defer m.Unlock()
+	fd, err := os.OpenFile(m.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = fd.Write(append(message(m.from, to, subject, body), separator...))
+	if cerr := fd.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// message returns the headers and body of a plain text message with CRLF line endings.
+func message(from, to, subject, body string) []byte {
+	buf := &bytes.Buffer{}
+	header := func(name, value string) {
+		buf.WriteString(name + ": " + value + "\r\n")
+	}
+	header("From", from)
+	header("To", to)
+	header("Subject", mime.QEncoding.Encode("utf-8", subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "8bit")
+	buf.WriteString("\r\n")
+	for _, line := range strings.Split(strings.ReplaceAll(body, "\r\n", "\n"), "\n") {
+		buf.WriteString(line + "\r\n")
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,186 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package notifications
+
+import (
+	"encoding/base64"
+	"net"
+	"net/textproto"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSMTPSend(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		auth     bool              // server offers AUTH PLAIN
+		username string            // client sends credentials if set
+		replies  map[string]string // replies that override the defaults
+		want     []string          // command verbs the server should see
+		wantErr  bool
+	}{
+		{"no credentials", false, "", nil, []string{"EHLO", "MAIL", "RCPT", "DATA", "QUIT"}, false},
+		{"credentials", true, "ottomap", nil, []string{"EHLO", "AUTH", "MAIL", "RCPT", "DATA", "QUIT"}, false},
+		{"server without auth", false, "ottomap", nil, []string{"EHLO"}, true},
+		{"credentials rejected", true, "ottomap", map[string]string{"AUTH": "535 5.7.8 bad credentials"}, []string{"EHLO", "AUTH", "*", "QUIT"}, true},
+		{"recipient rejected", false, "", map[string]string{"RCPT": "550 5.1.1 no such user"}, []string{"EHLO", "MAIL", "RCPT"}, true},
+	} {
+		server := startFakeSMTP(t, tc.auth, tc.replies)
+		host, port, err := net.SplitHostPort(server.addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := NewSMTP(host, port, tc.username, "secret", "ottomap@example.com")
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		m.timeout = 5 * time.Second
+		err = m.Send("clan0138@example.com", "Map ready for turn 0901-04", "The map is ready.\nGood hunting.")
+		<-server.done
+		if tc.wantErr != (err != nil) {
+			t.Errorf("%s: want error %v, got %v", tc.name, tc.wantErr, err)
+		}
+
+		var verbs []string
+		for _, command := range server.commands {
+			verbs = append(verbs, strings.Fields(command)[0])
+		}
+		if !reflect.DeepEqual(verbs, tc.want) {
+			t.Errorf("%s: want %q, got %q", tc.name, tc.want, server.commands)
+			continue
+		}
+		for _, command := range server.commands {
+			switch strings.Fields(command)[0] {
+			case "AUTH":
+				if want := "AUTH PLAIN " + base64.StdEncoding.EncodeToString([]byte("\x00ottomap\x00secret")); command != want {
+					t.Errorf("%s: want %q, got %q", tc.name, want, command)
+				}
+			case "MAIL":
+				if !strings.HasPrefix(command, "MAIL FROM:<ottomap@example.com>") {
+					t.Errorf("%s: got %q", tc.name, command)
+				}
+			case "RCPT":
+				if command != "RCPT TO:<clan0138@example.com>" {
+					t.Errorf("%s: got %q", tc.name, command)
+				}
+			}
+		}
+		if tc.wantErr {
+			continue
+		}
+		for _, want := range []string{
+			"From: ottomap@example.com\n",
+			"To: clan0138@example.com\n",
+			"Subject: Map ready for turn 0901-04\n",
+			"\n\nThe map is ready.\nGood hunting.\n",
+		} {
+			if !strings.Contains(server.data, want) {
+				t.Errorf("%s: want %q in message, got %q", tc.name, want, server.data)
+			}
+		}
+	}
+}
+
+func TestNewSMTP(t *testing.T) {
+	for _, tc := range []struct {
+		name             string
+		host, port, from string
+		wantErr          bool
+	}{
+		{"valid", "smtp.example.com", "587", "ottomap@example.com", false},
+		{"no host", "", "587", "ottomap@example.com", true},
+		{"no port", "smtp.example.com", "", "ottomap@example.com", true},
+		{"invalid from", "smtp.example.com", "587", "ottomap", true},
+	} {
+		if _, err := NewSMTP(tc.host, tc.port, "", "", tc.from); tc.wantErr != (err != nil) {
+			t.Errorf("%s: want error %v, got %v", tc.name, tc.wantErr, err)
+		}
+	}
+}
+
+func TestWriter(t *testing.T) {
+	sb := &strings.Builder{}
+	m := NewWriter(sb, "ottomap@example.com")
+	if err := m.Send("clan0138@example.com", "Orders due for turn 0901-05", "Your orders are due."); err != nil {
+		t.Fatal(err)
+	}
+	got := sb.String()
+	if !strings.HasPrefix(got, "From: ottomap@example.com\r\nTo: clan0138@example.com\r\nSubject: Orders due for turn 0901-05\r\n") {
+		t.Errorf("headers: got %q", got)
+	} else if !strings.HasSuffix(got, "\r\n\r\nYour orders are due.\r\n"+string(separator)) {
+		t.Errorf("body: got %q", got)
+	}
+}
+
+// fakeSMTP is a server that accepts a single connection. STARTTLS is never offered.
+type fakeSMTP struct {
+	addr     string
+	commands []string      // the commands that were received
+	data     string        // the message, with CRLF converted to LF
+	done     chan struct{} // closed when the connection is closed
+}
+
+// startFakeSMTP starts a server that replies to each command with the reply
+// for its verb in replies, or with a reply that accepts it.
+// The commands and data must not be read until done is closed.
+func startFakeSMTP(t *testing.T, auth bool, replies map[string]string) *fakeSMTP {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = l.Close()
+	})
+	s := &fakeSMTP{addr: l.Addr().String(), done: make(chan struct{})}
+	go func() {
+		defer close(s.done)
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+		tp := textproto.NewConn(conn)
+		_ = tp.PrintfLine("220 127.0.0.1 ESMTP fake")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil || len(strings.Fields(line)) == 0 {
+				return
+			}
+			s.commands = append(s.commands, line)
+			verb := strings.ToUpper(strings.Fields(line)[0])
+			if reply, ok := replies[verb]; ok {
+				_ = tp.PrintfLine("%s", reply)
+				continue
+			}
+			switch verb {
+			case "EHLO":
+				if auth {
+					_ = tp.PrintfLine("250-127.0.0.1")
+					_ = tp.PrintfLine("250 AUTH PLAIN")
+				} else {
+					_ = tp.PrintfLine("250 127.0.0.1")
+				}
+			case "AUTH":
+				_ = tp.PrintfLine("235 2.7.0 accepted")
+			case "DATA":
+				_ = tp.PrintfLine("354 go ahead")
+				data, err := tp.ReadDotBytes()
+				if err != nil {
+					return
+				}
+				s.data = string(data)
+				_ = tp.PrintfLine("250 2.0.0 queued")
+			case "QUIT":
+				_ = tp.PrintfLine("221 2.0.0 bye")
+				return
+			default:
+				_ = tp.PrintfLine("250 2.0.0 ok")
+			}
+		}
+	}()
+	return s
+}
@@ -0,0 +1,193 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+// Package notifications tells players about events on the server.
+//
+// Every notification is saved to the user's inbox, which is shown in the
+// notifications panel of the web application. If the user has asked for
+// e-mail and the server has a Mailer, the notification is also queued for
+// delivery. A single worker sends the queued e-mails, retrying failures with
+// a back-off, and checks once an hour for orders that are due soon.
+//
+// Users must opt in to each event. Events that the user hasn't opted in to
+// are dropped without being saved.
+package notifications
+
+import (
+	"context"
+	"fmt"
+	"github.com/mdhender/ottoapp/domains"
+	"github.com/mdhender/ottoapp/stores/sqlite"
+	"log"
+	"sync"
+	"time"
+)
+
+// retryDelays is how long to wait before retrying a failed e-mail.
+// The message is marked as failed after the last retry.
+var retryDelays = []time.Duration{
+	1 * time.Minute,
+	5 * time.Minute,
+	30 * time.Minute,
+	2 * time.Hour,
+	8 * time.Hour,
+}
+
+// Notifier saves notifications and delivers them by e-mail.
+type Notifier struct {
+	store     *sqlite.DB
+	mailer    Mailer        // nil if e-mail delivery is disabled
+	interval  time.Duration // how often the idle worker checks for e-mail
+	reminders time.Duration // how often the worker checks for orders that are due
+	wake      chan struct{}
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+// New returns a notifier. The mailer may be nil, in which case
+// notifications are only saved to the inbox.
+// The worker is not started until Start is called.
+func New(store *sqlite.DB, mailer Mailer) *Notifier {
+	return &Notifier{
+		store:     store,
+		mailer:    mailer,
+		interval:  30 * time.Second,
+		reminders: time.Hour,
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+// EmailEnabled returns true if the notifier can send e-mail.
+func (n *Notifier) EmailEnabled() bool {
+	return n != nil && n.mailer != nil
+}
+
+// Start starts the worker that sends e-mail and reminders.
+func (n *Notifier) Start(ctx context.Context) {
+	n.ctx, n.cancel = context.WithCancel(ctx)
+	n.wg.Add(1)
+	go n.worker()
+	log.Printf("notifications: started (e-mail enabled: %v)\n", n.EmailEnabled())
+}
+
+// Stop signals the worker to quit and waits for it to finish.
+// E-mails that have not been sent stay queued in the database.
+func (n *Notifier) Stop() {
+	if n.cancel == nil {
+		return
+	}
+	n.cancel()
+	n.wg.Wait()
+	log.Printf("notifications: stopped\n")
+}
+
+// Notify saves the notification to the user's inbox and queues the e-mail.
+// It does nothing if the user has not opted in to the event, or if the
+// dedupe key is not empty and has already been used for the user.
+// It is safe to call on a nil Notifier.
+func (n *Notifier) Notify(userId domains.ID, event domains.NotificationEvent, dedupeKey, title, message string) error {
+	if n == nil {
+		return nil
+	}
+	settings, err := n.store.GetNotificationSettings(userId)
+	if err != nil {
+		return err
+	} else if !settings.Wants(event) {
+		return nil
+	}
+	status := domains.EmailNone
+	if settings.ByEmail && n.mailer != nil {
+		status = domains.EmailPending
+	}
+	id, err := n.store.CreateNotification(userId, event, dedupeKey, title, message, status)
+	if err != nil {
+		return err
+	} else if id == 0 {
+		return nil
+	}
+	log.Printf("notifications: user %d: %s: notification %d\n", userId, event, id)
+
+	if status == domains.EmailPending {
+		// nudge the worker, but don't block if it is busy
+		select {
+		case n.wake <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+func (n *Notifier) worker() {
+	defer n.wg.Done()
+	var lastReminder time.Time
+	for {
+		if n.ctx.Err() != nil {
+			return
+		}
+		if time.Since(lastReminder) >= n.reminders {
+			n.remindOrdersDue(time.Now().UTC())
+			lastReminder = time.Now()
+		}
+		n.deliver()
+		select {
+		case <-n.ctx.Done():
+			return
+		case <-n.wake:
+		case <-time.After(n.interval):
+		}
+	}
+}
+
+// deliver sends the e-mails that are due.
+// A failed message is retried after the next delay in retryDelays.
+func (n *Notifier) deliver() {
+	if n.mailer == nil {
+		return
+	}
+	emails, err := n.store.GetPendingEmails(20)
+	if err != nil {
+		log.Printf("notifications: pending: %v\n", err)
+		return
+	}
+	for _, email := range emails {
+		if n.ctx.Err() != nil {
+			return
+		}
+		attempts := email.Attempts + 1
+		err := n.mailer.Send(email.To, email.Subject, email.Body)
+		if err == nil {
+			if err := n.store.UpdateEmailStatus(email.ID, domains.EmailSent, attempts, "", time.Time{}); err != nil {
+				log.Printf("notifications: notification %d: %v\n", email.ID, err)
+			}
+			log.Printf("notifications: notification %d: sent\n", email.ID)
+			continue
+		}
+		status, nextTry := domains.EmailFailed, time.Time{}
+		if attempts <= len(retryDelays) {
+			status, nextTry = domains.EmailPending, time.Now().Add(retryDelays[attempts-1])
+		}
+		log.Printf("notifications: notification %d: attempt %d: %v\n", email.ID, attempts, err)
+		if err := n.store.UpdateEmailStatus(email.ID, status, attempts, err.Error(), nextTry); err != nil {
+			log.Printf("notifications: notification %d: %v\n", email.ID, err)
+		}
+	}
+}
+
+// remindOrdersDue notifies users whose orders are due today or tomorrow.
+// The dedupe key makes sure that each turn is only reminded once.
+func (n *Notifier) remindOrdersDue(now time.Time) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	list, err := n.store.GetOrdersDueBetween(today, today.AddDate(0, 0, 1))
+	if err != nil {
+		log.Printf("notifications: orders due: %v\n", err)
+		return
+	}
+	for _, due := range list {
+		title := fmt.Sprintf("Orders due for turn %s", due.NextTurnId)
+		message := fmt.Sprintf("Your orders for turn %s are due on %s.", due.NextTurnId, due.Due.Format("Monday, January 2, 2006"))
+		dedupeKey := fmt.Sprintf("%s.%s", domains.EventOrdersDue, due.NextTurnId)
+		if err := n.Notify(due.UserID, domains.EventOrdersDue, dedupeKey, title, message); err != nil {
+			log.Printf("notifications: user %d: orders due: %v\n", due.UserID, err)
+		}
+	}
+}
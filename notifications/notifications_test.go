@@ -0,0 +1,205 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package notifications
+
+import (
+	"context"
+	"errors"
+	"github.com/mdhender/ottoapp/domains"
+	"github.com/mdhender/ottoapp/stores/sqlite"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNotify(t *testing.T) {
+	store, user := testStore(t)
+	settings := domains.NotificationSettings_t{UploadAccepted: true, RenderFailed: true, ByEmail: true}
+	if err := store.UpdateNotificationSettings(user.ID, settings); err != nil {
+		t.Fatal(err)
+	}
+	n := New(store, NewWriter(&strings.Builder{}, "ottomap@example.com"))
+
+	for _, tc := range []struct {
+		name      string
+		event     domains.NotificationEvent
+		dedupeKey string
+		saved     bool
+	}{
+		{"opted in", domains.EventUploadAccepted, "", true},
+		{"opted out", domains.EventMapRendered, "", false},
+		{"no dedupe key", domains.EventUploadAccepted, "", true},
+		{"dedupe key", domains.EventRenderFailed, "render-failed.0901-04", true},
+		{"dedupe key used", domains.EventRenderFailed, "render-failed.0901-04", false},
+		{"new dedupe key", domains.EventRenderFailed, "render-failed.0901-05", true},
+	} {
+		if err := n.Notify(user.ID, tc.event, tc.dedupeKey, tc.name, "message"); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+	}
+	want := []string{"new dedupe key", "dedupe key", "no dedupe key", "opted in"}
+	if got := inboxTitles(t, store, user.ID); !reflect.DeepEqual(got, want) {
+		t.Errorf("inbox: want %q, got %q", want, got)
+	}
+	// the user asked for e-mail, so every saved notification is queued
+	if emails, err := store.GetPendingEmails(20); err != nil {
+		t.Fatal(err)
+	} else if len(emails) != len(want) {
+		t.Errorf("pending: want %d, got %d", len(want), len(emails))
+	}
+
+	// without e-mail, notifications are only saved to the inbox
+	settings.ByEmail = false
+	if err := store.UpdateNotificationSettings(user.ID, settings); err != nil {
+		t.Fatal(err)
+	} else if err := n.Notify(user.ID, domains.EventUploadAccepted, "", "inbox only", "message"); err != nil {
+		t.Fatal(err)
+	}
+	settings.ByEmail = true
+	if err := store.UpdateNotificationSettings(user.ID, settings); err != nil {
+		t.Fatal(err)
+	} else if err := New(store, nil).Notify(user.ID, domains.EventUploadAccepted, "", "no mailer", "message"); err != nil {
+		t.Fatal(err)
+	}
+	if got := inboxTitles(t, store, user.ID); len(got) != 6 || got[0] != "no mailer" || got[1] != "inbox only" {
+		t.Errorf("inbox: got %q", got)
+	}
+	if emails, err := store.GetPendingEmails(20); err != nil {
+		t.Fatal(err)
+	} else if len(emails) != len(want) {
+		t.Errorf("pending: want %d, got %d", len(want), len(emails))
+	}
+
+	// a nil notifier is a no-op
+	var nilNotifier *Notifier
+	if err := nilNotifier.Notify(user.ID, domains.EventUploadAccepted, "", "nil", "message"); err != nil {
+		t.Errorf("nil notifier: %v", err)
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	defer func(saved []time.Duration) {
+		retryDelays = saved
+	}(retryDelays)
+
+	for _, tc := range []struct {
+		name     string
+		delays   []time.Duration
+		failures int // number of sends that fail before one succeeds
+		rounds   int // number of times deliver is called
+		calls    int // want number of attempts to send
+		sent     int // want number of messages sent
+		pending  int // want number of messages still due
+	}{
+		{"sent", []time.Duration{0}, 0, 2, 1, 1, 0},
+		{"sent after a retry", []time.Duration{0, 0}, 1, 3, 2, 1, 0},
+		{"gives up after the last retry", []time.Duration{0, 0}, 99, 5, 3, 0, 0},
+		{"waits for the back-off", []time.Duration{time.Hour}, 99, 3, 1, 0, 0},
+	} {
+		retryDelays = tc.delays
+		store, user := testStore(t)
+		if err := store.UpdateNotificationSettings(user.ID, domains.NotificationSettings_t{MapRendered: true, ByEmail: true}); err != nil {
+			t.Fatal(err)
+		}
+		mailer := &flakyMailer{failures: tc.failures}
+		n := New(store, mailer)
+		n.ctx = context.Background()
+		if err := n.Notify(user.ID, domains.EventMapRendered, "", "Map ready for turn 0901-04", "The map is ready."); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		for i := 0; i < tc.rounds; i++ {
+			n.deliver()
+		}
+		if mailer.calls != tc.calls || len(mailer.sent) != tc.sent {
+			t.Errorf("%s: want %d calls and %d sent, got %d and %d", tc.name, tc.calls, tc.sent, mailer.calls, len(mailer.sent))
+		}
+		if emails, err := store.GetPendingEmails(20); err != nil {
+			t.Fatal(err)
+		} else if len(emails) != tc.pending {
+			t.Errorf("%s: pending: want %d, got %d", tc.name, tc.pending, len(emails))
+		}
+		for _, to := range mailer.sent {
+			if to != "clan0138@ottomap" {
+				t.Errorf("%s: sent to %q", tc.name, to)
+			}
+		}
+	}
+}
+
+func TestDeliverWriter(t *testing.T) {
+	store, user := testStore(t)
+	if err := store.UpdateNotificationSettings(user.ID, domains.NotificationSettings_t{RenderFailed: true, ByEmail: true}); err != nil {
+		t.Fatal(err)
+	}
+	sb := &strings.Builder{}
+	n := New(store, NewWriter(sb, "ottomap@example.com"))
+	n.ctx = context.Background()
+	if err := n.Notify(user.ID, domains.EventRenderFailed, "", "Map failed for turn 0901-04", "The error log is on your dashboard."); err != nil {
+		t.Fatal(err)
+	}
+	n.deliver()
+	n.deliver()
+	got := sb.String()
+	if strings.Count(got, string(separator)) != 1 {
+		t.Errorf("want 1 message, got %q", got)
+	}
+	for _, want := range []string{"To: clan0138@ottomap\r\n", "Subject: Map failed for turn 0901-04\r\n", "\r\n\r\nThe error log is on your dashboard.\r\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("want %q in %q", want, got)
+		}
+	}
+}
+
+// flakyMailer fails until it has been called more than failures times.
+type flakyMailer struct {
+	failures int
+	calls    int
+	sent     []string
+}
+
+func (m *flakyMailer) Send(to, subject, body string) error {
+	m.calls++
+	if m.calls <= m.failures {
+		return errors.New("421 4.3.2 try again later")
+	}
+	m.sent = append(m.sent, to)
+	return nil
+}
+
+// inboxTitles returns the titles of the unread messages in the user's inbox, newest first.
+func inboxTitles(t *testing.T, store *sqlite.DB, userId domains.ID) []string {
+	t.Helper()
+	list, err := store.GetUnreadNotifications(userId, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var titles []string
+	for _, n := range list {
+		titles = append(titles, n.Title)
+	}
+	return titles
+}
+
+// testStore returns a new store in a temporary folder with a user for clan 0138.
+func testStore(t *testing.T) (*sqlite.DB, *domains.User_t) {
+	t.Helper()
+	path, ctx := t.TempDir(), context.Background()
+	dbPath := filepath.Join(path, "test.db")
+	if err := sqlite.Create(dbPath, false, "", "", path, "admin-secret", "", ctx); err != nil {
+		t.Fatal(err)
+	}
+	store, err := sqlite.Open(dbPath, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = store.Close()
+	})
+	user, err := store.CreateUser("clan0138@ottomap", "a-long-password", "0138", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store, user
+}
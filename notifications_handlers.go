@@ -0,0 +1,202 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mdhender/ottoapp/components/app"
+	"github.com/mdhender/ottoapp/components/app/pages/settings"
+	"github.com/mdhender/ottoapp/components/app/pages/settings/notifications"
+	"github.com/mdhender/ottoapp/components/app/widgets"
+	"github.com/mdhender/ottoapp/domains"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func (s *Server) getSettingsNotifications(path string, footer app.Footer) http.HandlerFunc {
+	files := []string{
+		filepath.Join(path, "app", "pages", "settings", "layout.gohtml"),
+		filepath.Join(path, "app", "pages", "settings", "notifications", "content.gohtml"),
+		filepath.Join(path, "app", "widgets", "notifications.gohtml"),
+	}
+	s.templates.register(files...)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		log.Printf("%s %s: entered\n", r.Method, r.URL.Path)
+		started, bytesWritten := time.Now(), 0
+		defer func() {
+			log.Printf("%s %s: wrote %d bytes in %s\n", r.Method, r.URL.Path, bytesWritten, time.Since(started))
+		}()
+
+		user := userFromRequest(r)
+
+		ns, err := s.stores.store.GetNotificationSettings(user.ID)
+		if err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		payload := settings.Layout_t{
+			Title:   fmt.Sprintf("Clan %s", user.Clan),
+			ClanId:  user.Clan,
+			Content: s.notificationSettingsContent(user, ns, false),
+			Footer:  footer,
+		}
+		payload.CurrentPage.Notifications = true
+		payload.Footer.Timestamp = time.Now().In(user.LanguageAndDates.Timezone.Location).Format("2006-01-02 15:04:05")
+
+		t, err := s.templates.lookup(files...)
+		if err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		// parse into a buffer so that we can handle errors without writing to the response
+		buf := &bytes.Buffer{}
+		if err := t.Execute(buf, payload); err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		bytesWritten, _ = w.Write(buf.Bytes())
+	}
+}
+
+func (s *Server) postSettingsNotifications(path string) http.HandlerFunc {
+	files := []string{
+		filepath.Join(path, "app", "pages", "settings", "notifications", "content.gohtml"),
+	}
+	s.templates.register(files...)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("%s %s: entered\n", r.Method, r.URL.Path)
+		if r.Method != "POST" {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		} else if r.Header.Get("HX-Request") != "true" {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		} else if contentType := r.Header.Get("Content-Type"); !(contentType == "application/x-www-form-urlencoded" || strings.HasPrefix(contentType, "application/x-www-form-urlencoded;")) {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		user := userFromRequest(r)
+
+		ns, err := s.stores.store.GetNotificationSettings(user.ID)
+		if err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		ns.UploadAccepted = cbIsSet(r.FormValue("upload-accepted"))
+		ns.MapRendered = cbIsSet(r.FormValue("map-rendered"))
+		ns.RenderFailed = cbIsSet(r.FormValue("render-failed"))
+		ns.OrdersDue = cbIsSet(r.FormValue("orders-due"))
+		// the checkbox is disabled when the server can't send e-mail, so keep the old value
+		if s.notifier.EmailEnabled() {
+			ns.ByEmail = cbIsSet(r.FormValue("by-email"))
+		}
+		if err := s.stores.store.UpdateNotificationSettings(user.ID, ns); err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		log.Printf("%s %s: %s: updated notification settings\n", r.Method, r.URL.Path, user.Clan)
+
+		_, _ = s.writeHtmxFragment(w, r, s.notificationSettingsContent(user, ns, true), "notification-settings", files...)
+	}
+}
+
+func (s *Server) notificationSettingsContent(user *domains.User_t, ns domains.NotificationSettings_t, saved bool) notifications.Content_t {
+	return notifications.Content_t{
+		Email:          user.Email,
+		EmailEnabled:   s.notifier.EmailEnabled(),
+		Saved:          saved,
+		UploadAccepted: ns.UploadAccepted,
+		MapRendered:    ns.MapRendered,
+		RenderFailed:   ns.RenderFailed,
+		OrdersDue:      ns.OrdersDue,
+		ByEmail:        ns.ByEmail,
+	}
+}
+
+// getNotificationsInbox shows the unread messages in the user's inbox using
+// the notifications panel. The messages are marked as read once they are shown.
+func (s *Server) getNotificationsInbox(path string) http.HandlerFunc {
+	files := []string{
+		filepath.Join(path, "app", "widgets", "notifications.gohtml"),
+	}
+	s.templates.register(files...)
+	const maxMessages = 5
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("%s %s: entered\n", r.Method, r.URL.Path)
+		if r.Method != "GET" {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		} else if r.Header.Get("HX-Request") != "true" {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		user := userFromRequest(r)
+
+		list, err := s.stores.store.GetUnreadNotifications(user.ID, maxMessages)
+		if err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		panel := widgets.NotificationPanel_t{OOB: true}
+		for _, n := range list {
+			button := widgets.BNone
+			if n.Event == domains.EventMapRendered || n.Event == domains.EventRenderFailed {
+				button = widgets.BOpenDashboard
+			}
+			panel.Notifications = append(panel.Notifications, widgets.Notification_t{
+				Title:   n.Title,
+				Message: fmt.Sprintf("%s (%s)", n.Message, n.CreatedAt.In(user.LanguageAndDates.Timezone.Location).Format("2006-01-02 15:04")),
+				Button:  button,
+			})
+		}
+		if len(list) == 0 {
+			panel.Notifications = append(panel.Notifications, widgets.Notification_t{
+				Title:   "No new notifications",
+				Message: "You can choose which events you hear about in Settings.",
+			})
+		} else if viewAsFromRequest(r) == "" {
+			// the messages stay unread while an operator is viewing the clan
+			// only the messages that were shown; older ones wait for the next time the inbox is opened
+			var shown []domains.ID
+			for _, n := range list {
+				shown = append(shown, n.ID)
+			}
+			if err := s.stores.store.MarkNotificationsRead(user.ID, shown); err != nil {
+				log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			}
+		}
+
+		frag, err := s.renderFragment(panel, "notifications-panel", files...)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		_, _ = s.writeFragments(w, r, frag)
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/mdhender/ottoapp/components/app"
+	"github.com/mdhender/ottoapp/components/app/pages/operator"
+	"github.com/mdhender/ottoapp/components/app/widgets"
+	"github.com/mdhender/ottoapp/domains"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Operators can view another clan's pages to help a player with a problem.
+// The clan is saved with the session, so user routes get that clan's user
+// until the operator stops viewing. ServeHTTP refuses every request other than
+// GET and HEAD while the operator is viewing. GET handlers that save data as a side
+// effect (marking notifications read, saving due dates, creating the calendar feed)
+// must check viewAsFromRequest and skip the write.
+//
+// The operator routes require the operator role, so the user in the request context
+// is always the operator, not the clan being viewed.
+
+// getOperator shows the form for choosing a clan to view.
+func (s *Server) getOperator(path string, footer app.Footer) http.HandlerFunc {
+	files := []string{
+		filepath.Join(path, "app", "layout.gohtml"),
+		filepath.Join(path, "app", "pages", "operator", "view_as.gohtml"),
+		filepath.Join(path, "app", "widgets", "notifications.gohtml"),
+	}
+	s.templates.register(files...)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		started, bytesWritten := time.Now(), 0
+		log.Printf("%s %s: entered\n", r.Method, r.URL.Path)
+		defer func() {
+			log.Printf("%s %s: wrote %d bytes in %s\n", r.Method, r.URL.Path, bytesWritten, time.Since(started))
+		}()
+
+		if r.Method != "GET" {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		user := userFromRequest(r)
+		viewAs := viewAsFromRequest(r)
+
+		loc := user.LanguageAndDates.Timezone.Location
+		payload := app.Layout{
+			Title:   fmt.Sprintf("Clan %s", user.Clan),
+			Heading: "Operator",
+			Content: operator.ViewAs_t{
+				Viewing: viewAs,
+				Form:    operator.ViewAsForm_t{ClanId: viewAs},
+			},
+			Footer: footer,
+		}
+		payload.Footer.Timestamp = time.Now().In(loc).Format("2006-01-02 15:04:05")
+
+		t, err := s.templates.lookup(files...)
+		if err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		// parse into a buffer so that we can handle errors without writing to the response
+		buf := &bytes.Buffer{}
+		if err := t.Execute(buf, payload); err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		bytesWritten, _ = w.Write(buf.Bytes())
+	}
+}
+
+// postOperatorViewAs starts viewing a clan and sends the operator to its dashboard.
+func (s *Server) postOperatorViewAs(path string) http.HandlerFunc {
+	files := []string{
+		filepath.Join(path, "app", "pages", "operator", "view_as.gohtml"),
+	}
+	s.templates.register(files...)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("%s %s: entered\n", r.Method, r.URL.Path)
+		if r.Method != "POST" {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		} else if r.Header.Get("HX-Request") != "true" {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		} else if contentType := r.Header.Get("Content-Type"); !(contentType == "application/x-www-form-urlencoded" || strings.HasPrefix(contentType, "application/x-www-form-urlencoded;")) {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		user := userFromRequest(r)
+
+		form := operator.ViewAsForm_t{
+			ClanId: strings.TrimSpace(r.FormValue("clan")),
+		}
+		// accept "138" as well as "0138"
+		clanNo, err := strconv.Atoi(form.ClanId)
+		if err != nil {
+			clanNo = -1
+		} else if 0 <= clanNo && clanNo <= 999 {
+			form.ClanId = fmt.Sprintf("%04d", clanNo)
+		}
+
+		if clanNo < 0 || clanNo > 999 {
+			form.Error = "Please enter a clan number between 0000 and 0999."
+		} else if form.ClanId == user.Clan {
+			form.Error = "That is your own clan."
+		} else if _, err := s.stores.store.GetUserAccount(form.ClanId); errors.Is(err, sql.ErrNoRows) {
+			form.Error = fmt.Sprintf("There is no user for clan %s.", form.ClanId)
+		} else if err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		} else if err := s.stores.sessions.UpdateSessionViewAs(s.sessionId(r), form.ClanId); err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		} else {
+			log.Printf("%s %s: clan %q: viewing clan %q\n", r.Method, r.URL.Path, user.Clan, form.ClanId)
+			s.audit(r, user.Clan, domains.AuditViewAsStart, fmt.Sprintf("clan %s", form.ClanId))
+			w.Header().Set("HX-Redirect", "/dashboard")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		_, _ = s.writeHtmxFragment(w, r, form, "view-as-form", files...)
+	}
+}
+
+// deleteOperatorViewAs stops viewing and returns the operator to their own clan.
+func (s *Server) deleteOperatorViewAs() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("%s %s: entered\n", r.Method, r.URL.Path)
+		if r.Method != "DELETE" {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		} else if r.Header.Get("HX-Request") != "true" {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		user, viewAs := userFromRequest(r), viewAsFromRequest(r)
+		if viewAs != "" {
+			if err := s.stores.sessions.UpdateSessionViewAs(s.sessionId(r), ""); err != nil {
+				log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			log.Printf("%s %s: clan %q: stopped viewing clan %q\n", r.Method, r.URL.Path, user.Clan, viewAs)
+			s.audit(r, user.Clan, domains.AuditViewAsStop, fmt.Sprintf("clan %s", viewAs))
+		}
+
+		w.Header().Set("HX-Redirect", "/operator")
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// getOperatorViewAsBanner returns the banner for the top of every page.
+// It returns an empty response if the operator is not viewing another clan,
+// which removes the placeholder from the page.
+func (s *Server) getOperatorViewAsBanner(path string) http.HandlerFunc {
+	files := []string{
+		filepath.Join(path, "app", "widgets", "view_as_banner.gohtml"),
+	}
+	s.templates.register(files...)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		} else if r.Header.Get("HX-Request") != "true" {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		user, viewAs, err := s.extractSessionViewAs(r)
+		if err != nil {
+			log.Printf("%s %s: extractSessionViewAs: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		} else if user == nil || viewAs == "" {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		_, _ = s.writeHtmxFragment(w, r, widgets.ViewAsBanner_t{Operator: user.Clan, Clan: viewAs}, "view-as-banner", files...)
+	}
+}
@@ -4,19 +4,26 @@ package main
 
 import (
 	"fmt"
+	"github.com/mdhender/ottoapp/jobs"
+	"github.com/mdhender/ottoapp/notifications"
 	"github.com/mdhender/ottoapp/stores/ffs"
 	"github.com/mdhender/ottoapp/stores/sqlite"
 	"net"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 type Options []Option
 type Option func(*Server) error
 
+// withAssets sets the assets override directory. An empty path means use only the embedded assets.
 func withAssets(path string) Option {
 	return func(s *Server) error {
-		if abspath, err := filepath.Abs(path); err != nil {
+		if path == "" {
+			s.paths.assets = ""
+		} else if abspath, err := filepath.Abs(path); err != nil {
 			return err
 		} else if sb, err := os.Stat(abspath); err != nil {
 			return err
@@ -29,9 +36,12 @@ func withAssets(path string) Option {
 	}
 }
 
+// withComponents sets the components override directory. An empty path means use only the embedded components.
 func withComponents(path string) Option {
 	return func(s *Server) error {
-		if abspath, err := filepath.Abs(path); err != nil {
+		if path == "" {
+			s.paths.components = ""
+		} else if abspath, err := filepath.Abs(path); err != nil {
 			return err
 		} else if sb, err := os.Stat(abspath); err != nil {
 			return err
@@ -44,6 +54,33 @@ func withComponents(path string) Option {
 	}
 }
 
+// withBaseURL sets the scheme and host used in links that are e-mailed or shared,
+// like password reset links and calendar feeds. An empty URL means use the address
+// that the server listens on.
+func withBaseURL(baseURL string) Option {
+	return func(s *Server) error {
+		if baseURL == "" {
+			s.baseURL = ""
+			return nil
+		}
+		u, err := url.Parse(baseURL)
+		if err != nil {
+			return fmt.Errorf("base url: %w", err)
+		} else if !(u.Scheme == "http" || u.Scheme == "https") || u.Host == "" || strings.Trim(u.Path, "/") != "" || u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+			return fmt.Errorf("base url: %q: must be a scheme and host, like https://ottomap.example.com", baseURL)
+		}
+		s.baseURL = u.Scheme + "://" + u.Host
+		return nil
+	}
+}
+
+func withDevMode(dev bool) Option {
+	return func(s *Server) error {
+		s.features.dev = dev
+		return nil
+	}
+}
+
 func withFS(fs *ffs.FFS) Option {
 	return func(s *Server) error {
 		s.stores.ffs = fs
@@ -59,6 +96,27 @@ func withHost(host string) Option {
 	}
 }
 
+func withJobs(q *jobs.Queue) Option {
+	return func(s *Server) error {
+		s.jobs = q
+		return nil
+	}
+}
+
+func withMailer(m notifications.Mailer) Option {
+	return func(s *Server) error {
+		s.mailer = m
+		return nil
+	}
+}
+
+func withNotifier(n *notifications.Notifier) Option {
+	return func(s *Server) error {
+		s.notifier = n
+		return nil
+	}
+}
+
 func withPort(port string) Option {
 	return func(s *Server) error {
 		s.port = port
@@ -15,6 +15,8 @@ var (
 	ErrInvalidClan     = errors.New("invalid clan")
 	ErrInvalidEmail    = errors.New("invalid email")
 	ErrInvalidTimezone = errors.New("invalid timezone")
+	ErrTokenInvalid    = errors.New("invalid refresh token")
+	ErrTokenReused     = errors.New("refresh token reused")
 	ErrUnauthorized    = errors.New("unauthorized")
 )
 
@@ -28,6 +30,7 @@ type User struct {
 	Created   time.Time `json:"created"`
 	LastLogin time.Time `json:"lastLogin"`
 	Timezone  string    `json:"timezone"`
+	Data      string    `json:"-"` // full path to the clan's data; the input, logs, and output folders are children of this folder
 }
 
 // UserStore defines the interface for user storage operations
@@ -37,19 +40,45 @@ type UserStore interface {
 	CreateUser(email, password, clan, timezone string) (*User, error)
 }
 
+// TokenStore defines the interface for refresh token storage operations.
+//
+// Each sign in starts a session, which is a family of refresh tokens.
+// Refreshing replaces the token with a new one in the same session.
+// Implementations must store only a hash of each token.
+type TokenStore interface {
+	// CreateRefreshToken starts a new session for the user and returns its first refresh token.
+	CreateRefreshToken(userID int64) (token, sessionID string, err error)
+	// RotateRefreshToken replaces the refresh token with a new one.
+	// It returns ErrTokenInvalid if the token is unknown, expired, or revoked.
+	// It returns ErrTokenReused, and revokes the session, if the token was already replaced.
+	RotateRefreshToken(token string) (userID int64, newToken, sessionID string, err error)
+	// RevokeRefreshToken revokes the session that the token belongs to.
+	// It returns ErrTokenInvalid if the token is unknown.
+	RevokeRefreshToken(token string) error
+	// IsSessionActive returns true if the session has not been revoked or expired.
+	IsSessionActive(sessionID string) (bool, error)
+}
+
 // LoginRequest represents the JSON payload for login requests
 type LoginRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
 }
 
-// LoginResponse represents the JSON response for login requests
+// LoginResponse represents the JSON response for login and refresh requests
 type LoginResponse struct {
-	Success bool   `json:"success"`
-	Token   string `json:"token,omitempty"`
-	Message string `json:"message,omitempty"`
-	Clan    string `json:"clan,omitempty"`
-	UserID  int64  `json:"userId,omitempty"`
+	Success      bool   `json:"success"`
+	Token        string `json:"token,omitempty"`        // access token
+	RefreshToken string `json:"refreshToken,omitempty"` // replaces the client's refresh token
+	ExpiresIn    int    `json:"expiresIn,omitempty"`    // seconds until the access token expires
+	Message      string `json:"message,omitempty"`
+	Clan         string `json:"clan,omitempty"`
+	UserID       int64  `json:"userId,omitempty"`
+}
+
+// RefreshRequest represents the JSON payload for refresh and logout requests
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
 }
 
 // UserResponse represents the JSON response for user information
@@ -67,7 +96,8 @@ type UserResponse struct {
 // AuthHandler handles authentication routes
 type AuthHandler struct {
 	Store  UserStore
-	JWTKey []byte // Key for signing JWT tokens
+	Tokens TokenStore
+	Keys   *KeySet // Keys for signing and verifying JWT tokens
 }
 
 // Register handles user registration requests
@@ -155,10 +185,10 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Generate JWT token
-	token, err := GenerateJWT(h.JWTKey, user.ID, user.Clan, user.IsActive, user.IsAdmin)
+	// Start a session and generate the tokens
+	refreshToken, sessionID, err := h.Tokens.CreateRefreshToken(user.ID)
 	if err != nil {
-		log.Printf("Login attempt for user: %q: token creation failed", req.Email)
+		log.Printf("Login attempt for user: %q: refresh token creation failed: %v", req.Email, err)
 		RespondWithJSON(w, http.StatusInternalServerError, LoginResponse{
 			Success: false,
 			Message: "Error generating authentication token",
@@ -168,11 +198,105 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("Login attempt for user: %q: succeeded", req.Email)
 
+	h.respondWithTokens(w, user, refreshToken, sessionID)
+}
+
+// Refresh exchanges a refresh token for a new access token and a new refresh token.
+// The old refresh token can't be used again. If it is, the session is revoked.
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s: entered\n", r.Method, r.URL.Path)
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	userID, refreshToken, sessionID, err := h.Tokens.RotateRefreshToken(req.RefreshToken)
+	if err != nil {
+		code, msg := http.StatusInternalServerError, "Error refreshing authentication token"
+		switch err {
+		case ErrTokenInvalid:
+			code, msg = http.StatusUnauthorized, "Invalid or expired refresh token"
+		case ErrTokenReused:
+			log.Printf("Refresh: refresh token reused: session revoked")
+			code, msg = http.StatusUnauthorized, "Refresh token was already used; please sign in again"
+		default:
+			log.Printf("Refresh: %v", err)
+		}
+		RespondWithJSON(w, code, LoginResponse{
+			Success: false,
+			Message: msg,
+		})
+		return
+	}
+
+	// The user may have been deactivated since they signed in
+	user, err := h.Store.GetUser(userID)
+	if err != nil {
+		code, msg := http.StatusInternalServerError, "Error retrieving user information"
+		if err == ErrUnauthorized {
+			_ = h.Tokens.RevokeRefreshToken(refreshToken)
+			code, msg = http.StatusUnauthorized, "Invalid credentials"
+		}
+		RespondWithJSON(w, code, LoginResponse{
+			Success: false,
+			Message: msg,
+		})
+		return
+	}
+
+	h.respondWithTokens(w, user, refreshToken, sessionID)
+}
+
+// Logout revokes the session that the refresh token belongs to.
+// Access tokens for the session stop working immediately.
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s: entered\n", r.Method, r.URL.Path)
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	// signing out twice is not an error
+	if err := h.Tokens.RevokeRefreshToken(req.RefreshToken); err != nil && err != ErrTokenInvalid {
+		log.Printf("Logout: %v", err)
+		RespondWithError(w, http.StatusInternalServerError, "Error revoking session")
+		return
+	}
+
+	RespondWithJSON(w, http.StatusOK, map[string]bool{"success": true})
+}
+
+// respondWithTokens sends a new access token along with the refresh token.
+func (h *AuthHandler) respondWithTokens(w http.ResponseWriter, user *User, refreshToken, sessionID string) {
+	token, err := GenerateJWT(h.Keys, user.ID, user.Clan, user.IsActive, user.IsAdmin, sessionID)
+	if err != nil {
+		log.Printf("Token creation for user %d failed: %v", user.ID, err)
+		RespondWithJSON(w, http.StatusInternalServerError, LoginResponse{
+			Success: false,
+			Message: "Error generating authentication token",
+		})
+		return
+	}
+
 	RespondWithJSON(w, http.StatusOK, LoginResponse{
-		Success: true,
-		Token:   token,
-		Clan:    user.Clan,
-		UserID:  user.ID,
+		Success:      true,
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(AccessTokenTTL.Seconds()),
+		Clan:         user.Clan,
+		UserID:       user.ID,
 	})
 }
 
@@ -187,7 +311,10 @@ func (h *AuthHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 
 	// Get user details
 	user, err := h.Store.GetUser(userID)
-	if err != nil {
+	if err == ErrUnauthorized {
+		RespondWithError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	} else if err != nil {
 		RespondWithError(w, http.StatusInternalServerError, "Error retrieving user information")
 		return
 	}
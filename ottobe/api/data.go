@@ -11,22 +11,37 @@ import (
 
 // DataHandler handles data-related API endpoints
 type DataHandler struct {
-	Store    UserStore
-	BasePath string // Base path for user data
+	Store UserStore
 }
 
-// GetUserData returns user data information
-func (h *DataHandler) GetUserData(w http.ResponseWriter, r *http.Request) {
-	// We only need the clan from context for this endpoint
-
-	clan, ok := r.Context().Value("clan").(string)
+// currentUser returns the user for the token in the request.
+// It sends an error response and returns nil if the user can't be found.
+func (h *DataHandler) currentUser(w http.ResponseWriter, r *http.Request) *User {
+	userID, ok := r.Context().Value("userID").(int64)
 	if !ok {
 		RespondWithError(w, http.StatusUnauthorized, "Authentication required")
-		return
+		return nil
 	}
 
-	// Create user data path
-	userDataPath := filepath.Join(h.BasePath, clan, "data")
+	user, err := h.Store.GetUser(userID)
+	if err == ErrUnauthorized {
+		RespondWithError(w, http.StatusUnauthorized, "Authentication required")
+		return nil
+	} else if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, "Error retrieving user information")
+		return nil
+	}
+	return user
+}
+
+// GetUserData returns user data information
+func (h *DataHandler) GetUserData(w http.ResponseWriter, r *http.Request) {
+	// The store resolves the data path, so we need the user, not just the clan
+	user := h.currentUser(w, r)
+	if user == nil {
+		return
+	}
+	clan, userDataPath := user.Clan, user.Data
 
 	// Check if data directory exists
 	if _, err := os.Stat(userDataPath); os.IsNotExist(err) {
@@ -56,11 +71,8 @@ func (h *DataHandler) GetUserData(w http.ResponseWriter, r *http.Request) {
 
 // GetTurnData returns data for a specific turn
 func (h *DataHandler) GetTurnData(w http.ResponseWriter, r *http.Request) {
-	// We don't need the userID for this endpoint, just the clan
-
-	clan, ok := r.Context().Value("clan").(string)
-	if !ok {
-		RespondWithError(w, http.StatusUnauthorized, "Authentication required")
+	user := h.currentUser(w, r)
+	if user == nil {
 		return
 	}
 
@@ -81,10 +93,8 @@ func (h *DataHandler) GetTurnData(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Create user data path
-	userDataPath := filepath.Join(h.BasePath, clan, "data")
 	// Construct path to turn data
-	turnDataPath := filepath.Join(userDataPath, "output", year, month)
+	turnDataPath := filepath.Join(user.Data, "output", year, month)
 
 	// Check if directory exists
 	if _, err := os.Stat(turnDataPath); os.IsNotExist(err) {
@@ -0,0 +1,86 @@
+// Copyright (c) 2024. All rights reserved.
+
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// KeySet holds the keys for signing and verifying JWT tokens.
+// Tokens are signed with the current key and carry its id in the "kid" header.
+//
+// To rotate keys, add a new key to the front of the list and keep the old one
+// until every token signed with it has expired.
+type KeySet struct {
+	current string            // id of the key used to sign new tokens
+	keys    map[string][]byte // every key that we accept, indexed by id
+}
+
+// ParseKeySet parses a comma separated list of "kid=secret" pairs.
+// The first key signs new tokens; the others are only used to verify tokens.
+// A secret without an id is given the id "default".
+func ParseKeySet(spec string) (*KeySet, error) {
+	ks := &KeySet{keys: make(map[string][]byte)}
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		kid, secret, ok := strings.Cut(pair, "=")
+		if !ok {
+			kid, secret = "default", pair
+		}
+		if kid == "" || secret == "" {
+			return nil, fmt.Errorf("jwt key %q: id and secret are required", pair)
+		} else if _, ok := ks.keys[kid]; ok {
+			return nil, fmt.Errorf("jwt key %q: duplicate id", kid)
+		}
+		ks.keys[kid] = []byte(secret)
+		if ks.current == "" {
+			ks.current = kid
+		}
+	}
+	if ks.current == "" {
+		return nil, fmt.Errorf("jwt keys: at least one key is required")
+	}
+	return ks, nil
+}
+
+// NewRandomKeySet returns a key set with a single random key.
+// Tokens signed with it are only good until the server restarts.
+func NewRandomKeySet() (*KeySet, error) {
+	kid, secret := make([]byte, 4), make([]byte, 32)
+	if _, err := rand.Read(kid); err != nil {
+		return nil, err
+	} else if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return &KeySet{
+		current: hex.EncodeToString(kid),
+		keys:    map[string][]byte{hex.EncodeToString(kid): secret},
+	}, nil
+}
+
+// Current returns the id of the key that signs new tokens.
+func (ks *KeySet) Current() string {
+	return ks.current
+}
+
+// Len returns the number of keys in the set.
+func (ks *KeySet) Len() int {
+	return len(ks.keys)
+}
+
+// signingKey returns the id and secret of the current key.
+func (ks *KeySet) signingKey() (string, []byte) {
+	return ks.current, ks.keys[ks.current]
+}
+
+// lookup returns the secret for the key id.
+func (ks *KeySet) lookup(kid string) ([]byte, bool) {
+	key, ok := ks.keys[kid]
+	return key, ok
+}
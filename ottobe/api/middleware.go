@@ -9,12 +9,16 @@ import (
 	"strings"
 )
 
-// AuthMiddleware validates JWT tokens and sets user information in request context
-func AuthMiddleware(jwtKey []byte) func(http.Handler) http.Handler {
+// AuthMiddleware validates JWT tokens and sets user information in request context.
+// Tokens for a session that has been revoked are rejected even if they haven't expired.
+func AuthMiddleware(keys *KeySet, tokens TokenStore) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Skip auth for specific paths
+			// The refresh and logout routes are authenticated by the refresh token in the body
 			if r.URL.Path == "/api/auth/login" ||
+				r.URL.Path == "/api/auth/refresh" ||
+				r.URL.Path == "/api/auth/logout" ||
 				r.URL.Path == "/api/health" ||
 				r.Method == http.MethodOptions {
 				next.ServeHTTP(w, r)
@@ -36,12 +40,22 @@ func AuthMiddleware(jwtKey []byte) func(http.Handler) http.Handler {
 			}
 
 			token := parts[1]
-			claims, err := ParseJWT(token, jwtKey)
+			claims, err := ParseJWT(token, keys)
 			if err != nil {
 				RespondWithError(w, http.StatusUnauthorized, "Invalid or expired token")
 				return
 			}
 
+			// Check that the session hasn't been revoked
+			if active, err := tokens.IsSessionActive(claims.SessionID); err != nil {
+				log.Printf("Auth middleware: session %q: %v", claims.SessionID, err)
+				RespondWithError(w, http.StatusInternalServerError, "Error checking session")
+				return
+			} else if !active {
+				RespondWithError(w, http.StatusUnauthorized, "Session has been revoked")
+				return
+			}
+
 			// Set claims in request context
 			ctx := context.WithValue(r.Context(), "userID", claims.UserID)
 			ctx = context.WithValue(ctx, "clan", claims.Clan)
@@ -28,37 +28,50 @@ func RespondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	w.Write(response)
 }
 
+// AccessTokenTTL is how long an access token is good for.
+// Access tokens are short-lived; clients use a refresh token to get a new one.
+const AccessTokenTTL = 15 * time.Minute
+
+// RefreshTokenTTL is how long a refresh token is good for if it isn't used.
+const RefreshTokenTTL = 30 * 24 * time.Hour
+
 // JWTClaims represents the claims in a JWT token
 type JWTClaims struct {
-	UserID   int64  `json:"userId"`
-	Clan     string `json:"clan"`
-	IsActive bool   `json:"isActive"`
-	IsAdmin  bool   `json:"isAdmin"`
+	UserID    int64  `json:"userId"`
+	Clan      string `json:"clan"`
+	IsActive  bool   `json:"isActive"`
+	IsAdmin   bool   `json:"isAdmin"`
+	SessionID string `json:"sid"` // the refresh token family that the token was issued for
 	jwt.RegisteredClaims
 }
 
-// GenerateJWT creates a JWT token for a user
-func GenerateJWT(key []byte, userID int64, clan string, isActive bool, isAdmin bool) (string, error) {
-	expiresAt := time.Now().Add(24 * time.Hour) // Token expires in 24 hours
+// GenerateJWT creates an access token for a user.
+// The token is signed with the current key, and the key id is set in the "kid" header.
+func GenerateJWT(keys *KeySet, userID int64, clan string, isActive bool, isAdmin bool, sessionID string) (string, error) {
+	now := time.Now()
 
 	claims := JWTClaims{
-		UserID:   userID,
-		Clan:     clan,
-		IsActive: isActive,
-		IsAdmin:  isAdmin,
+		UserID:    userID,
+		Clan:      clan,
+		IsActive:  isActive,
+		IsAdmin:   isAdmin,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expiresAt),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(now.Add(AccessTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
 		},
 	}
 
+	kid, key := keys.signingKey()
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = kid
 	tokenString, err := token.SignedString(key)
 	return tokenString, err
 }
 
-// ParseJWT parses and validates a JWT token
-func ParseJWT(tokenString string, key []byte) (*JWTClaims, error) {
+// ParseJWT parses and validates a JWT token.
+// The token must name one of the keys in the set in its "kid" header.
+func ParseJWT(tokenString string, keys *KeySet) (*JWTClaims, error) {
 	claims := &JWTClaims{}
 
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
@@ -66,6 +79,11 @@ func ParseJWT(tokenString string, key []byte) (*JWTClaims, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, jwt.ErrSignatureInvalid
 		}
+		kid, _ := token.Header["kid"].(string)
+		key, ok := keys.lookup(kid)
+		if !ok {
+			return nil, jwt.ErrTokenUnverifiable
+		}
 		return key, nil
 	})
 
@@ -78,4 +96,4 @@ func ParseJWT(tokenString string, key []byte) (*JWTClaims, error) {
 	}
 
 	return claims, nil
-}
\ No newline at end of file
+}
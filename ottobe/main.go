@@ -5,149 +5,41 @@ package main
 
 import (
 	"context"
-	"crypto/rand"
-	"encoding/hex"
 	"flag"
 	"fmt"
 	"github.com/mdhender/ottoapp/ottobe/api"
+	"github.com/mdhender/ottoapp/stores/sqlite"
 	"github.com/mdhender/semver"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
-	"strings"
 	"syscall"
 	"time"
 )
 
 var (
 	// Version information
-	version = semver.Version{Major: 0, Minor: 1, Patch: 2}  // Fixed isAdmin flag for admin user
+	version = semver.Version{Major: 0, Minor: 3, Patch: 0}  // Refresh tokens and key rotation
 	
 	// Command line flags
 	databasePath string
-	dataPath     string
 	host         string
 	port         string
-	jwtKey       string
+	jwtKeys      string  // Comma separated list of kid=secret pairs
 	devMode      bool    // Development mode flag
 	showVersion  bool    // Show version and exit
 )
 
-// SimpleUserStore is a simple implementation of the UserStore interface for demo purposes
-type SimpleUserStore struct {
-	users map[int64]*api.User
-}
-
-func NewSimpleUserStore() *SimpleUserStore {
-	return &SimpleUserStore{
-		users: make(map[int64]*api.User),
-	}
-}
-
-func (s *SimpleUserStore) AuthenticateUser(email, password string) (*api.User, error) {
-	// For the demo, we'll allow any login with demo/demo credentials
-	if email == "demo@example.com" && password == "demo" {
-		return &api.User{
-			ID:        1,
-			Email:     "demo@example.com",
-			Clan:      "0001",
-			IsActive:  true,
-			IsAdmin:   false,
-			Created:   time.Now().AddDate(0, 0, -30),
-			LastLogin: time.Now(),
-			Timezone:  "UTC",
-		}, nil
-	}
-	
-	// For admin login
-	if email == "admin@example.com" && password == "admin" {
-		return &api.User{
-			ID:        2,
-			Email:     "admin@example.com",
-			Clan:      "0000",
-			IsActive:  true,
-			IsAdmin:   true,  // Set admin flag for admin user
-			Created:   time.Now().AddDate(0, 0, -60),
-			LastLogin: time.Now(),
-			Timezone:  "UTC",
-		}, nil
-	}
-
-	return nil, api.ErrUnauthorized
-}
-
-func (s *SimpleUserStore) GetUser(userID int64) (*api.User, error) {
-	if user, exists := s.users[userID]; exists {
-		return user, nil
-	}
-
-	// For demo purposes, hardcode some users
-	if userID == 1 {
-		return &api.User{
-			ID:        1,
-			Email:     "demo@example.com",
-			Clan:      "0001",
-			IsActive:  true,
-			IsAdmin:   false,
-			Created:   time.Now().AddDate(0, 0, -30),
-			LastLogin: time.Now(),
-			Timezone:  "UTC",
-		}, nil
-	} else if userID == 2 {
-		return &api.User{
-			ID:        2,
-			Email:     "admin@example.com",
-			Clan:      "0000",
-			IsActive:  true,
-			IsAdmin:   true,   // Ensure admin status is set for GetUser
-			Created:   time.Now().AddDate(0, 0, -60),
-			LastLogin: time.Now(),
-			Timezone:  "UTC",
-		}, nil
-	}
-
-	return nil, fmt.Errorf("user not found")
-}
-
-func (s *SimpleUserStore) CreateUser(email, password, clan, timezone string) (*api.User, error) {
-	// Validate email
-	if !strings.Contains(email, "@") {
-		return nil, api.ErrInvalidEmail
-	}
-
-	// Validate clan ID
-	if len(clan) != 4 {
-		return nil, api.ErrInvalidClan
-	}
-
-	// Create a new user with next available ID
-	nextID := int64(len(s.users) + 3) // Start from 3 to avoid conflicts with hardcoded demo users
-	user := &api.User{
-		ID:        nextID,
-		Email:     email,
-		Clan:      clan,
-		IsActive:  true,
-		Created:   time.Now(),
-		LastLogin: time.Time{}, // Zero time
-		Timezone:  timezone,
-	}
-
-	// Save the user
-	s.users[nextID] = user
-	return user, nil
-}
-
 func main() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 	log.Printf("Starting ottobe API server v%s", version.String())
 
 	// Parse command line flags
-	flag.StringVar(&databasePath, "database", "", "Path to the SQLite database")
-	flag.StringVar(&dataPath, "data", "userdata", "Path to user data directory")
+	flag.StringVar(&databasePath, "database", "", "Path to the ottoapp SQLite database")
 	flag.StringVar(&host, "host", "localhost", "Host to serve on")
 	flag.StringVar(&port, "port", "29631", "Port to bind to")
-	flag.StringVar(&jwtKey, "jwt-key", "", "Secret key for JWT signing")
+	flag.StringVar(&jwtKeys, "jwt-keys", "", "Keys for JWT signing as kid=secret,... (the first key signs new tokens)")
 	flag.BoolVar(&devMode, "dev", false, "Enable development mode (enables route logging and other debug features)")
 	flag.BoolVar(&showVersion, "version", false, "Show version information and exit")
 	flag.Parse()
@@ -159,29 +51,47 @@ func main() {
 	}
 
 	// Generate random JWT key if not provided
-	if jwtKey == "" {
-		randBytes := make([]byte, 32)
-		if _, err := rand.Read(randBytes); err != nil {
+	var keys *api.KeySet
+	if jwtKeys == "" {
+		ks, err := api.NewRandomKeySet()
+		if err != nil {
 			log.Fatal("Error generating random JWT key: ", err)
 		}
-		jwtKey = hex.EncodeToString(randBytes)
+		keys = ks
 		log.Println("Generated random JWT key")
+	} else {
+		ks, err := api.ParseKeySet(jwtKeys)
+		if err != nil {
+			log.Fatalf("Error: --jwt-keys: %v", err)
+		}
+		keys = ks
+		log.Printf("Loaded %d JWT keys, signing with %q", keys.Len(), keys.Current())
 	}
 
-	// Create user store
-	// In a real implementation, we would connect to the database here
-	// But for now, use a simple in-memory store for demonstration
-	userStore := NewSimpleUserStore()
+	// Open the ottoapp database. The users and the path to their data come from
+	// the same tables that the web application uses.
+	if databasePath == "" {
+		log.Fatal("Error: --database is required")
+	}
+	db, err := sqlite.Open(databasePath, context.Background())
+	if err != nil {
+		log.Fatalf("Error opening database: %v", err)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+	userStore := NewSQLiteUserStore(db)
+	tokenStore := NewSQLiteTokenStore(db)
 
 	// Create API handlers
 	authHandler := &api.AuthHandler{
 		Store:  userStore,
-		JWTKey: []byte(jwtKey),
+		Tokens: tokenStore,
+		Keys:   keys,
 	}
 
 	dataHandler := &api.DataHandler{
-		Store:    userStore,
-		BasePath: dataPath,
+		Store: userStore,
 	}
 
 	// Create router
@@ -189,6 +99,8 @@ func main() {
 
 	// Auth routes
 	mux.HandleFunc("POST /api/auth/login", authHandler.Login)
+	mux.HandleFunc("POST /api/auth/refresh", authHandler.Refresh)
+	mux.HandleFunc("POST /api/auth/logout", authHandler.Logout)
 	mux.HandleFunc("GET /api/auth/user", authHandler.GetUser)
 	
 	// Data routes
@@ -217,10 +129,9 @@ func main() {
 	// Add debug routes - we'll add this manually after applying middleware
 
 	// Apply middlewares
-	jwtKeyBytes := []byte(jwtKey)
 	handler := api.CORSMiddleware("http://localhost:3000")(mux)
 	handler = api.LoggingMiddleware(loggingConfig)(handler)
-	handler = api.AuthMiddleware(jwtKeyBytes)(handler)
+	handler = api.AuthMiddleware(keys, tokenStore)(handler)
 	
 	// Add authorization check for admin routes
 	adminOnlyHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
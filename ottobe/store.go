@@ -0,0 +1,146 @@
+// Copyright (c) 2024. All rights reserved.
+
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/mdhender/ottoapp/domains"
+	"github.com/mdhender/ottoapp/ottobe/api"
+	"github.com/mdhender/ottoapp/stores/sqlite"
+	"time"
+)
+
+// SQLiteUserStore implements the UserStore interface with the ottoapp database.
+// The API and the web application share the users table, so a player can
+// sign in to either one with the same e-mail and password.
+type SQLiteUserStore struct {
+	db *sqlite.DB
+}
+
+func NewSQLiteUserStore(db *sqlite.DB) *SQLiteUserStore {
+	return &SQLiteUserStore{db: db}
+}
+
+// AuthenticateUser checks the password against the bcrypt hash in the users table.
+// Inactive users can't sign in.
+func (s *SQLiteUserStore) AuthenticateUser(email, password string) (*api.User, error) {
+	user, err := s.db.AuthenticateUser(email, password)
+	if err != nil {
+		if errors.Is(err, domains.ErrUnauthorized) {
+			return nil, api.ErrUnauthorized
+		}
+		return nil, err
+	}
+	return apiUser(user), nil
+}
+
+// GetUser returns the user with the given ID.
+// It returns ErrUnauthorized if the user doesn't exist or is no longer active,
+// so tokens issued to a deactivated user stop working.
+func (s *SQLiteUserStore) GetUser(userID int64) (*api.User, error) {
+	user, err := s.db.GetUser(domains.ID(userID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, api.ErrUnauthorized
+		}
+		return nil, err
+	}
+	return apiUser(user), nil
+}
+
+// CreateUser adds a user to the users table.
+func (s *SQLiteUserStore) CreateUser(email, password, clan, timezone string) (*api.User, error) {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, api.ErrInvalidTimezone
+	}
+
+	user, err := s.db.CreateUser(email, password, clan, loc)
+	if err != nil {
+		if errors.Is(err, domains.ErrInvalidEmail) {
+			return nil, api.ErrInvalidEmail
+		} else if errors.Is(err, domains.ErrInvalidClan) {
+			return nil, api.ErrInvalidClan
+		}
+		return nil, err
+	}
+	return apiUser(user), nil
+}
+
+// apiUser converts a user from the store to the API's user.
+// The data path comes from the store, which resolves it the same way for both servers.
+func apiUser(user *domains.User_t) *api.User {
+	u := &api.User{
+		ID:        int64(user.ID),
+		Email:     user.Email,
+		Clan:      user.Clan,
+		IsActive:  user.Roles.IsActive,
+		IsAdmin:   user.Roles.IsAdministrator,
+		Created:   user.Created,
+		LastLogin: user.LastLogin,
+		Timezone:  "UTC",
+		Data:      user.Data,
+	}
+	if loc := user.LanguageAndDates.Timezone.Location; loc != nil {
+		u.Timezone = loc.String()
+	}
+	return u
+}
+
+// SQLiteTokenStore implements the TokenStore interface with the ottoapp database.
+// The API's sessions are the store's refresh token families.
+type SQLiteTokenStore struct {
+	db *sqlite.DB
+}
+
+func NewSQLiteTokenStore(db *sqlite.DB) *SQLiteTokenStore {
+	return &SQLiteTokenStore{db: db}
+}
+
+// CreateRefreshToken starts a new session for the user.
+func (s *SQLiteTokenStore) CreateRefreshToken(userID int64) (string, string, error) {
+	token, familyId, _, err := s.db.CreateRefreshToken(domains.ID(userID), api.RefreshTokenTTL)
+	if err != nil {
+		return "", "", err
+	}
+	return token, familyId, nil
+}
+
+// RotateRefreshToken replaces the refresh token with a new one in the same session.
+func (s *SQLiteTokenStore) RotateRefreshToken(token string) (int64, string, string, error) {
+	userId, newToken, familyId, _, err := s.db.RotateRefreshToken(token, api.RefreshTokenTTL)
+	if err != nil {
+		return 0, "", "", apiTokenError(err)
+	}
+	return int64(userId), newToken, familyId, nil
+}
+
+// RevokeRefreshToken revokes the session that the token belongs to.
+func (s *SQLiteTokenStore) RevokeRefreshToken(token string) error {
+	return apiTokenError(s.db.RevokeRefreshToken(token))
+}
+
+// IsSessionActive returns true if the session has a refresh token that can still be used.
+func (s *SQLiteTokenStore) IsSessionActive(sessionID string) (bool, error) {
+	if sessionID == "" {
+		return false, nil
+	}
+	return s.db.IsRefreshTokenFamilyActive(sessionID)
+}
+
+// apiTokenError converts an error from the store to the API's token errors.
+// The client doesn't need to know why a token was rejected unless it was reused.
+func apiTokenError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, domains.ErrRefreshTokenReused):
+		return api.ErrTokenReused
+	case errors.Is(err, domains.ErrRefreshTokenInvalid),
+		errors.Is(err, domains.ErrRefreshTokenExpired),
+		errors.Is(err, domains.ErrRefreshTokenRevoked):
+		return api.ErrTokenInvalid
+	}
+	return err
+}
@@ -47,4 +47,47 @@ export const getCurrentUser = async (token) => {
   }
   
   return response.json();
-};
\ No newline at end of file
+};
+
+/**
+ * Exchange a refresh token for a new access token and refresh token.
+ * The old refresh token can't be used again.
+ * @param {string} refreshToken - Refresh token from login or the last refresh
+ * @returns {Promise} - Response with the new tokens and user info
+ */
+export const refresh = async (refreshToken) => {
+  const response = await fetch(`${API_URL}/auth/refresh`, {
+    method: 'POST',
+    headers: {
+      'Content-Type': 'application/json',
+    },
+    body: JSON.stringify({ refreshToken }),
+  });
+
+  if (!response.ok) {
+    throw new Error(`Refresh failed with status: ${response.status}`);
+  }
+
+  return response.json();
+};
+
+/**
+ * Logout and revoke the session on the server
+ * @param {string} refreshToken - Refresh token for the session
+ * @returns {Promise} - Response with success flag
+ */
+export const logout = async (refreshToken) => {
+  const response = await fetch(`${API_URL}/auth/logout`, {
+    method: 'POST',
+    headers: {
+      'Content-Type': 'application/json',
+    },
+    body: JSON.stringify({ refreshToken }),
+  });
+
+  if (!response.ok) {
+    throw new Error(`Logout failed with status: ${response.status}`);
+  }
+
+  return response.json();
+};
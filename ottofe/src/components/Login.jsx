@@ -82,11 +82,6 @@ export default function Login() {
               {loading ? 'Signing in...' : 'Sign in'}
             </button>
           </div>
-
-          <div className="text-sm text-center">
-            <p className="text-gray-600">Demo credentials:</p>
-            <p className="text-gray-500">Email: demo@example.com | Password: demo</p>
-          </div>
         </form>
       </div>
     </div>
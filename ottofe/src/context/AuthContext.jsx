@@ -1,5 +1,5 @@
 import { createContext, useContext, useState, useEffect, useCallback } from 'react';
-import { login as apiLogin, getCurrentUser } from '@/api/auth';
+import { login as apiLogin, logout as apiLogout, refresh as apiRefresh, getCurrentUser } from '@/api/auth';
 
 const AuthContext = createContext();
 
@@ -8,6 +8,7 @@ export const useAuth = () => useContext(AuthContext);
 export function AuthProvider({ children }) {
   const [currentUser, setCurrentUser] = useState(null);
   const [token, setToken] = useState(localStorage.getItem('token'));
+  const [expiresIn, setExpiresIn] = useState(0); // seconds until the access token expires
   const [loading, setLoading] = useState(true);
   const [error, setError] = useState('');
 
@@ -22,7 +23,11 @@ export function AuthProvider({ children }) {
           setCurrentUser(userData);
         } catch (err) {
           console.error('Failed to get user data during init:', err);
-          logout(); // Token invalid, so logout
+          // The access token may have expired, so try to refresh it.
+          // A new token re-runs this effect to fetch the user.
+          if (!(await refreshSession())) {
+            clearAuth(); // Refresh token invalid, so logout
+          }
         }
       } else {
         console.log('No token found, user is not authenticated');
@@ -33,6 +38,56 @@ export function AuthProvider({ children }) {
     initAuth();
   }, [token]);
 
+  // Refresh the access token a minute before it expires
+  useEffect(() => {
+    if (!token || !expiresIn) {
+      return;
+    }
+    const delay = Math.max(expiresIn - 60, 10) * 1000;
+    const timer = setTimeout(async () => {
+      if (!(await refreshSession())) {
+        clearAuth();
+      }
+    }, delay);
+    return () => clearTimeout(timer);
+  }, [token, expiresIn]);
+
+  const saveTokens = (data) => {
+    localStorage.setItem('token', data.token);
+    if (data.refreshToken) {
+      localStorage.setItem('refreshToken', data.refreshToken);
+    }
+    setExpiresIn(data.expiresIn || 0);
+    setToken(data.token);
+  };
+
+  const clearAuth = () => {
+    localStorage.removeItem('token');
+    localStorage.removeItem('refreshToken');
+    setExpiresIn(0);
+    setToken(null);
+    setCurrentUser(null);
+  };
+
+  // Exchange the refresh token for new tokens. Returns false if the session is gone.
+  const refreshSession = async () => {
+    const refreshToken = localStorage.getItem('refreshToken');
+    if (!refreshToken) {
+      return false;
+    }
+    try {
+      const data = await apiRefresh(refreshToken);
+      if (data.success && data.token) {
+        console.log('Access token refreshed');
+        saveTokens(data);
+        return true;
+      }
+    } catch (err) {
+      console.error('Failed to refresh access token:', err);
+    }
+    return false;
+  };
+
   const fetchUserData = useCallback(async (authToken) => {
     try {
       const userData = await getCurrentUser(authToken);
@@ -55,8 +110,7 @@ export function AuthProvider({ children }) {
       console.log('Login API response:', data);
       
       if (data.success && data.token) {
-        localStorage.setItem('token', data.token);
-        setToken(data.token);
+        saveTokens(data);
         
         // Immediately fetch user data after successful login
         const userData = await fetchUserData(data.token);
@@ -80,10 +134,17 @@ export function AuthProvider({ children }) {
     }
   };
 
-  const logout = () => {
-    localStorage.removeItem('token');
-    setToken(null);
-    setCurrentUser(null);
+  const logout = async () => {
+    // Revoke the session on the server so the tokens can't be used again
+    const refreshToken = localStorage.getItem('refreshToken');
+    if (refreshToken) {
+      try {
+        await apiLogout(refreshToken);
+      } catch (err) {
+        console.error('Logout error:', err);
+      }
+    }
+    clearAuth();
   };
 
   const value = {
@@ -0,0 +1,324 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/mdhender/ottoapp/components/pages"
+	"github.com/mdhender/ottoapp/domains"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	passwordResetTTL      = time.Hour
+	passwordResetInterval = 5 * time.Minute // minimum time between reset e-mails for a user
+)
+
+// getLoginClanIdForgot shows the form used to request a password reset link.
+func (s *Server) getLoginClanIdForgot(path string) http.HandlerFunc {
+	files := []string{
+		filepath.Join(path, "pages", "password_reset.gohtml"),
+	}
+	s.templates.register(files...)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("%s %s: entered\n", r.Method, r.URL.Path)
+		if r.Method != "GET" {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		clanId, ok := passwordResetClanId(r)
+		if !ok {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		payload := pages.PasswordReset{ClanId: clanId, Heading: "Reset your password"}
+		if s.mailer == nil {
+			payload.Message = "This server can't send e-mail. Please ask an administrator to reset your password or to send you a magic link."
+		} else {
+			payload.Form = "request"
+			payload.Message = fmt.Sprintf("Enter the e-mail address for clan %s and we'll send you a link to reset your password.", clanId)
+		}
+		s.writePasswordResetPage(w, r, http.StatusOK, payload, files...)
+	}
+}
+
+// postLoginClanIdForgot sends a password reset link if the e-mail address matches the clan.
+// The response is the same whether the address matches or not so that it can't be
+// used to find out which addresses have accounts.
+func (s *Server) postLoginClanIdForgot(path string) http.HandlerFunc {
+	files := []string{
+		filepath.Join(path, "pages", "password_reset.gohtml"),
+	}
+	s.templates.register(files...)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("%s %s: entered\n", r.Method, r.URL.Path)
+		if r.Method != "POST" {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		} else if contentType := r.Header.Get("Content-Type"); !(contentType == "application/x-www-form-urlencoded" || strings.HasPrefix(contentType, "application/x-www-form-urlencoded;")) {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		clanId, ok := passwordResetClanId(r)
+		if !ok {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		} else if s.mailer == nil {
+			http.Redirect(w, r, fmt.Sprintf("/login/clan/%s/forgot", clanId), http.StatusSeeOther)
+			return
+		}
+		email := strings.TrimSpace(r.FormValue("email"))
+
+		if err := s.sendPasswordReset(clanId, email); err != nil {
+			log.Printf("%s %s: clan %q: %v\n", r.Method, r.URL.Path, clanId, err)
+		}
+
+		payload := pages.PasswordReset{
+			ClanId:  clanId,
+			Heading: "Check your e-mail",
+			Message: fmt.Sprintf("If %s is the address for clan %s, we've sent it a link to reset your password. The link expires in an hour.", email, clanId),
+		}
+		s.writePasswordResetPage(w, r, http.StatusOK, payload, files...)
+	}
+}
+
+// sendPasswordReset creates a reset token and e-mails it to the user.
+// It returns an error explaining why nothing was sent; the caller only logs it.
+func (s *Server) sendPasswordReset(clanId, email string) error {
+	userId, err := s.stores.store.GetUserByClan(clanId)
+	if err != nil {
+		return err
+	}
+	user, err := s.stores.store.GetUser(userId)
+	if err != nil {
+		return err
+	} else if !user.Roles.IsActive {
+		return fmt.Errorf("user is not active")
+	} else if !strings.EqualFold(user.Email, email) {
+		return fmt.Errorf("e-mail %q does not match", email)
+	}
+	if n, err := s.stores.store.CountPasswordResetsSince(user.ID, time.Now().Add(-passwordResetInterval)); err != nil {
+		return err
+	} else if n != 0 {
+		return fmt.Errorf("reset link sent less than %v ago", passwordResetInterval)
+	}
+
+	token, _, err := s.stores.store.CreatePasswordReset(user.ID, passwordResetTTL)
+	if err != nil {
+		return err
+	}
+	link := fmt.Sprintf("%s/login/clan/%s/reset/%s", s.baseURL, clanId, token)
+	body := fmt.Sprintf("Someone asked to reset the password for clan %s on OttoMap.\n\n"+
+		"To choose a new password, open this link within the next hour:\n\n%s\n\n"+
+		"Resetting your password signs you out everywhere.\n"+
+		"If you didn't ask for this, you can ignore this message; your password has not been changed.\n",
+		clanId, link)
+
+	// send in the background so that the response doesn't show whether the address matched
+	go func(to string) {
+		if err := s.mailer.Send(to, "Reset your OttoMap password", body); err != nil {
+			log.Printf("password reset: clan %q: send: %v\n", clanId, err)
+			return
+		}
+		log.Printf("password reset: clan %q: sent reset link\n", clanId)
+	}(user.Email)
+
+	return nil
+}
+
+// getLoginClanIdReset shows the form used to set a new password if the token is valid.
+func (s *Server) getLoginClanIdReset(path string) http.HandlerFunc {
+	files := []string{
+		filepath.Join(path, "pages", "password_reset.gohtml"),
+	}
+	s.templates.register(files...)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("%s %s: entered\n", r.Method, r.URL.Path)
+		if r.Method != "GET" {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		clanId, ok := passwordResetClanId(r)
+		if !ok {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		token := r.PathValue("token")
+
+		if _, err := s.stores.store.CheckPasswordReset(clanId, token); err != nil {
+			payload, status := passwordResetFailed(clanId, err)
+			if status == http.StatusInternalServerError {
+				log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			log.Printf("%s %s: clan %q: %v\n", r.Method, r.URL.Path, clanId, err)
+			s.writePasswordResetPage(w, r, status, payload, files...)
+			return
+		}
+
+		payload := pages.PasswordReset{
+			ClanId:    clanId,
+			Token:     token,
+			Form:      "password",
+			Heading:   "Choose a new password",
+			Message:   fmt.Sprintf("Your new password must be %d to %d characters long.", minPasswordLength, maxPasswordLength),
+			MinLength: minPasswordLength,
+		}
+		s.writePasswordResetPage(w, r, http.StatusOK, payload, files...)
+	}
+}
+
+// postLoginClanIdReset sets the new password and signs the user out of all their sessions.
+func (s *Server) postLoginClanIdReset(path string) http.HandlerFunc {
+	files := []string{
+		filepath.Join(path, "pages", "password_reset.gohtml"),
+	}
+	s.templates.register(files...)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("%s %s: entered\n", r.Method, r.URL.Path)
+		if r.Method != "POST" {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		} else if contentType := r.Header.Get("Content-Type"); !(contentType == "application/x-www-form-urlencoded" || strings.HasPrefix(contentType, "application/x-www-form-urlencoded;")) {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		clanId, ok := passwordResetClanId(r)
+		if !ok {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		input := struct {
+			token   string
+			new     string
+			confirm string
+		}{
+			token:   r.PathValue("token"),
+			new:     r.FormValue("new-password"),
+			confirm: r.FormValue("confirm-password"),
+		}
+
+		payload := pages.PasswordReset{
+			ClanId:    clanId,
+			Token:     input.token,
+			Form:      "password",
+			Heading:   "Choose a new password",
+			Message:   fmt.Sprintf("Your new password must be %d to %d characters long.", minPasswordLength, maxPasswordLength),
+			MinLength: minPasswordLength,
+		}
+		if len(input.new) < minPasswordLength {
+			payload.Error = fmt.Sprintf("Your new password must be at least %d characters long.", minPasswordLength)
+		} else if len(input.new) > maxPasswordLength {
+			payload.Error = fmt.Sprintf("Your new password must be no more than %d characters long.", maxPasswordLength)
+		} else if input.new != input.confirm {
+			payload.Error = "The new passwords do not match."
+		}
+		if payload.Error != "" {
+			s.writePasswordResetPage(w, r, http.StatusOK, payload, files...)
+			return
+		}
+
+		if _, err := s.stores.store.ResetPassword(clanId, input.token, input.new); err != nil {
+			payload, status := passwordResetFailed(clanId, err)
+			if status == http.StatusInternalServerError {
+				log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			log.Printf("%s %s: clan %q: %v\n", r.Method, r.URL.Path, clanId, err)
+			s.writePasswordResetPage(w, r, status, payload, files...)
+			return
+		}
+		log.Printf("%s %s: clan %q: reset password\n", r.Method, r.URL.Path, clanId)
+		s.audit(r, clanId, domains.AuditPasswordReset, "")
+
+		// every session was deleted, so clear the cookie on this client too
+		if _, err := r.Cookie(s.sessions.cookieName); err == nil {
+			http.SetCookie(w, &http.Cookie{
+				Name:   s.sessions.cookieName,
+				Value:  "",
+				Path:   "/",
+				MaxAge: -1,
+			})
+		}
+
+		payload = pages.PasswordReset{
+			ClanId:  clanId,
+			Heading: "Your password has been changed",
+			Message: "You have been signed out everywhere. Please sign in with your new password.",
+		}
+		s.writePasswordResetPage(w, r, http.StatusOK, payload, files...)
+	}
+}
+
+// passwordResetClanId returns the clan from the request path if it is valid.
+func passwordResetClanId(r *http.Request) (string, bool) {
+	clanId := r.PathValue("clan_id")
+	if len(clanId) != 4 {
+		return "", false
+	} else if n, err := strconv.Atoi(clanId); err != nil || n < 0 || n > 999 {
+		return "", false
+	}
+	return clanId, true
+}
+
+// passwordResetFailed returns the page and status to show when a token can't be used.
+// The status is 500 if the error isn't one of the password reset errors.
+func passwordResetFailed(clanId string, err error) (pages.PasswordReset, int) {
+	payload := pages.PasswordReset{ClanId: clanId}
+	switch {
+	case errors.Is(err, domains.ErrPasswordResetUsed):
+		payload.Heading = "This link has already been used"
+		payload.Message = "Reset links only work once. Sign in with your password, or ask for a new link."
+		return payload, http.StatusGone
+	case errors.Is(err, domains.ErrPasswordResetExpired):
+		payload.Heading = "This link has expired"
+		payload.Message = "Reset links expire after an hour. Please ask for a new link."
+		return payload, http.StatusGone
+	case errors.Is(err, domains.ErrPasswordResetInvalid):
+		payload.Heading = "This link is not valid"
+		payload.Message = "Check that you copied the whole link, or ask for a new one."
+		return payload, http.StatusNotFound
+	}
+	return payload, http.StatusInternalServerError
+}
+
+func (s *Server) writePasswordResetPage(w http.ResponseWriter, r *http.Request, status int, payload pages.PasswordReset, files ...string) {
+	t, err := s.templates.lookup(files...)
+	if err != nil {
+		log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	// parse into a buffer so that we can handle errors without writing to the response
+	buf := &bytes.Buffer{}
+	if err := t.Execute(buf, payload); err != nil {
+		log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_, _ = w.Write(buf.Bytes())
+}
@@ -4,13 +4,12 @@ package main
 
 import (
 	"bytes"
-	"database/sql"
-	"errors"
 	"fmt"
 	"github.com/mdhender/ottoapp/components/app"
 	"github.com/mdhender/ottoapp/components/app/pages/reports/uploads/plaintext"
 	"github.com/mdhender/ottoapp/components/app/widgets"
-	"html/template"
+	"github.com/mdhender/ottoapp/domains"
+	"github.com/mdhender/ottoapp/validator"
 	"log"
 	"net/http"
 	"os"
@@ -28,6 +27,7 @@ func (s *Server) getReportsUploadsPlainText(path string, footer app.Footer) http
 		filepath.Join(path, "app", "widgets", "notifications.gohtml"),
 		filepath.Join(path, "app", "widgets", "report_text.gohtml"),
 	}
+	s.templates.register(files...)
 
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != "GET" {
@@ -43,17 +43,7 @@ func (s *Server) getReportsUploadsPlainText(path string, footer app.Footer) http
 		//}()
 		_, _ = started, bytesWritten
 
-		// fetch the session and get the current user. if either fails, return an error
-		user, err := s.extractSession(r)
-		if err != nil && !errors.Is(err, sql.ErrNoRows) {
-			//log.Printf("%s %s: extractSession: %v\n", r.Method, r.URL.Path, err)
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
-		} else if user == nil {
-			// there is no active session, so this is an error
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-			return
-		}
+		user := userFromRequest(r)
 		//log.Printf("%s %s: session: clan_id %q\n", r.Method, r.URL.Path, user.Clan)
 
 		payload := app.Layout{
@@ -65,7 +55,7 @@ func (s *Server) getReportsUploadsPlainText(path string, footer app.Footer) http
 		payload.CurrentPage.Reports = true
 		payload.Footer.Timestamp = time.Now().In(user.LanguageAndDates.Timezone.Location).Format("2006-01-02 15:04:05")
 
-		t, err := template.ParseFiles(files...)
+		t, err := s.templates.lookup(files...)
 		if err != nil {
 			//log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -93,9 +83,10 @@ func (s *Server) postPlainTextUpload(path string, footer app.Footer) http.Handle
 		filepath.Join(path, "app", "widgets", "notifications.gohtml"),
 		filepath.Join(path, "app", "widgets", "report_text.gohtml"),
 	}
+	s.templates.register(files...)
 	const fieldName = "text"
 
-	render := func(w http.ResponseWriter, r *http.Request, text, title, message string, button widgets.Button_e) (int, error) {
+	render := func(w http.ResponseWriter, r *http.Request, text, title, message string, button widgets.Button_e, details ...string) (int, error) {
 		textFragment, err := s.renderFragment(text, "report-text", files...)
 		if err != nil {
 			return 0, err
@@ -105,6 +96,7 @@ func (s *Server) postPlainTextUpload(path string, footer app.Footer) http.Handle
 			Notifications: []widgets.Notification_t{{
 				Title:   title,
 				Message: message,
+				Details: details,
 				Button:  button,
 			}},
 		}, "notifications-panel", files...)
@@ -113,7 +105,6 @@ func (s *Server) postPlainTextUpload(path string, footer app.Footer) http.Handle
 		}
 		return s.writeFragments(w, r, textFragment, alertFragment)
 	}
-	_ = render
 
 	return func(w http.ResponseWriter, r *http.Request) {
 		//log.Printf("%s %s: entered\n", r.Method, r.URL.Path)
@@ -134,23 +125,19 @@ func (s *Server) postPlainTextUpload(path string, footer app.Footer) http.Handle
 			return
 		}
 
-		// fetch the session and get the current user. if either fails, return an error
-		user, err := s.extractSession(r)
-		if err != nil && !errors.Is(err, sql.ErrNoRows) {
-			//log.Printf("%s %s: extractSession: %v\n", r.Method, r.URL.Path, err)
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
-		} else if user == nil {
-			// there is no active session, so this is an error
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-			return
-		}
+		user := userFromRequest(r)
+		var err error
 		//log.Printf("%s %s: session: clan_id %q\n", r.Method, r.URL.Path, user.Clan)
 
+		// the text is always repaired, so the history shows the option as set
+		upload := newUpload(user, domains.UploadText, scrubOptions(true, false)...)
+		defer s.recordUpload(r, upload)
+
 		// verify that we have an input directory for the clan
 		inputPath := filepath.Join(user.Data, "input")
 		if sb, err := os.Stat(inputPath); err != nil {
 			//log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			upload.Reason = "input folder is missing"
 			bytesWritten, err = render(w, r, "", "Account error", "Your account has not been set up correctly. Please let the administrator know that your input directory is missing.", "")
 			if err != nil {
 				//log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
@@ -159,6 +146,7 @@ func (s *Server) postPlainTextUpload(path string, footer app.Footer) http.Handle
 			return
 		} else if !sb.IsDir() {
 			//log.Printf("%s %s: %s is not a directory\n", r.Method, r.URL.Path, inputPath)
+			upload.Reason = "input folder is not a directory"
 			bytesWritten, err = render(w, r, "", "Account error", "Your account has not been set up correctly. Please let the administrator know that your input directory is not a folder.", "")
 			if err != nil {
 				//log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
@@ -172,6 +160,7 @@ func (s *Server) postPlainTextUpload(path string, footer app.Footer) http.Handle
 		outputPath := filepath.Join(user.Data, "output")
 		if sb, err := os.Stat(outputPath); err != nil {
 			//log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			upload.Reason = "output folder is missing"
 			bytesWritten, err = render(w, r, "", "Account error", "Your account has not been set up correctly. Please let the administrator know that your output directory is missing.", "")
 			if err != nil {
 				//log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
@@ -180,6 +169,7 @@ func (s *Server) postPlainTextUpload(path string, footer app.Footer) http.Handle
 			return
 		} else if !sb.IsDir() {
 			//log.Printf("%s %s: %s is not a directory\n", r.Method, r.URL.Path, outputPath)
+			upload.Reason = "output folder is not a directory"
 			bytesWritten, err = render(w, r, "", "Account error", "Your account has not been set up correctly. Please let the administrator know that your output directory is not a folder.", "")
 			if err != nil {
 				//log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
@@ -192,8 +182,10 @@ func (s *Server) postPlainTextUpload(path string, footer app.Footer) http.Handle
 		// pull the parameters from the form
 		text := r.FormValue(fieldName)
 		//log.Printf("%s %s: text %d bytes\n", r.Method, r.URL.Path, len(text))
+		setUploadData(upload, []byte(text))
 		if len(text) == 0 {
 			//log.Printf("%s %s: text is empty\n", r.Method, r.URL.Path)
+			upload.Reason = "input is empty"
 			bytesWritten, err = render(w, r, text, "Input is empty", "Please copy your input into the text box and try again.", "")
 			if err != nil {
 				//log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
@@ -202,24 +194,30 @@ func (s *Server) postPlainTextUpload(path string, footer app.Footer) http.Handle
 			return
 		}
 
-		text = scrubEOL(text)
+		// repair the character encoding before we look at the text
+		repaired, summary := replaceInvalidUTF8([]byte(text))
+		upload.Changes = summary.Changes()
+		text = scrubEOL(string(repaired))
 		//log.Printf("%s %s: text %d bytes\n", r.Method, r.URL.Path, len(text))
 		lines := trimLeadingBlankLines(trimTrailingBlankLines(bytes.Split([]byte(text), []byte{'\n'})))
 		//log.Printf("%s %s: text %d lines\n", r.Method, r.URL.Path, len(lines))
-		if len(lines) < 2 {
-			bytesWritten, err = render(w, r, text, "Input is too short", "Expected at least two lines of input.", "")
+
+		// walk the whole report so that the player can fix every problem at once
+		diagnostics := validator.Check(lines)
+		if validator.HasErrors(diagnostics) {
+			//log.Printf("%s %s: diagnostics: %d errors\n", r.Method, r.URL.Path, validator.CountErrors(diagnostics))
+			upload.Reason = diagnosticsReason(diagnostics)
+			bytesWritten, err = render(w, r, text, "Input checks failed", "Please fix the problems listed below and try again.", "", diagnosticsDetails(diagnostics)...)
 			if err != nil {
 				//log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
 				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			}
 			return
 		}
-
-		unitId, turnId, err := checkPlainTextReport(lines)
-		if err != nil {
-			//log.Printf("%s %s: checkPlainTextReport failed\n", r.Method, r.URL.Path)
-			//log.Printf("%s %s: checkPlainTextReport %v\n", r.Method, r.URL.Path, err)
-			bytesWritten, err = render(w, r, text, "Input checks failed", "Error: "+err.Error(), "")
+		unitId, turnId, _ := validator.Header(lines)
+		if reason := checkReportClan(user, unitId); reason != "" {
+			upload.Reason = reason
+			bytesWritten, err = render(w, r, text, "Wrong clan", reason, "")
 			if err != nil {
 				//log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
 				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -229,16 +227,15 @@ func (s *Server) postPlainTextUpload(path string, footer app.Footer) http.Handle
 		//log.Printf("%s %s: unitId %q turnId %q\n", r.Method, r.URL.Path, unitId, turnId)
 
 		fileName := fmt.Sprintf("%s.%s.report.txt", turnId, unitId)
+		upload.FileName, upload.TurnId = fileName, turnId
 		//log.Printf("%s %s: reportFileName %q\n", r.Method, r.URL.Path, fileName)
-		reportFile := filepath.Join(inputPath, fileName)
-		//log.Printf("%s %s: creating %q\n", r.Method, r.URL.Path, reportFile)
-
-		data := replaceInvalidUTF8(bytes.Join(lines, []byte{'\n'}))
+		data := bytes.Join(lines, []byte{'\n'})
 		if len(data) == 0 || data[len(data)-1] != '\n' {
 			data = append(data, '\n')
 		}
-		if err := os.WriteFile(reportFile, data, 0644); err != nil {
+		if _, err := s.stores.ffs.SaveReport(user, fileName, data); err != nil {
 			//log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			upload.Reason = "file could not be saved"
 			bytesWritten, err = render(w, r, text, "Upload failed", "Error: internal server error!", "")
 			if err != nil {
 				//log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
@@ -246,10 +243,20 @@ func (s *Server) postPlainTextUpload(path string, footer app.Footer) http.Handle
 			}
 			return
 		}
-		//log.Printf("%s %s: created  %q\n", r.Method, r.URL.Path, reportFile)
 		//log.Printf("%s %s: wrote    %d bytes\n", r.Method, r.URL.Path, len(data))
+		upload.Succeeded = true
+
+		s.recordDueDate(user, turnId, data)
+		s.queueRender(user, turnId)
 
-		bytesWritten, err = render(w, r, text, "File uploaded", fmt.Sprintf("The uploaded file has been saved as %q. You can view it from the dashboard.", fileName), widgets.BOpenDashboard)
+		message := fmt.Sprintf("The uploaded file has been saved as %q. You can view it from the dashboard.", fileName)
+		if summary.Changed() {
+			message += fmt.Sprintf(" We repaired the text before saving it: %s.", summary)
+		}
+		if len(diagnostics) != 0 {
+			message += " The report may not map correctly because of the warnings listed below."
+		}
+		bytesWritten, err = render(w, r, text, "File uploaded", message, widgets.BOpenDashboard, diagnosticsDetails(diagnostics)...)
 		if err != nil {
 			//log.Printf("%s %s: render %v\n", r.Method, r.URL.Path, err)
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -262,6 +269,7 @@ func (s *Server) postPlainTextScrub(path, userdata string) http.HandlerFunc {
 		filepath.Join(path, "app", "widgets", "notifications.gohtml"),
 		filepath.Join(path, "app", "widgets", "report_text.gohtml"),
 	}
+	s.templates.register(files...)
 	fieldName := "text"
 
 	render := func(w http.ResponseWriter, r *http.Request, text, title, message string, button widgets.Button_e) (int, error) {
@@ -301,17 +309,8 @@ func (s *Server) postPlainTextScrub(path, userdata string) http.HandlerFunc {
 			return
 		}
 
-		// fetch the session and get the current user. if either fails, return an error
-		user, err := s.extractSession(r)
-		if err != nil && !errors.Is(err, sql.ErrNoRows) {
-			log.Printf("%s %s: extractSession: %v\n", r.Method, r.URL.Path, err)
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
-		} else if user == nil {
-			// there is no active session, so this is an error
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-			return
-		}
+		user := userFromRequest(r)
+		var err error
 		log.Printf("%s %s: session: clan_id %q\n", r.Method, r.URL.Path, user.Clan)
 
 		// verify that we have a log directory for the clan
@@ -399,54 +398,6 @@ func scrubEOL(input string) string {
 	return string(bytes.Join(lines, []byte{'\n'}))
 }
 
-func checkUnitHeader(line string) (clanId string, err error) {
-	line = strings.ToLower(line)
-	//log.Printf("checkUnitHeader: %q\n", line)
-
-	unitId, ok := matchUnitPrefix(line)
-	if !ok {
-		return "", fmt.Errorf(`first line is missing the unit. expected it to look like "Tribe 0987, ,Current Hex = QQ 1234, (Previous Hex = QQ 1234)"`)
-	}
-
-	var currentHex, previousHex string
-	switch fields := strings.Split(line, ","); len(fields) {
-	case 4:
-		currentHex = strings.TrimSpace(fields[2])
-		previousHex = strings.TrimSpace(fields[3])
-	case 3, 2, 1:
-		return "", fmt.Errorf(`first line is missing fields. expected it to look like "Tribe 0987, ,Current Hex = QQ 1234, (Previous Hex = QQ 1234)"`)
-	default:
-		return "", fmt.Errorf(`first line contains too many fields. expected 4, found %d`, len(fields))
-	}
-
-	if !strings.HasPrefix(currentHex, "current hex = ") {
-		//log.Printf("checkUnitHeader: currentHex %q\n", currentHex)
-		return "", fmt.Errorf(`first line is missing the current hex. expected it to look like "Tribe 0987, ,Current Hex = QQ 1234, (Previous Hex = QQ 1234)"`)
-	} else if !strings.HasPrefix(previousHex, "(previous hex = ") {
-		//log.Printf("checkUnitHeader: previousHex %q\n", previousHex)
-		return "", fmt.Errorf(`first line is missing the previous hex. expected it to look like "Tribe 0987, ,Current Hex = QQ 1234, (Previous Hex = QQ 1234)"`)
-	}
-
-	return unitId, nil
-}
-
-var (
-	rxCourierPrefix  = regexp.MustCompile(`^courier (\d{4}c\d),`)
-	rxElementPrefix  = regexp.MustCompile(`^element (\d{4}e\d),`)
-	rxFleetPrefix    = regexp.MustCompile(`^fleet (\d{4}f\d),`)
-	rxGarrisonPrefix = regexp.MustCompile(`^garrison (\d{4}g\d),`)
-	rxTribePrefix    = regexp.MustCompile(`^tribe (\d{4}),`)
-)
-
-func matchUnitPrefix(line string) (string, bool) {
-	for _, rx := range []*regexp.Regexp{rxTribePrefix, rxCourierPrefix, rxElementPrefix, rxFleetPrefix, rxGarrisonPrefix} {
-		if matches := rx.FindStringSubmatch(line); len(matches) > 1 {
-			return matches[1], true
-		}
-	}
-	return "", false
-}
-
 var (
 	rxTurnHeader = regexp.MustCompile(`^current turn (\d+)-(\d+)`)
 )
@@ -471,33 +422,29 @@ func matchTurnHeader(line string) (string, bool) {
 	return "", false
 }
 
-func checkTurnHeader(line string) (string, error) {
-	line = strings.ToLower(line)
-	//log.Printf("checkUnitHeader: %q\n", line)
-
-	turnId, ok := matchTurnHeader(line)
-	if !ok {
-		return "", fmt.Errorf(`second line is missing Current Turn. expected it to look like "Current Turn 899-12 (#0), Winter, FINE\tNext Turn 900-01 (#1), 29/10/2023"`)
-	}
-
-	return turnId, nil
-}
+var (
+	rxNextTurn = regexp.MustCompile(`next turn (\d+)-(\d+)\s*\(#\d+\),\s*(\d{1,2})/(\d{1,2})/(\d{4})`)
+)
 
-// assumes that the input file has been scrubbed and is in plain text
-func checkPlainTextReport(lines [][]byte) (unitId, turnId string, err error) {
-	if len(lines) < 2 {
-		return "", "", fmt.Errorf("input file is missing the tribe and turn lines")
+// matchNextTurn returns the next turn and the date that its orders are due
+// from a lower-cased turn header, "next turn 900-01 (#1), 29/10/2023".
+// The date is day first and is returned as midnight UTC.
+func matchNextTurn(line string) (nextTurnId string, due time.Time, ok bool) {
+	matches := rxNextTurn.FindStringSubmatch(line)
+	if len(matches) != 6 {
+		return "", time.Time{}, false
 	}
-
-	// extract the clan and turn from the first two lines of the input
-	unitId, err = checkUnitHeader(string(lines[0]))
-	if err != nil {
-		return "", "", err
+	nextTurnId, ok = matchTurnHeader(fmt.Sprintf("current turn %s-%s", matches[1], matches[2]))
+	if !ok {
+		return "", time.Time{}, false
 	}
-	turnId, err = checkTurnHeader(string(lines[1]))
-	if err != nil {
-		return "", "", err
+	day, _ := strconv.Atoi(matches[3])
+	month, _ := strconv.Atoi(matches[4])
+	year, _ := strconv.Atoi(matches[5])
+	due = time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	// reject dates like 31/02/2023 that time.Date would normalize
+	if due.Day() != day || int(due.Month()) != month || due.Year() != year {
+		return "", time.Time{}, false
 	}
-
-	return unitId, turnId, nil
+	return nextTurnId, due, true
 }
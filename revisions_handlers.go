@@ -0,0 +1,228 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mdhender/ottoapp/domains"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// getApiReportRevisionsV1 returns the list of saved revisions for a turn report.
+func (s *Server) getApiReportRevisionsV1() http.HandlerFunc {
+	type revision_t struct {
+		Revision  int    `json:"revision"`
+		Size      int64  `json:"size"`
+		Timestamp string `json:"timestamp"`
+		IsCurrent bool   `json:"current"`
+		Route     string `json:"route"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		started, bytesWritten := time.Now(), 0
+		defer func() {
+			log.Printf("%s %s: wrote %d bytes in %s\n", r.Method, r.URL.Path, bytesWritten, time.Since(started))
+		}()
+
+		user := userFromRequest(r)
+
+		reportId := r.PathValue("report_id")
+		revisions, err := s.stores.ffs.GetReportRevisions(user, reportId)
+		if err != nil {
+			if errors.Is(err, domains.ErrInvalidPath) {
+				http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+				return
+			}
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		list := []revision_t{}
+		for _, rev := range revisions {
+			list = append(list, revision_t{
+				Revision:  rev.Number,
+				Size:      rev.Size,
+				Timestamp: rev.Timestamp.In(user.LanguageAndDates.Timezone.Location).Format(time.RFC3339),
+				IsCurrent: rev.IsCurrent,
+				Route:     fmt.Sprintf("/api/v1/report/%s/revisions/%d", reportId, rev.Number),
+			})
+		}
+
+		buf, _ := json.MarshalIndent(list, "", "  ")
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		bytesWritten, _ = w.Write(buf)
+	}
+}
+
+// getApiReportRevisionV1 returns the text of a single revision of a turn report.
+func (s *Server) getApiReportRevisionV1() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		started, bytesWritten := time.Now(), 0
+		defer func() {
+			log.Printf("%s %s: wrote %d bytes in %s\n", r.Method, r.URL.Path, bytesWritten, time.Since(started))
+		}()
+
+		user := userFromRequest(r)
+
+		revision, err := strconv.Atoi(r.PathValue("revision"))
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+		data, err := s.stores.ffs.GetReportRevision(user, r.PathValue("report_id"), revision)
+		if err != nil {
+			if errors.Is(err, domains.ErrInvalidPath) || errors.Is(err, domains.ErrNoSuchRevision) {
+				http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+				return
+			}
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		bytesWritten, _ = w.Write(data)
+	}
+}
+
+// getApiReportDiffV1 returns a unified diff between two revisions of a turn report.
+// The revisions are given by the "from" and "to" query parameters.
+// If "to" is missing, the newest revision is used. If "from" is missing, the revision
+// before "to" is used.
+func (s *Server) getApiReportDiffV1() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		started, bytesWritten := time.Now(), 0
+		defer func() {
+			log.Printf("%s %s: wrote %d bytes in %s\n", r.Method, r.URL.Path, bytesWritten, time.Since(started))
+		}()
+
+		user := userFromRequest(r)
+
+		reportId := r.PathValue("report_id")
+		revisions, err := s.stores.ffs.GetReportRevisions(user, reportId)
+		if err != nil {
+			if errors.Is(err, domains.ErrInvalidPath) {
+				http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+				return
+			}
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		} else if len(revisions) == 0 {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+
+		to := revisions[len(revisions)-1].Number
+		if value := r.URL.Query().Get("to"); value != "" {
+			if to, err = strconv.Atoi(value); err != nil {
+				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+				return
+			}
+		}
+		from := to - 1
+		if value := r.URL.Query().Get("from"); value != "" {
+			if from, err = strconv.Atoi(value); err != nil {
+				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+				return
+			}
+		}
+
+		diff, err := s.stores.ffs.DiffReportRevisions(user, reportId, from, to)
+		if err != nil {
+			if errors.Is(err, domains.ErrNoSuchRevision) {
+				http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+				return
+			} else if !errors.Is(err, domains.ErrRevisionsDiffer) {
+				log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			diff = []byte(fmt.Sprintf("revisions %d and %d differ too much to show\n", from, to))
+		} else if diff == nil {
+			diff = []byte(fmt.Sprintf("revisions %d and %d are the same\n", from, to))
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		bytesWritten, _ = w.Write(diff)
+	}
+}
+
+// postApiReportPromoteV1 makes an older revision the current turn report
+// and queues a new map render for the turn.
+func (s *Server) postApiReportPromoteV1() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		started, bytesWritten := time.Now(), 0
+		defer func() {
+			log.Printf("%s %s: wrote %d bytes in %s\n", r.Method, r.URL.Path, bytesWritten, time.Since(started))
+		}()
+
+		user := userFromRequest(r)
+
+		reportId := r.PathValue("report_id")
+		revision, err := strconv.Atoi(r.PathValue("revision"))
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+		if err := s.stores.ffs.PromoteReportRevision(user, reportId, revision); err != nil {
+			if errors.Is(err, domains.ErrInvalidPath) || errors.Is(err, domains.ErrNoSuchRevision) {
+				http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+				return
+			}
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		log.Printf("%s %s: promoted revision %d\n", r.Method, r.URL.Path, revision)
+
+		// the report id starts with the turn id, YYYY-MM
+		if turnId, _, ok := strings.Cut(reportId, "."); ok {
+			if data, err := s.stores.ffs.GetReportRevision(user, reportId, revision); err == nil {
+				s.recordDueDate(user, turnId, data)
+			}
+			s.queueRender(user, turnId)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(struct {
+			Success  bool `json:"success"`
+			Revision int  `json:"revision"`
+		}{
+			Success:  true,
+			Revision: revision,
+		})
+	}
+}
@@ -7,82 +7,121 @@ import "net/http"
 func (s *Server) routes() *http.ServeMux {
 	s.mux = http.NewServeMux()
 
-	//s.mux.HandleFunc("GET /login/{clan_id}/{magic_link}", s.getLoginClanIdMagicLink())
-
-	s.mux.HandleFunc("GET /about", s.getHeroPage(s.paths.components, "about"))
-	s.mux.HandleFunc("GET /calendar", s.getCalendar(s.paths.components, s.blocks.Footer))
-	s.mux.HandleFunc("GET /contact-us", s.getHeroPage(s.paths.components, "contact-us"))
-	s.mux.HandleFunc("GET /dashboard", s.getDashboard(s.paths.components, s.blocks.Footer, s.features.cacheBuster))
-	s.mux.HandleFunc("GET /docs", s.getHeroPage(s.paths.components, "docs"))
-	s.mux.HandleFunc("GET /docs/converting-turn-reports", s.getHeroPage(s.paths.components, "docs/converting-turn-reports"))
-	s.mux.HandleFunc("GET /docs/dashboard-overview", s.getHeroPage(s.paths.components, "docs/dashboard-overview"))
-	s.mux.HandleFunc("GET /docs/errors", s.getHeroPage(s.paths.components, "docs/errors"))
-	s.mux.HandleFunc("GET /docs/getting-started", s.getHeroPage(s.paths.components, "docs/getting-started"))
-	s.mux.HandleFunc("GET /docs/map-key", s.getHeroPage(s.paths.components, "docs/map-key"))
-	s.mux.HandleFunc("GET /docs/ottomap-for-tribenet", s.getHeroPage(s.paths.components, "docs/ottomap-for-tribenet"))
-	s.mux.HandleFunc("GET /docs/report-layout", s.getHeroPage(s.paths.components, "docs/report-layout"))
-	s.mux.HandleFunc("GET /get-started", s.getHeroPage(s.paths.components, "get-started"))
-	s.mux.HandleFunc("GET /learn-more", s.getHeroPage(s.paths.components, "learn-more"))
-	s.mux.HandleFunc("GET /privacy", s.getHeroPage(s.paths.components, "privacy"))
-	s.mux.HandleFunc("GET /settings", s.getSettings(s.paths.components, s.blocks.Footer))
-	s.mux.HandleFunc("GET /settings/general", s.getSettingsGeneral(s.paths.components, s.blocks.Footer))
-	s.mux.HandleFunc("GET /settings/general/timezone", s.getSettingsGeneralTimezone(s.paths.components))
-	s.mux.HandleFunc("POST /settings/general/timezone", s.postSettingsGeneralTimezone(s.paths.components))
-	s.mux.HandleFunc("GET /settings/notifications", s.getSettingsGeneral(s.paths.components, s.blocks.Footer))
-	s.mux.HandleFunc("GET /settings/plans", s.getSettingsPlans(s.paths.components, s.blocks.Footer))
-	s.mux.HandleFunc("GET /settings/security", s.getSettingsGeneral(s.paths.components, s.blocks.Footer))
-	s.mux.HandleFunc("GET /trusted", s.getHeroPage(s.paths.components, "trusted"))
-
-	s.mux.HandleFunc("GET /login", s.getLogin(s.paths.components))
-	s.mux.HandleFunc("GET /login/clan/{clan_id}", s.getLoginClanId(s.paths.components))
-	s.mux.HandleFunc("POST /login/clan/{clan_id}", s.postLoginClanId())
-	s.mux.HandleFunc("GET /logout", s.getLogout())
-
-	s.mux.HandleFunc("DELETE /errlog/{log_id}", s.deleteErrorLogLogId(s.paths.components))
-	s.mux.HandleFunc("GET /errlog/{log_id}", s.getErrorLogLogId())
-
-	s.mux.HandleFunc("DELETE /log/{log_id}", s.deleteLogLogId(s.paths.components))
-	s.mux.HandleFunc("GET /log/{log_id}", s.getLogLogId())
-
-	s.mux.HandleFunc("GET /maps", s.getMaps(s.paths.components, s.blocks.Footer))
-	s.mux.HandleFunc("DELETE /map/{map_id}", s.deleteMapMapId(s.paths.components))
-	s.mux.HandleFunc("GET /map/{map_id}", s.getMapMapId())
-
-	s.mux.HandleFunc("GET /reports", s.getReports(s.paths.components, s.blocks.Footer))
-	s.mux.HandleFunc("DELETE /report/{report_id}", s.deleteReportReportId(s.paths.components))
-	s.mux.HandleFunc("GET /report/{report_id}", s.getReportReportId())
-	s.mux.HandleFunc("GET /report/beta/docx-to-json", s.getReportBetaDocxToJson())
-	s.mux.HandleFunc("GET /report/beta/docx-to-text", s.getReportBetaDocxToText())
-	s.mux.HandleFunc("GET /reports/uploads", s.getReportsUploads(s.paths.components, s.blocks.Footer))
-	s.mux.HandleFunc("GET /reports/uploads/failed", s.getReportsUploadsFailed(s.paths.components))
-	s.mux.HandleFunc("GET /reports/uploads/plain-text", s.getReportsUploadsPlainText(s.paths.components, s.blocks.Footer))
-	s.mux.HandleFunc("GET /reports/uploads/success", s.getReportsUploadsSuccess(s.paths.components))
-	s.mux.HandleFunc("GET /reports/turn/{turn_id}/clan/{clan_id}", s.getReportsTurnIdClanId(s.paths.components))
-
-	s.mux.HandleFunc("GET /reports/dropbox/upload", s.getReportsDropboxUpload(s.paths.components, s.blocks.Footer))
-	s.mux.HandleFunc("POST /reports/dropbox/scrub", s.postDropboxScrub(s.paths.components, version.String()))
-	s.mux.HandleFunc("POST /reports/dropbox/upload", s.postDropboxUpload(s.paths.components))
-
-	s.mux.HandleFunc("POST /reports/plain-text/scrub", s.postPlainTextScrub(s.paths.components, s.paths.userdata))
-	s.mux.HandleFunc("POST /reports/plain-text/upload", s.postPlainTextUpload(s.paths.components, s.blocks.Footer))
-
-	//s.mux.HandleFunc("GET /reports/docx/upload", s.getReportsDocxUpload(s.paths.components, s.blocks.Footer))
-	//s.mux.HandleFunc("POST /reports/docx/upload", s.postDocxUpload(s.paths.components))
-	//s.mux.HandleFunc("GET /reports/uploads/msword", func(w http.ResponseWriter, r *http.Request) {
-	//	http.Redirect(w, r, "/reports/docx/upload", http.StatusSeeOther)
-	//})
+	s.mux.HandleFunc("GET /admin", s.requires(authAdministrator, s.getAdmin(s.paths.components, s.blocks.Footer)))
+	s.mux.HandleFunc("GET /admin/audit", s.requires(authAdministrator, s.getAdminAudit(s.paths.components, s.blocks.Footer)))
+	s.mux.HandleFunc("GET /admin/lockouts", s.requires(authAdministrator, s.getAdminLockouts(s.paths.components, s.blocks.Footer)))
+	s.mux.HandleFunc("DELETE /admin/lockouts/{scope}/{subject}", s.requires(authAdministrator, s.deleteAdminLockoutsScopeSubject()))
+	s.mux.HandleFunc("GET /admin/magic-links", s.requires(authAdministrator, s.getAdminMagicLinks(s.paths.components, s.blocks.Footer)))
+	s.mux.HandleFunc("POST /admin/magic-links", s.requires(authAdministrator, s.postAdminMagicLinks(s.paths.components)))
+	s.mux.HandleFunc("POST /admin/users", s.requires(authAdministrator, s.postAdminUsers(s.paths.components)))
+	s.mux.HandleFunc("GET /admin/users/{clan_id}", s.requires(authAdministrator, s.getAdminUsersClanId(s.paths.components, s.blocks.Footer)))
+	s.mux.HandleFunc("POST /admin/users/{clan_id}/deactivate", s.requires(authAdministrator, s.postAdminUsersClanIdDeactivate(s.paths.components)))
+	s.mux.HandleFunc("POST /admin/users/{clan_id}/password", s.requires(authAdministrator, s.postAdminUsersClanIdPassword(s.paths.components)))
+	s.mux.HandleFunc("POST /admin/users/{clan_id}/reactivate", s.requires(authAdministrator, s.postAdminUsersClanIdReactivate(s.paths.components)))
+	s.mux.HandleFunc("POST /admin/users/{clan_id}/roles", s.requires(authAdministrator, s.postAdminUsersClanIdRoles(s.paths.components)))
+
+	s.mux.HandleFunc("GET /operator", s.requires(authOperator, s.getOperator(s.paths.components, s.blocks.Footer)))
+	s.mux.HandleFunc("POST /operator/view-as", s.requires(authOperator, s.postOperatorViewAs(s.paths.components)))
+	s.mux.HandleFunc("DELETE /operator/view-as", s.requires(authOperator, s.deleteOperatorViewAs()))
+	s.mux.HandleFunc("GET /operator/view-as/banner", s.requires(authPublic, s.getOperatorViewAsBanner(s.paths.components)))
+
+	s.mux.HandleFunc("GET /about", s.requires(authPublic, s.getHeroPage(s.paths.components, "about")))
+	s.mux.HandleFunc("GET /calendar", s.requires(authUser, s.getCalendar(s.paths.components, s.blocks.Footer)))
+	s.mux.HandleFunc("POST /calendar/feed/reset", s.requires(authUser, s.postCalendarFeedReset()))
+	s.mux.HandleFunc("GET /calendar/feeds/{feed}", s.requires(authPublic, s.getCalendarFeedsFeed()))
+	s.mux.HandleFunc("GET /contact-us", s.requires(authPublic, s.getHeroPage(s.paths.components, "contact-us")))
+	s.mux.HandleFunc("GET /dashboard", s.requires(authUser, s.getDashboard(s.paths.components, s.blocks.Footer, s.features.cacheBuster)))
+	s.mux.HandleFunc("GET /docs", s.requires(authPublic, s.getHeroPage(s.paths.components, "docs")))
+	s.mux.HandleFunc("GET /docs/converting-turn-reports", s.requires(authPublic, s.getHeroPage(s.paths.components, "docs/converting-turn-reports")))
+	s.mux.HandleFunc("GET /docs/dashboard-overview", s.requires(authPublic, s.getHeroPage(s.paths.components, "docs/dashboard-overview")))
+	s.mux.HandleFunc("GET /docs/errors", s.requires(authPublic, s.getHeroPage(s.paths.components, "docs/errors")))
+	s.mux.HandleFunc("GET /docs/getting-started", s.requires(authPublic, s.getHeroPage(s.paths.components, "docs/getting-started")))
+	s.mux.HandleFunc("GET /docs/map-key", s.requires(authPublic, s.getHeroPage(s.paths.components, "docs/map-key")))
+	s.mux.HandleFunc("GET /docs/ottomap-for-tribenet", s.requires(authPublic, s.getHeroPage(s.paths.components, "docs/ottomap-for-tribenet")))
+	s.mux.HandleFunc("GET /docs/report-layout", s.requires(authPublic, s.getHeroPage(s.paths.components, "docs/report-layout")))
+	s.mux.HandleFunc("GET /get-started", s.requires(authPublic, s.getHeroPage(s.paths.components, "get-started")))
+	s.mux.HandleFunc("GET /learn-more", s.requires(authPublic, s.getHeroPage(s.paths.components, "learn-more")))
+	s.mux.HandleFunc("GET /privacy", s.requires(authPublic, s.getHeroPage(s.paths.components, "privacy")))
+	s.mux.HandleFunc("GET /settings", s.requires(authUser, s.getSettings(s.paths.components, s.blocks.Footer)))
+	s.mux.HandleFunc("GET /settings/general", s.requires(authUser, s.getSettingsGeneral(s.paths.components, s.blocks.Footer)))
+	s.mux.HandleFunc("GET /settings/general/timezone", s.requires(authUser, s.getSettingsGeneralTimezone(s.paths.components)))
+	s.mux.HandleFunc("POST /settings/general/timezone", s.requires(authUser, s.postSettingsGeneralTimezone(s.paths.components)))
+	s.mux.HandleFunc("GET /settings/notifications", s.requires(authUser, s.getSettingsNotifications(s.paths.components, s.blocks.Footer)))
+	s.mux.HandleFunc("POST /settings/notifications", s.requires(authUser, s.postSettingsNotifications(s.paths.components)))
+	s.mux.HandleFunc("GET /settings/plans", s.requires(authUser, s.getSettingsPlans(s.paths.components, s.blocks.Footer)))
+	s.mux.HandleFunc("GET /settings/security", s.requires(authUser, s.getSettingsSecurity(s.paths.components, s.blocks.Footer)))
+	s.mux.HandleFunc("POST /settings/security/password", s.requires(authUser, s.postSettingsSecurityPassword(s.paths.components)))
+	s.mux.HandleFunc("DELETE /settings/security/sessions/{key}", s.requires(authUser, s.deleteSettingsSecuritySessionsKey()))
+	s.mux.HandleFunc("POST /settings/security/sessions/revoke-others", s.requires(authUser, s.postSettingsSecuritySessionsRevokeOthers()))
+	s.mux.HandleFunc("GET /trusted", s.requires(authPublic, s.getHeroPage(s.paths.components, "trusted")))
+
+	s.mux.HandleFunc("GET /login", s.requires(authPublic, s.getLogin(s.paths.components)))
+	s.mux.HandleFunc("GET /login/clan/{clan_id}", s.requires(authPublic, s.getLoginClanId(s.paths.components)))
+	s.mux.HandleFunc("GET /login/clan/{clan_id}/forgot", s.requires(authPublic, s.getLoginClanIdForgot(s.paths.components)))
+	s.mux.HandleFunc("POST /login/clan/{clan_id}/forgot", s.requires(authPublic, s.postLoginClanIdForgot(s.paths.components)))
+	s.mux.HandleFunc("GET /login/clan/{clan_id}/reset/{token}", s.requires(authPublic, s.getLoginClanIdReset(s.paths.components)))
+	s.mux.HandleFunc("POST /login/clan/{clan_id}/reset/{token}", s.requires(authPublic, s.postLoginClanIdReset(s.paths.components)))
+	s.mux.HandleFunc("GET /login/{clan_id}/{magic_link}", s.requires(authPublic, s.getLoginClanIdMagicLink(s.paths.components)))
+	s.mux.HandleFunc("POST /login/{clan_id}/{magic_link}", s.requires(authPublic, s.postLoginClanIdMagicLink(s.paths.components)))
+	s.mux.HandleFunc("POST /login/clan/{clan_id}", s.requires(authPublic, s.postLoginClanId()))
+	s.mux.HandleFunc("GET /logout", s.requires(authPublic, s.getLogout()))
+
+	s.mux.HandleFunc("DELETE /errlog/{log_id}", s.requires(authUser, s.deleteErrorLogLogId(s.paths.components)))
+	s.mux.HandleFunc("GET /errlog/{log_id}", s.requires(authUser, s.getErrorLogLogId()))
+
+	s.mux.HandleFunc("DELETE /log/{log_id}", s.requires(authUser, s.deleteLogLogId(s.paths.components)))
+	s.mux.HandleFunc("GET /log/{log_id}", s.requires(authUser, s.getLogLogId()))
+
+	s.mux.HandleFunc("GET /notifications/inbox", s.requires(authUser, s.getNotificationsInbox(s.paths.components)))
+
+	s.mux.HandleFunc("GET /maps", s.requires(authUser, s.getMaps(s.paths.components, s.blocks.Footer)))
+	s.mux.HandleFunc("DELETE /map/{map_id}", s.requires(authUser, s.deleteMapMapId(s.paths.components)))
+	s.mux.HandleFunc("GET /map/{map_id}", s.requires(authUser, s.getMapMapId()))
+	s.mux.HandleFunc("GET /map/{map_id}/preview", s.requires(authUser, s.getMapMapIdPreview(s.paths.components, s.blocks.Footer)))
+	s.mux.HandleFunc("POST /map/{map_id}/share", s.requires(authUser, s.postMapMapIdShare(s.paths.components)))
+	s.mux.HandleFunc("DELETE /maps/shares/{share_id}", s.requires(authUser, s.deleteMapsSharesShareId()))
+
+	s.mux.HandleFunc("GET /reports", s.requires(authUser, s.getReports(s.paths.components, s.blocks.Footer)))
+	s.mux.HandleFunc("DELETE /report/{report_id}", s.requires(authUser, s.deleteReportReportId(s.paths.components)))
+	s.mux.HandleFunc("GET /report/{report_id}", s.requires(authUser, s.getReportReportId()))
+	s.mux.HandleFunc("GET /report/beta/docx-to-json", s.requires(authUser, s.getReportBetaDocxToJson()))
+	s.mux.HandleFunc("GET /report/beta/docx-to-text", s.requires(authUser, s.getReportBetaDocxToText()))
+	s.mux.HandleFunc("GET /reports/history", s.requires(authUser, s.getReportsHistory(s.paths.components, s.blocks.Footer)))
+	s.mux.HandleFunc("GET /reports/uploads", s.requires(authUser, s.getReportsUploads(s.paths.components, s.blocks.Footer)))
+	s.mux.HandleFunc("GET /reports/uploads/plain-text", s.requires(authUser, s.getReportsUploadsPlainText(s.paths.components, s.blocks.Footer)))
+	s.mux.HandleFunc("GET /reports/uploads/success", s.requires(authUser, s.getReportsUploadsSuccess(s.paths.components)))
+	s.mux.HandleFunc("GET /reports/turn/{turn_id}/clan/{clan_id}", s.requires(authUser, s.getReportsTurnIdClanId(s.paths.components)))
+
+	s.mux.HandleFunc("GET /reports/dropbox/upload", s.requires(authUser, s.getReportsDropboxUpload(s.paths.components, s.blocks.Footer)))
+	s.mux.HandleFunc("POST /reports/dropbox/scrub", s.requires(authUser, s.postDropboxScrub(s.paths.components, version.String())))
+	s.mux.HandleFunc("POST /reports/dropbox/upload", s.requires(authUser, s.postDropboxUpload(s.paths.components)))
+	s.mux.HandleFunc("POST /reports/dropbox/zip", s.requires(authUser, s.postDropboxZip(s.paths.components, version.String())))
+
+	s.mux.HandleFunc("POST /reports/plain-text/scrub", s.requires(authUser, s.postPlainTextScrub(s.paths.components, s.paths.userdata)))
+	s.mux.HandleFunc("POST /reports/plain-text/upload", s.requires(authUser, s.postPlainTextUpload(s.paths.components, s.blocks.Footer)))
+
+	s.mux.HandleFunc("GET /reports/docx/upload", s.requires(authUser, s.getReportsDocxUpload(s.paths.components, s.blocks.Footer)))
+	s.mux.HandleFunc("POST /reports/docx/upload", s.requires(authUser, s.postDocxUpload(s.paths.components)))
+	s.mux.HandleFunc("GET /reports/uploads/msword", s.requires(authUser, func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/reports/docx/upload", http.StatusSeeOther)
+	}))
 	////s.mux.HandleFunc("POST /reports/uploads/msword", s.postReportsUploadsMSWord(s.paths.components, s.blocks.Footer))
 
-	s.mux.HandleFunc("GET /api/v1/paths", s.getApiPathsV1())
-	s.mux.HandleFunc("GET /api/v1/version", s.getApiVersionV1())
-	s.mux.HandleFunc("GET /api/v1/clan-files/{clan_id}", s.getApiClanFilesV1(s.paths.userdata))
-	s.mux.HandleFunc("POST /api/v1/report/upload/docx", s.postApiReportUploadDocx(s.paths.userdata))
-	s.mux.HandleFunc("POST /api/v1/report/upload/file", s.postApiReportUploadFile(s.paths.userdata))
-	s.mux.HandleFunc("POST /api/v1/report/upload/text", s.postApiReportUploadText(s.paths.userdata))
+	s.mux.HandleFunc("GET /api/v1/paths", s.requires(authUser, s.getApiPathsV1()))
+	s.mux.HandleFunc("GET /api/v1/version", s.requires(authPublic, s.getApiVersionV1()))
+	s.mux.HandleFunc("GET /api/v1/clan-files/{clan_id}", s.requires(authUser, s.getApiClanFilesV1(s.paths.userdata)))
+	s.mux.HandleFunc("GET /api/v1/report/{report_id}/diff", s.requires(authUser, s.getApiReportDiffV1()))
+	s.mux.HandleFunc("GET /api/v1/report/{report_id}/revisions", s.requires(authUser, s.getApiReportRevisionsV1()))
+	s.mux.HandleFunc("GET /api/v1/report/{report_id}/revisions/{revision}", s.requires(authUser, s.getApiReportRevisionV1()))
+	s.mux.HandleFunc("POST /api/v1/report/{report_id}/revisions/{revision}/promote", s.requires(authUser, s.postApiReportPromoteV1()))
+	s.mux.HandleFunc("POST /api/v1/report/upload/docx", s.requires(authUser, s.postApiReportUploadDocx(s.paths.userdata)))
+	s.mux.HandleFunc("POST /api/v1/report/upload/file", s.requires(authUser, s.postApiReportUploadFile(s.paths.userdata)))
+	s.mux.HandleFunc("POST /api/v1/report/upload/text", s.requires(authUser, s.postApiReportUploadText(s.paths.components, s.paths.userdata)))
+	s.mux.HandleFunc("POST /api/v1/report/validate", s.requires(authUser, s.postApiReportValidate()))
 
 	// unfortunately for us, the "/" route is special. it serves the landing page as well as all the assets.
 	//s.mux.Handle("GET /", http.FileServer(http.Dir(s.paths.assets)))
-	s.mux.Handle("GET /", s.getIndex(s.staticFileServer, s.paths.assets, s.getHeroPage(s.paths.components, "landing")))
+	s.mux.Handle("GET /", s.getIndex(s.staticFileServer, s.assets, s.getHeroPage(s.paths.components, "landing")))
 
 	return s.mux
 }
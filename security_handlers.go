@@ -0,0 +1,249 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/mdhender/ottoapp/components/app"
+	"github.com/mdhender/ottoapp/components/app/pages/settings"
+	"github.com/mdhender/ottoapp/components/app/pages/settings/security"
+	"github.com/mdhender/ottoapp/domains"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 72 // bcrypt ignores anything longer
+)
+
+func (s *Server) getSettingsSecurity(path string, footer app.Footer) http.HandlerFunc {
+	files := []string{
+		filepath.Join(path, "app", "pages", "settings", "layout.gohtml"),
+		filepath.Join(path, "app", "pages", "settings", "security", "content.gohtml"),
+		filepath.Join(path, "app", "widgets", "notifications.gohtml"),
+	}
+	s.templates.register(files...)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		log.Printf("%s %s: entered\n", r.Method, r.URL.Path)
+		started, bytesWritten := time.Now(), 0
+		defer func() {
+			log.Printf("%s %s: wrote %d bytes in %s\n", r.Method, r.URL.Path, bytesWritten, time.Since(started))
+		}()
+
+		user := userFromRequest(r)
+
+		sessions, err := s.stores.sessions.GetUserSessions(user.ID, s.sessionId(r))
+		if err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		var content security.Content_t
+		loc := user.LanguageAndDates.Timezone.Location
+		for _, session := range sessions {
+			content.Sessions = append(content.Sessions, security.Session_t{
+				Key:       session.Key,
+				Current:   session.Current,
+				UserAgent: session.UserAgent,
+				Created:   session.CreatedAt.In(loc).Format("2006-01-02 15:04"),
+				LastSeen:  session.LastSeen.In(loc).Format("2006-01-02 15:04"),
+				Expires:   session.ExpiresAt.In(loc).Format("2006-01-02 15:04"),
+			})
+		}
+
+		payload := settings.Layout_t{
+			Title:   fmt.Sprintf("Clan %s", user.Clan),
+			ClanId:  user.Clan,
+			Content: content,
+			Footer:  footer,
+		}
+		payload.CurrentPage.Security = true
+		payload.Footer.Timestamp = time.Now().In(loc).Format("2006-01-02 15:04:05")
+
+		t, err := s.templates.lookup(files...)
+		if err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		// parse into a buffer so that we can handle errors without writing to the response
+		buf := &bytes.Buffer{}
+		if err := t.Execute(buf, payload); err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		bytesWritten, _ = w.Write(buf.Bytes())
+	}
+}
+
+// postSettingsSecurityPassword changes the user's password after checking the current one.
+// Form errors are shown in the form rather than returned as HTTP errors.
+func (s *Server) postSettingsSecurityPassword(path string) http.HandlerFunc {
+	files := []string{
+		filepath.Join(path, "app", "pages", "settings", "security", "content.gohtml"),
+	}
+	s.templates.register(files...)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("%s %s: entered\n", r.Method, r.URL.Path)
+		if r.Method != "POST" {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		} else if r.Header.Get("HX-Request") != "true" {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		} else if contentType := r.Header.Get("Content-Type"); !(contentType == "application/x-www-form-urlencoded" || strings.HasPrefix(contentType, "application/x-www-form-urlencoded;")) {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		user := userFromRequest(r)
+
+		input := struct {
+			current string
+			new     string
+			confirm string
+		}{
+			current: r.FormValue("current-password"),
+			new:     r.FormValue("new-password"),
+			confirm: r.FormValue("confirm-password"),
+		}
+
+		var form security.Password_t
+		if err := s.stores.store.VerifyUserPassword(user.ID, input.current); err != nil {
+			if !errors.Is(err, domains.ErrUnauthorized) {
+				log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			log.Printf("%s %s: %s: current password does not match\n", r.Method, r.URL.Path, user.Clan)
+			form.Error = "Your current password is not correct."
+		} else if len(input.new) < minPasswordLength {
+			form.Error = fmt.Sprintf("Your new password must be at least %d characters long.", minPasswordLength)
+		} else if len(input.new) > maxPasswordLength {
+			form.Error = fmt.Sprintf("Your new password must be no more than %d characters long.", maxPasswordLength)
+		} else if input.new != input.confirm {
+			form.Error = "The new passwords do not match."
+		} else if input.new == input.current {
+			form.Error = "Your new password must be different from your current password."
+		} else if err := s.stores.store.UpdateUserPassword(user.ID, input.new, true); err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		} else {
+			log.Printf("%s %s: %s: updated password\n", r.Method, r.URL.Path, user.Clan)
+			s.audit(r, user.Clan, domains.AuditPasswordChange, "")
+			// anyone who signed in with the old password is signed out
+			if err := s.stores.sessions.DeleteOtherUserSessions(user.ID, s.sessionId(r)); err != nil {
+				log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			} else {
+				s.audit(r, user.Clan, domains.AuditSessionRevoke, "all other sessions: password changed")
+			}
+			form.Saved = true
+		}
+
+		_, _ = s.writeHtmxFragment(w, r, form, "password-form", files...)
+	}
+}
+
+// deleteSettingsSecuritySessionsKey revokes one of the user's sessions.
+// If the user revokes the current session, the cookie is cleared and they are sent to the landing page.
+func (s *Server) deleteSettingsSecuritySessionsKey() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("%s %s: entered\n", r.Method, r.URL.Path)
+		if r.Method != "DELETE" {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		} else if r.Header.Get("HX-Request") != "true" {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		user := userFromRequest(r)
+
+		// check for the current session before deleting it
+		key, current := r.PathValue("key"), false
+		if sessions, err := s.stores.sessions.GetUserSessions(user.ID, s.sessionId(r)); err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		} else {
+			for _, session := range sessions {
+				if session.Key == key {
+					current = session.Current
+				}
+			}
+		}
+
+		if err := s.stores.sessions.DeleteUserSessionByKey(user.ID, key); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+				return
+			}
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		log.Printf("%s %s: %s: revoked session (current %v)\n", r.Method, r.URL.Path, user.Clan, current)
+		s.audit(r, user.Clan, domains.AuditSessionRevoke, fmt.Sprintf("session %s (current %v)", key, current))
+
+		if current {
+			http.SetCookie(w, &http.Cookie{
+				Name:   s.sessions.cookieName,
+				Value:  "",
+				Path:   "/",
+				MaxAge: -1,
+			})
+			w.Header().Set("HX-Redirect", "/")
+		} else {
+			w.Header().Set("HX-Refresh", "true")
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// postSettingsSecuritySessionsRevokeOthers revokes all the user's sessions except the current one.
+func (s *Server) postSettingsSecuritySessionsRevokeOthers() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("%s %s: entered\n", r.Method, r.URL.Path)
+		if r.Method != "POST" {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		} else if r.Header.Get("HX-Request") != "true" {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		user := userFromRequest(r)
+
+		if err := s.stores.sessions.DeleteOtherUserSessions(user.ID, s.sessionId(r)); err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		log.Printf("%s %s: %s: revoked other sessions\n", r.Method, r.URL.Path, user.Clan)
+		s.audit(r, user.Clan, domains.AuditSessionRevoke, "all other sessions")
+
+		w.Header().Set("HX-Refresh", "true")
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -4,13 +4,17 @@ package main
 
 import (
 	"fmt"
-	"github.com/mdhender/ottapp/components/app"
-	"github.com/mdhender/ottapp/domains"
-	"github.com/mdhender/ottapp/stores/ffs"
-	"github.com/mdhender/ottapp/stores/sqlite"
+	"github.com/mdhender/ottoapp/components/app"
+	"github.com/mdhender/ottoapp/domains"
+	"github.com/mdhender/ottoapp/jobs"
+	"github.com/mdhender/ottoapp/notifications"
+	"github.com/mdhender/ottoapp/stores/ffs"
+	"github.com/mdhender/ottoapp/stores/sqlite"
+	"io/fs"
 	"log"
 	"net"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -40,6 +44,7 @@ func newServer(options ...Option) (*Server, error) {
 	s.sessions.rememberMe = "ottoapp1-clan-idff-b364-a70ced220fff"
 	s.sessions.ttl = 2 * 7 * 24 * time.Hour
 	s.sessions.maxAge = 2 * 7 * 24 * 60 * 60 // 2 weeks
+	s.sessions.maxPerUser = 10
 
 	for _, option := range options {
 		if err := option(s); err != nil {
@@ -47,7 +52,19 @@ func newServer(options ...Option) (*Server, error) {
 		}
 	}
 
-	// get the path to the user data from the database
+	// links sent to users must not depend on the Host header, which the client controls
+	if s.baseURL == "" {
+		host := s.host
+		if host == "" || host == "0.0.0.0" || host == "::" {
+			host = "localhost"
+		}
+		s.baseURL = fmt.Sprintf("%s://%s", s.scheme, net.JoinHostPort(host, s.port))
+		log.Printf("base url: %s (set --base-url if users reach the server at another address)\n", s.baseURL)
+	} else {
+		log.Printf("base url: %s\n", s.baseURL)
+	}
+
+	// get the paths to the override directories and the user data from the database
 	assets, components, userdata, err := s.stores.store.GetServerPaths()
 	if err != nil {
 		return nil, err
@@ -61,6 +78,23 @@ func newServer(options ...Option) (*Server, error) {
 	if err := withUserData(userdata)(s); err != nil {
 		return nil, err
 	}
+	if s.assets, err = newOverlayFS(s.paths.assets, embeddedAssets, "assets"); err != nil {
+		return nil, err
+	}
+	if s.components, err = newOverlayFS(s.paths.components, embeddedComponents, "components"); err != nil {
+		return nil, err
+	}
+	if s.paths.assets == "" {
+		log.Printf("assets: embedded\n")
+	} else {
+		log.Printf("assets: embedded, overridden by %s\n", s.paths.assets)
+	}
+	if s.paths.components == "" {
+		log.Printf("components: embedded\n")
+	} else {
+		log.Printf("components: embedded, overridden by %s\n", s.paths.components)
+	}
+	s.templates = newTemplateRegistry(s.components, s.paths.components)
 
 	if fs, err := ffs.New(s.paths.userdata); err != nil {
 		log.Fatalf("error: %v\n", err)
@@ -70,22 +104,41 @@ func newServer(options ...Option) (*Server, error) {
 
 	s.mux = s.routes()
 
+	// the handlers registered their templates when the routes were created.
+	// parse them now so that a broken template is reported before we start serving.
+	started := time.Now()
+	if err := s.templates.build(); err != nil {
+		return nil, err
+	}
+	log.Printf("templates: parsed %d sets in %v\n", s.templates.count(), time.Since(started))
+	if s.features.dev && s.paths.components == "" {
+		log.Printf("templates: dev mode: no components override directory to watch\n")
+	} else if s.features.dev {
+		log.Printf("templates: dev mode: watching %s\n", s.paths.components)
+		go s.templates.watch(time.Second)
+	}
+
 	return s, nil
 }
 
 type Server struct {
 	http.Server
 	scheme, host, port string
+	baseURL            string // scheme and host for links that are e-mailed or shared, never taken from the request
 	mux                *http.ServeMux
 	staticFileServer   bool
+	templates          *templateRegistry
+	jobs               *jobs.Queue             // nil if map rendering is disabled
+	notifier           *notifications.Notifier // nil if notifications are disabled
+	mailer             notifications.Mailer    // nil if e-mail is disabled
 	stores             struct {
 		ffs      *ffs.FFS
 		sessions *sqlite.DB
 		store    *sqlite.DB
 	}
-	//assets             fs.FS
-	//components          fs.FS
-	paths struct {
+	assets     fs.FS // embedded assets with the override directory on top
+	components fs.FS // embedded components with the override directory on top
+	paths      struct {
 		assets     string
 		components string
 		userdata   string
@@ -93,6 +146,7 @@ type Server struct {
 	sessions struct {
 		cookieName string
 		maxAge     int // maximum age of a session cookie in seconds
+		maxPerUser int // maximum number of sessions for a user, the oldest are evicted
 		rememberMe string
 		ttl        time.Duration
 	}
@@ -101,6 +155,7 @@ type Server struct {
 	}
 	features struct {
 		cacheBuster bool
+		dev         bool // if true, rebuild the templates when the components change
 	}
 }
 
@@ -108,18 +163,136 @@ func (s *Server) BaseURL() string {
 	return fmt.Sprintf("%s://%s", s.scheme, s.Addr)
 }
 
+// ServeHTTP refuses requests that could change data while an operator is viewing
+// another clan, then passes the request to the router.
+// Only GET and HEAD requests and the requests that start or stop viewing are allowed.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !(r.Method == "GET" || r.Method == "HEAD" || r.URL.Path == "/operator/view-as") {
+		if operator, viewAs, err := s.extractSessionViewAs(r); err != nil {
+			log.Printf("%s %s: extractSessionViewAs: %v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		} else if viewAs != "" {
+			log.Printf("%s %s: clan %q: read-only while viewing clan %q\n", r.Method, r.URL.Path, operator.Clan, viewAs)
+			s.audit(r, operator.Clan, domains.AuditViewAs, fmt.Sprintf("clan %s: refused %s", viewAs, r.Method))
+			http.Error(w, fmt.Sprintf("You are viewing clan %s in read-only mode. Stop viewing to make changes.", viewAs), http.StatusForbidden)
+			return
+		}
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
 // extractSession extracts the session from the request.
 // Returns nil if there is no session, or it is invalid.
+//
+// If an operator is viewing another clan, it returns that clan's user with ViewedBy
+// set to the operator, and records the access in the audit log.
 func (s *Server) extractSession(r *http.Request) (*domains.User_t, error) {
+	user, viewAs, err := s.extractSessionViewAs(r)
+	if err != nil || user == nil || viewAs == "" {
+		return user, err
+	}
+	return s.viewAsUser(r, user, viewAs)
+}
+
+// viewAsUser returns the user for the clan that the operator is viewing,
+// and records the access in the audit log.
+func (s *Server) viewAsUser(r *http.Request, operator *domains.User_t, viewAs string) (*domains.User_t, error) {
+	target, err := s.stores.store.GetUserAccount(viewAs)
+	if err != nil {
+		return nil, err
+	}
+	target.ViewedBy = operator
+	s.audit(r, operator.Clan, domains.AuditViewAs, fmt.Sprintf("clan %s", target.Clan))
+
+	return target, nil
+}
+
+// extractSessionViewAs returns the user signed in to the session and the clan they are viewing.
+// The clan is empty if they are not viewing another clan.
+// Viewing stops if the user is no longer an operator.
+func (s *Server) extractSessionViewAs(r *http.Request) (*domains.User_t, string, error) {
 	cookie, err := r.Cookie(s.sessions.cookieName)
 	if err != nil {
-		return nil, nil
+		return nil, "", nil
+	}
+
+	user, viewAs, err := s.stores.sessions.GetSession(cookie.Value)
+	if err != nil || user == nil {
+		return nil, "", err
+	} else if viewAs != "" && !user.Roles.IsOperator {
+		log.Printf("%s %s: clan %q: not an operator, stopped viewing clan %q\n", r.Method, r.URL.Path, user.Clan, viewAs)
+		if err := s.stores.sessions.UpdateSessionViewAs(cookie.Value, ""); err != nil {
+			return nil, "", err
+		}
+		viewAs = ""
 	}
 
-	user, err := s.stores.sessions.GetSession(cookie.Value)
+	return user, viewAs, nil
+}
+
+// sessionId returns the session id from the request's cookie.
+// Returns an empty string if there is no session cookie.
+func (s *Server) sessionId(r *http.Request) string {
+	cookie, err := r.Cookie(s.sessions.cookieName)
 	if err != nil {
-		return nil, err
+		return ""
+	}
+	return cookie.Value
+}
+
+// startSession creates a new session for the user and sets the session cookie.
+func (s *Server) startSession(w http.ResponseWriter, r *http.Request, user *domains.User_t) error {
+	// the user agent is only shown on the security settings page, so limit the length
+	userAgent := r.UserAgent()
+	if len(userAgent) > 256 {
+		userAgent = userAgent[:256]
 	}
+	sessionId, err := s.stores.sessions.CreateSession(user.ID, s.sessions.ttl, userAgent, s.sessions.maxPerUser)
+	if err != nil {
+		return err
+	}
+
+	// set the session cookie
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.sessions.cookieName,
+		Value:    sessionId,
+		Path:     "/",
+		MaxAge:   s.sessions.maxAge,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return nil
+}
+
+// clientIP returns the address of the client.
+// X-Forwarded-For is only trusted when the connection comes from a proxy on the
+// same host, and then only the address that the proxy added (the last one).
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+			forwarded := strings.TrimSpace(xff[strings.LastIndex(xff, ",")+1:])
+			if net.ParseIP(forwarded) != nil {
+				return forwarded
+			}
+		}
+	}
+	return host
+}
 
-	return user, nil
+// queueRender queues a map render for the user's clan and turn.
+// It should be called after every successful write to the user's input folder.
+// Errors are logged, not returned, because the upload itself succeeded.
+func (s *Server) queueRender(user *domains.User_t, turnId string) {
+	if s.jobs == nil {
+		return
+	}
+	if err := s.jobs.Enqueue(user, turnId); err != nil {
+		log.Printf("jobs: %s: %s: %v\n", user.Clan, turnId, err)
+	}
 }
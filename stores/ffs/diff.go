@@ -0,0 +1,228 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package ffs
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mdhender/ottoapp/domains"
+)
+
+// maxDiffEdits is the longest edit script that unifiedDiff will search for.
+// The search takes O((N+M)·D) time, so two unrelated reports would keep the
+// server busy for a long time to produce a diff that nobody can read.
+const maxDiffEdits = 2000
+
+// diffLine_t is a single line in an edit script.
+// Op is ' ' for a line in both inputs, '-' for a line only in the first,
+// and '+' for a line only in the second.
+type diffLine_t struct {
+	Op   byte
+	Text string
+	A, B int // zero-based line numbers in the first and second inputs
+}
+
+// diffLines returns the shortest edit script that turns a into b.
+// It implements the linear space refinement of Myers' O(ND) algorithm.
+// Each step finds the "middle snake" of the shortest edit script and then
+// splits the problem in two at that snake, so memory is O(N+M) no matter
+// how different the inputs are.
+//
+// If the script would have more than maxEdits edits, it stops searching and
+// returns ErrRevisionsDiffer. A maxEdits of 0 means there is no limit.
+func diffLines(a, b []string, maxEdits int) ([]diffLine_t, error) {
+	d := &differ_t{
+		a:        a,
+		b:        b,
+		maxEdits: maxEdits,
+		vf:       make([]int, len(a)+len(b)+4),
+		vb:       make([]int, len(a)+len(b)+4),
+	}
+	if !d.compare(0, len(a), 0, len(b)) {
+		return nil, domains.ErrRevisionsDiffer
+	}
+	return d.script, nil
+}
+
+// differ_t holds the state for diffLines.
+// The V arrays are shared by every step, which only uses the part it needs.
+type differ_t struct {
+	a, b     []string
+	maxEdits int   // stop searching for longer edit scripts, 0 for no limit
+	vf, vb   []int // furthest reaching paths, forward and backward
+	script   []diffLine_t
+}
+
+// compare appends the edit script for a[aLo:aHi] and b[bLo:bHi].
+// It returns false if the script is longer than the limit.
+func (d *differ_t) compare(aLo, aHi, bLo, bHi int) bool {
+	// common prefix and suffix are not interesting to the search
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		d.script = append(d.script, diffLine_t{Op: ' ', Text: d.a[aLo], A: aLo, B: bLo})
+		aLo, bLo = aLo+1, bLo+1
+	}
+	suffix := 0
+	for aLo < aHi-suffix && bLo < bHi-suffix && d.a[aHi-1-suffix] == d.b[bHi-1-suffix] {
+		suffix++
+	}
+	aHi, bHi = aHi-suffix, bHi-suffix
+
+	if aLo == aHi {
+		for ; bLo < bHi; bLo++ {
+			d.script = append(d.script, diffLine_t{Op: '+', Text: d.b[bLo], A: aLo, B: bLo})
+		}
+	} else if bLo == bHi {
+		for ; aLo < aHi; aLo++ {
+			d.script = append(d.script, diffLine_t{Op: '-', Text: d.a[aLo], A: aLo, B: bLo})
+		}
+	} else {
+		// both sides have a change left, so the edit distance is at least 2
+		// and both halves are smaller than the whole
+		x, y, u, v, ok := d.middleSnake(aLo, aHi, bLo, bHi)
+		if !ok || !d.compare(aLo, x, bLo, y) {
+			return false
+		}
+		for ; x < u; x, y = x+1, y+1 {
+			d.script = append(d.script, diffLine_t{Op: ' ', Text: d.a[x], A: x, B: y})
+		}
+		if !d.compare(u, aHi, v, bHi) {
+			return false
+		}
+	}
+
+	for i := 0; i < suffix; i++ {
+		d.script = append(d.script, diffLine_t{Op: ' ', Text: d.a[aHi+i], A: aHi + i, B: bHi + i})
+	}
+	return true
+}
+
+// middleSnake returns the start (x, y) and end (u, v) of the middle snake of a
+// shortest edit script for a[aLo:aHi] and b[bLo:bHi]. It searches forward from
+// the start and backward from the end at the same time until the paths overlap.
+// It returns false if the edit script is longer than the limit.
+func (d *differ_t) middleSnake(aLo, aHi, bLo, bHi int) (x, y, u, v int, ok bool) {
+	a, b := d.a[aLo:aHi], d.b[bLo:bHi]
+	n, m := len(a), len(b)
+	delta := n - m
+	odd := delta&1 != 0
+	max := (n + m + 1) / 2
+	offset := max + 1
+	vf, vb := d.vf[:2*max+3], d.vb[:2*max+3]
+	vf[offset+1], vb[offset+1] = 0, 0
+
+	for D := 0; D <= max; D++ {
+		// the shortest script that this step can find has 2D-1 edits
+		if d.maxEdits > 0 && 2*D-1 > d.maxEdits {
+			return 0, 0, 0, 0, false
+		}
+
+		// forward paths, in the coordinates of a and b
+		for k := -D; k <= D; k += 2 {
+			var x int
+			if k == -D || (k != D && vf[offset+k-1] < vf[offset+k+1]) {
+				x = vf[offset+k+1]
+			} else {
+				x = vf[offset+k-1] + 1
+			}
+			y := x - k
+			x0, y0 := x, y
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			vf[offset+k] = x
+			// backward diagonal delta-k was extended in step D-1
+			if odd && delta-k >= -(D-1) && delta-k <= D-1 && x+vb[offset+delta-k] >= n {
+				return aLo + x0, bLo + y0, aLo + x, bLo + y, true
+			}
+		}
+
+		// the shortest script that this step can find has 2D edits
+		if d.maxEdits > 0 && 2*D > d.maxEdits {
+			return 0, 0, 0, 0, false
+		}
+
+		// backward paths, in the coordinates of a and b reversed
+		for k := -D; k <= D; k += 2 {
+			var x int
+			if k == -D || (k != D && vb[offset+k-1] < vb[offset+k+1]) {
+				x = vb[offset+k+1]
+			} else {
+				x = vb[offset+k-1] + 1
+			}
+			y := x - k
+			x0, y0 := x, y
+			for x < n && y < m && a[n-1-x] == b[m-1-y] {
+				x, y = x+1, y+1
+			}
+			vb[offset+k] = x
+			// forward diagonal delta-k was extended in step D
+			if !odd && delta-k >= -D && delta-k <= D && x+vf[offset+delta-k] >= n {
+				return aLo + n - x, bLo + m - y, aLo + n - x0, bLo + m - y0, true
+			}
+		}
+	}
+	panic("diff: middle snake not found")
+}
+
+// unifiedDiff formats the differences between a and b as a unified diff
+// with the given number of lines of context around each change.
+// It returns nil if the inputs are the same and ErrRevisionsDiffer if the
+// inputs are too different to show.
+func unifiedDiff(nameA, nameB string, a, b []string, context int) ([]byte, error) {
+	script, err := diffLines(a, b, maxDiffEdits)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []int
+	for i, line := range script {
+		if line.Op != ' ' {
+			changes = append(changes, i)
+		}
+	}
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	buf := &bytes.Buffer{}
+	_, _ = fmt.Fprintf(buf, "--- %s\n+++ %s\n", nameA, nameB)
+	for i := 0; i < len(changes); {
+		// extend the hunk while the next change is close enough to share context
+		j := i
+		for j+1 < len(changes) && changes[j+1]-changes[j] <= 2*context {
+			j++
+		}
+		start, end := changes[i]-context, changes[j]+context+1
+		if start < 0 {
+			start = 0
+		}
+		if end > len(script) {
+			end = len(script)
+		}
+
+		countA, countB := 0, 0
+		for _, line := range script[start:end] {
+			if line.Op != '+' {
+				countA++
+			}
+			if line.Op != '-' {
+				countB++
+			}
+		}
+		startA, startB := script[start].A+1, script[start].B+1
+		if countA == 0 {
+			startA--
+		}
+		if countB == 0 {
+			startB--
+		}
+		_, _ = fmt.Fprintf(buf, "@@ -%d,%d +%d,%d @@\n", startA, countA, startB, countB)
+		for _, line := range script[start:end] {
+			buf.WriteByte(line.Op)
+			buf.WriteString(line.Text)
+			buf.WriteByte('\n')
+		}
+		i = j + 1
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,232 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package ffs
+
+import (
+	"fmt"
+	"github.com/mdhender/ottoapp/domains"
+	"math/rand"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiffLines(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		a, b  string
+		edits int
+	}{
+		{"both empty", "", "", 0},
+		{"same", "a b c", "a b c", 0},
+		{"insert all", "", "a b c", 3},
+		{"delete all", "a b c", "", 3},
+		{"insert middle", "a c", "a b c", 1},
+		{"delete middle", "a b c", "a c", 1},
+		{"replace one", "a b c", "a x c", 2},
+		{"replace all", "a b c", "x y z", 6},
+		{"myers paper", "a b c a b b a", "c b a b a c", 5},
+		{"move line", "a b c d", "b c d a", 2},
+		{"repeated lines", "a a a b", "b a a a", 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a, b := strings.Fields(tc.a), strings.Fields(tc.b)
+			script, err := diffLines(a, b, 0)
+			if err != nil {
+				t.Fatalf("diff: %v", err)
+			}
+			checkScript(t, a, b, script)
+			if got := countEdits(script); got != tc.edits {
+				t.Errorf("edits: want %d, got %d", tc.edits, got)
+			}
+		})
+	}
+}
+
+// TestDiffLinesShortest compares the length of the edit script with the
+// length from the textbook longest common subsequence on random inputs.
+func TestDiffLinesShortest(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	randomLines := func() []string {
+		lines := make([]string, rnd.Intn(40))
+		for i := range lines {
+			lines[i] = string(rune('a' + rnd.Intn(4)))
+		}
+		return lines
+	}
+	for i := 0; i < 500; i++ {
+		a, b := randomLines(), randomLines()
+		script, err := diffLines(a, b, 0)
+		if err != nil {
+			t.Fatalf("diff: %v", err)
+		}
+		checkScript(t, a, b, script)
+		if want, got := len(a)+len(b)-2*lcsLength(a, b), countEdits(script); got != want {
+			t.Fatalf("%q -> %q: edits: want %d, got %d", a, b, want, got)
+		}
+	}
+}
+
+func TestDiffLinesLimit(t *testing.T) {
+	a, b := strings.Fields("a b c d e"), strings.Fields("a x c y e")
+	for _, tc := range []struct {
+		maxEdits int
+		wantErr  bool
+	}{
+		{0, false},
+		{3, true},
+		{4, false},
+		{5, false},
+	} {
+		_, err := diffLines(a, b, tc.maxEdits)
+		if tc.wantErr && err != domains.ErrRevisionsDiffer {
+			t.Errorf("limit %d: want %v, got %v", tc.maxEdits, domains.ErrRevisionsDiffer, err)
+		} else if !tc.wantErr && err != nil {
+			t.Errorf("limit %d: want nil, got %v", tc.maxEdits, err)
+		}
+	}
+}
+
+// unrelatedLines returns two large inputs with nothing in common,
+// which is the worst case for the search.
+func unrelatedLines(lines int) (a, b []string) {
+	a, b = make([]string, lines), make([]string, lines)
+	for i := 0; i < lines; i++ {
+		a[i] = fmt.Sprintf("Tribe 0138, , Current Hex = ## %04d, (Previous Hex = N/A)", i)
+		b[i] = fmt.Sprintf("Tribe 0987, , Current Hex = OO %04d, (Previous Hex = N/A)", i)
+	}
+	return a, b
+}
+
+// TestDiffLinesUnrelated checks that memory stays linear when the search has no limit.
+func TestDiffLinesUnrelated(t *testing.T) {
+	const lines = 8000
+	a, b := unrelatedLines(lines)
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	started := time.Now()
+	script, err := diffLines(a, b, 0)
+	elapsed := time.Since(started)
+	runtime.ReadMemStats(&after)
+	if err != nil {
+		t.Fatalf("diff: %v", err)
+	}
+
+	checkScript(t, a, b, script)
+	if got := countEdits(script); got != 2*lines {
+		t.Errorf("edits: want %d, got %d", 2*lines, got)
+	}
+	// the script itself is about 1.5 MB, so anything near the size of the
+	// search space (lines squared) means the V arrays are being kept
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 16<<20 {
+		t.Errorf("allocated %d bytes, want less than %d", allocated, 16<<20)
+	}
+	t.Logf("diffed %d x %d lines in %v", lines, lines, elapsed)
+}
+
+// TestUnifiedDiffUnrelated checks that the server gives up quickly on inputs that are too different.
+func TestUnifiedDiffUnrelated(t *testing.T) {
+	a, b := unrelatedLines(8000)
+	started := time.Now()
+	diff, err := unifiedDiff("A", "B", a, b, 3)
+	if err != domains.ErrRevisionsDiffer {
+		t.Fatalf("want %v, got %v", domains.ErrRevisionsDiffer, err)
+	} else if diff != nil {
+		t.Errorf("want nil diff, got %d bytes", len(diff))
+	}
+	t.Logf("gave up in %v", time.Since(started))
+
+	// a small change to a large input is still shown
+	b = append([]string(nil), a...)
+	b[4000] = "Tribe 0138, , Current Hex = ## 4000, (Previous Hex = ## 3999)"
+	if diff, err = unifiedDiff("A", "B", a, b, 3); err != nil {
+		t.Fatalf("small change: %v", err)
+	} else if !strings.Contains(string(diff), "@@ -3998,7 +3998,7 @@") {
+		t.Errorf("small change: got\n%s", diff)
+	}
+}
+
+// checkScript verifies that the script turns a into b and that the line numbers are consistent.
+func checkScript(t *testing.T, a, b []string, script []diffLine_t) {
+	t.Helper()
+	var gotA, gotB []string
+	for _, line := range script {
+		switch line.Op {
+		case ' ':
+			if line.A != len(gotA) || line.B != len(gotB) {
+				t.Fatalf("line %q: want %d,%d, got %d,%d", line.Text, len(gotA), len(gotB), line.A, line.B)
+			}
+			gotA, gotB = append(gotA, line.Text), append(gotB, line.Text)
+		case '-':
+			if line.A != len(gotA) {
+				t.Fatalf("line -%q: want %d, got %d", line.Text, len(gotA), line.A)
+			}
+			gotA = append(gotA, line.Text)
+		case '+':
+			if line.B != len(gotB) {
+				t.Fatalf("line +%q: want %d, got %d", line.Text, len(gotB), line.B)
+			}
+			gotB = append(gotB, line.Text)
+		default:
+			t.Fatalf("line %q: unknown op %q", line.Text, line.Op)
+		}
+	}
+	if strings.Join(gotA, "\n") != strings.Join(a, "\n") {
+		t.Fatalf("script does not reproduce a")
+	} else if strings.Join(gotB, "\n") != strings.Join(b, "\n") {
+		t.Fatalf("script does not reproduce b")
+	}
+}
+
+func countEdits(script []diffLine_t) int {
+	n := 0
+	for _, line := range script {
+		if line.Op != ' ' {
+			n++
+		}
+	}
+	return n
+}
+
+func lcsLength(a, b []string) int {
+	dp := make([][]int, len(a)+1)
+	for i := range dp {
+		dp[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				dp[i][j] = dp[i+1][j+1] + 1
+			} else {
+				dp[i][j] = max(dp[i+1][j], dp[i][j+1])
+			}
+		}
+	}
+	return dp[0][0]
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"same", "a b c", "a b c", ""},
+		{"change", "a b c d e f g h", "a b c D e f g h",
+			"--- A\n+++ B\n@@ -1,7 +1,7 @@\n a\n b\n c\n-d\n+D\n e\n f\n g\n"},
+		{"insert into empty", "", "a", "--- A\n+++ B\n@@ -0,0 +1,1 @@\n+a\n"},
+		{"two hunks", "1 2 3 4 5 6 7 8 9 10 11 12", "x 2 3 4 5 6 7 8 9 10 11 y",
+			"--- A\n+++ B\n@@ -1,4 +1,4 @@\n-1\n+x\n 2\n 3\n 4\n@@ -9,4 +9,4 @@\n 9\n 10\n 11\n-12\n+y\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			diff, err := unifiedDiff("A", "B", strings.Fields(tc.a), strings.Fields(tc.b), 3)
+			if err != nil {
+				t.Fatalf("diff: %v", err)
+			} else if got := string(diff); got != tc.want {
+				t.Errorf("want\n%s\ngot\n%s", tc.want, diff)
+			}
+		})
+	}
+}
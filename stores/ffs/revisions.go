@@ -0,0 +1,273 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package ffs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/mdhender/ottoapp/domains"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Every time a turn report is saved, a numbered copy is kept in
+//
+//	ClanId/data/revisions/YYYY-MM.CCCC/NNNN.report.txt
+//
+// NNNN is the revision number padded to at least four digits.
+//
+// The copy in the input folder is always the "current" revision and is the
+// only one that ottomap sees. Revision numbers start at 1 and are never reused.
+//
+// Revision files are created with O_EXCL, so two uploads of the same report
+// that race each other get different numbers instead of overwriting one revision.
+
+var (
+	// revisions past 9999 are named without leading zeros, just like revisionName
+	rxRevision   = regexp.MustCompile(`^([0-9]{4}|[1-9][0-9]{4,})\.report\.txt$`)
+	rxReportName = regexp.MustCompile(`^[0-9]{4}-[0-9]{2}\.[0-9]{4}([cefg][0-9])?\.report\.txt$`)
+)
+
+type Revision_t struct {
+	Number    int
+	Size      int64
+	Timestamp time.Time // must be UTC
+	IsCurrent bool      // true if the revision matches the report in the input folder
+}
+
+// SaveReport writes the turn report to the input folder and keeps a copy
+// as a new revision. Returns the number of the new revision.
+//
+// If the report already exists but has no revisions (it was uploaded before
+// revisions were kept), the existing report is saved as revision 1 first.
+func (f *FFS) SaveReport(user *domains.User_t, reportName string, data []byte) (int, error) {
+	revisionsPath, err := f.revisionsPath(user, reportName)
+	if err != nil {
+		return 0, err
+	} else if err = os.MkdirAll(revisionsPath, 0755); err != nil {
+		return 0, err
+	}
+	reportPath := filepath.Join(user.Data, "input", reportName)
+
+	revisions, err := f.GetReportRevisions(user, reportName)
+	if err != nil {
+		return 0, err
+	}
+	next := 1
+	if len(revisions) != 0 {
+		next = revisions[len(revisions)-1].Number + 1
+	} else if current, err := os.ReadFile(reportPath); err == nil {
+		// if another upload saved revision 1 first, it has already kept the old report
+		if err := createRevision(filepath.Join(revisionsPath, revisionName(next)), current); err != nil && !errors.Is(err, os.ErrExist) {
+			return 0, err
+		}
+		next++
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return 0, err
+	}
+
+	// another upload may take the number between listing the folder and creating the file
+	for ; ; next++ {
+		err := createRevision(filepath.Join(revisionsPath, revisionName(next)), data)
+		if err == nil {
+			break
+		} else if !errors.Is(err, os.ErrExist) {
+			return 0, err
+		}
+	}
+	if err := writeFileAtomic(reportPath, data); err != nil {
+		return 0, err
+	}
+	return next, nil
+}
+
+// GetReportRevisions returns the revisions of the turn report, oldest first.
+func (f *FFS) GetReportRevisions(user *domains.User_t, reportName string) ([]Revision_t, error) {
+	revisionsPath, err := f.revisionsPath(user, reportName)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(revisionsPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	current, _ := os.ReadFile(filepath.Join(user.Data, "input", reportName))
+
+	var revisions []Revision_t
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		n, ok := revisionNumber(entry.Name())
+		if !ok {
+			continue
+		}
+		fi, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		revision := Revision_t{
+			Number:    n,
+			Size:      fi.Size(),
+			Timestamp: fi.ModTime().UTC(),
+		}
+		if current != nil && int64(len(current)) == fi.Size() {
+			if data, err := os.ReadFile(filepath.Join(revisionsPath, entry.Name())); err == nil {
+				revision.IsCurrent = bytes.Equal(data, current)
+			}
+		}
+		revisions = append(revisions, revision)
+	}
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisions[i].Number < revisions[j].Number
+	})
+	return revisions, nil
+}
+
+// GetReportRevision returns the contents of a single revision of the turn report.
+func (f *FFS) GetReportRevision(user *domains.User_t, reportName string, revision int) ([]byte, error) {
+	revisionsPath, err := f.revisionsPath(user, reportName)
+	if err != nil {
+		return nil, err
+	} else if revision < 1 {
+		return nil, domains.ErrNoSuchRevision
+	}
+	data, err := os.ReadFile(filepath.Join(revisionsPath, revisionName(revision)))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, domains.ErrNoSuchRevision
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// DiffReportRevisions returns a unified diff between two revisions of the turn report.
+// Returns nil if the revisions are the same and ErrRevisionsDiffer if they are too different to show.
+func (f *FFS) DiffReportRevisions(user *domains.User_t, reportName string, from, to int) ([]byte, error) {
+	a, err := f.GetReportRevision(user, reportName, from)
+	if err != nil {
+		return nil, err
+	}
+	b, err := f.GetReportRevision(user, reportName, to)
+	if err != nil {
+		return nil, err
+	}
+	return unifiedDiff(
+		fmt.Sprintf("%s revision %d", reportName, from),
+		fmt.Sprintf("%s revision %d", reportName, to),
+		splitLines(a), splitLines(b), 3)
+}
+
+// PromoteReportRevision replaces the turn report in the input folder with an older revision.
+// The revision history is not changed.
+func (f *FFS) PromoteReportRevision(user *domains.User_t, reportName string, revision int) error {
+	data, err := f.GetReportRevision(user, reportName, revision)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(user.Data, "input", reportName), data)
+}
+
+// countReportRevisions returns the number of revisions kept for the turn report.
+// It is called for every report on the dashboard, so it only reads the names in
+// the folder and never opens the revisions.
+func (f *FFS) countReportRevisions(user *domains.User_t, reportName string) int {
+	revisionsPath, err := f.revisionsPath(user, reportName)
+	if err != nil {
+		return 0
+	}
+	entries, err := os.ReadDir(revisionsPath)
+	if err != nil {
+		return 0
+	}
+	count := 0
+	for _, entry := range entries {
+		if _, ok := revisionNumber(entry.Name()); ok && !entry.IsDir() {
+			count++
+		}
+	}
+	return count
+}
+
+// createRevision writes a new revision file. It fails with an error matching
+// os.ErrExist if the revision has already been created.
+func createRevision(path string, data []byte) error {
+	fp, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	} else if _, err := fp.Write(data); err != nil {
+		_ = fp.Close()
+		return err
+	}
+	return fp.Close()
+}
+
+// revisionsPath returns the folder that holds the revisions of the turn report.
+func (f *FFS) revisionsPath(user *domains.User_t, reportName string) (string, error) {
+	if !rxReportName.MatchString(reportName) {
+		return "", domains.ErrInvalidPath
+	}
+	return filepath.Join(user.Data, "revisions", strings.TrimSuffix(reportName, ".report.txt")), nil
+}
+
+// revisionName returns the name of the revision file.
+func revisionName(revision int) string {
+	return fmt.Sprintf("%04d.report.txt", revision)
+}
+
+// revisionNumber returns the number of the revision from the name of the file.
+func revisionNumber(name string) (int, bool) {
+	m := rxRevision.FindStringSubmatch(name)
+	if len(m) != 2 {
+		return 0, false
+	}
+	n, err := strconv.Atoi(m[1])
+	if err != nil || n < 1 {
+		return 0, false
+	}
+	return n, true
+}
+
+func splitLines(data []byte) []string {
+	text := strings.TrimSuffix(string(data), "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// writeFileAtomic writes to a temporary file and renames it so that
+// readers never see a partially written report. Each writer gets its own
+// temporary file, so concurrent saves of the same report don't collide.
+func writeFileAtomic(path string, data []byte) error {
+	fp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := fp.Name()
+	if _, err := fp.Write(data); err != nil {
+		_ = fp.Close()
+		_ = os.Remove(tmp)
+		return err
+	} else if err := fp.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	} else if err := os.Chmod(tmp, 0644); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	} else if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
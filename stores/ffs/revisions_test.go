@@ -0,0 +1,257 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package ffs
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mdhender/ottoapp/domains"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestRevisionName(t *testing.T) {
+	for _, tc := range []struct {
+		revision int
+		want     string
+	}{
+		{1, "0001.report.txt"},
+		{42, "0042.report.txt"},
+		{9999, "9999.report.txt"},
+		{10000, "10000.report.txt"},
+		{123456, "123456.report.txt"},
+	} {
+		got := revisionName(tc.revision)
+		if got != tc.want {
+			t.Errorf("revisionName(%d): want %q, got %q", tc.revision, tc.want, got)
+		}
+		// every name we write must be listed again
+		if !rxRevision.MatchString(got) {
+			t.Errorf("revisionName(%d): %q does not match rxRevision", tc.revision, got)
+		}
+	}
+}
+
+func TestRxRevision(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		want bool
+	}{
+		{"0001.report.txt", true},
+		{"9999.report.txt", true},
+		{"10000.report.txt", true},
+		{"001.report.txt", false},
+		{"01000.report.txt", false}, // revisionName never writes this
+		{"0001.report.txt.tmp", false},
+		{"0001.report.log", false},
+		{"abcd.report.txt", false},
+	} {
+		if got := rxRevision.MatchString(tc.name); got != tc.want {
+			t.Errorf("%q: want %v, got %v", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestSaveReport(t *testing.T) {
+	f, user := testFFS(t)
+	const reportName = "0901-04.0138.report.txt"
+
+	for i, data := range []string{"first\n", "second\n", "third\n"} {
+		n, err := f.SaveReport(user, reportName, []byte(data))
+		if err != nil {
+			t.Fatalf("save %d: %v", i+1, err)
+		} else if n != i+1 {
+			t.Errorf("save %d: want revision %d, got %d", i+1, i+1, n)
+		}
+	}
+
+	revisions, err := f.GetReportRevisions(user, reportName)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(revisions) != 3 {
+		t.Fatalf("revisions: want 3, got %d", len(revisions))
+	}
+	for i, revision := range revisions {
+		if revision.Number != i+1 {
+			t.Errorf("revision %d: want number %d, got %d", i, i+1, revision.Number)
+		}
+		if want := i == 2; revision.IsCurrent != want {
+			t.Errorf("revision %d: want current %v, got %v", revision.Number, want, revision.IsCurrent)
+		}
+	}
+
+	if err := f.PromoteReportRevision(user, reportName, 1); err != nil {
+		t.Fatal(err)
+	} else if data, err := os.ReadFile(filepath.Join(user.Data, "input", reportName)); err != nil {
+		t.Fatal(err)
+	} else if string(data) != "first\n" {
+		t.Errorf("promote: want %q, got %q", "first\n", data)
+	}
+}
+
+func TestSaveReportKeepsUnrevisionedReport(t *testing.T) {
+	f, user := testFFS(t)
+	const reportName = "0901-04.0138.report.txt"
+
+	// uploaded before revisions were kept
+	if err := os.WriteFile(filepath.Join(user.Data, "input", reportName), []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	n, err := f.SaveReport(user, reportName, []byte("new\n"))
+	if err != nil {
+		t.Fatal(err)
+	} else if n != 2 {
+		t.Errorf("want revision 2, got %d", n)
+	}
+	if data, err := f.GetReportRevision(user, reportName, 1); err != nil {
+		t.Fatal(err)
+	} else if string(data) != "old\n" {
+		t.Errorf("revision 1: want %q, got %q", "old\n", data)
+	}
+}
+
+func TestSaveReportPastRevision9999(t *testing.T) {
+	f, user := testFFS(t)
+	const reportName = "0901-04.0138.report.txt"
+
+	revisionsPath, err := f.revisionsPath(user, reportName)
+	if err != nil {
+		t.Fatal(err)
+	} else if err := os.MkdirAll(revisionsPath, 0755); err != nil {
+		t.Fatal(err)
+	} else if err := os.WriteFile(filepath.Join(revisionsPath, revisionName(9999)), []byte("9999\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []int{10000, 10001} {
+		n, err := f.SaveReport(user, reportName, []byte("newer\n"))
+		if err != nil {
+			t.Fatal(err)
+		} else if n != want {
+			t.Errorf("save: want revision %d, got %d", want, n)
+		}
+	}
+
+	revisions, err := f.GetReportRevisions(user, reportName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var numbers []int
+	for _, revision := range revisions {
+		numbers = append(numbers, revision.Number)
+	}
+	if len(numbers) != 3 || numbers[0] != 9999 || numbers[1] != 10000 || numbers[2] != 10001 {
+		t.Errorf("revisions: want [9999 10000 10001], got %v", numbers)
+	}
+	if _, err := f.GetReportRevision(user, reportName, 10001); err != nil {
+		t.Errorf("revision 10001: %v", err)
+	}
+}
+
+func TestSaveReportConcurrent(t *testing.T) {
+	f, user := testFFS(t)
+	const reportName, saves = "0901-04.0138.report.txt", 20
+
+	var wg sync.WaitGroup
+	numbers, errs := make([]int, saves), make([]error, saves)
+	for i := 0; i < saves; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			numbers[i], errs[i] = f.SaveReport(user, reportName, []byte(fmt.Sprintf("save %d\n", i)))
+		}(i)
+	}
+	wg.Wait()
+
+	// every save gets its own revision, and every revision holds the data of its save
+	seen := map[int]bool{}
+	for i, n := range numbers {
+		if errs[i] != nil {
+			t.Fatalf("save %d: %v", i, errs[i])
+		} else if seen[n] {
+			t.Errorf("save %d: revision %d was returned twice", i, n)
+		}
+		seen[n] = true
+		if data, err := f.GetReportRevision(user, reportName, n); err != nil {
+			t.Errorf("save %d: %v", i, err)
+		} else if want := fmt.Sprintf("save %d\n", i); string(data) != want {
+			t.Errorf("save %d: revision %d: want %q, got %q", i, n, want, data)
+		}
+	}
+	if got := f.countReportRevisions(user, reportName); got != saves {
+		t.Errorf("count: want %d, got %d", saves, got)
+	}
+}
+
+func TestCountReportRevisions(t *testing.T) {
+	f, user := testFFS(t)
+	const reportName = "0901-04.0138.report.txt"
+	if got := f.countReportRevisions(user, reportName); got != 0 {
+		t.Errorf("no revisions: want 0, got %d", got)
+	}
+	for _, data := range []string{"first\n", "second\n"} {
+		if _, err := f.SaveReport(user, reportName, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	revisionsPath, err := f.revisionsPath(user, reportName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only revision files are counted, and they are never opened
+	for _, name := range []string{"0000.report.txt", "0003.report.txt.tmp", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(revisionsPath, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(revisionsPath, revisionName(3)), []byte("third\n"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := f.countReportRevisions(user, reportName); got != 3 {
+		t.Errorf("want 3, got %d", got)
+	}
+	if got := f.countReportRevisions(user, "../"+reportName); got != 0 {
+		t.Errorf("traversal: want 0, got %d", got)
+	}
+}
+
+func TestGetReportRevisionErrors(t *testing.T) {
+	f, user := testFFS(t)
+	if _, err := f.SaveReport(user, "0901-04.0138.report.txt", []byte("first\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name       string
+		reportName string
+		revision   int
+		want       error
+	}{
+		{"zero", "0901-04.0138.report.txt", 0, domains.ErrNoSuchRevision},
+		{"negative", "0901-04.0138.report.txt", -1, domains.ErrNoSuchRevision},
+		{"missing", "0901-04.0138.report.txt", 2, domains.ErrNoSuchRevision},
+		{"no revisions", "0901-05.0138.report.txt", 1, domains.ErrNoSuchRevision},
+		{"traversal", "../0901-04.0138.report.txt", 1, domains.ErrInvalidPath},
+		{"bad name", "0901-04.0138.wxx", 1, domains.ErrInvalidPath},
+	} {
+		if _, err := f.GetReportRevision(user, tc.reportName, tc.revision); !errors.Is(err, tc.want) {
+			t.Errorf("%s: want %v, got %v", tc.name, tc.want, err)
+		}
+	}
+}
+
+// testFFS returns a file system and a user with an empty input folder.
+func testFFS(t *testing.T) (*FFS, *domains.User_t) {
+	t.Helper()
+	f, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &domains.User_t{Data: filepath.Join(f.path, "0138", "data")}
+	if err := os.MkdirAll(filepath.Join(user.Data, "input"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return f, user
+}
@@ -96,6 +96,8 @@ type File_t struct {
 	Clan      string
 	Path      string    // full path to file
 	Timestamp time.Time // must be UTC
+	Revisions int       // number of revisions kept, only set for turn reports
+	Size      int64     // size of the file in bytes, only set for maps
 }
 
 func (f *FFS) GetClanFiles(user *domains.User_t) (ClanFiles_t, error) {
@@ -154,6 +156,7 @@ func (f *FFS) GetClanFiles(user *domains.User_t) (ClanFiles_t, error) {
 					ft.Timestamp = fi.ModTime().UTC()
 				}
 				ft.Turn = fmt.Sprintf("%04d-%02d", ft.Year, ft.Month)
+				ft.Revisions = f.countReportRevisions(user, ft.Name)
 				files.ReportFiles = append(files.ReportFiles, ft)
 			}
 		}
@@ -198,7 +201,7 @@ func (f *FFS) GetClanFiles(user *domains.User_t) (ClanFiles_t, error) {
 					//log.Printf("ffs: getClanFiles: %v\n", err)
 					return files, err
 				} else {
-					ft.Timestamp = fi.ModTime().UTC()
+					ft.Timestamp, ft.Size = fi.ModTime().UTC(), fi.Size()
 				}
 				ft.Turn = fmt.Sprintf("%04d-%02d", ft.Year, ft.Month)
 				files.MapFiles = append(files.MapFiles, ft)
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"io"
 	"regexp"
+	"strings"
 )
 
 // http://officeopenxml.com/anatomyofOOXML.php
@@ -59,15 +60,115 @@ func (d *docx) retrieveFileContents(filename string) ([]byte, error) {
 // GenWordsList generate a list of all words
 func (d *docx) GenWordsList() {
 	xmlData := string(d.FilesContent["word/document.xml"])
-	d.listP(xmlData)
+	d.listBody(xmlData)
+}
+
+// listBody walks the paragraphs and tables in document order.
+// Tables are handed off to listTbl so that each row becomes a single line.
+func (d *docx) listBody(data string) {
+	for len(data) != 0 {
+		start, end, inner := findElement(data, "w:tbl")
+		if start < 0 {
+			d.listP(data)
+			return
+		}
+		d.listP(data[:start])
+		d.listTbl(inner)
+		data = data[end:]
+	}
+}
+
+// listTbl adds one line for each row in the table.
+// The cells are separated by a comma and a space so that a unit header that
+// was split across cells still reads "Tribe 0987, , Current Hex = ...".
+// When a cell already ends with a colon or comma, only the space is added.
+// Paragraphs within a cell, and rows of nested tables, are joined with a space.
+func (d *docx) listTbl(data string) {
+	for _, row := range listElements(data, "w:tr") {
+		line := &strings.Builder{}
+		for column, cell := range listElements(row, "w:tc") {
+			if column != 0 {
+				if prev := line.String(); !(strings.HasSuffix(prev, ":") || strings.HasSuffix(prev, ",")) {
+					line.WriteByte(',')
+				}
+				line.WriteByte(' ')
+			}
+			line.WriteString(cellText(cell))
+		}
+		d.WordsList = append(d.WordsList, &words{Content: []string{line.String()}})
+	}
+}
+
+// cellText returns the text of a table cell as a single line.
+func cellText(data string) string {
+	cell := &docx{}
+	cell.listBody(data)
+	var paragraphs []string
+	for _, w := range cell.WordsList {
+		if text := strings.TrimSpace(w.String()); text != "" {
+			paragraphs = append(paragraphs, text)
+		}
+	}
+	return strings.Join(paragraphs, " ")
+}
+
+// findElement returns the location of the first element with the given tag
+// along with its inner content. Nested elements with the same tag are skipped
+// over. If the element isn't found, start is -1.
+func findElement(data, tag string) (start, end int, inner string) {
+	open, closing := "<"+tag, "</"+tag+">"
+	start, depth, pos, innerStart := -1, 0, 0, 0
+	for pos < len(data) {
+		i := strings.Index(data[pos:], "<"+tag)
+		j := strings.Index(data[pos:], closing)
+		if i >= 0 && (j < 0 || i < j) {
+			// make sure this isn't a longer tag, such as w:tblPr for w:tbl
+			at := pos + i + len(open)
+			if at < len(data) && (data[at] == '>' || data[at] == ' ') {
+				gt := strings.IndexByte(data[at:], '>')
+				if gt < 0 {
+					return -1, 0, ""
+				}
+				if depth == 0 {
+					start, innerStart = pos+i, at+gt+1
+				}
+				depth++
+				pos = at + gt + 1
+			} else {
+				pos = at
+			}
+			continue
+		} else if j < 0 || depth == 0 {
+			return -1, 0, ""
+		}
+		depth--
+		pos = pos + j + len(closing)
+		if depth == 0 {
+			return start, pos, data[innerStart : pos-len(closing)]
+		}
+	}
+	return -1, 0, ""
+}
+
+// listElements returns the inner content of each top level element with the given tag.
+func listElements(data, tag string) []string {
+	var list []string
+	for {
+		start, end, inner := findElement(data, tag)
+		if start < 0 {
+			return list
+		}
+		list = append(list, inner)
+		data = data[end:]
+	}
 }
 
 var (
 	reRunT = regexp.MustCompile(`(?U)(<w:r>|<w:r .*>)(.*)(</w:r>)`)
-	reT    = regexp.MustCompile(`(?U)(<w:t>|<w:t .*>)(.*)(</w:t>)`)
+	reT    = regexp.MustCompile(`(?U)(<w:t>|<w:t .*>)(.*)(</w:t>)|<w:tab/>`)
 )
 
-// get w:t value
+// get w:t value. tabs within a run are returned as a "\t".
 func (d *docx) getT(item string) {
 	var subStr string
 	data := item
@@ -80,6 +181,10 @@ func (d *docx) getT(item string) {
 		rData := data[rMatch[4]:rMatch[5]]
 		wtMatch := reT.FindAllStringSubmatchIndex(rData, -1)
 		for _, match := range wtMatch {
+			if match[4] < 0 { // w:tab
+				content = append(content, "\t")
+				continue
+			}
 			subStr = rData[match[4]:match[5]]
 			content = append(content, subStr)
 		}
@@ -128,3 +233,16 @@ type docx struct {
 type words struct {
 	Content []string
 }
+
+// String returns the runs joined with a single space.
+// No space is added next to a tab so that tabs are preserved.
+func (w *words) String() string {
+	sb := &strings.Builder{}
+	for column, content := range w.Content {
+		if column != 0 && content != "\t" && w.Content[column-1] != "\t" {
+			sb.WriteString(" ")
+		}
+		sb.WriteString(content)
+	}
+	return sb.String()
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package office
+
+import (
+	"archive/zip"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadText(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		body string
+		want []string
+	}{
+		{"paragraphs",
+			p("Tribe 0138, , Current Hex = QQ 1234, (Previous Hex = QQ 1234)") + p("0138 Status: PRAIRIE"),
+			[]string{"Tribe 0138, , Current Hex = QQ 1234, (Previous Hex = QQ 1234)", "0138 Status: PRAIRIE"}},
+		{"runs are joined with a space",
+			`<w:p><w:r><w:t>Tribe</w:t></w:r><w:r><w:rPr><w:b/></w:rPr><w:t xml:space="preserve">Movement:</w:t></w:r></w:p>`,
+			[]string{"Tribe Movement:"}},
+		{"tab",
+			`<w:p><w:r><w:t>Current Turn 901-04 (#40), Spring, FINE</w:t><w:tab/><w:t>Next Turn 901-05 (#41), 12/10/2024</w:t></w:r></w:p>`,
+			[]string{"Current Turn 901-04 (#40), Spring, FINE\tNext Turn 901-05 (#41), 12/10/2024"}},
+		{"unit header split across cells",
+			tbl(tr(tc(p("Tribe 0138")), tc(`<w:p/>`), tc(p("Current Hex = QQ 1234")), tc(p("(Previous Hex = QQ 1234)")))),
+			[]string{"Tribe 0138, , Current Hex = QQ 1234, (Previous Hex = QQ 1234)"}},
+		{"one line for each row",
+			tbl(tr(tc(p("Scout 1:")), tc(p("Scout N-PR"))), tr(tc(p("Scout 2:")), tc(p("Scout S-PR")))),
+			[]string{"Scout 1: Scout N-PR", "Scout 2: Scout S-PR"}},
+		{"cell ending with a comma",
+			tbl(tr(tc(p("Tribe 0138,")), tc(p("Current Hex = QQ 1234")))),
+			[]string{"Tribe 0138, Current Hex = QQ 1234"}},
+		{"paragraphs in a cell",
+			tbl(tr(tc(p("0138 Status:")+p("PRAIRIE, River S")), tc(p("2 Warriors")))),
+			[]string{"0138 Status: PRAIRIE, River S, 2 Warriors"}},
+		{"nested table",
+			tbl(tr(tc(p("outer")), tc(tbl(tr(tc(p("a")), tc(p("b"))), tr(tc(p("c"))))))),
+			[]string{"outer, a, b c"}},
+		{"table properties are not cells",
+			`<w:tbl><w:tblPr><w:tblW w:w="0" w:type="auto"/></w:tblPr><w:tblGrid><w:gridCol w:w="100"/></w:tblGrid>` +
+				tr(`<w:tcPr><w:tcW w:w="100"/></w:tcPr>`+tc(p("x")), tc(p("y"))) + `</w:tbl>`,
+			[]string{"x, y"}},
+		{"table between paragraphs",
+			p("before") + tbl(tr(tc(p("a")), tc(p("b")))) + p("after"),
+			[]string{"before", "a, b", "after"}},
+		{"case is kept",
+			p("Tribe Movement: Move NE-GH"),
+			[]string{"Tribe Movement: Move NE-GH"}},
+	} {
+		text, err := ReadText(bytes.NewReader(testDocx(t, tc.body)))
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		got := strings.Split(strings.TrimSuffix(string(text), "\n"), "\n")
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: want %q, got %q", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestReadTextNotDocx(t *testing.T) {
+	if _, err := ReadText(bytes.NewReader([]byte("Tribe 0138"))); err == nil {
+		t.Errorf("want error, got nil")
+	}
+}
+
+func p(text string) string {
+	return `<w:p><w:pPr><w:spacing w:after="0"/></w:pPr><w:r><w:t>` + text + `</w:t></w:r></w:p>`
+}
+
+func tbl(rows ...string) string {
+	return `<w:tbl><w:tblPr/>` + strings.Join(rows, "") + `</w:tbl>`
+}
+
+func tr(cells ...string) string {
+	return `<w:tr>` + strings.Join(cells, "") + `</w:tr>`
+}
+
+func tc(content string) string {
+	return `<w:tc>` + content + `</w:tc>`
+}
+
+// testDocx returns a minimal Word document with the given body.
+func testDocx(t *testing.T, body string) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	w, err := zw.Create("word/document.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = w.Write([]byte(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+		`<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>` +
+		body +
+		`<w:sectPr/></w:body></w:document>`))
+	if err != nil {
+		t.Fatal(err)
+	} else if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
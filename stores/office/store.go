@@ -10,33 +10,15 @@ import (
 
 // NewStore returns a new store from the Word document.
 func NewStore(path string, reader *bytes.Reader, invalidCharacters, preprocess, sensitiveData, smartQuotes bool) (d *DOCX, err error) {
-	dx, err := openDocxReader(reader)
+	text, err := ReadText(reader)
 	if err != nil {
 		return nil, err
 	}
 
-	// convert the xml data to a slice of word tokens
-	dx.GenWordsList()
-
-	// convert the word tokens to a slice containing all the words.
-	// we collapse spaces into a single space and can't tell the difference between
-	// a space and a tab. we also destroy all the original Word tables.
-	result := &bytes.Buffer{}
-	for _, word := range dx.WordsList {
-		//result.WriteString(fmt.Sprintf("%06d: ", line+1))
-		for column, content := range word.Content {
-			if column != 0 {
-				result.WriteString(" ")
-			}
-			result.WriteString(content)
-		}
-		result.WriteByte('\n')
-	}
-
 	// split the result into lines terminated by newlines
 	d = &DOCX{
 		path:  path,
-		lines: bytes.Split(result.Bytes(), []byte{'\n'}),
+		lines: bytes.Split(text, []byte{'\n'}),
 	}
 
 	if sensitiveData {
@@ -49,9 +31,30 @@ func NewStore(path string, reader *bytes.Reader, invalidCharacters, preprocess,
 	return d, nil
 }
 
+// ReadText returns the text of the Word document with one line for each paragraph.
+// Runs are joined with a single space, but tabs are kept. Each row of a Word table
+// is written as a single line with the cells separated by commas.
+// Unlike the tndocx reader, the case of the text is not changed.
+func ReadText(reader *bytes.Reader) ([]byte, error) {
+	dx, err := openDocxReader(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	// convert the xml data to a slice of word tokens
+	dx.GenWordsList()
+
+	result := &bytes.Buffer{}
+	for _, word := range dx.WordsList {
+		result.WriteString(word.String())
+		result.WriteByte('\n')
+	}
+	return result.Bytes(), nil
+}
+
 // Lines returns the lines of the document.
-// Note that Word tables are not preserved and most runs of spaces and tabs are
-// collapsed into a single space.
+// Note that each row of a Word table is returned as a single line and that
+// runs of spaces are collapsed into a single space.
 func (d *DOCX) Lines() [][]byte {
 	return d.lines
 }
@@ -122,7 +125,6 @@ func (d *DOCX) RemoveSensitiveData() {
 	d.lines = lines
 }
 
-// todo: can we use this office package if we fix the tab issue?
 type DOCX struct {
 	path  string
 	lines [][]byte
@@ -0,0 +1,75 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package sqlite
+
+import (
+	"github.com/mdhender/ottoapp/domains"
+	"github.com/mdhender/ottoapp/stores/sqlite/sqlc"
+	"math"
+	"time"
+)
+
+// CreateAuditEvent records an event in the audit log.
+// If the event doesn't have a time, the current time is used.
+func (db *DB) CreateAuditEvent(event domains.AuditEvent_t) error {
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	return db.q.CreateAuditEvent(db.ctx, sqlc.CreateAuditEventParams{
+		CreatedAt: event.CreatedAt.UTC().Unix(),
+		Actor:     event.Actor,
+		Action:    string(event.Action),
+		Target:    event.Target,
+		ClientIp:  event.ClientIP,
+		Detail:    event.Detail,
+	})
+}
+
+// GetAuditActions returns the actions that have been recorded.
+func (db *DB) GetAuditActions() ([]domains.AuditAction, error) {
+	rows, err := db.q.GetAuditActions(db.ctx)
+	if err != nil {
+		return nil, err
+	}
+	var list []domains.AuditAction
+	for _, row := range rows {
+		list = append(list, domains.AuditAction(row))
+	}
+	return list, nil
+}
+
+// GetAuditEvents returns the events that match the filter, newest first.
+func (db *DB) GetAuditEvents(filter domains.AuditFilter_t) ([]*domains.AuditEvent_t, error) {
+	parms := sqlc.GetAuditEventsParams{
+		Until:  math.MaxInt64,
+		Actor:  filter.Actor,
+		Action: string(filter.Action),
+		Limit:  -1,
+	}
+	if !filter.Since.IsZero() {
+		parms.Since = filter.Since.UTC().Unix()
+	}
+	if !filter.Until.IsZero() {
+		parms.Until = filter.Until.UTC().Unix()
+	}
+	if filter.Limit > 0 {
+		parms.Limit = int64(filter.Limit)
+	}
+	rows, err := db.q.GetAuditEvents(db.ctx, parms)
+	if err != nil {
+		return nil, err
+	}
+	var list []*domains.AuditEvent_t
+	for _, row := range rows {
+		list = append(list, &domains.AuditEvent_t{
+			ID:        domains.ID(row.EventID),
+			CreatedAt: time.Unix(row.CreatedAt, 0).UTC(),
+			Actor:     row.Actor,
+			Action:    domains.AuditAction(row.Action),
+			Target:    row.Target,
+			ClientIP:  row.ClientIp,
+			Detail:    row.Detail,
+		})
+	}
+	return list, nil
+}
@@ -182,11 +182,112 @@ func (db *DB) GetUser(userID domains.ID) (*domains.User_t, error) {
 	return user, nil
 }
 
+// GetUserAccount returns the user for the clan, even if the user is not active.
+// It is used by the administrator pages, which must be able to reactivate users.
+func (db *DB) GetUserAccount(clan string) (*domains.User_t, error) {
+	row, err := db.q.GetUserAccount(db.ctx, clan)
+	if err != nil {
+		return nil, err
+	}
+	paths, err := db.q.GetServerPaths(db.ctx)
+	if err != nil {
+		return nil, err
+	} else if paths.UserdataPath == "" {
+		return nil, domains.ErrMissingUserdataPath
+	}
+	return userAccount(row, paths.UserdataPath), nil
+}
+
+// GetUserAccounts returns all the users, including the ones that are not active, ordered by clan.
+func (db *DB) GetUserAccounts() ([]*domains.User_t, error) {
+	rows, err := db.q.GetUserAccounts(db.ctx)
+	if err != nil {
+		return nil, err
+	}
+	paths, err := db.q.GetServerPaths(db.ctx)
+	if err != nil {
+		return nil, err
+	} else if paths.UserdataPath == "" {
+		return nil, domains.ErrMissingUserdataPath
+	}
+	var users []*domains.User_t
+	for _, row := range rows {
+		users = append(users, userAccount(sqlc.GetUserAccountRow(row), paths.UserdataPath))
+	}
+	return users, nil
+}
+
+// userAccount converts the row to a user.
+// Unlike GetUser, a bad timezone is not an error; the user is shown in UTC instead.
+func userAccount(row sqlc.GetUserAccountRow, userdataPath string) *domains.User_t {
+	loc, err := time.LoadLocation(row.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	user := &domains.User_t{
+		ID:    domains.ID(row.UserID),
+		Email: row.Email,
+		Clan:  row.Clan,
+		Roles: struct {
+			IsActive        bool
+			IsAdministrator bool
+			IsAuthenticated bool
+			IsOperator      bool
+			IsUser          bool
+		}{
+			IsActive:        row.IsActive == 1,
+			IsAdministrator: row.IsAdministrator == 1,
+			IsOperator:      row.IsOperator == 1,
+			IsUser:          row.IsUser == 1,
+		},
+		Data:      filepath.Join(userdataPath, row.Clan, "data"),
+		Created:   row.CreatedAt,
+		Updated:   row.UpdatedAt,
+		LastLogin: time.Unix(row.LastLogin, 0),
+	}
+	user.LanguageAndDates.DateFormat = "2006-01-02"
+	user.LanguageAndDates.Timezone.Location = loc
+	return user
+}
+
 func (db *DB) GetUserByClan(clan string) (domains.ID, error) {
 	id, err := db.q.GetUserByClan(db.ctx, clan)
 	return domains.ID(id), err
 }
 
+// VerifyUserPassword returns domains.ErrUnauthorized if the password does not match the user's password.
+func (db *DB) VerifyUserPassword(userID domains.ID, plainTextPassword string) error {
+	row, err := db.q.GetUserHashedPassword(db.ctx, int64(userID))
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		return domains.ErrUnauthorized
+	} else if !CheckPassword(plainTextPassword, row.HashedPassword) {
+		return domains.ErrUnauthorized
+	}
+	return nil
+}
+
+// SetUserRoles replaces the roles for the user.
+// Reactivating a user does not restore their password; the caller must set a new one.
+func (db *DB) SetUserRoles(userID domains.ID, isActive, isAdministrator, isOperator, isUser bool) error {
+	parms := sqlc.SetUserRolesParams{UserID: int64(userID)}
+	if isActive {
+		parms.IsActive = 1
+	}
+	if isAdministrator {
+		parms.IsAdministrator = 1
+	}
+	if isOperator {
+		parms.IsOperator = 1
+	}
+	if isUser {
+		parms.IsUser = 1
+	}
+	return db.q.SetUserRoles(db.ctx, parms)
+}
+
 func (db *DB) UpdateUserPassword(userID domains.ID, plainTextSecret string, forceActive bool) error {
 	// hash the password. can fail if the password is too long.
 	hashedPassword, err := HashPassword(plainTextSecret)
@@ -0,0 +1,77 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/mdhender/ottoapp/domains"
+	"github.com/mdhender/ottoapp/stores/sqlite/sqlc"
+	"time"
+)
+
+// SetTurnDueDate saves the date that orders are due for the turn after turnId.
+func (db *DB) SetTurnDueDate(userId domains.ID, turnId, nextTurnId string, due time.Time) error {
+	return db.q.UpsertTurnDueDate(db.ctx, sqlc.UpsertTurnDueDateParams{
+		UserID:     int64(userId),
+		TurnID:     turnId,
+		NextTurnID: nextTurnId,
+		DueDate:    due.Format(time.DateOnly),
+		UpdatedAt:  time.Now().UTC().Unix(),
+	})
+}
+
+// GetTurnDueDates returns the due dates for all of the user's turns, ordered by turn.
+// Rows with an invalid date are skipped.
+func (db *DB) GetTurnDueDates(userId domains.ID) ([]*domains.DueDate_t, error) {
+	rows, err := db.q.GetTurnDueDates(db.ctx, int64(userId))
+	if err != nil {
+		return nil, err
+	}
+	var dates []*domains.DueDate_t
+	for _, row := range rows {
+		due, err := time.Parse(time.DateOnly, row.DueDate)
+		if err != nil {
+			continue
+		}
+		dates = append(dates, &domains.DueDate_t{
+			TurnId:     row.TurnID,
+			NextTurnId: row.NextTurnID,
+			Due:        due,
+		})
+	}
+	return dates, nil
+}
+
+// GetCalendarFeedToken returns the token for the user's calendar feed.
+// The feed is created the first time it is requested.
+func (db *DB) GetCalendarFeedToken(userId domains.ID) (string, error) {
+	token, err := db.q.GetCalendarFeedToken(db.ctx, int64(userId))
+	if errors.Is(err, sql.ErrNoRows) {
+		return db.ResetCalendarFeedToken(userId)
+	}
+	return token, err
+}
+
+// ResetCalendarFeedToken replaces the token for the user's calendar feed.
+// Calendars subscribed to the old token will stop receiving updates.
+func (db *DB) ResetCalendarFeedToken(userId domains.ID) (string, error) {
+	token := uuid.NewString()
+	err := db.q.UpsertCalendarFeed(db.ctx, sqlc.UpsertCalendarFeedParams{
+		UserID:    int64(userId),
+		Token:     token,
+		CreatedAt: time.Now().UTC().Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// GetCalendarFeedUser returns the user that owns the calendar feed.
+// Returns sql.ErrNoRows if the token is not valid or the user is not active.
+func (db *DB) GetCalendarFeedUser(token string) (domains.ID, error) {
+	id, err := db.q.GetCalendarFeedUser(db.ctx, token)
+	return domains.ID(id), err
+}
@@ -22,9 +22,18 @@ var (
 
 // Create creates a new store.
 // Returns an error if the database already exists.
+//
+// The assets and components paths are optional override directories.
+// An empty path means the server uses the copies embedded in the binary.
 func Create(path string, force bool, assets, components, userdata string, adminSecret, salt string, ctx context.Context) error {
-	// all the data paths must exist and be folders
-	for _, path := range []string{assets, components, userdata} {
+	// the data path must exist and be a folder, and so must the override paths if they are set
+	paths := []string{userdata}
+	for _, path := range []string{assets, components} {
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	for _, path := range paths {
 		sb, err := os.Stat(path)
 		if err != nil {
 			log.Printf("[sqldb] %q: %s\n", path, err)
@@ -0,0 +1,88 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/mdhender/ottoapp/domains"
+	"github.com/mdhender/ottoapp/stores/sqlite/sqlc"
+	"time"
+)
+
+// CreateJob queues a render job for the clan and turn.
+// If a job for the clan and turn is already waiting in the queue, no new job
+// is created and the returned id is zero.
+func (db *DB) CreateJob(userId domains.ID, clan, turnId string) (domains.ID, error) {
+	n, err := db.q.CountQueuedJobs(db.ctx, sqlc.CountQueuedJobsParams{Clan: clan, TurnID: turnId})
+	if err != nil {
+		return 0, err
+	} else if n != 0 {
+		return 0, nil
+	}
+	id, err := db.q.CreateJob(db.ctx, sqlc.CreateJobParams{
+		UserID:   int64(userId),
+		Clan:     clan,
+		TurnID:   turnId,
+		QueuedAt: time.Now().UTC().Unix(),
+	})
+	if err != nil {
+		return 0, err
+	}
+	return domains.ID(id), nil
+}
+
+// ClaimNextJob marks the oldest queued job as running and returns it.
+// Jobs for a clan that already has a running job are left on the queue.
+// Returns nil if there are no jobs that can be claimed.
+func (db *DB) ClaimNextJob() (*domains.Job_t, error) {
+	startedAt := time.Now().UTC()
+	row, err := db.q.ClaimNextJob(db.ctx, startedAt.Unix())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &domains.Job_t{
+		ID:        domains.ID(row.JobID),
+		UserID:    domains.ID(row.UserID),
+		Clan:      row.Clan,
+		TurnId:    row.TurnID,
+		Status:    domains.JobRunning,
+		StartedAt: startedAt,
+	}, nil
+}
+
+// FinishJob records the final status of the job.
+func (db *DB) FinishJob(jobId domains.ID, status domains.JobStatus, errorMessage string) error {
+	return db.q.FinishJob(db.ctx, sqlc.FinishJobParams{
+		Status:       string(status),
+		ErrorMessage: errorMessage,
+		FinishedAt:   time.Now().UTC().Unix(),
+		JobID:        int64(jobId),
+	})
+}
+
+// GetJob returns the job.
+// Returns sql.ErrNoRows if there is no such job.
+func (db *DB) GetJob(jobId domains.ID) (*domains.Job_t, error) {
+	row, err := db.q.GetJob(db.ctx, int64(jobId))
+	if err != nil {
+		return nil, err
+	}
+	return &domains.Job_t{
+		ID:           domains.ID(row.JobID),
+		UserID:       domains.ID(row.UserID),
+		Clan:         row.Clan,
+		TurnId:       row.TurnID,
+		Status:       domains.JobStatus(row.Status),
+		ErrorMessage: row.ErrorMessage,
+		StartedAt:    time.Unix(row.StartedAt, 0).UTC(),
+	}, nil
+}
+
+// ResetRunningJobs puts any job that was running when the server stopped back on the queue.
+func (db *DB) ResetRunningJobs() error {
+	return db.q.ResetRunningJobs(db.ctx)
+}
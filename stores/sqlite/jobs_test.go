@@ -0,0 +1,95 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package sqlite
+
+import (
+	"github.com/mdhender/ottoapp/domains"
+	"testing"
+	"time"
+)
+
+func TestJobs(t *testing.T) {
+	db := testDB(t)
+	user, err := db.CreateUser("clan0138@ottomap", "a-long-password", "0138", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := db.CreateUser("clan0200@ottomap", "a-long-password", "0200", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	createJob := func(user *domains.User_t, turnId string) domains.ID {
+		t.Helper()
+		id, err := db.CreateJob(user.ID, user.Clan, turnId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	claimJob := func(name string, want domains.ID) {
+		t.Helper()
+		job, err := db.ClaimNextJob()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		} else if want == 0 && job != nil {
+			t.Fatalf("%s: want nil, got job %d", name, job.ID)
+		} else if want != 0 && (job == nil || job.ID != want || job.Status != domains.JobRunning) {
+			t.Fatalf("%s: want job %d, got %+v", name, want, job)
+		}
+	}
+	checkJob := func(name string, id domains.ID, status domains.JobStatus, message string) {
+		t.Helper()
+		job, err := db.GetJob(id)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		} else if job.Status != status || job.ErrorMessage != message {
+			t.Errorf("%s: want %s %q, got %s %q", name, status, message, job.Status, job.ErrorMessage)
+		}
+	}
+
+	first := createJob(user, "0901-04")
+	if first == 0 {
+		t.Fatalf("create: want job id, got 0")
+	} else if id := createJob(user, "0901-04"); id != 0 {
+		t.Errorf("duplicate: want 0, got %d", id)
+	}
+	second := createJob(user, "0901-05")
+	third := createJob(other, "0901-04")
+	checkJob("queued", first, domains.JobQueued, "")
+
+	claimJob("oldest", first)
+	checkJob("claimed", first, domains.JobRunning, "")
+
+	// a job that has started is not a duplicate of a new upload
+	fourth := createJob(user, "0901-04")
+	if fourth == 0 {
+		t.Errorf("requeue while running: want job id, got 0")
+	}
+
+	// jobs for 0138 wait while it has a job running, so 0200 goes next
+	claimJob("skip running clan", third)
+	if err := db.FinishJob(third, domains.JobFailed, "render failed"); err != nil {
+		t.Fatal(err)
+	}
+	checkJob("failed", third, domains.JobFailed, "render failed")
+	claimJob("only the running clan is queued", 0)
+
+	// a restart puts the running job back on the queue
+	if err := db.ResetRunningJobs(); err != nil {
+		t.Fatal(err)
+	}
+	checkJob("reset", first, domains.JobQueued, "")
+	claimJob("after reset", first)
+
+	if err := db.FinishJob(first, domains.JobSucceeded, ""); err != nil {
+		t.Fatal(err)
+	}
+	checkJob("succeeded", first, domains.JobSucceeded, "")
+	claimJob("after finish", second)
+	if err := db.FinishJob(second, domains.JobSucceeded, ""); err != nil {
+		t.Fatal(err)
+	}
+	claimJob("last", fourth)
+	claimJob("empty", 0)
+}
@@ -0,0 +1,217 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/mdhender/ottoapp/domains"
+	"github.com/mdhender/ottoapp/stores/sqlite/sqlc"
+	"time"
+)
+
+// GetLoginFailure returns the failed sign in attempts for the scope and subject.
+// Returns a zero-value record if there have been no failures.
+func (db *DB) GetLoginFailure(scope, subject string) (*domains.LoginFailure_t, error) {
+	row, err := db.q.GetLoginFailure(db.ctx, sqlc.GetLoginFailureParams{
+		Scope:   scope,
+		Subject: subject,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return &domains.LoginFailure_t{Scope: scope, Subject: subject}, nil
+		}
+		return nil, err
+	}
+	return loginFailureFromRow(row), nil
+}
+
+// GetLoginFailures returns the subjects that have failed since the given time or are still locked.
+func (db *DB) GetLoginFailures(since time.Time) ([]*domains.LoginFailure_t, error) {
+	rows, err := db.q.GetLoginFailures(db.ctx, sqlc.GetLoginFailuresParams{
+		Since: since.UTC().Unix(),
+		Now:   time.Now().UTC().Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var list []*domains.LoginFailure_t
+	for _, row := range rows {
+		list = append(list, loginFailureFromRow(row))
+	}
+	return list, nil
+}
+
+// CountLoginAttempt counts a sign in attempt against each scope and subject before the password is checked.
+// The attempt counts as a failure until UncountLoginAttempt or DeleteLoginFailure takes it back.
+//
+// For each subject, the count is incremented in the database and apply sets the backoff and lockout
+// from the new count. If apply returns a lockout event, it is recorded. Everything happens in one
+// transaction, so attempts made at the same time are counted one after the other and can't pass
+// the check together.
+//
+// If any subject is locked or waiting out a backoff, nothing is counted and the current records
+// are returned with counted set to false. The caller must refuse the attempt.
+//
+// Subjects that haven't failed since staleBefore and are not locked are deleted.
+func (db *DB) CountLoginAttempt(subjects []*domains.LoginFailure_t, now, staleBefore time.Time, apply func(lf *domains.LoginFailure_t) *domains.LockoutEvent_t) (list []*domains.LoginFailure_t, counted bool, err error) {
+	tx, err := db.db.BeginTx(db.ctx, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	qtx := db.q.WithTx(tx)
+
+	for _, subject := range subjects {
+		row, err := qtx.CountLoginAttempt(db.ctx, sqlc.CountLoginAttemptParams{
+			Scope:       subject.Scope,
+			Subject:     subject.Subject,
+			Now:         now.UTC().Unix(),
+			StaleBefore: staleBefore.UTC().Unix(),
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			// refused, so don't count the attempt against the other subjects either
+			_ = tx.Rollback()
+			list = nil
+			for _, subject := range subjects {
+				lf, err := db.GetLoginFailure(subject.Scope, subject.Subject)
+				if err != nil {
+					return nil, false, err
+				}
+				list = append(list, lf)
+			}
+			return list, false, nil
+		} else if err != nil {
+			return nil, false, err
+		}
+
+		lf := loginFailureFromRow(row)
+		if event := apply(lf); event != nil {
+			err = qtx.CreateLockoutEvent(db.ctx, sqlc.CreateLockoutEventParams{
+				Scope:       event.Scope,
+				Subject:     event.Subject,
+				Clan:        event.Clan,
+				ClientIp:    event.ClientIP,
+				Failures:    int64(event.Failures),
+				CreatedAt:   event.CreatedAt.UTC().Unix(),
+				LockedUntil: event.LockedUntil.UTC().Unix(),
+			})
+			if err != nil {
+				return nil, false, err
+			}
+		}
+		err = qtx.UpdateLoginFailure(db.ctx, sqlc.UpdateLoginFailureParams{
+			Failures:    int64(lf.Failures),
+			Lockouts:    int64(lf.Lockouts),
+			LockedUntil: unixOrZero(lf.LockedUntil),
+			RetryAt:     unixOrZero(lf.RetryAt),
+			Scope:       lf.Scope,
+			Subject:     lf.Subject,
+		})
+		if err != nil {
+			return nil, false, err
+		}
+		list = append(list, lf)
+	}
+
+	err = qtx.DeleteStaleLoginFailures(db.ctx, sqlc.DeleteStaleLoginFailuresParams{
+		Before: staleBefore.UTC().Unix(),
+		Now:    now.UTC().Unix(),
+	})
+	if err != nil {
+		return nil, false, err
+	} else if err = tx.Commit(); err != nil {
+		return nil, false, err
+	}
+	return list, true, nil
+}
+
+// UncountLoginAttempt takes back an attempt for the scope and subject that turned out to be a successful sign in.
+func (db *DB) UncountLoginAttempt(scope, subject string) error {
+	return db.q.UncountLoginAttempt(db.ctx, sqlc.UncountLoginAttemptParams{
+		Scope:   scope,
+		Subject: subject,
+	})
+}
+
+// DeleteLoginFailure clears the failed attempts and any lock for the scope and subject.
+// Returns sql.ErrNoRows if there was nothing to clear.
+func (db *DB) DeleteLoginFailure(scope, subject string) error {
+	n, err := db.q.DeleteLoginFailure(db.ctx, sqlc.DeleteLoginFailureParams{
+		Scope:   scope,
+		Subject: subject,
+	})
+	if err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteAllLoginFailures clears all failed attempts and locks and returns the number cleared.
+func (db *DB) DeleteAllLoginFailures() (int, error) {
+	n, err := db.q.DeleteAllLoginFailures(db.ctx)
+	return int(n), err
+}
+
+// CreateLockoutEvent records a lockout.
+func (db *DB) CreateLockoutEvent(event domains.LockoutEvent_t) error {
+	return db.q.CreateLockoutEvent(db.ctx, sqlc.CreateLockoutEventParams{
+		Scope:       event.Scope,
+		Subject:     event.Subject,
+		Clan:        event.Clan,
+		ClientIp:    event.ClientIP,
+		Failures:    int64(event.Failures),
+		CreatedAt:   event.CreatedAt.UTC().Unix(),
+		LockedUntil: event.LockedUntil.UTC().Unix(),
+	})
+}
+
+// GetRecentLockoutEvents returns the most recent lockouts, newest first.
+func (db *DB) GetRecentLockoutEvents(limit int) ([]*domains.LockoutEvent_t, error) {
+	rows, err := db.q.GetRecentLockoutEvents(db.ctx, int64(limit))
+	if err != nil {
+		return nil, err
+	}
+	var list []*domains.LockoutEvent_t
+	for _, row := range rows {
+		list = append(list, &domains.LockoutEvent_t{
+			Scope:       row.Scope,
+			Subject:     row.Subject,
+			Clan:        row.Clan,
+			ClientIP:    row.ClientIp,
+			Failures:    int(row.Failures),
+			CreatedAt:   time.Unix(row.CreatedAt, 0).UTC(),
+			LockedUntil: time.Unix(row.LockedUntil, 0).UTC(),
+		})
+	}
+	return list, nil
+}
+
+func loginFailureFromRow(row sqlc.LoginFailure) *domains.LoginFailure_t {
+	lf := &domains.LoginFailure_t{
+		Scope:         row.Scope,
+		Subject:       row.Subject,
+		Failures:      int(row.Failures),
+		Lockouts:      int(row.Lockouts),
+		LastFailureAt: time.Unix(row.LastFailureAt, 0).UTC(),
+	}
+	if row.LockedUntil != 0 {
+		lf.LockedUntil = time.Unix(row.LockedUntil, 0).UTC()
+	}
+	if row.RetryAt != 0 {
+		lf.RetryAt = time.Unix(row.RetryAt, 0).UTC()
+	}
+	return lf
+}
+
+// unixOrZero returns the time in unix seconds, or 0 for the zero time.
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UTC().Unix()
+}
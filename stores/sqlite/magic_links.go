@@ -0,0 +1,118 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package sqlite
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/mdhender/ottoapp/domains"
+	"github.com/mdhender/ottoapp/stores/sqlite/sqlc"
+	"time"
+)
+
+// CreateMagicLink creates a single-use login link for the user and returns the token.
+// Only the hash of the token is saved, so the caller must show the token to the
+// administrator now; it can't be recovered later.
+// createdBy is the administrator creating the link, or 0 for the command line.
+func (db *DB) CreateMagicLink(userId, createdBy domains.ID, ttl time.Duration) (string, time.Time, error) {
+	now := time.Now().UTC()
+	token, expiresAt := uuid.NewString(), now.Add(ttl)
+	err := db.q.CreateMagicLink(db.ctx, sqlc.CreateMagicLinkParams{
+		LinkHash:  hashToken(token),
+		UserID:    int64(userId),
+		CreatedBy: int64(createdBy),
+		CreatedAt: now.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+// GetRecentMagicLinks returns the most recently created links, newest first.
+func (db *DB) GetRecentMagicLinks(limit int) ([]*domains.MagicLink_t, error) {
+	rows, err := db.q.GetRecentMagicLinks(db.ctx, int64(limit))
+	if err != nil {
+		return nil, err
+	}
+	var list []*domains.MagicLink_t
+	for _, row := range rows {
+		link := &domains.MagicLink_t{
+			Clan:          row.Clan,
+			CreatedAt:     time.Unix(row.CreatedAt, 0).UTC(),
+			ExpiresAt:     time.Unix(row.ExpiresAt, 0).UTC(),
+			UsedUserAgent: row.UsedUserAgent,
+		}
+		if row.UsedAt != 0 {
+			link.UsedAt = time.Unix(row.UsedAt, 0).UTC()
+		}
+		list = append(list, link)
+	}
+	return list, nil
+}
+
+// CheckMagicLink returns the user that the link logs in without using the link.
+// Returns ErrMagicLinkInvalid, ErrMagicLinkExpired, or ErrMagicLinkUsed if it can't be redeemed.
+func (db *DB) CheckMagicLink(clan, token string) (*domains.User_t, error) {
+	row, err := db.q.GetMagicLink(db.ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domains.ErrMagicLinkInvalid
+		}
+		return nil, err
+	} else if row.Clan != clan {
+		return nil, domains.ErrMagicLinkInvalid
+	} else if row.UsedAt != 0 {
+		return nil, domains.ErrMagicLinkUsed
+	} else if !time.Now().Before(time.Unix(row.ExpiresAt, 0)) {
+		return nil, domains.ErrMagicLinkExpired
+	}
+	user, err := db.GetUser(domains.ID(row.UserID))
+	if err != nil {
+		return nil, err
+	} else if !user.Roles.IsActive {
+		return nil, domains.ErrMagicLinkInvalid
+	}
+	return user, nil
+}
+
+// RedeemMagicLink marks the link as used and returns the user that it logs in.
+// The link must belong to the clan and must not be expired or already used.
+// Returns ErrMagicLinkInvalid, ErrMagicLinkExpired, or ErrMagicLinkUsed if it can't be redeemed.
+func (db *DB) RedeemMagicLink(clan, token, userAgent string) (*domains.User_t, error) {
+	user, err := db.CheckMagicLink(clan, token)
+	if err != nil {
+		return nil, err
+	}
+
+	// the update only succeeds once, even if the link is used twice at the same time
+	now := time.Now().UTC()
+	n, err := db.q.RedeemMagicLink(db.ctx, sqlc.RedeemMagicLinkParams{
+		UsedAt:        now.Unix(),
+		UsedUserAgent: userAgent,
+		LinkHash:      hashToken(token),
+	})
+	if err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, domains.ErrMagicLinkUsed
+	}
+
+	// update the last login time, ignoring any errors
+	_ = db.q.UpdateUserLastLogin(db.ctx, sqlc.UpdateUserLastLoginParams{
+		UserID:    int64(user.ID),
+		LastLogin: now.Unix(),
+	})
+
+	return user, nil
+}
+
+// hashToken returns the hash of a magic link or password reset token that is saved in the database.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
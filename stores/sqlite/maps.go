@@ -0,0 +1,83 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package sqlite
+
+import (
+	"github.com/mdhender/ottoapp/domains"
+	"github.com/mdhender/ottoapp/stores/sqlite/sqlc"
+	"time"
+)
+
+// CreateMapShare grants the grantee read access to the owner's map.
+func (db *DB) CreateMapShare(ownerId, granteeId domains.ID, mapId string) error {
+	return db.q.CreateMapShare(db.ctx, sqlc.CreateMapShareParams{
+		OwnerID:   int64(ownerId),
+		GranteeID: int64(granteeId),
+		MapID:     mapId,
+		CreatedAt: time.Now().UTC().Unix(),
+	})
+}
+
+// DeleteMapShare removes the share if the user is either the owner or the grantee.
+func (db *DB) DeleteMapShare(userId, shareId domains.ID) error {
+	return db.q.DeleteMapShare(db.ctx, sqlc.DeleteMapShareParams{
+		ShareID: int64(shareId),
+		UserID:  int64(userId),
+	})
+}
+
+// DeleteMapSharesByMap removes all the shares for one of the owner's maps.
+func (db *DB) DeleteMapSharesByMap(ownerId domains.ID, mapId string) error {
+	return db.q.DeleteMapSharesByMap(db.ctx, sqlc.DeleteMapSharesByMapParams{
+		OwnerID: int64(ownerId),
+		MapID:   mapId,
+	})
+}
+
+// GetMapSharesByOwner returns the maps that the owner has shared with other clans.
+func (db *DB) GetMapSharesByOwner(ownerId domains.ID) ([]*domains.MapShare_t, error) {
+	rows, err := db.q.GetMapSharesByOwner(db.ctx, int64(ownerId))
+	if err != nil {
+		return nil, err
+	}
+	var shares []*domains.MapShare_t
+	for _, row := range rows {
+		shares = append(shares, &domains.MapShare_t{
+			ID:          domains.ID(row.ShareID),
+			OwnerID:     ownerId,
+			GranteeClan: row.Clan,
+			MapId:       row.MapID,
+			CreatedAt:   time.Unix(row.CreatedAt, 0).UTC(),
+		})
+	}
+	return shares, nil
+}
+
+// GetMapSharesByGrantee returns the maps that other clans have shared with the grantee.
+func (db *DB) GetMapSharesByGrantee(granteeId domains.ID) ([]*domains.MapShare_t, error) {
+	rows, err := db.q.GetMapSharesByGrantee(db.ctx, int64(granteeId))
+	if err != nil {
+		return nil, err
+	}
+	var shares []*domains.MapShare_t
+	for _, row := range rows {
+		shares = append(shares, &domains.MapShare_t{
+			ID:        domains.ID(row.ShareID),
+			OwnerID:   domains.ID(row.OwnerID),
+			OwnerClan: row.Clan,
+			MapId:     row.MapID,
+			CreatedAt: time.Unix(row.CreatedAt, 0).UTC(),
+		})
+	}
+	return shares, nil
+}
+
+// GetMapShareOwner returns the owner of a map that has been shared with the grantee.
+// Returns sql.ErrNoRows if the map has not been shared with the grantee.
+func (db *DB) GetMapShareOwner(granteeId domains.ID, mapId string) (domains.ID, error) {
+	id, err := db.q.GetMapShareOwner(db.ctx, sqlc.GetMapShareOwnerParams{
+		GranteeID: int64(granteeId),
+		MapID:     mapId,
+	})
+	return domains.ID(id), err
+}
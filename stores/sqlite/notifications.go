@@ -0,0 +1,160 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/mdhender/ottoapp/domains"
+	"github.com/mdhender/ottoapp/stores/sqlite/sqlc"
+	"time"
+)
+
+// CreateNotification adds a message to the user's inbox.
+// If dedupeKey is not empty and has already been used for the user, nothing
+// is added and the returned id is zero.
+func (db *DB) CreateNotification(userId domains.ID, event domains.NotificationEvent, dedupeKey, title, message string, emailStatus domains.EmailStatus) (domains.ID, error) {
+	id, err := db.q.CreateNotification(db.ctx, sqlc.CreateNotificationParams{
+		UserID:      int64(userId),
+		Event:       string(event),
+		DedupeKey:   dedupeKey,
+		Title:       title,
+		Message:     message,
+		EmailStatus: string(emailStatus),
+		CreatedAt:   time.Now().UTC().Unix(),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return domains.ID(id), err
+}
+
+// GetUnreadNotifications returns the newest unread messages in the user's inbox.
+func (db *DB) GetUnreadNotifications(userId domains.ID, limit int) ([]*domains.Notification_t, error) {
+	rows, err := db.q.GetUnreadNotifications(db.ctx, sqlc.GetUnreadNotificationsParams{
+		UserID: int64(userId),
+		Limit:  int64(limit),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var list []*domains.Notification_t
+	for _, row := range rows {
+		list = append(list, &domains.Notification_t{
+			ID:        domains.ID(row.NotificationID),
+			Event:     domains.NotificationEvent(row.Event),
+			Title:     row.Title,
+			Message:   row.Message,
+			CreatedAt: time.Unix(row.CreatedAt, 0).UTC(),
+		})
+	}
+	return list, nil
+}
+
+// MarkNotificationsRead marks the user's messages with the given ids as read.
+func (db *DB) MarkNotificationsRead(userId domains.ID, ids []domains.ID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	params := sqlc.MarkNotificationsReadParams{UserID: int64(userId)}
+	for _, id := range ids {
+		params.Ids = append(params.Ids, int64(id))
+	}
+	return db.q.MarkNotificationsRead(db.ctx, params)
+}
+
+// GetPendingEmails returns the messages that are due to be e-mailed.
+func (db *DB) GetPendingEmails(limit int) ([]*domains.PendingEmail_t, error) {
+	rows, err := db.q.GetPendingEmails(db.ctx, sqlc.GetPendingEmailsParams{
+		Now:   time.Now().UTC().Unix(),
+		Limit: int64(limit),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var list []*domains.PendingEmail_t
+	for _, row := range rows {
+		list = append(list, &domains.PendingEmail_t{
+			ID:       domains.ID(row.NotificationID),
+			To:       row.Email,
+			Subject:  row.Title,
+			Body:     row.Message,
+			Attempts: int(row.EmailAttempts),
+		})
+	}
+	return list, nil
+}
+
+// UpdateEmailStatus records the outcome of an attempt to e-mail a message.
+// The zero time for nextTry means the message will not be retried.
+func (db *DB) UpdateEmailStatus(id domains.ID, status domains.EmailStatus, attempts int, emailError string, nextTry time.Time) error {
+	var next int64
+	if !nextTry.IsZero() {
+		next = nextTry.UTC().Unix()
+	}
+	return db.q.UpdateEmailStatus(db.ctx, sqlc.UpdateEmailStatusParams{
+		EmailStatus:    string(status),
+		EmailAttempts:  int64(attempts),
+		EmailError:     emailError,
+		EmailNextTry:   next,
+		NotificationID: int64(id),
+	})
+}
+
+// GetNotificationSettings returns the events that the user has opted in to.
+func (db *DB) GetNotificationSettings(userId domains.ID) (domains.NotificationSettings_t, error) {
+	row, err := db.q.GetNotificationSettings(db.ctx, int64(userId))
+	if err != nil {
+		return domains.NotificationSettings_t{}, err
+	}
+	return domains.NotificationSettings_t{
+		UploadAccepted: row.NotifyUploadAccepted == 1,
+		MapRendered:    row.NotifyMapRendered == 1,
+		RenderFailed:   row.NotifyRenderFailed == 1,
+		OrdersDue:      row.NotifyOrdersDue == 1,
+		ByEmail:        row.NotifyByEmail == 1,
+	}, nil
+}
+
+// UpdateNotificationSettings saves the events that the user has opted in to.
+func (db *DB) UpdateNotificationSettings(userId domains.ID, settings domains.NotificationSettings_t) error {
+	flag := func(b bool) int64 {
+		if b {
+			return 1
+		}
+		return 0
+	}
+	return db.q.UpdateNotificationSettings(db.ctx, sqlc.UpdateNotificationSettingsParams{
+		NotifyUploadAccepted: flag(settings.UploadAccepted),
+		NotifyMapRendered:    flag(settings.MapRendered),
+		NotifyRenderFailed:   flag(settings.RenderFailed),
+		NotifyOrdersDue:      flag(settings.OrdersDue),
+		NotifyByEmail:        flag(settings.ByEmail),
+		UserID:               int64(userId),
+	})
+}
+
+// GetOrdersDueBetween returns the due dates between from and to, inclusive,
+// for users that want to be reminded when orders are due.
+func (db *DB) GetOrdersDueBetween(from, to time.Time) ([]*domains.OrdersDue_t, error) {
+	rows, err := db.q.GetOrdersDueBetween(db.ctx, sqlc.GetOrdersDueBetweenParams{
+		FromDate: from.Format(time.DateOnly),
+		ToDate:   to.Format(time.DateOnly),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var list []*domains.OrdersDue_t
+	for _, row := range rows {
+		due, err := time.Parse(time.DateOnly, row.DueDate)
+		if err != nil {
+			continue
+		}
+		list = append(list, &domains.OrdersDue_t{
+			UserID:     domains.ID(row.UserID),
+			NextTurnId: row.NextTurnID,
+			Due:        due,
+		})
+	}
+	return list, nil
+}
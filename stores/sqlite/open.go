@@ -36,7 +36,9 @@ func Open(path string, ctx context.Context) (*DB, error) {
 		return nil, domains.ErrInvalidPath
 	}
 	log.Printf("[sqldb] opening %s\n", path)
-	db, err := sql.Open("sqlite", path)
+	// the render workers share the database with the web handlers, so wait
+	// on locks rather than failing immediately with SQLITE_BUSY.
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)")
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,113 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/mdhender/ottoapp/domains"
+	"github.com/mdhender/ottoapp/stores/sqlite/sqlc"
+	"time"
+)
+
+// CountPasswordResetsSince returns the number of reset tokens created for the user since the given time.
+func (db *DB) CountPasswordResetsSince(userId domains.ID, since time.Time) (int, error) {
+	n, err := db.q.CountPasswordResetsSince(db.ctx, sqlc.CountPasswordResetsSinceParams{
+		UserID: int64(userId),
+		Since:  since.UTC().Unix(),
+	})
+	return int(n), err
+}
+
+// CreatePasswordReset creates a password reset token for the user and returns it.
+// Only the hash of the token is saved, so the token must be sent to the user now.
+func (db *DB) CreatePasswordReset(userId domains.ID, ttl time.Duration) (string, time.Time, error) {
+	now := time.Now().UTC()
+	token, expiresAt := uuid.NewString(), now.Add(ttl)
+	err := db.q.CreatePasswordReset(db.ctx, sqlc.CreatePasswordResetParams{
+		TokenHash: hashToken(token),
+		UserID:    int64(userId),
+		CreatedAt: now.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+// CheckPasswordReset returns the user that the token resets.
+// Returns ErrPasswordResetInvalid, ErrPasswordResetExpired, or ErrPasswordResetUsed if the token can't be used.
+func (db *DB) CheckPasswordReset(clan, token string) (domains.ID, error) {
+	row, err := db.q.GetPasswordReset(db.ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, domains.ErrPasswordResetInvalid
+		}
+		return 0, err
+	} else if row.Clan != clan {
+		return 0, domains.ErrPasswordResetInvalid
+	} else if row.UsedAt != 0 {
+		return 0, domains.ErrPasswordResetUsed
+	} else if !time.Now().Before(time.Unix(row.ExpiresAt, 0)) {
+		return 0, domains.ErrPasswordResetExpired
+	}
+	user, err := db.GetUser(domains.ID(row.UserID))
+	if err != nil {
+		return 0, err
+	} else if !user.Roles.IsActive {
+		return 0, domains.ErrPasswordResetInvalid
+	}
+	return user.ID, nil
+}
+
+// ResetPassword uses the token to set a new password for the user.
+// The token is marked as used, the user's other tokens are deleted, and all
+// of the user's sessions are deleted so that they must sign in again.
+func (db *DB) ResetPassword(clan, token, plainTextSecret string) (domains.ID, error) {
+	userId, err := db.CheckPasswordReset(clan, token)
+	if err != nil {
+		return 0, err
+	}
+
+	// hash the password. can fail if the password is too long.
+	hashedPassword, err := HashPassword(plainTextSecret)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := db.db.BeginTx(db.ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	qtx := db.q.WithTx(tx)
+
+	// the update only succeeds once, even if the token is used twice at the same time
+	n, err := qtx.UsePasswordReset(db.ctx, sqlc.UsePasswordResetParams{
+		UsedAt:    time.Now().UTC().Unix(),
+		TokenHash: hashToken(token),
+	})
+	if err != nil {
+		return 0, err
+	} else if n == 0 {
+		return 0, domains.ErrPasswordResetUsed
+	}
+	err = qtx.UpdateUserPassword(db.ctx, sqlc.UpdateUserPasswordParams{
+		UserID:         int64(userId),
+		HashedPassword: hashedPassword,
+		IsActive:       1,
+	})
+	if err != nil {
+		return 0, err
+	} else if err = qtx.DeleteUnusedPasswordResets(db.ctx, int64(userId)); err != nil {
+		return 0, err
+	} else if err = qtx.DeleteUserSessions(db.ctx, int64(userId)); err != nil {
+		return 0, err
+	}
+
+	return userId, tx.Commit()
+}
@@ -0,0 +1,144 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/mdhender/ottoapp/domains"
+	"github.com/mdhender/ottoapp/stores/sqlite/sqlc"
+	"log"
+	"time"
+)
+
+// Refresh tokens are used by the ottobe API. Each sign in starts a family of tokens,
+// and each refresh replaces the current token with a new one in the same family.
+// Only the hash of a token is saved, so tokens must be sent to the client when they are created.
+
+// CreateRefreshToken starts a new family of refresh tokens for the user.
+// It returns the first token in the family and the family id.
+func (db *DB) CreateRefreshToken(userId domains.ID, ttl time.Duration) (token, familyId string, expiresAt time.Time, err error) {
+	now := time.Now().UTC()
+
+	// this is a good time to clean up, ignoring any errors
+	_ = db.q.DeleteExpiredRefreshTokens(db.ctx, now.Unix())
+
+	token, familyId, expiresAt = uuid.NewString(), uuid.NewString(), now.Add(ttl)
+	err = db.q.CreateRefreshToken(db.ctx, sqlc.CreateRefreshTokenParams{
+		TokenHash: hashToken(token),
+		FamilyID:  familyId,
+		UserID:    int64(userId),
+		CreatedAt: now.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+	})
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	return token, familyId, expiresAt, nil
+}
+
+// RotateRefreshToken replaces the token with a new one in the same family.
+// Returns ErrRefreshTokenInvalid, ErrRefreshTokenExpired, or ErrRefreshTokenRevoked if the token can't be used.
+//
+// A token that has already been replaced should never be seen again. If it is, either
+// the client or an attacker has a copy, and we can't tell which, so the whole family
+// is revoked and ErrRefreshTokenReused is returned. The user must sign in again.
+func (db *DB) RotateRefreshToken(token string, ttl time.Duration) (userId domains.ID, newToken, familyId string, expiresAt time.Time, err error) {
+	row, err := db.q.GetRefreshToken(db.ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, "", "", time.Time{}, domains.ErrRefreshTokenInvalid
+		}
+		return 0, "", "", time.Time{}, err
+	} else if row.RevokedAt != 0 {
+		return 0, "", "", time.Time{}, domains.ErrRefreshTokenRevoked
+	} else if row.UsedAt != 0 {
+		return 0, "", "", time.Time{}, db.revokeReusedRefreshToken(row.FamilyID)
+	}
+	now := time.Now().UTC()
+	if !now.Before(time.Unix(row.ExpiresAt, 0)) {
+		return 0, "", "", time.Time{}, domains.ErrRefreshTokenExpired
+	}
+
+	tx, err := db.db.BeginTx(db.ctx, nil)
+	if err != nil {
+		return 0, "", "", time.Time{}, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	qtx := db.q.WithTx(tx)
+
+	// the update only succeeds once, even if the token is used twice at the same time
+	n, err := qtx.UseRefreshToken(db.ctx, sqlc.UseRefreshTokenParams{
+		UsedAt:    now.Unix(),
+		TokenHash: hashToken(token),
+	})
+	if err != nil {
+		return 0, "", "", time.Time{}, err
+	} else if n == 0 {
+		_ = tx.Rollback()
+		return 0, "", "", time.Time{}, db.revokeReusedRefreshToken(row.FamilyID)
+	}
+
+	newToken, expiresAt = uuid.NewString(), now.Add(ttl)
+	err = qtx.CreateRefreshToken(db.ctx, sqlc.CreateRefreshTokenParams{
+		TokenHash: hashToken(newToken),
+		FamilyID:  row.FamilyID,
+		UserID:    row.UserID,
+		CreatedAt: now.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+	})
+	if err != nil {
+		return 0, "", "", time.Time{}, err
+	} else if err = tx.Commit(); err != nil {
+		return 0, "", "", time.Time{}, err
+	}
+
+	return domains.ID(row.UserID), newToken, row.FamilyID, expiresAt, nil
+}
+
+// revokeReusedRefreshToken revokes the family of a token that was used twice.
+// It returns ErrRefreshTokenReused unless the family can't be revoked.
+func (db *DB) revokeReusedRefreshToken(familyId string) error {
+	log.Printf("db: refresh tokens: family %q: token reused: revoking family\n", familyId)
+	if err := db.RevokeRefreshTokenFamily(familyId); err != nil {
+		return err
+	}
+	return domains.ErrRefreshTokenReused
+}
+
+// RevokeRefreshToken revokes the family that the token belongs to.
+// It is used to sign out, so it returns ErrRefreshTokenInvalid if the token doesn't exist.
+func (db *DB) RevokeRefreshToken(token string) error {
+	row, err := db.q.GetRefreshToken(db.ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domains.ErrRefreshTokenInvalid
+		}
+		return err
+	}
+	return db.RevokeRefreshTokenFamily(row.FamilyID)
+}
+
+// RevokeRefreshTokenFamily revokes every token in the family.
+func (db *DB) RevokeRefreshTokenFamily(familyId string) error {
+	return db.q.RevokeRefreshTokenFamily(db.ctx, sqlc.RevokeRefreshTokenFamilyParams{
+		RevokedAt: time.Now().UTC().Unix(),
+		FamilyID:  familyId,
+	})
+}
+
+// IsRefreshTokenFamilyActive returns true if the family has a token that has not been revoked or expired.
+// Access tokens carry the family id, so this is how a revoked sign in is rejected before its access token expires.
+func (db *DB) IsRefreshTokenFamilyActive(familyId string) (bool, error) {
+	n, err := db.q.CountLiveRefreshTokens(db.ctx, sqlc.CountLiveRefreshTokensParams{
+		FamilyID: familyId,
+		Now:      time.Now().UTC().Unix(),
+	})
+	if err != nil {
+		return false, err
+	}
+	return n != 0, nil
+}
@@ -3,7 +3,9 @@
 package sqlite
 
 import (
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"errors"
 	"github.com/google/uuid"
 	"github.com/mdhender/ottoapp/domains"
@@ -11,44 +13,158 @@ import (
 	"time"
 )
 
-func (db *DB) CreateSession(userId domains.ID, ttl time.Duration) (string, error) {
-	err := db.q.DeleteUserSessions(db.ctx, int64(userId))
+// lastSeenInterval limits how often GetSession updates the session's last seen time.
+// Without it, every request would write to the database.
+const lastSeenInterval = 5 * time.Minute
+
+// CreateSession creates a new session for the user.
+// Users may have several sessions at once, one for each browser or device.
+// If the user has more than maxSessions sessions, the oldest are deleted.
+func (db *DB) CreateSession(userId domains.ID, ttl time.Duration, userAgent string, maxSessions int) (string, error) {
+	now := time.Now().UTC()
+
+	// take the opportunity to clean up sessions that are no longer valid
+	err := db.q.DeleteExpiredSessions(db.ctx, now.Unix())
 	if err != nil {
 		return "", err
 	}
 
 	sessionId := uuid.NewString()
 	err = db.q.CreateUserSession(db.ctx, sqlc.CreateUserSessionParams{
-		SessID:    sessionId,
-		UserID:    int64(userId),
-		ExpiresAt: time.Now().Add(ttl).UTC().Unix(),
+		SessID:     sessionId,
+		UserID:     int64(userId),
+		ExpiresAt:  now.Add(ttl).Unix(),
+		UserAgent:  userAgent,
+		LastSeenAt: now.Unix(),
 	})
 	if err != nil {
 		return "", err
 	}
 
+	// evict the oldest sessions. the new session is the newest, so it is always kept.
+	if maxSessions > 0 {
+		err = db.q.DeleteOldestUserSessions(db.ctx, sqlc.DeleteOldestUserSessionsParams{
+			UserID: int64(userId),
+			Keep:   int64(maxSessions),
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+
 	return sessionId, nil
 }
 
+// DeleteOtherUserSessions deletes all the user's sessions except the current one.
+func (db *DB) DeleteOtherUserSessions(userId domains.ID, currentId string) error {
+	return db.q.DeleteOtherUserSessions(db.ctx, sqlc.DeleteOtherUserSessionsParams{
+		UserID: int64(userId),
+		SessID: currentId,
+	})
+}
+
+// DeleteSession deletes the user's session with the given id.
+func (db *DB) DeleteSession(userId domains.ID, id string) error {
+	return db.q.DeleteUserSession(db.ctx, sqlc.DeleteUserSessionParams{
+		SessID: id,
+		UserID: int64(userId),
+	})
+}
+
+// DeleteUserSessionByKey deletes the user's session with the given key.
+// It returns sql.ErrNoRows if the user doesn't have a session with that key.
+func (db *DB) DeleteUserSessionByKey(userId domains.ID, key string) error {
+	rows, err := db.q.GetUserSessions(db.ctx, sqlc.GetUserSessionsParams{
+		UserID: int64(userId),
+		Dttm:   time.Now().UTC().Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if sessionKey(row.SessID) == key {
+			return db.DeleteSession(userId, row.SessID)
+		}
+	}
+	return sql.ErrNoRows
+}
+
 func (db *DB) DeleteUserSessions(userId domains.ID) error {
 	return db.q.DeleteUserSessions(db.ctx, int64(userId))
 }
 
-func (db *DB) GetSession(id string) (*domains.User_t, error) {
+// GetSession returns the user for the session, or nil if there is no session.
+// viewAs is the clan that an operator is viewing with the session, or empty.
+func (db *DB) GetSession(id string) (user *domains.User_t, viewAs string, err error) {
 	row, err := db.q.GetSession(db.ctx, id)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, nil
+			return nil, "", nil
 		}
-		return nil, err
+		return nil, "", err
 	}
 	expiresAt := time.Unix(row.ExpiresAt, 0)
 	//log.Printf("sessions: %s: expires at %v\n", id, expiresAt)
 	//db.q.DeleteExpiredSessions(db.ctx, time.Now().UTC().Unix())
 	if !time.Now().Before(expiresAt) {
 		// session expired, should delete it
-		return nil, db.q.DeleteExpiredSessions(db.ctx, time.Now().UTC().Unix())
+		return nil, "", db.q.DeleteExpiredSessions(db.ctx, time.Now().UTC().Unix())
+	}
+
+	// update the last seen time, ignoring any errors
+	if now := time.Now().UTC(); now.Sub(time.Unix(row.LastSeenAt, 0)) >= lastSeenInterval {
+		_ = db.q.UpdateSessionLastSeen(db.ctx, sqlc.UpdateSessionLastSeenParams{
+			LastSeenAt: now.Unix(),
+			SessID:     id,
+		})
+	}
+
+	user, err = db.GetUser(domains.ID(row.UserID))
+	if err != nil {
+		return nil, "", err
+	}
+	return user, row.ViewAs, nil
+}
+
+// GetUserSessions returns the user's sessions that have not expired, newest first.
+// The session with currentId is flagged as the current session.
+func (db *DB) GetUserSessions(userId domains.ID, currentId string) ([]*domains.Session_t, error) {
+	rows, err := db.q.GetUserSessions(db.ctx, sqlc.GetUserSessionsParams{
+		UserID: int64(userId),
+		Dttm:   time.Now().UTC().Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var list []*domains.Session_t
+	for _, row := range rows {
+		session := &domains.Session_t{
+			Id:        row.SessID,
+			Key:       sessionKey(row.SessID),
+			Current:   row.SessID == currentId,
+			UserAgent: row.UserAgent,
+			CreatedAt: row.CreatedAt.UTC(),
+			ExpiresAt: time.Unix(row.ExpiresAt, 0).UTC(),
+			LastSeen:  time.Unix(row.LastSeenAt, 0).UTC(),
+		}
+		session.UserId = userId
+		list = append(list, session)
 	}
+	return list, nil
+}
+
+// UpdateSessionViewAs sets the clan that an operator is viewing with the session.
+// An empty clan stops viewing.
+func (db *DB) UpdateSessionViewAs(id, clan string) error {
+	return db.q.UpdateSessionViewAs(db.ctx, sqlc.UpdateSessionViewAsParams{
+		ViewAs: clan,
+		SessID: id,
+	})
+}
 
-	return db.GetUser(domains.ID(row.UserID))
+// sessionKey returns a handle for the session that can be shown to the user.
+// The session id is a bearer token, so it must never be sent back to the browser.
+func sessionKey(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:8])
 }
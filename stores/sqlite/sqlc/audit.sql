@@ -0,0 +1,27 @@
+--  Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+-- CreateAuditEvent records an event.
+--
+-- name: CreateAuditEvent :exec
+INSERT INTO audit_events (created_at, actor, action, target, client_ip, detail)
+VALUES (:created_at, :actor, :action, :target, :client_ip, :detail);
+
+-- GetAuditEvents returns the events in the time range, newest first.
+-- An empty actor or action matches every event. A negative limit returns all events.
+--
+-- name: GetAuditEvents :many
+SELECT event_id, created_at, actor, action, target, client_ip, detail
+FROM audit_events
+WHERE created_at >= :since
+  AND created_at < :until
+  AND (:actor = '' OR actor = :actor)
+  AND (:action = '' OR action = :action)
+ORDER BY created_at DESC, event_id DESC
+LIMIT :limit;
+
+-- GetAuditActions returns the distinct actions that have been recorded.
+--
+-- name: GetAuditActions :many
+SELECT DISTINCT action
+FROM audit_events
+ORDER BY action;
@@ -74,6 +74,41 @@ FROM users
 WHERE is_active = 1
   AND user_id = :user_id;
 
+-- GetUserAccount returns the user with the given clan.
+-- Unlike GetUser, it returns users that are not active.
+--
+-- name: GetUserAccount :one
+SELECT user_id,
+       email,
+       timezone,
+       is_active,
+       is_administrator,
+       is_operator,
+       is_user,
+       clan,
+       created_at,
+       updated_at,
+       last_login
+FROM users
+WHERE clan = :clan;
+
+-- GetUserAccounts returns all users, including users that are not active, ordered by clan.
+--
+-- name: GetUserAccounts :many
+SELECT user_id,
+       email,
+       timezone,
+       is_active,
+       is_administrator,
+       is_operator,
+       is_user,
+       clan,
+       created_at,
+       updated_at,
+       last_login
+FROM users
+ORDER BY clan;
+
 -- GetUserByClan returns the user id for the given clan.
 -- Fails if the user is not active.
 --
@@ -168,6 +168,123 @@ func (q *Queries) GetUser(ctx context.Context, userID int64) (GetUserRow, error)
 	return i, err
 }
 
+const getUserAccount = `-- name: GetUserAccount :one
+SELECT user_id,
+       email,
+       timezone,
+       is_active,
+       is_administrator,
+       is_operator,
+       is_user,
+       clan,
+       created_at,
+       updated_at,
+       last_login
+FROM users
+WHERE clan = ?1
+`
+
+type GetUserAccountRow struct {
+	UserID          int64
+	Email           string
+	Timezone        string
+	IsActive        int64
+	IsAdministrator int64
+	IsOperator      int64
+	IsUser          int64
+	Clan            string
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	LastLogin       int64
+}
+
+// GetUserAccount returns the user with the given clan.
+// Unlike GetUser, it returns users that are not active.
+func (q *Queries) GetUserAccount(ctx context.Context, clan string) (GetUserAccountRow, error) {
+	row := q.db.QueryRowContext(ctx, getUserAccount, clan)
+	var i GetUserAccountRow
+	err := row.Scan(
+		&i.UserID,
+		&i.Email,
+		&i.Timezone,
+		&i.IsActive,
+		&i.IsAdministrator,
+		&i.IsOperator,
+		&i.IsUser,
+		&i.Clan,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.LastLogin,
+	)
+	return i, err
+}
+
+const getUserAccounts = `-- name: GetUserAccounts :many
+SELECT user_id,
+       email,
+       timezone,
+       is_active,
+       is_administrator,
+       is_operator,
+       is_user,
+       clan,
+       created_at,
+       updated_at,
+       last_login
+FROM users
+ORDER BY clan
+`
+
+type GetUserAccountsRow struct {
+	UserID          int64
+	Email           string
+	Timezone        string
+	IsActive        int64
+	IsAdministrator int64
+	IsOperator      int64
+	IsUser          int64
+	Clan            string
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	LastLogin       int64
+}
+
+// GetUserAccounts returns all users, including users that are not active, ordered by clan.
+func (q *Queries) GetUserAccounts(ctx context.Context) ([]GetUserAccountsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getUserAccounts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUserAccountsRow
+	for rows.Next() {
+		var i GetUserAccountsRow
+		if err := rows.Scan(
+			&i.UserID,
+			&i.Email,
+			&i.Timezone,
+			&i.IsActive,
+			&i.IsAdministrator,
+			&i.IsOperator,
+			&i.IsUser,
+			&i.Clan,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.LastLogin,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getUserByClan = `-- name: GetUserByClan :one
 SELECT user_id
 FROM users
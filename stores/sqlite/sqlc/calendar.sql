@@ -0,0 +1,46 @@
+--  Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+-- UpsertTurnDueDate saves the date that orders are due for the turn after turn_id.
+-- Uploading a new report for the turn replaces the date.
+--
+-- name: UpsertTurnDueDate :exec
+INSERT INTO turn_due_dates (user_id, turn_id, next_turn_id, due_date, updated_at)
+VALUES (:user_id, :turn_id, :next_turn_id, :due_date, :updated_at)
+ON CONFLICT (user_id, turn_id) DO UPDATE SET next_turn_id = excluded.next_turn_id,
+                                             due_date     = excluded.due_date,
+                                             updated_at   = excluded.updated_at;
+
+-- GetTurnDueDates returns the due dates for all of the user's turns.
+--
+-- name: GetTurnDueDates :many
+SELECT turn_id, next_turn_id, due_date
+FROM turn_due_dates
+WHERE user_id = :user_id
+ORDER BY turn_id;
+
+-- GetCalendarFeedToken returns the token for the user's calendar feed.
+--
+-- name: GetCalendarFeedToken :one
+SELECT token
+FROM calendar_feeds
+WHERE user_id = :user_id;
+
+-- GetCalendarFeedUser returns the user that owns the calendar feed.
+-- Feeds owned by inactive users are not returned.
+--
+-- name: GetCalendarFeedUser :one
+SELECT calendar_feeds.user_id
+FROM calendar_feeds,
+     users
+WHERE calendar_feeds.token = :token
+  AND users.user_id = calendar_feeds.user_id
+  AND users.is_active = 1;
+
+-- UpsertCalendarFeed creates the user's calendar feed, or replaces the token
+-- of an existing feed. Replacing the token breaks any existing subscriptions.
+--
+-- name: UpsertCalendarFeed :exec
+INSERT INTO calendar_feeds (user_id, token, created_at)
+VALUES (:user_id, :token, :created_at)
+ON CONFLICT (user_id) DO UPDATE SET token      = excluded.token,
+                                    created_at = excluded.created_at;
@@ -0,0 +1,62 @@
+--  Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+-- CreateJob queues a new render job for the given clan and turn.
+--
+-- name: CreateJob :one
+INSERT INTO jobs (user_id, clan, turn_id, status, queued_at)
+VALUES (:user_id, :clan, :turn_id, 'queued', :queued_at)
+RETURNING job_id;
+
+-- CountQueuedJobs returns the number of jobs that are waiting
+-- to run for the given clan and turn.
+--
+-- name: CountQueuedJobs :one
+SELECT COUNT(*)
+FROM jobs
+WHERE clan = :clan
+  AND turn_id = :turn_id
+  AND status = 'queued';
+
+-- ClaimNextJob marks the oldest queued job as running and returns it.
+-- Jobs for a clan that already has a running job are skipped so that
+-- two workers never render the same clan at the same time.
+-- Fails with no rows if there are no jobs that can be claimed.
+--
+-- name: ClaimNextJob :one
+UPDATE jobs
+SET status     = 'running',
+    started_at = :started_at
+WHERE job_id = (SELECT job_id
+                FROM jobs
+                WHERE status = 'queued'
+                  AND clan NOT IN (SELECT clan
+                                   FROM jobs
+                                   WHERE status = 'running')
+                ORDER BY job_id
+                LIMIT 1)
+RETURNING job_id, user_id, clan, turn_id;
+
+-- FinishJob records the final status of a job.
+--
+-- name: FinishJob :exec
+UPDATE jobs
+SET status        = :status,
+    error_message = :error_message,
+    finished_at   = :finished_at
+WHERE job_id = :job_id;
+
+-- GetJob returns the job.
+--
+-- name: GetJob :one
+SELECT job_id, user_id, clan, turn_id, status, error_message, queued_at, started_at, finished_at
+FROM jobs
+WHERE job_id = :job_id;
+
+-- ResetRunningJobs puts jobs that were running when the server
+-- stopped back on the queue.
+--
+-- name: ResetRunningJobs :exec
+UPDATE jobs
+SET status     = 'queued',
+    started_at = 0
+WHERE status = 'running';
@@ -0,0 +1,93 @@
+--  Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+-- GetLoginFailure returns the failed sign in attempts for the scope and subject.
+--
+-- name: GetLoginFailure :one
+SELECT scope, subject, failures, lockouts, last_failure_at, locked_until, retry_at
+FROM login_failures
+WHERE scope = :scope
+  AND subject = :subject;
+
+-- GetLoginFailures returns the subjects that have failed recently or are locked.
+-- Locked subjects are listed first.
+--
+-- name: GetLoginFailures :many
+SELECT scope, subject, failures, lockouts, last_failure_at, locked_until, retry_at
+FROM login_failures
+WHERE last_failure_at >= :since
+   OR locked_until > :now
+ORDER BY locked_until DESC, last_failure_at DESC;
+
+-- CountLoginAttempt counts a sign in attempt against the scope and subject.
+-- Failures and lockouts are forgotten if the subject hasn't failed since :stale_before.
+-- Nothing is counted, and no row is returned, if the subject is locked or waiting out a backoff.
+--
+-- name: CountLoginAttempt :one
+INSERT INTO login_failures (scope, subject, failures, lockouts, last_failure_at)
+VALUES (:scope, :subject, 1, 0, :now)
+ON CONFLICT (scope, subject) DO UPDATE SET failures        = CASE
+                                                               WHEN last_failure_at < :stale_before THEN 1
+                                                               ELSE failures + 1 END,
+                                          lockouts        = CASE
+                                                               WHEN last_failure_at < :stale_before THEN 0
+                                                               ELSE lockouts END,
+                                          last_failure_at = :now
+WHERE locked_until <= :now
+  AND retry_at <= :now
+RETURNING scope, subject, failures, lockouts, last_failure_at, locked_until, retry_at;
+
+-- UpdateLoginFailure sets the backoff and lockout for the scope and subject.
+--
+-- name: UpdateLoginFailure :exec
+UPDATE login_failures
+SET failures     = :failures,
+    lockouts     = :lockouts,
+    locked_until = :locked_until,
+    retry_at     = :retry_at
+WHERE scope = :scope
+  AND subject = :subject;
+
+-- UncountLoginAttempt takes back an attempt that turned out to be a successful sign in.
+--
+-- name: UncountLoginAttempt :exec
+UPDATE login_failures
+SET failures = failures - 1
+WHERE scope = :scope
+  AND subject = :subject
+  AND failures > 0;
+
+-- DeleteLoginFailure clears the failed sign in attempts and any lock for the scope and subject.
+--
+-- name: DeleteLoginFailure :execrows
+DELETE
+FROM login_failures
+WHERE scope = :scope
+  AND subject = :subject;
+
+-- DeleteAllLoginFailures clears all failed sign in attempts and locks.
+--
+-- name: DeleteAllLoginFailures :execrows
+DELETE
+FROM login_failures;
+
+-- DeleteStaleLoginFailures deletes subjects that haven't failed recently and are not locked.
+--
+-- name: DeleteStaleLoginFailures :exec
+DELETE
+FROM login_failures
+WHERE last_failure_at < :before
+  AND locked_until <= :now;
+
+-- CreateLockoutEvent records a lockout.
+--
+-- name: CreateLockoutEvent :exec
+INSERT INTO lockout_events (scope, subject, clan, client_ip, failures, created_at, locked_until)
+VALUES (:scope, :subject, :clan, :client_ip, :failures, :created_at, :locked_until);
+
+-- GetRecentLockoutEvents returns the most recent lockouts, newest first.
+--
+-- name: GetRecentLockoutEvents :many
+SELECT event_id, scope, subject, clan, client_ip, failures, created_at, locked_until
+FROM lockout_events
+ORDER BY created_at DESC, event_id DESC
+LIMIT :limit;
@@ -0,0 +1,44 @@
+--  Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+-- CreateMagicLink creates a single-use login link for the user.
+--
+-- name: CreateMagicLink :exec
+INSERT INTO magic_links (link_hash, user_id, created_by, created_at, expires_at)
+VALUES (:link_hash, :user_id, :created_by, :created_at, :expires_at);
+
+-- GetMagicLink returns the link with the given hash and the clan of the user that it logs in.
+--
+-- name: GetMagicLink :one
+SELECT magic_links.user_id,
+       users.clan,
+       magic_links.expires_at,
+       magic_links.used_at
+FROM magic_links,
+     users
+WHERE magic_links.link_hash = :link_hash
+  AND users.user_id = magic_links.user_id;
+
+-- GetRecentMagicLinks returns the most recently created links, newest first.
+--
+-- name: GetRecentMagicLinks :many
+SELECT users.clan,
+       magic_links.created_at,
+       magic_links.expires_at,
+       magic_links.used_at,
+       magic_links.used_user_agent
+FROM magic_links,
+     users
+WHERE users.user_id = magic_links.user_id
+ORDER BY magic_links.created_at DESC
+LIMIT :limit;
+
+-- RedeemMagicLink marks the link as used.
+-- Returns the number of rows updated, which is 0 if the link was already used or has expired.
+--
+-- name: RedeemMagicLink :execrows
+UPDATE magic_links
+SET used_at         = :used_at,
+    used_user_agent = :used_user_agent
+WHERE link_hash = :link_hash
+  AND used_at = 0
+  AND expires_at > :used_at;
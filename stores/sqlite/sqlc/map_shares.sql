@@ -0,0 +1,64 @@
+--  Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+-- CreateMapShare grants the grantee read access to the owner's map.
+-- Sharing a map that is already shared is not an error.
+--
+-- name: CreateMapShare :exec
+INSERT INTO map_shares (owner_id, grantee_id, map_id, created_at)
+VALUES (:owner_id, :grantee_id, :map_id, :created_at)
+ON CONFLICT (owner_id, grantee_id, map_id) DO NOTHING;
+
+-- DeleteMapShare removes a share. Either the owner or the grantee may remove it.
+--
+-- name: DeleteMapShare :exec
+DELETE
+FROM map_shares
+WHERE share_id = :share_id
+  AND (owner_id = :user_id OR grantee_id = :user_id);
+
+-- DeleteMapSharesByMap removes all the shares for one of the owner's maps.
+--
+-- name: DeleteMapSharesByMap :exec
+DELETE
+FROM map_shares
+WHERE owner_id = :owner_id
+  AND map_id = :map_id;
+
+-- GetMapSharesByOwner returns the maps that the owner has shared.
+--
+-- name: GetMapSharesByOwner :many
+SELECT map_shares.share_id,
+       map_shares.map_id,
+       users.clan,
+       map_shares.created_at
+FROM map_shares,
+     users
+WHERE map_shares.owner_id = :owner_id
+  AND users.user_id = map_shares.grantee_id
+ORDER BY map_shares.map_id DESC, users.clan;
+
+-- GetMapSharesByGrantee returns the maps that have been shared with the grantee.
+-- Maps owned by inactive users are not returned.
+--
+-- name: GetMapSharesByGrantee :many
+SELECT map_shares.share_id,
+       map_shares.owner_id,
+       map_shares.map_id,
+       users.clan,
+       map_shares.created_at
+FROM map_shares,
+     users
+WHERE map_shares.grantee_id = :grantee_id
+  AND users.user_id = map_shares.owner_id
+  AND users.is_active = 1
+ORDER BY map_shares.map_id DESC, users.clan;
+
+-- GetMapShareOwner returns the owner of a map that has been shared with the grantee.
+--
+-- name: GetMapShareOwner :one
+SELECT owner_id
+FROM map_shares
+WHERE grantee_id = :grantee_id
+  AND map_id = :map_id
+ORDER BY share_id
+LIMIT 1;
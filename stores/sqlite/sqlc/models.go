@@ -8,6 +8,106 @@ import (
 	"time"
 )
 
+type AuditEvent struct {
+	EventID   int64
+	CreatedAt int64
+	Actor     string
+	Action    string
+	Target    string
+	ClientIp  string
+	Detail    string
+}
+
+type CalendarFeed struct {
+	UserID    int64
+	Token     string
+	CreatedAt int64
+}
+
+type Job struct {
+	JobID        int64
+	UserID       int64
+	Clan         string
+	TurnID       string
+	Status       string
+	ErrorMessage string
+	QueuedAt     int64
+	StartedAt    int64
+	FinishedAt   int64
+}
+
+type LockoutEvent struct {
+	EventID     int64
+	Scope       string
+	Subject     string
+	Clan        string
+	ClientIp    string
+	Failures    int64
+	CreatedAt   int64
+	LockedUntil int64
+}
+
+type LoginFailure struct {
+	Scope         string
+	Subject       string
+	Failures      int64
+	Lockouts      int64
+	LastFailureAt int64
+	LockedUntil   int64
+	RetryAt       int64
+}
+
+type MagicLink struct {
+	LinkHash      string
+	UserID        int64
+	CreatedBy     int64
+	CreatedAt     int64
+	ExpiresAt     int64
+	UsedAt        int64
+	UsedUserAgent string
+}
+
+type MapShare struct {
+	ShareID   int64
+	OwnerID   int64
+	GranteeID int64
+	MapID     string
+	CreatedAt int64
+}
+
+type Notification struct {
+	NotificationID int64
+	UserID         int64
+	Event          string
+	DedupeKey      string
+	Title          string
+	Message        string
+	IsRead         int64
+	EmailStatus    string
+	EmailAttempts  int64
+	EmailError     string
+	CreatedAt      int64
+	EmailNextTry   int64
+}
+
+type PasswordReset struct {
+	TokenHash string
+	UserID    int64
+	CreatedAt int64
+	ExpiresAt int64
+	UsedAt    int64
+}
+
+type RefreshToken struct {
+	TokenHash string
+	FamilyID  string
+	UserID    int64
+	CreatedAt int64
+	ExpiresAt int64
+	UsedAt    int64
+	RevokedAt int64
+}
+
 type Server struct {
 	AssetsPath     string
 	ComponentsPath string
@@ -17,24 +117,56 @@ type Server struct {
 }
 
 type Session struct {
-	SessID    string
-	UserID    int64
-	ExpiresAt int64
-	CreatedAt time.Time
+	SessID     string
+	UserID     int64
+	ExpiresAt  int64
+	UserAgent  string
+	LastSeenAt int64
+	ViewAs     string
+	CreatedAt  time.Time
+}
+
+type TurnDueDate struct {
+	UserID     int64
+	TurnID     string
+	NextTurnID string
+	DueDate    string
+	UpdatedAt  int64
 }
 
 type User struct {
-	UserID          int64
-	Email           string
-	Timezone        string
-	IsActive        int64
-	HashedPassword  string
-	MagicLink       string
-	Clan            string
-	IsAdministrator int64
-	IsOperator      int64
-	IsUser          int64
-	LastLogin       int64
-	CreatedAt       time.Time
-	UpdatedAt       time.Time
+	UserID               int64
+	Email                string
+	Timezone             string
+	IsActive             int64
+	HashedPassword       string
+	MagicLink            string
+	Clan                 string
+	IsAdministrator      int64
+	IsOperator           int64
+	IsUser               int64
+	LastLogin            int64
+	NotifyUploadAccepted int64
+	NotifyMapRendered    int64
+	NotifyRenderFailed   int64
+	NotifyOrdersDue      int64
+	NotifyByEmail        int64
+	CreatedAt            time.Time
+	UpdatedAt            time.Time
+}
+
+type Upload struct {
+	UploadID     int64
+	UserID       int64
+	Clan         string
+	TurnID       string
+	FileName     string
+	Kind         string
+	ByteSize     int64
+	Checksum     string
+	ScrubOptions string
+	Succeeded    int64
+	Reason       string
+	Changes      string
+	UploadedAt   int64
 }
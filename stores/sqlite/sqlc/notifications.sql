@@ -0,0 +1,96 @@
+--  Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+-- CreateNotification adds a message to the user's inbox and returns its id.
+-- If the dedupe key has already been used for the user, nothing is added
+-- and no row is returned.
+--
+-- name: CreateNotification :one
+INSERT INTO notifications (user_id, event, dedupe_key, title, message, email_status, created_at)
+VALUES (:user_id, :event, :dedupe_key, :title, :message, :email_status, :created_at)
+ON CONFLICT DO NOTHING
+RETURNING notification_id;
+
+-- GetUnreadNotifications returns the newest unread messages in the user's inbox.
+--
+-- name: GetUnreadNotifications :many
+SELECT notification_id, event, title, message, created_at
+FROM notifications
+WHERE user_id = :user_id
+  AND is_read = 0
+ORDER BY notification_id DESC
+LIMIT :limit;
+
+-- MarkNotificationsRead marks the user's messages with the given ids as read.
+--
+-- name: MarkNotificationsRead :exec
+UPDATE notifications
+SET is_read = 1
+WHERE user_id = :user_id
+  AND notification_id IN (sqlc.slice(ids))
+  AND is_read = 0;
+
+-- GetPendingEmails returns the messages that are waiting to be e-mailed.
+-- Messages for inactive users are not returned.
+--
+-- name: GetPendingEmails :many
+SELECT notifications.notification_id,
+       users.email,
+       notifications.title,
+       notifications.message,
+       notifications.email_attempts
+FROM notifications,
+     users
+WHERE notifications.email_status = 'pending'
+  AND notifications.email_next_try <= :now
+  AND users.user_id = notifications.user_id
+  AND users.is_active = 1
+ORDER BY notifications.notification_id
+LIMIT :limit;
+
+-- UpdateEmailStatus records the outcome of an attempt to e-mail a message.
+--
+-- name: UpdateEmailStatus :exec
+UPDATE notifications
+SET email_status   = :email_status,
+    email_attempts = :email_attempts,
+    email_error    = :email_error,
+    email_next_try = :email_next_try
+WHERE notification_id = :notification_id;
+
+-- GetNotificationSettings returns the user's notification settings.
+--
+-- name: GetNotificationSettings :one
+SELECT notify_upload_accepted,
+       notify_map_rendered,
+       notify_render_failed,
+       notify_orders_due,
+       notify_by_email
+FROM users
+WHERE user_id = :user_id;
+
+-- UpdateNotificationSettings updates the user's notification settings.
+--
+-- name: UpdateNotificationSettings :exec
+UPDATE users
+SET notify_upload_accepted = :notify_upload_accepted,
+    notify_map_rendered    = :notify_map_rendered,
+    notify_render_failed   = :notify_render_failed,
+    notify_orders_due      = :notify_orders_due,
+    notify_by_email        = :notify_by_email,
+    updated_at             = CURRENT_TIMESTAMP
+WHERE user_id = :user_id;
+
+-- GetOrdersDueBetween returns the due dates between from_date and to_date,
+-- inclusive, for active users that want to be told when orders are due.
+--
+-- name: GetOrdersDueBetween :many
+SELECT turn_due_dates.user_id,
+       turn_due_dates.next_turn_id,
+       turn_due_dates.due_date
+FROM turn_due_dates,
+     users
+WHERE turn_due_dates.due_date BETWEEN :from_date AND :to_date
+  AND users.user_id = turn_due_dates.user_id
+  AND users.is_active = 1
+  AND users.notify_orders_due = 1
+ORDER BY turn_due_dates.due_date, turn_due_dates.user_id;
@@ -0,0 +1,45 @@
+--  Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+-- CreatePasswordReset creates a password reset token for the user.
+--
+-- name: CreatePasswordReset :exec
+INSERT INTO password_resets (token_hash, user_id, created_at, expires_at)
+VALUES (:token_hash, :user_id, :created_at, :expires_at);
+
+-- CountPasswordResetsSince returns the number of tokens created for the user since the given time.
+--
+-- name: CountPasswordResetsSince :one
+SELECT COUNT(*)
+FROM password_resets
+WHERE user_id = :user_id
+  AND created_at >= :since;
+
+-- GetPasswordReset returns the token with the given hash and the clan of the user that it resets.
+--
+-- name: GetPasswordReset :one
+SELECT password_resets.user_id,
+       users.clan,
+       password_resets.expires_at,
+       password_resets.used_at
+FROM password_resets,
+     users
+WHERE password_resets.token_hash = :token_hash
+  AND users.user_id = password_resets.user_id;
+
+-- UsePasswordReset marks the token as used.
+-- Returns the number of rows updated, which is 0 if the token was already used or has expired.
+--
+-- name: UsePasswordReset :execrows
+UPDATE password_resets
+SET used_at = :used_at
+WHERE token_hash = :token_hash
+  AND used_at = 0
+  AND expires_at > :used_at;
+
+-- DeleteUnusedPasswordResets deletes the user's tokens that have not been used.
+--
+-- name: DeleteUnusedPasswordResets :exec
+DELETE
+FROM password_resets
+WHERE user_id = :user_id
+  AND used_at = 0;
@@ -0,0 +1,52 @@
+--  Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+-- CreateRefreshToken creates a refresh token in the family.
+--
+-- name: CreateRefreshToken :exec
+INSERT INTO refresh_tokens (token_hash, family_id, user_id, created_at, expires_at)
+VALUES (:token_hash, :family_id, :user_id, :created_at, :expires_at);
+
+-- GetRefreshToken returns the token with the given hash.
+--
+-- name: GetRefreshToken :one
+SELECT family_id,
+       user_id,
+       expires_at,
+       used_at,
+       revoked_at
+FROM refresh_tokens
+WHERE token_hash = :token_hash;
+
+-- UseRefreshToken marks the token as replaced.
+-- Returns the number of rows updated, which is 0 if the token was already replaced or revoked.
+--
+-- name: UseRefreshToken :execrows
+UPDATE refresh_tokens
+SET used_at = :used_at
+WHERE token_hash = :token_hash
+  AND used_at = 0
+  AND revoked_at = 0;
+
+-- RevokeRefreshTokenFamily revokes every token in the family.
+--
+-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens
+SET revoked_at = :revoked_at
+WHERE family_id = :family_id
+  AND revoked_at = 0;
+
+-- CountLiveRefreshTokens returns the number of tokens in the family that have not been revoked or expired.
+--
+-- name: CountLiveRefreshTokens :one
+SELECT COUNT(*)
+FROM refresh_tokens
+WHERE family_id = :family_id
+  AND revoked_at = 0
+  AND expires_at > :now;
+
+-- DeleteExpiredRefreshTokens deletes the tokens that expired before the given time.
+--
+-- name: DeleteExpiredRefreshTokens :exec
+DELETE
+FROM refresh_tokens
+WHERE expires_at < :expires_at;
@@ -3,6 +3,18 @@
 -- foreign keys must be disabled to drop tables with foreign keys
 PRAGMA foreign_keys = OFF;
 
+DROP TABLE IF EXISTS audit_events;
+DROP TABLE IF EXISTS lockout_events;
+DROP TABLE IF EXISTS login_failures;
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS password_resets;
+DROP TABLE IF EXISTS magic_links;
+DROP TABLE IF EXISTS notifications;
+DROP TABLE IF EXISTS calendar_feeds;
+DROP TABLE IF EXISTS turn_due_dates;
+DROP TABLE IF EXISTS map_shares;
+DROP TABLE IF EXISTS jobs;
+DROP TABLE IF EXISTS uploads;
 DROP TABLE IF EXISTS sessions;
 DROP TABLE IF EXISTS server;
 DROP TABLE IF EXISTS users;
@@ -30,6 +42,14 @@ CREATE TABLE users
 
     last_login       INTEGER     NOT NULL,
 
+    -- columns for notification settings. each event must be opted in to.
+    notify_upload_accepted INTEGER NOT NULL DEFAULT 0,
+    notify_map_rendered    INTEGER NOT NULL DEFAULT 1,
+    notify_render_failed   INTEGER NOT NULL DEFAULT 1,
+    notify_orders_due      INTEGER NOT NULL DEFAULT 1,
+    -- if set, notifications are sent by e-mail as well as to the inbox
+    notify_by_email        INTEGER NOT NULL DEFAULT 0,
+
     -- columns for auditing
     created_at       TIMESTAMP   NOT NULL DEFAULT CURRENT_TIMESTAMP,
     updated_at       TIMESTAMP   NOT NULL DEFAULT CURRENT_TIMESTAMP
@@ -37,17 +57,23 @@ CREATE TABLE users
 
 CREATE TABLE sessions
 (
-    sess_id    TEXT           NOT NULL,
-    user_id    INTEGER UNIQUE NOT NULL,
-    expires_at INTEGER        NOT NULL,
+    sess_id      TEXT      NOT NULL,
+    user_id      INTEGER   NOT NULL,
+    expires_at   INTEGER   NOT NULL,
+    user_agent   TEXT      NOT NULL DEFAULT '',
+    last_seen_at INTEGER   NOT NULL DEFAULT 0,
+    -- clan that an operator is viewing in read-only mode, empty if none
+    view_as      TEXT      NOT NULL DEFAULT '',
 
     -- columns for auditing
-    created_at TIMESTAMP      NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_at   TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
 
     PRIMARY KEY (sess_id),
     FOREIGN KEY (user_id) REFERENCES users (user_id) ON DELETE CASCADE
 );
 
+CREATE INDEX sessions_user_ix ON sessions (user_id, created_at);
+
 CREATE TABLE server
 (
     assets_path     TEXT NOT NULL,
@@ -56,3 +82,250 @@ CREATE TABLE server
     userdata_path   TEXT NOT NULL,
     salt            TEXT NOT NULL
 );
+
+CREATE TABLE jobs
+(
+    job_id        INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id       INTEGER NOT NULL,
+    clan          TEXT    NOT NULL,
+    turn_id       TEXT    NOT NULL,
+
+    -- status is one of queued, running, succeeded, or failed
+    status        TEXT    NOT NULL DEFAULT 'queued',
+    error_message TEXT    NOT NULL DEFAULT '',
+
+    -- timestamps are unix seconds, zero if the event has not happened
+    queued_at     INTEGER NOT NULL,
+    started_at    INTEGER NOT NULL DEFAULT 0,
+    finished_at   INTEGER NOT NULL DEFAULT 0,
+
+    FOREIGN KEY (user_id) REFERENCES users (user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX jobs_status_ix ON jobs (status, job_id);
+
+CREATE TABLE uploads
+(
+    upload_id     INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id       INTEGER NOT NULL,
+    clan          TEXT    NOT NULL,
+    turn_id       TEXT    NOT NULL DEFAULT '',
+
+    -- the file name sent by the browser, empty for pasted text
+    file_name     TEXT    NOT NULL DEFAULT '',
+    -- kind is one of text, file, docx, or dropbox
+    kind          TEXT    NOT NULL,
+    byte_size     INTEGER NOT NULL DEFAULT 0,
+    -- hex encoded SHA-256 of the bytes that were received
+    checksum      TEXT    NOT NULL DEFAULT '',
+    -- comma separated list of the scrub options that were selected
+    scrub_options TEXT    NOT NULL DEFAULT '',
+
+    succeeded     INTEGER NOT NULL DEFAULT 0,
+    reason        TEXT    NOT NULL DEFAULT '',
+    -- semicolon separated list of the changes made while repairing the text
+    changes       TEXT    NOT NULL DEFAULT '',
+
+    -- unix seconds
+    uploaded_at   INTEGER NOT NULL,
+
+    FOREIGN KEY (user_id) REFERENCES users (user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX uploads_user_ix ON uploads (user_id, upload_id);
+
+CREATE TABLE map_shares
+(
+    share_id   INTEGER PRIMARY KEY AUTOINCREMENT,
+    -- the owner grants the grantee read access to one of the owner's maps
+    owner_id   INTEGER NOT NULL,
+    grantee_id INTEGER NOT NULL,
+    -- file name of the map, e.g. 0901-02.0138.wxx
+    map_id     TEXT    NOT NULL,
+
+    -- unix seconds
+    created_at INTEGER NOT NULL,
+
+    UNIQUE (owner_id, grantee_id, map_id),
+    FOREIGN KEY (owner_id) REFERENCES users (user_id) ON DELETE CASCADE,
+    FOREIGN KEY (grantee_id) REFERENCES users (user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX map_shares_grantee_ix ON map_shares (grantee_id, map_id);
+
+CREATE TABLE turn_due_dates
+(
+    user_id      INTEGER NOT NULL,
+    -- the turn that the report is for, e.g. 0901-02
+    turn_id      TEXT    NOT NULL,
+    -- the next turn and the date that its orders are due,
+    -- taken from the turn header of the report.
+    next_turn_id TEXT    NOT NULL,
+    -- YYYY-MM-DD, the date has no time or timezone
+    due_date     TEXT    NOT NULL,
+
+    -- unix seconds
+    updated_at   INTEGER NOT NULL,
+
+    PRIMARY KEY (user_id, turn_id),
+    FOREIGN KEY (user_id) REFERENCES users (user_id) ON DELETE CASCADE
+);
+
+CREATE TABLE calendar_feeds
+(
+    user_id    INTEGER PRIMARY KEY,
+    -- the token is the only thing that protects the feed,
+    -- so it must be hard to guess.
+    token      TEXT UNIQUE NOT NULL,
+
+    -- unix seconds
+    created_at INTEGER     NOT NULL,
+
+    FOREIGN KEY (user_id) REFERENCES users (user_id) ON DELETE CASCADE
+);
+
+CREATE TABLE notifications
+(
+    notification_id  INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id          INTEGER NOT NULL,
+    -- upload-accepted, map-rendered, render-failed, or orders-due
+    event            TEXT    NOT NULL,
+    -- optional key that keeps an event from being sent twice,
+    -- e.g. orders-due.0901-03. empty if the event can repeat.
+    dedupe_key       TEXT    NOT NULL DEFAULT '',
+    title            TEXT    NOT NULL,
+    message          TEXT    NOT NULL,
+    -- set when the message has been shown in the inbox
+    is_read          INTEGER NOT NULL DEFAULT 0,
+
+    -- e-mail delivery status is none, pending, sent, or failed
+    email_status     TEXT    NOT NULL DEFAULT 'none',
+    email_attempts   INTEGER NOT NULL DEFAULT 0,
+    email_error      TEXT    NOT NULL DEFAULT '',
+
+    -- unix seconds
+    created_at       INTEGER NOT NULL,
+    email_next_try   INTEGER NOT NULL DEFAULT 0,
+
+    FOREIGN KEY (user_id) REFERENCES users (user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX notifications_user_ix ON notifications (user_id, is_read);
+CREATE INDEX notifications_email_ix ON notifications (email_status, email_next_try);
+CREATE UNIQUE INDEX notifications_dedupe_ix ON notifications (user_id, dedupe_key) WHERE dedupe_key != '';
+
+CREATE TABLE magic_links
+(
+    -- sha256 of the token, the token itself is only shown when the link is created
+    link_hash       TEXT    NOT NULL,
+    user_id         INTEGER NOT NULL,
+    -- user id of the administrator that created the link, 0 if created from the command line
+    created_by      INTEGER NOT NULL DEFAULT 0,
+
+    -- unix seconds, used_at is 0 until the link is redeemed
+    created_at      INTEGER NOT NULL,
+    expires_at      INTEGER NOT NULL,
+    used_at         INTEGER NOT NULL DEFAULT 0,
+    used_user_agent TEXT    NOT NULL DEFAULT '',
+
+    PRIMARY KEY (link_hash),
+    FOREIGN KEY (user_id) REFERENCES users (user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX magic_links_created_ix ON magic_links (created_at);
+
+CREATE TABLE password_resets
+(
+    -- sha256 of the token, the token itself is only sent to the user
+    token_hash TEXT    NOT NULL,
+    user_id    INTEGER NOT NULL,
+
+    -- unix seconds, used_at is 0 until the token is used
+    created_at INTEGER NOT NULL,
+    expires_at INTEGER NOT NULL,
+    used_at    INTEGER NOT NULL DEFAULT 0,
+
+    PRIMARY KEY (token_hash),
+    FOREIGN KEY (user_id) REFERENCES users (user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX password_resets_user_ix ON password_resets (user_id, created_at);
+
+-- refresh_tokens are the ottobe API's refresh tokens.
+-- every sign in starts a family, and each refresh replaces the token with a new one
+-- in the same family. if a replaced token is used again, it has been stolen, so the
+-- whole family is revoked.
+CREATE TABLE refresh_tokens
+(
+    -- sha256 of the token, the token itself is only sent to the client
+    token_hash TEXT    NOT NULL,
+    family_id  TEXT    NOT NULL,
+    user_id    INTEGER NOT NULL,
+
+    -- unix seconds, used_at is 0 until the token is replaced,
+    -- and revoked_at is 0 until the family is revoked
+    created_at INTEGER NOT NULL,
+    expires_at INTEGER NOT NULL,
+    used_at    INTEGER NOT NULL DEFAULT 0,
+    revoked_at INTEGER NOT NULL DEFAULT 0,
+
+    PRIMARY KEY (token_hash),
+    FOREIGN KEY (user_id) REFERENCES users (user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX refresh_tokens_family_ix ON refresh_tokens (family_id);
+CREATE INDEX refresh_tokens_expires_ix ON refresh_tokens (expires_at);
+
+-- login_failures tracks failed sign in attempts.
+-- scope is 'clan' or 'ip' and subject is the clan id or the client address.
+CREATE TABLE login_failures
+(
+    scope           TEXT    NOT NULL,
+    subject         TEXT    NOT NULL,
+    failures        INTEGER NOT NULL DEFAULT 0,
+    lockouts        INTEGER NOT NULL DEFAULT 0,
+
+    -- unix seconds, locked_until is 0 if the subject has never been locked,
+    -- and retry_at is when the backoff from the last failure ends
+    last_failure_at INTEGER NOT NULL,
+    locked_until    INTEGER NOT NULL DEFAULT 0,
+    retry_at        INTEGER NOT NULL DEFAULT 0,
+
+    PRIMARY KEY (scope, subject)
+);
+
+-- lockout_events is the history of lockouts so that administrators can see attacks.
+CREATE TABLE lockout_events
+(
+    event_id     INTEGER PRIMARY KEY AUTOINCREMENT,
+    scope        TEXT    NOT NULL,
+    subject      TEXT    NOT NULL,
+
+    -- the clan and address of the attempt that caused the lockout
+    clan         TEXT    NOT NULL,
+    client_ip    TEXT    NOT NULL,
+    failures     INTEGER NOT NULL,
+
+    -- unix seconds
+    created_at   INTEGER NOT NULL,
+    locked_until INTEGER NOT NULL
+);
+
+CREATE INDEX lockout_events_created_ix ON lockout_events (created_at);
+
+-- audit_events is a durable record of security and data events.
+-- rows are never updated. actor is the clan id of the user, or the clan that
+-- a failed sign in was for, or 'cli' for the command line.
+CREATE TABLE audit_events
+(
+    event_id   INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at INTEGER NOT NULL, -- unix seconds
+    actor      TEXT    NOT NULL,
+    action     TEXT    NOT NULL,
+    target     TEXT    NOT NULL, -- request path
+    client_ip  TEXT    NOT NULL,
+    detail     TEXT    NOT NULL DEFAULT ''
+);
+
+CREATE INDEX audit_events_created_ix ON audit_events (created_at);
+CREATE INDEX audit_events_actor_ix ON audit_events (actor, created_at);
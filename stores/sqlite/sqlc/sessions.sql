@@ -5,26 +5,85 @@
 --
 -- name: GetSession :one
 SELECT user_id,
-       expires_at
+       expires_at,
+       last_seen_at,
+       view_as
 FROM sessions
 WHERE sess_id = :session_id;
 
+-- GetUserSessions returns the sessions for the given user id that have not expired.
+--
+-- name: GetUserSessions :many
+SELECT sess_id,
+       user_agent,
+       created_at,
+       expires_at,
+       last_seen_at
+FROM sessions
+WHERE user_id = :user_id
+  AND expires_at > :dttm
+ORDER BY created_at DESC, sess_id;
+
 -- CreateUserSession creates a new session for the given user id.
 --
 -- name: CreateUserSession :exec
-INSERT INTO sessions (sess_id, user_id, expires_at)
-VALUES (:sess_id, :user_id, :expires_at);
+INSERT INTO sessions (sess_id, user_id, expires_at, user_agent, last_seen_at)
+VALUES (:sess_id, :user_id, :expires_at, :user_agent, :last_seen_at);
+
+-- UpdateSessionLastSeen updates the time that the session was last used.
+--
+-- name: UpdateSessionLastSeen :exec
+UPDATE sessions
+SET last_seen_at = :last_seen_at
+WHERE sess_id = :sess_id;
+
+-- UpdateSessionViewAs sets the clan that an operator is viewing.
+-- An empty clan returns the session to the operator's own clan.
+--
+-- name: UpdateSessionViewAs :exec
+UPDATE sessions
+SET view_as = :view_as
+WHERE sess_id = :sess_id;
 
 -- DeleteExpiredSessions deletes all expired sessions.
 --
 -- name: DeleteExpiredSessions :exec
 DELETE
 FROM sessions
-WHERE expires_at >= :dttm;
+WHERE expires_at < :dttm;
+
+-- DeleteOldestUserSessions deletes the oldest sessions for the given user id,
+-- keeping only the newest sessions.
+--
+-- name: DeleteOldestUserSessions :exec
+DELETE
+FROM sessions
+WHERE user_id = :user_id
+  AND sess_id NOT IN (SELECT sess_id
+                      FROM sessions
+                      WHERE user_id = :user_id
+                      ORDER BY created_at DESC, rowid DESC
+                      LIMIT :keep);
 
 -- DeleteUserSessions deletes all sessions for the given user id.
 --
 -- name: DeleteUserSessions :exec
 DELETE
 FROM sessions
-WHERE user_id = :user_id;
\ No newline at end of file
+WHERE user_id = :user_id;
+
+-- DeleteUserSession deletes a single session for the given user id.
+--
+-- name: DeleteUserSession :exec
+DELETE
+FROM sessions
+WHERE sess_id = :sess_id
+  AND user_id = :user_id;
+
+-- DeleteOtherUserSessions deletes all sessions for the given user id except the given session.
+--
+-- name: DeleteOtherUserSessions :exec
+DELETE
+FROM sessions
+WHERE user_id = :user_id
+  AND sess_id != :sess_id;
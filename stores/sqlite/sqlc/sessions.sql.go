@@ -7,29 +7,38 @@ package sqlc
 
 import (
 	"context"
+	"time"
 )
 
 const createUserSession = `-- name: CreateUserSession :exec
-INSERT INTO sessions (sess_id, user_id, expires_at)
-VALUES (?1, ?2, ?3)
+INSERT INTO sessions (sess_id, user_id, expires_at, user_agent, last_seen_at)
+VALUES (?1, ?2, ?3, ?4, ?5)
 `
 
 type CreateUserSessionParams struct {
-	SessID    string
-	UserID    int64
-	ExpiresAt int64
+	SessID     string
+	UserID     int64
+	ExpiresAt  int64
+	UserAgent  string
+	LastSeenAt int64
 }
 
 // CreateUserSession creates a new session for the given user id.
 func (q *Queries) CreateUserSession(ctx context.Context, arg CreateUserSessionParams) error {
-	_, err := q.db.ExecContext(ctx, createUserSession, arg.SessID, arg.UserID, arg.ExpiresAt)
+	_, err := q.db.ExecContext(ctx, createUserSession,
+		arg.SessID,
+		arg.UserID,
+		arg.ExpiresAt,
+		arg.UserAgent,
+		arg.LastSeenAt,
+	)
 	return err
 }
 
 const deleteExpiredSessions = `-- name: DeleteExpiredSessions :exec
 DELETE
 FROM sessions
-WHERE expires_at >= ?1
+WHERE expires_at < ?1
 `
 
 // DeleteExpiredSessions deletes all expired sessions.
@@ -38,6 +47,65 @@ func (q *Queries) DeleteExpiredSessions(ctx context.Context, dttm int64) error {
 	return err
 }
 
+const deleteOldestUserSessions = `-- name: DeleteOldestUserSessions :exec
+DELETE
+FROM sessions
+WHERE user_id = ?1
+  AND sess_id NOT IN (SELECT sess_id
+                      FROM sessions
+                      WHERE user_id = ?1
+                      ORDER BY created_at DESC, rowid DESC
+                      LIMIT ?2)
+`
+
+type DeleteOldestUserSessionsParams struct {
+	UserID int64
+	Keep   int64
+}
+
+// DeleteOldestUserSessions deletes the oldest sessions for the given user id,
+// keeping only the newest sessions.
+func (q *Queries) DeleteOldestUserSessions(ctx context.Context, arg DeleteOldestUserSessionsParams) error {
+	_, err := q.db.ExecContext(ctx, deleteOldestUserSessions, arg.UserID, arg.Keep)
+	return err
+}
+
+const deleteOtherUserSessions = `-- name: DeleteOtherUserSessions :exec
+DELETE
+FROM sessions
+WHERE user_id = ?1
+  AND sess_id != ?2
+`
+
+type DeleteOtherUserSessionsParams struct {
+	UserID int64
+	SessID string
+}
+
+// DeleteOtherUserSessions deletes all sessions for the given user id except the given session.
+func (q *Queries) DeleteOtherUserSessions(ctx context.Context, arg DeleteOtherUserSessionsParams) error {
+	_, err := q.db.ExecContext(ctx, deleteOtherUserSessions, arg.UserID, arg.SessID)
+	return err
+}
+
+const deleteUserSession = `-- name: DeleteUserSession :exec
+DELETE
+FROM sessions
+WHERE sess_id = ?1
+  AND user_id = ?2
+`
+
+type DeleteUserSessionParams struct {
+	SessID string
+	UserID int64
+}
+
+// DeleteUserSession deletes a single session for the given user id.
+func (q *Queries) DeleteUserSession(ctx context.Context, arg DeleteUserSessionParams) error {
+	_, err := q.db.ExecContext(ctx, deleteUserSession, arg.SessID, arg.UserID)
+	return err
+}
+
 const deleteUserSessions = `-- name: DeleteUserSessions :exec
 DELETE
 FROM sessions
@@ -53,14 +121,18 @@ func (q *Queries) DeleteUserSessions(ctx context.Context, userID int64) error {
 const getSession = `-- name: GetSession :one
 
 SELECT user_id,
-       expires_at
+       expires_at,
+       last_seen_at,
+       view_as
 FROM sessions
 WHERE sess_id = ?1
 `
 
 type GetSessionRow struct {
-	UserID    int64
-	ExpiresAt int64
+	UserID     int64
+	ExpiresAt  int64
+	LastSeenAt int64
+	ViewAs     string
 }
 
 //	Copyright (c) 2024 Michael D Henderson. All rights reserved.
@@ -70,6 +142,101 @@ type GetSessionRow struct {
 func (q *Queries) GetSession(ctx context.Context, sessionID string) (GetSessionRow, error) {
 	row := q.db.QueryRowContext(ctx, getSession, sessionID)
 	var i GetSessionRow
-	err := row.Scan(&i.UserID, &i.ExpiresAt)
+	err := row.Scan(
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.LastSeenAt,
+		&i.ViewAs,
+	)
 	return i, err
 }
+
+const getUserSessions = `-- name: GetUserSessions :many
+SELECT sess_id,
+       user_agent,
+       created_at,
+       expires_at,
+       last_seen_at
+FROM sessions
+WHERE user_id = ?1
+  AND expires_at > ?2
+ORDER BY created_at DESC, sess_id
+`
+
+type GetUserSessionsParams struct {
+	UserID int64
+	Dttm   int64
+}
+
+type GetUserSessionsRow struct {
+	SessID     string
+	UserAgent  string
+	CreatedAt  time.Time
+	ExpiresAt  int64
+	LastSeenAt int64
+}
+
+// GetUserSessions returns the sessions for the given user id that have not expired.
+func (q *Queries) GetUserSessions(ctx context.Context, arg GetUserSessionsParams) ([]GetUserSessionsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getUserSessions, arg.UserID, arg.Dttm)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUserSessionsRow
+	for rows.Next() {
+		var i GetUserSessionsRow
+		if err := rows.Scan(
+			&i.SessID,
+			&i.UserAgent,
+			&i.CreatedAt,
+			&i.ExpiresAt,
+			&i.LastSeenAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateSessionLastSeen = `-- name: UpdateSessionLastSeen :exec
+UPDATE sessions
+SET last_seen_at = ?1
+WHERE sess_id = ?2
+`
+
+type UpdateSessionLastSeenParams struct {
+	LastSeenAt int64
+	SessID     string
+}
+
+// UpdateSessionLastSeen updates the time that the session was last used.
+func (q *Queries) UpdateSessionLastSeen(ctx context.Context, arg UpdateSessionLastSeenParams) error {
+	_, err := q.db.ExecContext(ctx, updateSessionLastSeen, arg.LastSeenAt, arg.SessID)
+	return err
+}
+
+const updateSessionViewAs = `-- name: UpdateSessionViewAs :exec
+UPDATE sessions
+SET view_as = ?1
+WHERE sess_id = ?2
+`
+
+type UpdateSessionViewAsParams struct {
+	ViewAs string
+	SessID string
+}
+
+// UpdateSessionViewAs sets the clan that an operator is viewing.
+// An empty clan returns the session to the operator's own clan.
+func (q *Queries) UpdateSessionViewAs(ctx context.Context, arg UpdateSessionViewAsParams) error {
+	_, err := q.db.ExecContext(ctx, updateSessionViewAs, arg.ViewAs, arg.SessID)
+	return err
+}
@@ -0,0 +1,30 @@
+--  Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+-- CreateUpload records an upload attempt, successful or not.
+--
+-- name: CreateUpload :one
+INSERT INTO uploads (user_id, clan, turn_id, file_name, kind, byte_size, checksum, scrub_options, succeeded, reason,
+                     changes, uploaded_at)
+VALUES (:user_id, :clan, :turn_id, :file_name, :kind, :byte_size, :checksum, :scrub_options, :succeeded, :reason,
+        :changes, :uploaded_at)
+RETURNING upload_id;
+
+-- GetUserUploads returns the most recent uploads for the given user.
+--
+-- name: GetUserUploads :many
+SELECT upload_id,
+       clan,
+       turn_id,
+       file_name,
+       kind,
+       byte_size,
+       checksum,
+       scrub_options,
+       succeeded,
+       reason,
+       changes,
+       uploaded_at
+FROM uploads
+WHERE user_id = :user_id
+ORDER BY upload_id DESC
+LIMIT :limit;
@@ -0,0 +1,70 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package sqlite
+
+import (
+	"github.com/mdhender/ottoapp/domains"
+	"github.com/mdhender/ottoapp/stores/sqlite/sqlc"
+	"strings"
+	"time"
+)
+
+// CreateUpload adds the upload to the history.
+func (db *DB) CreateUpload(upload *domains.Upload_t) (domains.ID, error) {
+	parms := sqlc.CreateUploadParams{
+		UserID:       int64(upload.UserID),
+		Clan:         upload.Clan,
+		TurnID:       upload.TurnId,
+		FileName:     upload.FileName,
+		Kind:         string(upload.Kind),
+		ByteSize:     int64(upload.Size),
+		Checksum:     upload.Checksum,
+		ScrubOptions: strings.Join(upload.ScrubOptions, ","),
+		Reason:       upload.Reason,
+		Changes:      strings.Join(upload.Changes, ";"),
+		UploadedAt:   upload.UploadedAt.UTC().Unix(),
+	}
+	if upload.Succeeded {
+		parms.Succeeded = 1
+	}
+	id, err := db.q.CreateUpload(db.ctx, parms)
+	if err != nil {
+		return 0, err
+	}
+	return domains.ID(id), nil
+}
+
+// GetUserUploads returns the user's most recent uploads, newest first.
+func (db *DB) GetUserUploads(userId domains.ID, limit int) ([]*domains.Upload_t, error) {
+	rows, err := db.q.GetUserUploads(db.ctx, sqlc.GetUserUploadsParams{
+		UserID: int64(userId),
+		Limit:  int64(limit),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var uploads []*domains.Upload_t
+	for _, row := range rows {
+		upload := &domains.Upload_t{
+			ID:         domains.ID(row.UploadID),
+			UserID:     userId,
+			Clan:       row.Clan,
+			TurnId:     row.TurnID,
+			FileName:   row.FileName,
+			Kind:       domains.UploadKind(row.Kind),
+			Size:       int(row.ByteSize),
+			Checksum:   row.Checksum,
+			Succeeded:  row.Succeeded == 1,
+			Reason:     row.Reason,
+			UploadedAt: time.Unix(row.UploadedAt, 0).UTC(),
+		}
+		if row.ScrubOptions != "" {
+			upload.ScrubOptions = strings.Split(row.ScrubOptions, ",")
+		}
+		if row.Changes != "" {
+			upload.Changes = strings.Split(row.Changes, ";")
+		}
+		uploads = append(uploads, upload)
+	}
+	return uploads, nil
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package sqlite
+
+import (
+	"context"
+	"github.com/mdhender/ottoapp/domains"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestUploads(t *testing.T) {
+	db := testDB(t)
+	user, err := db.CreateUser("clan0138@ottomap", "a-long-password", "0138", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := db.CreateUser("clan0200@ottomap", "a-long-password", "0200", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uploadedAt := time.Date(2024, 10, 18, 12, 0, 0, 0, time.UTC)
+	for _, upload := range []*domains.Upload_t{
+		{UserID: user.ID, Clan: "0138", Kind: domains.UploadFile, FileName: "0901-04.0138.report.txt", Checksum: "rejected", Reason: "The report is empty."},
+		{UserID: user.ID, Clan: "0138", Kind: domains.UploadFile, FileName: "0901-04.0138.report.txt", TurnId: "0901-04", Checksum: "accepted", Size: 1234, Succeeded: true,
+			ScrubOptions: []string{"remove-bad-bytes", "remove-sensitive-lines"}, Changes: []string{"removed the byte order mark", "removed 2 control characters"}},
+		{UserID: other.ID, Clan: "0200", Kind: domains.UploadFile, FileName: "0901-04.0200.report.txt", TurnId: "0901-04", Checksum: "other", Succeeded: true},
+	} {
+		upload.UploadedAt = uploadedAt
+		if _, err := db.CreateUpload(upload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	uploads, err := db.GetUserUploads(user.ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(uploads) != 2 {
+		t.Fatalf("uploads: want 2, got %d", len(uploads))
+	}
+	// newest first
+	if got := uploads[0]; !got.Succeeded || got.Checksum != "accepted" || got.Size != 1234 || got.TurnId != "0901-04" || !got.UploadedAt.Equal(uploadedAt) {
+		t.Errorf("uploads[0]: got %+v", got)
+	} else if want := []string{"remove-bad-bytes", "remove-sensitive-lines"}; !reflect.DeepEqual(got.ScrubOptions, want) {
+		t.Errorf("uploads[0]: scrub options: want %q, got %q", want, got.ScrubOptions)
+	} else if want := []string{"removed the byte order mark", "removed 2 control characters"}; !reflect.DeepEqual(got.Changes, want) {
+		t.Errorf("uploads[0]: changes: want %q, got %q", want, got.Changes)
+	}
+	if got := uploads[1]; got.Succeeded || got.Reason != "The report is empty." || got.ScrubOptions != nil || got.Changes != nil {
+		t.Errorf("uploads[1]: got %+v", got)
+	}
+
+	if uploads, err := db.GetUserUploads(user.ID, 1); err != nil {
+		t.Fatal(err)
+	} else if len(uploads) != 1 || uploads[0].Checksum != "accepted" {
+		t.Errorf("limit 1: got %d uploads", len(uploads))
+	}
+}
+
+// testDB returns a new store in a temporary folder. It is closed when the test ends.
+func testDB(t *testing.T) *DB {
+	t.Helper()
+	path, ctx := t.TempDir(), context.Background()
+	dbPath := filepath.Join(path, "test.db")
+	if err := Create(dbPath, false, "", "", path, "admin-secret", "", ctx); err != nil {
+		t.Fatal(err)
+	}
+	db, err := Open(dbPath, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	return db
+}
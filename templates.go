@@ -0,0 +1,198 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// templateRegistry caches the parsed templates for the handlers.
+//
+// Handlers register the files that they render when they are created.
+// The server parses every registered set once at startup, so a broken
+// template stops the server instead of failing a request.
+//
+// Templates are read from the components file system. Handlers name their files
+// with filepath.Join(root, ...), so the registry strips the root before opening them.
+//
+// In dev mode, the registry watches the components override directory and
+// rebuilds every set when a file changes.
+type templateRegistry struct {
+	fsys fs.FS  // the embedded components, with the override directory on top
+	root string // path to the components override directory, empty if there isn't one
+
+	sync.RWMutex
+	keys []string                      // registered sets, in the order they were registered
+	sets map[string]*template.Template // parsed templates, indexed by key
+}
+
+func newTemplateRegistry(fsys fs.FS, root string) *templateRegistry {
+	return &templateRegistry{
+		fsys: fsys,
+		root: root,
+		sets: map[string]*template.Template{},
+	}
+}
+
+// templateKey returns the key for a set of files.
+// The order matters because the last definition of a template wins.
+func templateKey(files ...string) string {
+	return strings.Join(files, "\n")
+}
+
+// register adds a set of files to the registry.
+// The files are parsed by build, not here.
+func (tr *templateRegistry) register(files ...string) {
+	key := templateKey(files...)
+	tr.Lock()
+	defer tr.Unlock()
+	if _, ok := tr.sets[key]; !ok {
+		tr.keys = append(tr.keys, key)
+		tr.sets[key] = nil
+	}
+}
+
+// count returns the number of registered sets.
+func (tr *templateRegistry) count() int {
+	tr.RLock()
+	defer tr.RUnlock()
+	return len(tr.keys)
+}
+
+// build parses every registered set of files.
+// If any set fails to parse, it returns the errors and leaves the current templates in place.
+func (tr *templateRegistry) build() error {
+	tr.RLock()
+	keys := append([]string(nil), tr.keys...)
+	tr.RUnlock()
+
+	// a broken file is usually shared by many sets, so report each error once
+	sets, errs, seen := map[string]*template.Template{}, []error(nil), map[string]bool{}
+	for _, key := range keys {
+		t, err := tr.parse(strings.Split(key, "\n")...)
+		if err != nil {
+			if !seen[err.Error()] {
+				errs, seen[err.Error()] = append(errs, err), true
+			}
+			continue
+		}
+		sets[key] = t
+	}
+	if errs != nil {
+		return errors.Join(errs...)
+	}
+
+	tr.Lock()
+	defer tr.Unlock()
+	for key, t := range sets {
+		tr.sets[key] = t
+	}
+	return nil
+}
+
+// lookup returns the parsed templates for a set of files.
+// A set that was not registered is parsed now and kept for the next request.
+//
+// Handlers must not change the template that is returned. Clone it if you need to.
+func (tr *templateRegistry) lookup(files ...string) (*template.Template, error) {
+	key := templateKey(files...)
+	tr.RLock()
+	t := tr.sets[key]
+	tr.RUnlock()
+	if t != nil {
+		return t, nil
+	}
+
+	t, err := tr.parse(files...)
+	if err != nil {
+		return nil, err
+	}
+	tr.Lock()
+	defer tr.Unlock()
+	if _, ok := tr.sets[key]; !ok {
+		tr.keys = append(tr.keys, key)
+	}
+	tr.sets[key] = t
+	return t, nil
+}
+
+// parse parses a set of files from the components file system.
+func (tr *templateRegistry) parse(files ...string) (*template.Template, error) {
+	names := make([]string, len(files))
+	for n, file := range files {
+		if tr.root != "" {
+			rel, err := filepath.Rel(tr.root, file)
+			if err != nil {
+				return nil, err
+			}
+			file = rel
+		}
+		names[n] = filepath.ToSlash(file)
+	}
+	return template.ParseFS(tr.fsys, names...)
+}
+
+// watch polls the components override directory and rebuilds the templates when a file changes.
+// It never returns, so run it in a goroutine.
+//
+// Parse errors are logged and the previous templates are kept, so a typo in a
+// template doesn't take down a running server.
+func (tr *templateRegistry) watch(interval time.Duration) {
+	last, err := tr.stamp()
+	if err != nil {
+		log.Printf("templates: watch: %v\n", err)
+	}
+	for {
+		time.Sleep(interval)
+		stamp, err := tr.stamp()
+		if err != nil {
+			log.Printf("templates: watch: %v\n", err)
+			continue
+		} else if stamp == last {
+			continue
+		}
+		last = stamp
+
+		started := time.Now()
+		if err := tr.build(); err != nil {
+			log.Printf("templates: rebuild: %v\n", err)
+			continue
+		}
+		log.Printf("templates: rebuilt in %v\n", time.Since(started))
+	}
+}
+
+// stamp returns a summary of the components override directory that changes when
+// a template is added, removed, or modified.
+func (tr *templateRegistry) stamp() (string, error) {
+	var count int
+	var latest time.Time
+	err := filepath.WalkDir(tr.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		} else if d.IsDir() || filepath.Ext(path) != ".gohtml" {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		count++
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d:%d", count, latest.UnixNano()), nil
+}
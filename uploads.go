@@ -0,0 +1,80 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/mdhender/ottoapp/domains"
+	"log"
+	"net/http"
+	"time"
+)
+
+// newUpload starts an upload history entry for the user.
+// Handlers should defer recordUpload as soon as the entry is created so that
+// every exit path is recorded, and set Succeeded only after the report is saved.
+func newUpload(user *domains.User_t, kind domains.UploadKind, scrubOptions ...string) *domains.Upload_t {
+	return &domains.Upload_t{
+		UserID:       user.ID,
+		Clan:         user.Clan,
+		Kind:         kind,
+		ScrubOptions: scrubOptions,
+		UploadedAt:   time.Now().UTC(),
+	}
+}
+
+// setUploadData records the size and checksum of the bytes that were received.
+func setUploadData(upload *domains.Upload_t, data []byte) {
+	sum := sha256.Sum256(data)
+	upload.Size = len(data)
+	upload.Checksum = hex.EncodeToString(sum[:])
+}
+
+// checkReportClan returns the reason to reject a report for a unit that the user's
+// clan doesn't own, or an empty string if it does. Clan 0138 owns tribes 0138
+// through 9138 and all of their couriers, elements, fleets, and garrisons.
+func checkReportClan(user *domains.User_t, unitId string) string {
+	if len(unitId) < 4 {
+		return "The report does not name a clan."
+	} else if clanId := "0" + unitId[1:4]; clanId != user.Clan {
+		return fmt.Sprintf("The report is for clan %s, but you are signed in as clan %s.", clanId, user.Clan)
+	}
+	return ""
+}
+
+// recordUpload saves the entry to the upload history and the audit log.
+// Errors are logged, not returned, because they should not fail the upload.
+func (s *Server) recordUpload(r *http.Request, upload *domains.Upload_t) {
+	if !upload.Succeeded && upload.Reason == "" {
+		upload.Reason = "unknown error"
+	}
+	if _, err := s.stores.store.CreateUpload(upload); err != nil {
+		log.Printf("uploads: %s: %v\n", upload.Clan, err)
+	}
+	if upload.Succeeded {
+		s.audit(r, upload.Clan, domains.AuditUpload, fmt.Sprintf("%s %q turn %s, %d bytes", upload.Kind, upload.FileName, upload.TurnId, upload.Size))
+	} else {
+		s.audit(r, upload.Clan, domains.AuditUploadFailed, fmt.Sprintf("%s %q: %s", upload.Kind, upload.FileName, upload.Reason))
+	}
+	if upload.Succeeded {
+		title := fmt.Sprintf("Report uploaded for turn %s", upload.TurnId)
+		message := fmt.Sprintf("We accepted %s.", upload.FileName)
+		if err := s.notifier.Notify(upload.UserID, domains.EventUploadAccepted, "", title, message); err != nil {
+			log.Printf("uploads: %s: notify: %v\n", upload.Clan, err)
+		}
+	}
+}
+
+// scrubOptions returns the names of the scrub options that are set.
+func scrubOptions(removeBadBytes, removeSensitiveLines bool) []string {
+	var options []string
+	if removeBadBytes {
+		options = append(options, "remove-bad-bytes")
+	}
+	if removeSensitiveLines {
+		options = append(options, "remove-sensitive-lines")
+	}
+	return options
+}
@@ -0,0 +1,324 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+// Package validator checks turn reports before they are saved.
+//
+// Unlike the header checks in the upload handlers, the validator does not stop
+// at the first problem. It walks the whole report and returns every problem it
+// finds, with the line and column, so that players can fix them all at once.
+package validator
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mdhender/ottoapp/charset"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type Severity string
+
+const (
+	Error   Severity = "error"   // the report can't be mapped
+	Warning Severity = "warning" // the report may not map correctly
+	Info    Severity = "info"    // something the player may want to know
+)
+
+// Diagnostic_t is a single problem found in a report.
+type Diagnostic_t struct {
+	Line     int      `json:"line"`   // 1-based line number
+	Column   int      `json:"column"` // 1-based column, counted in characters
+	Severity Severity `json:"severity"`
+	Code     string   `json:"code"`
+	Message  string   `json:"message"`
+	Fix      string   `json:"fix,omitempty"` // suggested fix, if we have one
+}
+
+var (
+	rxUnitHeader      = regexp.MustCompile(`^(tribe|courier|element|fleet|garrison) (\d{4}([cefg]\d)?)\b`)
+	rxTurnHeader      = regexp.MustCompile(`^current turn (\d+)-(\d+)`)
+	rxTribeMove       = regexp.MustCompile(`^tribe movement:`)
+	rxScoutMove       = regexp.MustCompile(`^scout (\d):`)
+	exampleUnitHeader = `"Tribe 0987, , Current Hex = QQ 1234, (Previous Hex = QQ 1234)"`
+	exampleTurnHeader = `"Current Turn 899-12 (#0), Winter, FINE	Next Turn 900-01 (#1), 29/10/2023"`
+)
+
+// section_t tracks a unit section while we walk the report.
+type section_t struct {
+	unitId    string
+	line      int // line number of the unit header
+	hasStatus bool
+}
+
+// Check walks every line of the report and returns the problems it finds,
+// in line order. The lines should not include the end-of-line characters.
+func Check(lines [][]byte) []Diagnostic_t {
+	var diagnostics []Diagnostic_t
+	add := func(line, column int, severity Severity, code, message, fix string) {
+		diagnostics = append(diagnostics, Diagnostic_t{
+			Line:     line,
+			Column:   column,
+			Severity: severity,
+			Code:     code,
+			Message:  message,
+			Fix:      fix,
+		})
+	}
+
+	if len(lines) == 0 {
+		add(1, 1, Error, "empty-report", "The report is empty.", "Paste or upload the full text of the turn report.")
+		return diagnostics
+	}
+
+	var sections []*section_t
+	var turnId string
+	endSection := func() {
+		if len(sections) == 0 {
+			return
+		}
+		if section := sections[len(sections)-1]; !section.hasStatus {
+			add(section.line, 1, Warning, "missing-status",
+				fmt.Sprintf("Unit %s does not have a status line.", section.unitId),
+				fmt.Sprintf("Make sure the %q line was copied with the rest of the section.", section.unitId+" Status: "))
+		}
+	}
+
+	for n, raw := range lines {
+		lineNo := n + 1
+		checkCharacters(raw, func(column int, severity Severity, code, message, fix string) {
+			add(lineNo, column, severity, code, message, fix)
+		})
+
+		text := strings.TrimSpace(string(raw))
+		lower := strings.ToLower(text)
+
+		if m := rxUnitHeader.FindStringSubmatch(lower); m != nil {
+			endSection()
+			sections = append(sections, &section_t{unitId: m[2], line: lineNo})
+			checkUnitHeader(string(raw), lineNo, add)
+
+			// the turn line must immediately follow the unit header
+			if n+1 >= len(lines) {
+				add(lineNo, len([]rune(string(raw)))+1, Error, "missing-turn-header",
+					"The report ends after the unit header.",
+					fmt.Sprintf("Add the turn line after the unit header. It should look like %s.", exampleTurnHeader))
+			} else if next := strings.ToLower(strings.TrimSpace(string(lines[n+1]))); !strings.HasPrefix(next, "current turn") {
+				add(lineNo+1, 1, Error, "missing-turn-header",
+					"The line after the unit header should be the Current Turn line.",
+					fmt.Sprintf("Add the turn line after the unit header. It should look like %s.", exampleTurnHeader))
+			}
+			continue
+		} else if n == 0 {
+			add(lineNo, 1, Error, "missing-unit-header",
+				"The first line of the report should be the unit header.",
+				fmt.Sprintf("Start the report with the unit header. It should look like %s.", exampleUnitHeader))
+		}
+
+		if strings.HasPrefix(lower, "current turn") {
+			id, ok := parseTurn(lower)
+			if !ok {
+				add(lineNo, 1, Error, "invalid-turn",
+					"The Current Turn line does not have a valid turn number.",
+					fmt.Sprintf("The turn line should look like %s.", exampleTurnHeader))
+			} else if turnId == "" {
+				turnId = id
+			} else if id != turnId {
+				add(lineNo, 14, Error, "turn-mismatch",
+					fmt.Sprintf("This section is for turn %s, but the report started with turn %s.", id, turnId),
+					"Upload each turn's report separately.")
+			}
+			continue
+		}
+
+		if len(sections) != 0 {
+			section := sections[len(sections)-1]
+			if strings.HasPrefix(lower, section.unitId+" status:") {
+				section.hasStatus = true
+				continue
+			}
+		}
+
+		if rxTribeMove.MatchString(lower) {
+			rest := strings.TrimSpace(lower[len("tribe movement:"):])
+			if rest != "" && !strings.HasPrefix(rest, "move") {
+				add(lineNo, len("Tribe Movement:")+2, Warning, "movement-prefix",
+					`The tribe movement line should start with "Move".`,
+					`The line should look like "Tribe Movement: Move N-PR, ..."`)
+			}
+		} else if m := rxScoutMove.FindStringSubmatch(lower); m != nil {
+			rest := strings.TrimSpace(lower[len(m[0]):])
+			if rest != "" && !strings.HasPrefix(rest, "scout") {
+				add(lineNo, len(m[0])+2, Warning, "scout-prefix",
+					fmt.Sprintf(`Scout %s's line should start with "Scout".`, m[1]),
+					fmt.Sprintf(`The line should look like "Scout %s:Scout N-PR, ..."`, m[1]))
+			}
+		}
+	}
+	endSection()
+
+	// we add diagnostics for the turn line while looking at the header, so sort them by position
+	sortDiagnostics(diagnostics)
+
+	return diagnostics
+}
+
+// Header returns the unit id from the unit header and the turn id, YYYY-MM,
+// from the Current Turn line that follows it. Reports that Check found no
+// errors in always have both.
+func Header(lines [][]byte) (unitId, turnId string, ok bool) {
+	if len(lines) < 2 {
+		return "", "", false
+	}
+	unitId, ok = UnitId(lines[0])
+	if !ok {
+		return "", "", false
+	}
+	turnId, ok = parseTurn(strings.ToLower(strings.TrimSpace(string(lines[1]))))
+	if !ok {
+		return "", "", false
+	}
+	return unitId, turnId, true
+}
+
+// UnitId returns the unit id from a unit header, "Tribe 0138, , Current Hex = ...".
+func UnitId(line []byte) (string, bool) {
+	m := rxUnitHeader.FindStringSubmatch(strings.ToLower(strings.TrimSpace(string(line))))
+	if m == nil {
+		return "", false
+	}
+	return m[2], true
+}
+
+// HasErrors returns true if any of the diagnostics is an error.
+func HasErrors(diagnostics []Diagnostic_t) bool {
+	return CountErrors(diagnostics) != 0
+}
+
+// CountErrors returns the number of diagnostics that are errors.
+func CountErrors(diagnostics []Diagnostic_t) int {
+	n := 0
+	for _, d := range diagnostics {
+		if d.Severity == Error {
+			n++
+		}
+	}
+	return n
+}
+
+// checkUnitHeader checks the fields of a unit header line.
+func checkUnitHeader(line string, lineNo int, add func(line, column int, severity Severity, code, message, fix string)) {
+	fields := strings.Split(line, ",")
+	if len(fields) != 4 {
+		add(lineNo, 1, Error, "unit-header-fields",
+			fmt.Sprintf("The unit header should have 4 fields separated by commas, but it has %d.", len(fields)),
+			fmt.Sprintf("The unit header should look like %s.", exampleUnitHeader))
+		return
+	}
+	// column of the start of each field
+	column := 1
+	for i, field := range fields {
+		trimmed := strings.ToLower(strings.TrimSpace(field))
+		fieldColumn := column + len([]rune(field)) - len([]rune(strings.TrimLeft(field, " \t")))
+		switch i {
+		case 2:
+			if !strings.HasPrefix(trimmed, "current hex = ") {
+				add(lineNo, fieldColumn, Error, "current-hex",
+					"The third field of the unit header should be the current hex.",
+					`The field should look like "Current Hex = QQ 1234".`)
+			}
+		case 3:
+			if !strings.HasPrefix(trimmed, "(previous hex = ") {
+				add(lineNo, fieldColumn, Error, "previous-hex",
+					"The fourth field of the unit header should be the previous hex.",
+					`The field should look like "(Previous Hex = QQ 1234)".`)
+			}
+		}
+		column += len([]rune(field)) + 1
+	}
+}
+
+// checkCharacters reports bytes and characters that the parser can't handle.
+// Only the first problem of each kind is reported for a line to keep the list readable.
+func checkCharacters(line []byte, add func(column int, severity Severity, code, message, fix string)) {
+	seen := map[string]bool{}
+	column := 0
+	for i := 0; i < len(line); {
+		column++
+		r, width := utf8.DecodeRune(line[i:])
+		i += width
+		if r == utf8.RuneError && width == 1 {
+			if !seen["invalid-utf8"] {
+				seen["invalid-utf8"] = true
+				add(column, Error, "invalid-utf8",
+					fmt.Sprintf("Byte 0x%02X is not valid UTF-8.", line[i-1]),
+					`Check "remove bad bytes" or save the file as UTF-8 before uploading.`)
+			}
+		} else if charset.IsControl(r) {
+			if !seen["control-character"] {
+				seen["control-character"] = true
+				add(column, Error, "control-character",
+					fmt.Sprintf("The line contains the control character %s.", strconv.QuoteRune(r)),
+					"Delete the character.")
+			}
+		} else if replacement, ok := charset.Typographic(r); ok {
+			if !seen["typographic-character"] {
+				seen["typographic-character"] = true
+				add(column, Warning, "typographic-character",
+					fmt.Sprintf("The line contains the typographic character %s.", strconv.QuoteRune(r)),
+					fmt.Sprintf("Replace it with %q.", replacement))
+			}
+		} else if r >= utf8.RuneSelf {
+			if !seen["non-ascii"] {
+				seen["non-ascii"] = true
+				add(column, Warning, "non-ascii",
+					fmt.Sprintf("The line contains the non-ASCII character %s.", strconv.QuoteRune(r)),
+					"Check that the character belongs in the report.")
+			}
+		}
+	}
+}
+
+// parseTurn returns the turn id, YYYY-MM, from a lower-cased Current Turn line.
+func parseTurn(line string) (string, bool) {
+	m := rxTurnHeader.FindStringSubmatch(line)
+	if m == nil {
+		return "", false
+	}
+	year, err := strconv.Atoi(m[1])
+	if err != nil || year < 899 || year > 1234 {
+		return "", false
+	}
+	month, err := strconv.Atoi(m[2])
+	if err != nil || month < 1 || month > 12 {
+		return "", false
+	}
+	return fmt.Sprintf("%04d-%02d", year, month), true
+}
+
+// sortDiagnostics sorts by line and then column, keeping the order of diagnostics at the same position.
+func sortDiagnostics(diagnostics []Diagnostic_t) {
+	for i := 1; i < len(diagnostics); i++ {
+		for j := i; j > 0 && less(diagnostics[j], diagnostics[j-1]); j-- {
+			diagnostics[j], diagnostics[j-1] = diagnostics[j-1], diagnostics[j]
+		}
+	}
+}
+
+func less(a, b Diagnostic_t) bool {
+	if a.Line != b.Line {
+		return a.Line < b.Line
+	}
+	return a.Column < b.Column
+}
+
+// SplitLines splits the report into lines, accepting any mix of line endings.
+func SplitLines(data []byte) [][]byte {
+	data = bytes.ReplaceAll(data, []byte{'\r', '\n'}, []byte{'\n'})
+	data = bytes.ReplaceAll(data, []byte{'\r'}, []byte{'\n'})
+	data = bytes.TrimSuffix(data, []byte{'\n'})
+	if len(data) == 0 {
+		return nil
+	}
+	return bytes.Split(data, []byte{'\n'})
+}
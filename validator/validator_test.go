@@ -0,0 +1,159 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package validator
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	testUnitHeader = "Tribe 0138, , Current Hex = QQ 1234, (Previous Hex = QQ 1234)"
+	testTurnHeader = "Current Turn 901-04 (#40), Spring, FINE\tNext Turn 901-05 (#41), 12/10/2024"
+	testStatus     = "0138 Status: PRAIRIE, River S"
+)
+
+// position_t is the part of a diagnostic that the tests check.
+type position_t struct {
+	Line     int
+	Column   int
+	Severity Severity
+	Code     string
+}
+
+func TestCheck(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		lines []string
+		want  []position_t
+	}{
+		{"empty", nil, []position_t{{1, 1, Error, "empty-report"}}},
+		{"valid", []string{testUnitHeader, testTurnHeader, "Tribe Movement: Move N-PR", "Scout 1:Scout N-PR", testStatus}, nil},
+		{"valid two units", []string{
+			testUnitHeader, testTurnHeader, testStatus,
+			"Courier 0138c1, , Current Hex = QQ 1235, (Previous Hex = QQ 1234)", testTurnHeader, "0138c1 Status: PRAIRIE",
+		}, nil},
+		{"no unit header", []string{testTurnHeader, testStatus}, []position_t{{1, 1, Error, "missing-unit-header"}}},
+		{"ends after unit header", []string{testUnitHeader}, []position_t{
+			{1, 1, Warning, "missing-status"},
+			{1, len(testUnitHeader) + 1, Error, "missing-turn-header"},
+		}},
+		{"missing turn header", []string{testUnitHeader, testStatus}, []position_t{{2, 1, Error, "missing-turn-header"}}},
+		{"unit header fields", []string{"Tribe 0138, Current Hex = QQ 1234", testTurnHeader, testStatus}, []position_t{{1, 1, Error, "unit-header-fields"}}},
+		{"current hex", []string{"Tribe 0138, , Hex = QQ 1234, (Previous Hex = QQ 1234)", testTurnHeader, testStatus}, []position_t{{1, 15, Error, "current-hex"}}},
+		{"previous hex", []string{"Tribe 0138, , Current Hex = QQ 1234, Previous Hex = QQ 1234", testTurnHeader, testStatus}, []position_t{{1, 38, Error, "previous-hex"}}},
+		{"invalid turn", []string{testUnitHeader, "Current Turn 1301-04 (#40)", testStatus}, []position_t{{2, 1, Error, "invalid-turn"}}},
+		{"turn mismatch", []string{
+			testUnitHeader, testTurnHeader, testStatus,
+			"Courier 0138c1, , Current Hex = QQ 1235, (Previous Hex = QQ 1234)", "Current Turn 901-05 (#41)", "0138c1 Status: PRAIRIE",
+		}, []position_t{{5, 14, Error, "turn-mismatch"}}},
+		{"missing status", []string{testUnitHeader, testTurnHeader}, []position_t{{1, 1, Warning, "missing-status"}}},
+		{"movement prefix", []string{testUnitHeader, testTurnHeader, "Tribe Movement: N-PR", testStatus}, []position_t{{3, 17, Warning, "movement-prefix"}}},
+		{"scout prefix", []string{testUnitHeader, testTurnHeader, "Scout 2:N-PR", testStatus}, []position_t{{3, 10, Warning, "scout-prefix"}}},
+		{"invalid utf-8", []string{testUnitHeader, testTurnHeader, "Tribe Movement: Move N\xFF-PR\xFE", testStatus}, []position_t{{3, 23, Error, "invalid-utf8"}}},
+		{"control character", []string{testUnitHeader, testTurnHeader, testStatus + "\x00"}, []position_t{{3, len(testStatus) + 1, Error, "control-character"}}},
+		{"typographic character", []string{testUnitHeader, testTurnHeader, "Tribe Movement: Move N–PR, N–PR", testStatus}, []position_t{{3, 23, Warning, "typographic-character"}}},
+		{"non-ascii", []string{testUnitHeader, testTurnHeader, "0138 Status: PRAIRIE, Fjörd", testStatus}, []position_t{{3, 25, Warning, "non-ascii"}}},
+	} {
+		var lines [][]byte
+		for _, line := range tc.lines {
+			lines = append(lines, []byte(line))
+		}
+		var got []position_t
+		for _, d := range Check(lines) {
+			got = append(got, position_t{d.Line, d.Column, d.Severity, d.Code})
+			if d.Message == "" {
+				t.Errorf("%s: %s: missing message", tc.name, d.Code)
+			}
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: want %+v, got %+v", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestHeader(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		lines  []string
+		unitId string
+		turnId string
+		ok     bool
+	}{
+		{"tribe", []string{testUnitHeader, testTurnHeader}, "0138", "0901-04", true},
+		{"courier", []string{"Courier 0138c1, , Current Hex = QQ 1235, (Previous Hex = QQ 1234)", "Current Turn 1234-12 (#0)"}, "0138c1", "1234-12", true},
+		{"compressed spaces", []string{"Tribe 0138,,Current Hex = QQ 1234,(Previous Hex = QQ 1234)", "Current Turn 901-04(#40),Spring,FINE"}, "0138", "0901-04", true},
+		{"too short", []string{testUnitHeader}, "", "", false},
+		{"no unit header", []string{testTurnHeader, testStatus}, "", "", false},
+		{"invalid turn", []string{testUnitHeader, "Current Turn 901-13 (#40)"}, "", "", false},
+	} {
+		var lines [][]byte
+		for _, line := range tc.lines {
+			lines = append(lines, []byte(line))
+		}
+		unitId, turnId, ok := Header(lines)
+		if unitId != tc.unitId || turnId != tc.turnId || ok != tc.ok {
+			t.Errorf("%s: want %q %q %v, got %q %q %v", tc.name, tc.unitId, tc.turnId, tc.ok, unitId, turnId, ok)
+		}
+	}
+}
+
+func TestCountErrors(t *testing.T) {
+	diagnostics := []Diagnostic_t{{Severity: Error}, {Severity: Warning}, {Severity: Error}, {Severity: Info}}
+	if got := CountErrors(diagnostics); got != 2 {
+		t.Errorf("want 2, got %d", got)
+	}
+	if !HasErrors(diagnostics) {
+		t.Errorf("want errors")
+	}
+	if HasErrors(diagnostics[1:2]) {
+		t.Errorf("want no errors")
+	}
+}
+
+func TestSplitLines(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{"empty", "", nil},
+		{"new line only", "\n", nil},
+		{"unix", "a\nb\n", []string{"a", "b"}},
+		{"windows", "a\r\nb\r\n", []string{"a", "b"}},
+		{"mac", "a\rb\r", []string{"a", "b"}},
+		{"mixed", "a\r\nb\rc\nd", []string{"a", "b", "c", "d"}},
+		{"blank lines", "a\n\nb\n", []string{"a", "", "b"}},
+	} {
+		var got []string
+		for _, line := range SplitLines([]byte(tc.input)) {
+			got = append(got, string(line))
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: want %q, got %q", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestParseTurn(t *testing.T) {
+	for _, tc := range []struct {
+		line string
+		want string
+		ok   bool
+	}{
+		{strings.ToLower(testTurnHeader), "0901-04", true},
+		{"current turn 899-12 (#0)", "0899-12", true},
+		{"current turn 1234-01 (#0)", "1234-01", true},
+		{"current turn 898-12 (#0)", "", false},
+		{"current turn 1235-01 (#0)", "", false},
+		{"current turn 901-00 (#0)", "", false},
+		{"current turn 901-13 (#0)", "", false},
+		{"current turn (#0)", "", false},
+	} {
+		got, ok := parseTurn(tc.line)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("%q: want %q %v, got %q %v", tc.line, tc.want, tc.ok, got, ok)
+		}
+	}
+}
@@ -4,15 +4,13 @@ package main
 
 import (
 	"bytes"
-	"database/sql"
-	"encoding/json"
-	"errors"
 	"fmt"
 	"github.com/mdhender/ottoapp/components/app"
 	"github.com/mdhender/ottoapp/components/app/pages/reports/uploads"
 	"github.com/mdhender/ottoapp/components/app/widgets"
+	"github.com/mdhender/ottoapp/domains"
 	"github.com/mdhender/ottoapp/stores/office"
-	"html/template"
+	"github.com/mdhender/ottoapp/validator"
 	"io"
 	"log"
 	"net/http"
@@ -29,6 +27,7 @@ func (s *Server) getReportsUploadsMSWord(path string, footer app.Footer) http.Ha
 		filepath.Join(path, "app", "pages", "reports", "uploads", "msword", "content.gohtml"),
 		filepath.Join(path, "app", "widgets", "notifications.gohtml"),
 	}
+	s.templates.register(files...)
 	scripts := []string{
 		// "https://unpkg.com/jszip/dist/jszip.min.js",
 		"/js/jszip-3.10.1.min.js",
@@ -48,17 +47,7 @@ func (s *Server) getReportsUploadsMSWord(path string, footer app.Footer) http.Ha
 			log.Printf("%s %s: wrote %d bytes in %s\n", r.Method, r.URL.Path, bytesWritten, time.Since(started))
 		}()
 
-		// fetch the session and get the current user. if either fails, return an error
-		user, err := s.extractSession(r)
-		if err != nil && !errors.Is(err, sql.ErrNoRows) {
-			log.Printf("%s %s: extractSession: %v\n", r.Method, r.URL.Path, err)
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
-		} else if user == nil {
-			// there is no active session, so this is an error
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-			return
-		}
+		user := userFromRequest(r)
 		log.Printf("%s %s: session: clan_id %q\n", r.Method, r.URL.Path, user.Clan)
 
 		payload := app.Layout{
@@ -78,7 +67,7 @@ func (s *Server) getReportsUploadsMSWord(path string, footer app.Footer) http.Ha
 		payload.CurrentPage.Reports = true
 		payload.Footer.Timestamp = time.Now().In(user.LanguageAndDates.Timezone.Location).Format("2006-01-02 15:04:05")
 
-		t, err := template.ParseFiles(files...)
+		t, err := s.templates.lookup(files...)
 		if err != nil {
 			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -106,6 +95,7 @@ func (s *Server) postReportsUploadsMSWord(path string, footer app.Footer) http.H
 		filepath.Join(path, "app", "widgets", "notifications.gohtml"),
 		filepath.Join(path, "app", "widgets", "report_text.gohtml"),
 	}
+	s.templates.register(files...)
 	fieldName := "file-upload"
 
 	var (
@@ -161,16 +151,8 @@ func (s *Server) postReportsUploadsMSWord(path string, footer app.Footer) http.H
 			log.Printf("%s %s: wrote %d bytes in %s\n", r.Method, r.URL.Path, bytesWritten, time.Since(started))
 		}()
 
-		// fetch the session and get the current user. if either fails, return an error
-		user, err := s.extractSession(r)
-		if err != nil && !errors.Is(err, sql.ErrNoRows) {
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
-		} else if user == nil {
-			// there is no active session, so this is an error
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-			return
-		}
+		user := userFromRequest(r)
+		var err error
 
 		// verify that we have an input directory for the clan
 		inputPath := filepath.Join(user.Data, "input")
@@ -496,7 +478,6 @@ func (s *Server) postReportsUploadsMSWord(path string, footer app.Footer) http.H
 //		}
 //		log.Printf("%s %s: ct accepted\n", r.Method, r.URL.Path)
 //
-//		// fetch the session and get the current user. if either fails, return an error
 //		user, err := s.extractSession(r)
 //		if err != nil && !errors.Is(err, sql.ErrNoRows) {
 //			log.Printf("%s %s: extractSession: %v\n", r.Method, r.URL.Path, err)
@@ -593,17 +574,7 @@ func (s *Server) postApiReportUploadDocx(userdata string) http.HandlerFunc {
 		}
 		log.Printf("%s %s: ct accepted\n", r.Method, r.URL.Path)
 
-		// fetch the session and get the current user. if either fails, return an error
-		user, err := s.extractSession(r)
-		if err != nil && !errors.Is(err, sql.ErrNoRows) {
-			log.Printf("%s %s: extractSession: %v\n", r.Method, r.URL.Path, err)
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
-		} else if user == nil {
-			// there is no active session, so this is an error
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-			return
-		}
+		user := userFromRequest(r)
 		log.Printf("%s %s: session: clan_id %q\n", r.Method, r.URL.Path, user.Clan)
 
 		// verify that we have an input directory for the clan
@@ -658,24 +629,72 @@ func (s *Server) postApiReportUploadDocx(userdata string) http.HandlerFunc {
 		defer func() {
 			_ = file.Close()
 		}()
+		upload := newUpload(user, domains.UploadDocx)
+		defer s.recordUpload(r, upload)
+		upload.FileName = handler.Filename
+
 		data, err := io.ReadAll(file)
 		if err != nil {
 			log.Printf("%s %s: reading form data: %v\n", r.Method, r.URL.Path, err)
+			upload.Reason = "file could not be read"
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			return
 		}
 		log.Printf("%s %s: read     %d bytes\n", r.Method, r.URL.Path, len(data))
+		setUploadData(upload, data)
 
 		// ensure the uploaded file has the correct suffix
 		log.Printf("%s %s: filename %q\n", r.Method, r.URL.Path, handler.Filename)
+		if !strings.HasSuffix(handler.Filename, ".docx") {
+			upload.Reason = "file name must end with .docx"
+			bytesWritten = writeDiagnostics(w, http.StatusBadRequest, false, upload.Reason, nil, nil)
+			return
+		}
+
+		// extract the mapping lines from the Word document
+		lines, summary, err := convertDocxReport(data)
+		if err != nil {
+			log.Printf("%s %s: docx: %v\n", r.Method, r.URL.Path, err)
+			upload.Reason = err.Error()
+			bytesWritten = writeDiagnostics(w, http.StatusUnprocessableEntity, false, upload.Reason, summary.Changes(), nil)
+			return
+		}
+		upload.Changes = summary.Changes()
+
+		// walk the whole report so that the player can fix every problem at once
+		diagnostics := validator.Check(lines)
+		if validator.HasErrors(diagnostics) {
+			log.Printf("%s %s: diagnostics: %d errors\n", r.Method, r.URL.Path, validator.CountErrors(diagnostics))
+			upload.Reason = diagnosticsReason(diagnostics)
+			bytesWritten = writeDiagnostics(w, http.StatusUnprocessableEntity, false, "report has errors", upload.Changes, diagnostics)
+			return
+		}
+		unitId, turnId, _ := validator.Header(lines)
+		if reason := checkReportClan(user, unitId); reason != "" {
+			upload.Reason = reason
+			bytesWritten = writeDiagnostics(w, http.StatusForbidden, false, reason, upload.Changes, nil)
+			return
+		}
+
+		fileName := fmt.Sprintf("%s.%s.report.txt", turnId, unitId)
+		upload.FileName, upload.TurnId = fileName, turnId
+		report := bytes.Join(lines, []byte{'\n'})
+		if len(report) == 0 || report[len(report)-1] != '\n' {
+			report = append(report, '\n')
+		}
+		if _, err := s.stores.ffs.SaveReport(user, fileName, report); err != nil {
+			log.Printf("%s %s: %v\n", r.Method, r.URL.Path, err)
+			upload.Reason = "file could not be saved"
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		log.Printf("%s %s: created  %q\n", r.Method, r.URL.Path, fileName)
+
+		upload.Succeeded = true
+		s.recordDueDate(user, turnId, report)
+		s.queueRender(user, turnId)
 
 		// send a json response
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		_ = json.NewEncoder(w).Encode(struct {
-			Success bool `json:"success"`
-		}{
-			Success: true,
-		})
+		bytesWritten = writeDiagnostics(w, http.StatusOK, true, "", upload.Changes, diagnostics)
 	}
 }
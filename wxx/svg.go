@@ -0,0 +1,128 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+package wxx
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// SVG renders the map as an SVG document.
+// Each hex is filled with a color picked from the name of its terrain.
+func (m *Map_t) SVG() []byte {
+	w, h := m.HexWidth, m.HexHeight
+	var width, height float64
+	if m.Orientation == "ROWS" {
+		width, height = w*float64(m.TilesWide)+w/2, h*(0.75*float64(m.TilesHigh)+0.25)
+	} else {
+		width, height = w*(0.75*float64(m.TilesWide)+0.25), h*float64(m.TilesHigh)+h/2
+	}
+
+	buf := &bytes.Buffer{}
+	_, _ = fmt.Fprintf(buf, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %.1f %.1f" width="%.0f" height="%.0f">`+"\n", width, height, width, height)
+
+	// one class per terrain keeps the document small
+	buf.WriteString("<style>\n")
+	buf.WriteString("polygon { stroke: #9ca3af; stroke-width: 0.5; }\n")
+	_, _ = fmt.Fprintf(buf, "text { font-family: sans-serif; font-size: %.1fpx; fill: #111827; stroke: #ffffff; stroke-width: %.1fpx; paint-order: stroke; text-anchor: middle; dominant-baseline: middle; }\n", h/3, h/16)
+	for n, name := range m.Terrain {
+		_, _ = fmt.Fprintf(buf, ".t%d { fill: %s; }\n", n, TerrainColor(name))
+	}
+	buf.WriteString("</style>\n")
+
+	buf.WriteString(`<g class="tiles">` + "\n")
+	for column, tiles := range m.Tiles {
+		for row, terrain := range tiles {
+			var cx, cy float64
+			var points [6][2]float64
+			if m.Orientation == "ROWS" {
+				cx, cy = w/2+float64(column)*w, h/2+float64(row)*0.75*h
+				if row%2 == 1 {
+					cx += w / 2
+				}
+				points = [6][2]float64{{cx, cy - h/2}, {cx + w/2, cy - h/4}, {cx + w/2, cy + h/4}, {cx, cy + h/2}, {cx - w/2, cy + h/4}, {cx - w/2, cy - h/4}}
+			} else {
+				cx, cy = w/2+float64(column)*0.75*w, h/2+float64(row)*h
+				if column%2 == 1 {
+					cy += h / 2
+				}
+				points = [6][2]float64{{cx - w/2, cy}, {cx - w/4, cy - h/2}, {cx + w/4, cy - h/2}, {cx + w/2, cy}, {cx + w/4, cy + h/2}, {cx - w/4, cy + h/2}}
+			}
+			var sb strings.Builder
+			for i, p := range points {
+				if i != 0 {
+					sb.WriteByte(' ')
+				}
+				_, _ = fmt.Fprintf(&sb, "%.1f,%.1f", p[0], p[1])
+			}
+			name := "Unknown"
+			if terrain < len(m.Terrain) && m.Terrain[terrain] != "" {
+				name = m.Terrain[terrain]
+			}
+			_, _ = fmt.Fprintf(buf, `<polygon class="t%d" points="%s"><title>%02d%02d %s</title></polygon>`+"\n", terrain, sb.String(), column+1, row+1, escape(name))
+		}
+	}
+	buf.WriteString("</g>\n")
+
+	buf.WriteString(`<g class="labels">` + "\n")
+	for _, label := range m.Labels {
+		_, _ = fmt.Fprintf(buf, `<text x="%.1f" y="%.1f">%s</text>`+"\n", label.X, label.Y, escape(label.Text))
+	}
+	buf.WriteString("</g>\n")
+
+	buf.WriteString("</svg>\n")
+	return buf.Bytes()
+}
+
+// terrainColors maps words in a terrain name to a fill color.
+// The first match wins, so the more specific words come first.
+var terrainColors = []struct {
+	word  string
+	color string
+}{
+	{"blank", "#ffffff"},
+	{"shoals", "#93c5fd"},
+	{"lake", "#60a5fa"},
+	{"water", "#3b82f6"},
+	{"ocean", "#2563eb"},
+	{"sea", "#2563eb"},
+	{"swamp", "#6b8e23"},
+	{"marsh", "#6b8e23"},
+	{"snow", "#f1f5f9"},
+	{"ice", "#e0f2fe"},
+	{"tundra", "#cbd5e1"},
+	{"mountain", "#8b7355"},
+	{"volcano", "#7f1d1d"},
+	{"forest", "#228b22"},
+	{"jungle", "#166534"},
+	{"woods", "#2e8b57"},
+	{"hills", "#c2a878"},
+	{"desert", "#f4d58d"},
+	{"sand", "#f4d58d"},
+	{"brush", "#a3b86c"},
+	{"scrub", "#a3b86c"},
+	{"grass", "#b5e08f"},
+	{"prairie", "#b5e08f"},
+	{"plains", "#c9e4a6"},
+	{"moss", "#9acd32"},
+	{"flat", "#d9f0b8"},
+}
+
+// TerrainColor returns the fill color for the terrain name.
+func TerrainColor(name string) string {
+	name = strings.ToLower(name)
+	for _, tc := range terrainColors {
+		if strings.Contains(name, tc.word) {
+			return tc.color
+		}
+	}
+	return "#e5e7eb"
+}
+
+func escape(s string) string {
+	var sb strings.Builder
+	_ = xml.EscapeText(&sb, []byte(s))
+	return sb.String()
+}
@@ -0,0 +1,188 @@
+// Copyright (c) 2024 Michael D Henderson. All rights reserved.
+
+// Package wxx reads Worldographer map files.
+//
+// A .wxx file is gzip'd XML, usually encoded as UTF-16. We only decode the
+// parts of the map that we need to draw a preview: the hex grid, the terrain
+// of each tile, and the labels.
+package wxx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Map_t is the decoded map.
+type Map_t struct {
+	Orientation string  // COLUMNS (flat top hexes) or ROWS (pointy top hexes)
+	HexWidth    float64 // width of a hex, in pixels
+	HexHeight   float64 // height of a hex, in pixels
+	TilesWide   int
+	TilesHigh   int
+	Terrain     []string  // terrain names, indexed by the terrain number in the tiles
+	Tiles       [][]int   // terrain number of each tile, indexed by column then row
+	Labels      []Label_t // labels on the world layer
+}
+
+// Label_t is a text label on the map.
+// X and Y are in map pixels, not the units Worldographer uses for locations.
+type Label_t struct {
+	X, Y float64
+	Text string
+}
+
+// locationSize is the size of a hex in the units that Worldographer uses for
+// the locations of labels and features. It doesn't depend on the hex size.
+const locationSize = 300
+
+// Decode returns the map from the contents of a .wxx file.
+func Decode(data []byte) (*Map_t, error) {
+	// files are usually compressed, but accept plain xml, too
+	if len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b {
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("wxx: %w", err)
+		}
+		if data, err = io.ReadAll(gz); err != nil {
+			return nil, fmt.Errorf("wxx: %w", err)
+		}
+	}
+	data = toUTF8(data)
+
+	var doc xmlMap_t
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	// we have already converted the text to UTF-8, so ignore the declared encoding
+	decoder.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("wxx: %w", err)
+	}
+
+	m := &Map_t{
+		Orientation: strings.ToUpper(doc.HexOrientation),
+		HexWidth:    doc.HexWidth,
+		HexHeight:   doc.HexHeight,
+		TilesWide:   doc.Tiles.TilesWide,
+		TilesHigh:   doc.Tiles.TilesHigh,
+	}
+	if m.Orientation != "ROWS" {
+		m.Orientation = "COLUMNS"
+	}
+	if m.HexWidth <= 0 || m.HexHeight <= 0 {
+		return nil, fmt.Errorf("wxx: invalid hex size %gx%g", m.HexWidth, m.HexHeight)
+	}
+
+	// the terrain map is a tab separated list of name and number pairs
+	fields := strings.Split(strings.TrimSpace(doc.TerrainMap), "\t")
+	for i := 0; i+1 < len(fields); i += 2 {
+		n, err := strconv.Atoi(strings.TrimSpace(fields[i+1]))
+		if err != nil || n < 0 || n > 1024 {
+			continue
+		}
+		for len(m.Terrain) <= n {
+			m.Terrain = append(m.Terrain, "")
+		}
+		m.Terrain[n] = fields[i]
+	}
+
+	// each tile row holds one column of the map, one tile per line.
+	// the first field of each tile is the terrain number.
+	for _, row := range doc.Tiles.Rows {
+		var column []int
+		for _, line := range strings.Split(strings.TrimSpace(row), "\n") {
+			terrain, _, _ := strings.Cut(strings.TrimSpace(line), "\t")
+			n, err := strconv.Atoi(terrain)
+			if err != nil || n < 0 {
+				n = 0
+			}
+			column = append(column, n)
+		}
+		m.Tiles = append(m.Tiles, column)
+	}
+	if m.TilesWide == 0 {
+		m.TilesWide = len(m.Tiles)
+	}
+	if m.TilesHigh == 0 && len(m.Tiles) != 0 {
+		m.TilesHigh = len(m.Tiles[0])
+	}
+
+	for _, label := range doc.Labels {
+		if label.Location.ViewLevel != "" && label.Location.ViewLevel != "WORLD" {
+			continue
+		}
+		text := strings.TrimSpace(label.Text)
+		if text == "" {
+			continue
+		}
+		m.Labels = append(m.Labels, Label_t{
+			X:    label.Location.X * m.HexWidth / locationSize,
+			Y:    label.Location.Y * m.HexHeight / locationSize,
+			Text: text,
+		})
+	}
+
+	return m, nil
+}
+
+// toUTF8 converts UTF-16 input to UTF-8.
+// Input without a byte order mark is treated as UTF-16 if it starts with a NUL.
+func toUTF8(data []byte) []byte {
+	var bigEndian bool
+	switch {
+	case bytes.HasPrefix(data, []byte{0xfe, 0xff}):
+		bigEndian, data = true, data[2:]
+	case bytes.HasPrefix(data, []byte{0xff, 0xfe}):
+		bigEndian, data = false, data[2:]
+	case bytes.HasPrefix(data, []byte{0xef, 0xbb, 0xbf}):
+		return data[3:]
+	case len(data) > 1 && data[0] == 0 && data[1] != 0:
+		bigEndian = true
+	case len(data) > 1 && data[0] != 0 && data[1] == 0:
+		bigEndian = false
+	default:
+		return data
+	}
+	units := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		if bigEndian {
+			units = append(units, uint16(data[i])<<8|uint16(data[i+1]))
+		} else {
+			units = append(units, uint16(data[i+1])<<8|uint16(data[i]))
+		}
+	}
+	return []byte(string(utf16.Decode(units)))
+}
+
+type xmlMap_t struct {
+	XMLName        xml.Name     `xml:"map"`
+	HexWidth       float64      `xml:"hexWidth,attr"`
+	HexHeight      float64      `xml:"hexHeight,attr"`
+	HexOrientation string       `xml:"hexOrientation,attr"`
+	TerrainMap     string       `xml:"terrainmap"`
+	Tiles          xmlTiles_t   `xml:"tiles"`
+	Labels         []xmlLabel_t `xml:"labels>label"`
+}
+
+type xmlTiles_t struct {
+	TilesWide int      `xml:"tilesWide,attr"`
+	TilesHigh int      `xml:"tilesHigh,attr"`
+	Rows      []string `xml:"tilerow"`
+}
+
+type xmlLabel_t struct {
+	Location xmlLocation_t `xml:"location"`
+	Text     string        `xml:",chardata"`
+}
+
+type xmlLocation_t struct {
+	ViewLevel string  `xml:"viewLevel,attr"`
+	X         float64 `xml:"x,attr"`
+	Y         float64 `xml:"y,attr"`
+}